@@ -0,0 +1,36 @@
+package app
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// StartupState tells whether the app has caught up with the events and fast-forwarded the sequences,
+// the http server is started before it in order to answer the probes and, optionally, the queries
+type StartupState struct {
+	started  atomic.Bool
+	progress atomic.Uint64 // float64 bits of the percent of the consumed offsets
+}
+
+func NewStartupState() *StartupState {
+	return &StartupState{}
+}
+
+func (s *StartupState) IsStarted() bool {
+	return s.started.Load()
+}
+
+// Progress returns the percent of the offsets consumed by the common projection, it's 100 after the catching up
+func (s *StartupState) Progress() float64 {
+	return math.Float64frombits(s.progress.Load())
+}
+
+func (s *StartupState) SetProgress(percent float64) {
+	s.progress.Store(math.Float64bits(percent))
+}
+
+// MarkStarted should be invoked after WaitForCatchingUp and RunSequenceFastforwarder
+func MarkStarted(startupState *StartupState) {
+	startupState.SetProgress(100)
+	startupState.started.Store(true)
+}
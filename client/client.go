@@ -68,10 +68,65 @@ func (rc *RestClient) EditChat(ctx context.Context, chatId int64, chatName strin
 	return nil
 }
 
+// EditChatIfMatch edits the chat only if its version is still expectedVersion, returns the new version
+func (rc *RestClient) EditChatIfMatch(ctx context.Context, chatId int64, chatName string, blog bool, expectedVersion int64) (int64, error) {
+	req := handlers.ChatEditDto{
+		Id: chatId,
+		ChatCreateDto: handlers.ChatCreateDto{
+			Title: chatName,
+		},
+		Blog: blog,
+	}
+	headers := map[string]string{
+		handlers.IfMatchHeader: cqrs.FormatETag(expectedVersion),
+	}
+	httpResp, err := queryRawResponse[handlers.ChatEditDto](ctx, rc, 0, "PUT", "/chat", "chat.Edit", &req, nil, headers)
+	if err != nil {
+		return 0, err
+	}
+	defer httpResp.Body.Close()
+
+	version, err := cqrs.ParseIfMatch(httpResp.Header.Get(handlers.ETagHeader))
+	if err != nil {
+		return 0, err
+	}
+	if version == nil {
+		return 0, errors.New("no " + handlers.ETagHeader + " in the response")
+	}
+	return *version, nil
+}
+
 func (rc *RestClient) PinChat(ctx context.Context, behalfUserId int64, chatId int64, pin bool) error {
 	return queryNoResponse[any](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/pin?pin="+utils.ToString(pin), "chat.Pin", nil)
 }
 
+func (rc *RestClient) PinChatIdempotent(ctx context.Context, behalfUserId int64, chatId int64, pin bool, idempotencyKey string) error {
+	headers := map[string]string{
+		handlers.IdempotencyKeyHeader: idempotencyKey,
+	}
+	httpResp, err := queryRawResponse[any](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/pin?pin="+utils.ToString(pin), "chat.Pin", nil, nil, headers)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	return nil
+}
+
+func (rc *RestClient) EditChatRetention(ctx context.Context, behalfUserId int64, chatId int64, retentionSeconds int64) error {
+	req := handlers.ChatRetentionEditDto{
+		RetentionSeconds: retentionSeconds,
+	}
+	return queryNoResponse[handlers.ChatRetentionEditDto](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/retention", "chat.EditRetention", &req)
+}
+
+func (rc *RestClient) EditChatSlowMode(ctx context.Context, behalfUserId int64, chatId int64, slowModeSeconds int64) error {
+	req := handlers.ChatSlowModeEditDto{
+		SlowModeSeconds: slowModeSeconds,
+	}
+	return queryNoResponse[handlers.ChatSlowModeEditDto](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/slow-mode", "chat.EditSlowMode", &req)
+}
+
 func (rc *RestClient) DeleteChat(ctx context.Context, chatId int64) error {
 	return queryNoResponse[any](ctx, rc, 0, "DELETE", "/chat/"+utils.ToString(chatId), "chat.Delete", nil)
 }
@@ -95,6 +150,20 @@ func (rc *RestClient) CreateMessage(ctx context.Context, behalfUserId int64, cha
 	return resp.Id, nil
 }
 
+func (rc *RestClient) CreateMessageIdempotent(ctx context.Context, behalfUserId int64, chatId int64, text, idempotencyKey string) (int64, error) {
+	req := handlers.MessageCreateDto{
+		Content: text,
+	}
+	headers := map[string]string{
+		handlers.IdempotencyKeyHeader: idempotencyKey,
+	}
+	resp, err := queryWithHeaders[handlers.MessageCreateDto, handlers.IdResponse](ctx, rc, behalfUserId, "POST", "/chat/"+utils.ToString(chatId)+"/message", "message.Create", &req, nil, headers)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Id, nil
+}
+
 func (rc *RestClient) EditMessage(ctx context.Context, behalfUserId int64, chatId, messageId int64, text string) error {
 	req := handlers.MessageEditDto{
 		Id: messageId,
@@ -105,6 +174,33 @@ func (rc *RestClient) EditMessage(ctx context.Context, behalfUserId int64, chatI
 	return queryNoResponse[handlers.MessageEditDto](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/message", "message.Edit", &req)
 }
 
+// EditMessageIfMatch edits the message only if its version is still expectedVersion, returns the new version
+func (rc *RestClient) EditMessageIfMatch(ctx context.Context, behalfUserId int64, chatId, messageId int64, text string, expectedVersion int64) (int64, error) {
+	req := handlers.MessageEditDto{
+		Id: messageId,
+		MessageCreateDto: handlers.MessageCreateDto{
+			Content: text,
+		},
+	}
+	headers := map[string]string{
+		handlers.IfMatchHeader: cqrs.FormatETag(expectedVersion),
+	}
+	httpResp, err := queryRawResponse[handlers.MessageEditDto](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/message", "message.Edit", &req, nil, headers)
+	if err != nil {
+		return 0, err
+	}
+	defer httpResp.Body.Close()
+
+	version, err := cqrs.ParseIfMatch(httpResp.Header.Get(handlers.ETagHeader))
+	if err != nil {
+		return 0, err
+	}
+	if version == nil {
+		return 0, errors.New("no " + handlers.ETagHeader + " in the response")
+	}
+	return *version, nil
+}
+
 func (rc *RestClient) DeleteMessage(ctx context.Context, behalfUserId int64, chatId, messageId int64) error {
 	return queryNoResponse[any](ctx, rc, behalfUserId, "DELETE", "/chat/"+utils.ToString(chatId)+"/message/"+utils.ToString(messageId), "message.Delete", nil)
 }
@@ -143,12 +239,82 @@ func (rc *RestClient) ReadMessage(ctx context.Context, behalfUserId int64, chatI
 	return queryNoResponse[any](ctx, rc, behalfUserId, "PUT", "/chat/"+utils.ToString(chatId)+"/message/"+utils.ToString(messageId)+"/read", "message.Read", nil)
 }
 
+func (rc *RestClient) CreateWebhookSubscription(ctx context.Context, url, secret string, eventTypes []string, chatId *int64) (int64, error) {
+	req := handlers.WebhookSubscriptionCreateDto{
+		Url:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		ChatId:     chatId,
+	}
+	resp, err := query[handlers.WebhookSubscriptionCreateDto, handlers.IdResponse](ctx, rc, 0, "POST", "/webhook/subscription", "webhook.CreateSubscription", &req, nil)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Id, nil
+}
+
+func (rc *RestClient) GetWebhookSubscriptions(ctx context.Context) ([]cqrs.WebhookSubscription, error) {
+	return query[any, []cqrs.WebhookSubscription](ctx, rc, 0, "GET", "/webhook/subscription/search", "webhook.SearchSubscriptions", nil, nil)
+}
+
+func (rc *RestClient) GetWebhookDeliveries(ctx context.Context, subscriptionId int64) ([]cqrs.WebhookDelivery, error) {
+	return query[any, []cqrs.WebhookDelivery](ctx, rc, 0, "GET", "/webhook/subscription/"+utils.ToString(subscriptionId)+"/delivery/search", "webhook.SearchDeliveries", nil, nil)
+}
+
+func (rc *RestClient) RedeliverWebhook(ctx context.Context, deliveryId int64) error {
+	return queryNoResponse[any](ctx, rc, 0, "PUT", "/webhook/delivery/"+utils.ToString(deliveryId)+"/redeliver", "webhook.Redeliver", nil)
+}
+
+func (rc *RestClient) SearchAuditLog(ctx context.Context, queryParams *url.Values) ([]cqrs.AuditLogEntry, error) {
+	return query[any, []cqrs.AuditLogEntry](ctx, rc, 0, "GET", "/admin/audit-log/search", "admin.SearchAuditLog", nil, queryParams)
+}
+
+func (rc *RestClient) GetProjectionsStatus(ctx context.Context) (handlers.ProjectionsStatusDto, error) {
+	return query[any, handlers.ProjectionsStatusDto](ctx, rc, 0, "GET", "/admin/projections", "admin.GetProjectionsStatus", nil, nil)
+}
+
+func (rc *RestClient) RefreshChat(ctx context.Context, chatId int64) error {
+	return queryNoResponse[any](ctx, rc, 0, "PUT", "/admin/chat/"+utils.ToString(chatId)+"/refresh", "admin.RefreshChat", nil)
+}
+
+func (rc *RestClient) RefreshChatParticipant(ctx context.Context, chatId, userId int64) error {
+	return queryNoResponse[any](ctx, rc, 0, "PUT", "/admin/chat/"+utils.ToString(chatId)+"/user/"+utils.ToString(userId)+"/refresh", "admin.RefreshChatParticipant", nil)
+}
+
+func (rc *RestClient) RefreshUserChats(ctx context.Context, userId int64) error {
+	return queryNoResponse[any](ctx, rc, 0, "PUT", "/admin/user/"+utils.ToString(userId)+"/refresh", "admin.RefreshUserChats", nil)
+}
+
+// GetMetrics returns the metrics in Prometheus text format
+func (rc *RestClient) GetMetrics(ctx context.Context) (string, error) {
+	httpResp, err := queryRawResponse[any](ctx, rc, 0, "GET", handlers.MetricsPath, "metrics", nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
 func (rc *RestClient) HealthCheck(ctx context.Context) error {
 	return queryNoResponse[any](ctx, rc, 0, "GET", "/internal/health", "internal.HealthCheck", nil)
 }
 
+func (rc *RestClient) Liveness(ctx context.Context) (*handlers.HealthReportDto, error) {
+	return query[any, *handlers.HealthReportDto](ctx, rc, 0, "GET", "/internal/health/liveness", "internal.Liveness", nil, nil)
+}
+
+// Readiness returns an error while any of the checks is DOWN, because the server responds 503
+func (rc *RestClient) Readiness(ctx context.Context) (*handlers.HealthReportDto, error) {
+	return query[any, *handlers.HealthReportDto](ctx, rc, 0, "GET", "/internal/health/readiness", "internal.Readiness", nil, nil)
+}
+
 // You should call 	defer httpResp.Body.Close()
-func queryRawResponse[ReqDto any](ctx context.Context, rc *RestClient, behalfUserId int64, method, url, opName string, req *ReqDto, queryParams *url.Values) (*http.Response, error) {
+func queryRawResponse[ReqDto any](ctx context.Context, rc *RestClient, behalfUserId int64, method, url, opName string, req *ReqDto, queryParams *url.Values, headers map[string]string) (*http.Response, error) {
 	contentType := "application/json;charset=UTF-8"
 	fullUrl := utils.StringToUrl("http://localhost" + rc.cfg.HttpServerConfig.Address + url)
 	if queryParams != nil {
@@ -161,6 +327,9 @@ func queryRawResponse[ReqDto any](ctx context.Context, rc *RestClient, behalfUse
 		"Content-Type":    {contentType},
 		"X-UserId":        {utils.ToString(behalfUserId)},
 	}
+	for hk, hv := range headers {
+		requestHeaders[hk] = []string{hv}
+	}
 
 	httpReq := &http.Request{
 		Method: method,
@@ -225,9 +394,13 @@ func queryRawResponse[ReqDto any](ctx context.Context, rc *RestClient, behalfUse
 }
 
 func query[ReqDto any, ResDto any](ctx context.Context, rc *RestClient, behalfUserId int64, method, url, opName string, req *ReqDto, queryParams *url.Values) (ResDto, error) {
+	return queryWithHeaders[ReqDto, ResDto](ctx, rc, behalfUserId, method, url, opName, req, queryParams, nil)
+}
+
+func queryWithHeaders[ReqDto any, ResDto any](ctx context.Context, rc *RestClient, behalfUserId int64, method, url, opName string, req *ReqDto, queryParams *url.Values, headers map[string]string) (ResDto, error) {
 	var resp ResDto
 	var err error
-	httpResp, err := queryRawResponse(ctx, rc, behalfUserId, method, url, opName, req, queryParams)
+	httpResp, err := queryRawResponse(ctx, rc, behalfUserId, method, url, opName, req, queryParams, headers)
 	if err != nil {
 		return resp, err
 	}
@@ -248,7 +421,7 @@ func query[ReqDto any, ResDto any](ctx context.Context, rc *RestClient, behalfUs
 
 func queryNoResponse[ReqDto any](ctx context.Context, rc *RestClient, behalfUserId int64, method, url, opName string, req *ReqDto) error {
 	var err error
-	httpResp, err := queryRawResponse(ctx, rc, behalfUserId, method, url, opName, req, nil)
+	httpResp, err := queryRawResponse(ctx, rc, behalfUserId, method, url, opName, req, nil, nil)
 	if err != nil {
 		return err
 	}
@@ -9,21 +9,34 @@ import (
 	"go-cqrs-chat-example/config"
 	"go-cqrs-chat-example/kafka"
 	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"os"
+	"time"
 )
 
 // exportCmd represents the export command
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Export events",
-	Long:  `Export events from configured topic to stdout.`,
+	Long:  `Export events from configured topic to stdout or to the configured file. The events can be filtered by chat id, event type, createdAt time range and offset range, and compressed with gzip or zstd. A manifest with the offset ranges and the checksums of the partitions is written next to the file, --validate checks the file against it. With --incremental the events after the previous incremental export are written into the new segment files of the configured directory, with --daemon it's repeated every configured interval.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		RunExport()
+		RunExport(exportChatIds, exportEventTypes, exportFrom, exportTo, exportFromOffsets, exportToOffsets, exportCompression, exportValidate, exportIncremental, exportDaemon)
 	},
 }
 
+var exportChatIds []int64
+var exportEventTypes []string
+var exportFrom string
+var exportTo string
+var exportFromOffsets []string
+var exportToOffsets []string
+var exportCompression string
+var exportValidate bool
+var exportIncremental bool
+var exportDaemon bool
+
 func init() {
 	rootCmd.AddCommand(exportCmd)
 
@@ -36,9 +49,19 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// exportCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	exportCmd.Flags().Int64SliceVar(&exportChatIds, "chat-id", nil, "the chats to export the events of")
+	exportCmd.Flags().StringSliceVar(&exportEventTypes, "event-type", nil, "the event types to export, e.g. messageCreated")
+	exportCmd.Flags().StringVar(&exportFrom, "from", "", "RFC 3339 time, the events created before it aren't exported")
+	exportCmd.Flags().StringVar(&exportTo, "to", "", "RFC 3339 time, the events created at it or after it aren't exported")
+	exportCmd.Flags().StringSliceVar(&exportFromOffsets, "from-offset", nil, "partition=offset, the first event to read in the partition")
+	exportCmd.Flags().StringSliceVar(&exportToOffsets, "to-offset", nil, "partition=offset, the last event to read in the partition")
+	exportCmd.Flags().StringVar(&exportCompression, "compression", kafka.CompressionNone, "none, gzip or zstd")
+	exportCmd.Flags().BoolVar(&exportValidate, "validate", false, "validate the configured file against its manifest instead of exporting")
+	exportCmd.Flags().BoolVar(&exportIncremental, "incremental", false, "continue from the state of the previous incremental export and write the new segments")
+	exportCmd.Flags().BoolVar(&exportDaemon, "daemon", false, "keep running and export incrementally every configured interval")
 }
 
-func RunExport() {
+func RunExport(chatIds []int64, eventTypes []string, from, to string, fromOffsets, toOffsets []string, compression string, validate, incremental, daemon bool) {
 	cfg, err := config.CreateTypedConfig()
 	if err != nil {
 		panic(err)
@@ -48,9 +71,70 @@ func RunExport() {
 
 	lgr.Info("Start export command")
 
+	if validate {
+		err = kafka.RunValidateExport(lgr, cfg)
+		if err != nil {
+			lgr.Error("The export is invalid", "err", err)
+			os.Exit(1)
+		}
+		lgr.Info("Exit export command")
+		return
+	}
+
+	options, err := parseExportOptions(chatIds, eventTypes, from, to, fromOffsets, toOffsets, compression)
+	if err != nil {
+		panic(err)
+	}
+
+	if incremental || daemon {
+		runIncrementalExport(lgr, cfg, options, daemon)
+	} else {
+		runExport(lgr, cfg, options)
+	}
+	lgr.Info("Exit export command")
+}
+
+func parseExportOptions(chatIds []int64, eventTypes []string, from, to string, fromOffsets, toOffsets []string, compression string) (*kafka.ExportOptions, error) {
+	options := &kafka.ExportOptions{
+		EventTypes:  eventTypes,
+		Compression: compression,
+	}
+	for _, chatId := range chatIds {
+		options.ChatIds = append(options.ChatIds, utils.ToString(chatId))
+	}
+	var err error
+	options.FromOffsets, err = kafka.ParsePartitionOffsets(fromOffsets)
+	if err != nil {
+		return nil, err
+	}
+	options.ToOffsets, err = kafka.ParsePartitionOffsets(toOffsets)
+	if err != nil {
+		return nil, err
+	}
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, err
+		}
+		t = t.UTC()
+		options.From = &t
+	}
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, err
+		}
+		t = t.UTC()
+		options.To = &t
+	}
+	return options, nil
+}
+
+func runExport(lgr *logger.LoggerWrapper, cfg *config.AppConfig, options *kafka.ExportOptions) {
 	appFx := fx.New(
 		fx.Supply(cfg),
 		fx.Supply(lgr),
+		fx.Supply(options),
 		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
 			return &fxevent.SlogLogger{Logger: lgr.Logger}
 		}),
@@ -63,5 +147,25 @@ func RunExport() {
 		),
 	)
 	appFx.Run()
-	lgr.Info("Exit export command")
+}
+
+func runIncrementalExport(lgr *logger.LoggerWrapper, cfg *config.AppConfig, options *kafka.ExportOptions, daemon bool) {
+	invokes := []any{kafka.RunIncrementalExport, app.Shutdown}
+	if daemon {
+		// runs until it's interrupted
+		invokes = []any{kafka.RunIncrementalExportDaemon}
+	}
+	appFx := fx.New(
+		fx.Supply(cfg),
+		fx.Supply(lgr),
+		fx.Supply(options),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			kafka.ConfigureSaramaClient,
+		),
+		fx.Invoke(invokes...),
+	)
+	appFx.Run()
 }
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-cqrs-chat-example/client"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"go.uber.org/fx"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportFilter(t *testing.T) {
+	cfg, err := config.CreateTestTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	const user1 int64 = 1
+
+	var chat1Id int64
+
+	resetInfra(lgr, cfg)
+
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		var err error
+		chat1Id, err = restClient.CreateChat(ctx, user1, "new chat 1")
+		require.NoError(t, err, "error in creating chat")
+		chat2Id, err := restClient.CreateChat(ctx, user1, "new chat 2")
+		require.NoError(t, err, "error in creating chat")
+		for _, chatId := range []int64{chat1Id, chat1Id, chat2Id} {
+			_, err = restClient.CreateMessage(ctx, user1, chatId, "new message")
+			require.NoError(t, err, "error in creating message")
+		}
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+	})
+
+	exportCfg := *cfg
+	exportCfg.CqrsConfig.ExportConfig.File = "./event-filtered.json.gz"
+	defer os.Remove(exportCfg.CqrsConfig.ExportConfig.File)
+	defer os.Remove(kafka.ExportManifestFile(exportCfg.CqrsConfig.ExportConfig.File))
+
+	runExport(lgr, &exportCfg, &kafka.ExportOptions{
+		ChatIds:     []string{utils.ToString(chat1Id)},
+		EventTypes:  []string{(&cqrs.MessageCreated{}).Name()},
+		Compression: kafka.CompressionGzip,
+	})
+
+	require.NoError(t, kafka.RunValidateExport(lgr, &exportCfg))
+
+	f, err := os.Open(exportCfg.CqrsConfig.ExportConfig.File)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	scanner := bufio.NewScanner(gz)
+	var lines int
+	for scanner.Scan() {
+		lines++
+		line := map[string]any{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		assert.Equal(t, utils.ToString(chat1Id), line[kafka.KeyKey])
+		assert.Equal(t, (&cqrs.MessageCreated{}).Name(), line[kafka.HeadersKey].(map[string]any)[kafka.EventNameHeader])
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, 2, lines)
+
+	// the corrupted export is rejected
+	manifestFile := kafka.ExportManifestFile(exportCfg.CqrsConfig.ExportConfig.File)
+	manifestBytes, err := os.ReadFile(manifestFile)
+	require.NoError(t, err)
+	manifest := kafka.ExportManifest{}
+	require.NoError(t, json.Unmarshal(manifestBytes, &manifest))
+	manifest.Partitions[0].Events++
+	manifestBytes, err = json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(manifestFile, manifestBytes, 0644))
+	assert.Error(t, kafka.RunValidateExport(lgr, &exportCfg))
+}
+
+func TestIncrementalExport(t *testing.T) {
+	cfg, err := config.CreateTestTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	const user1 int64 = 1
+
+	directory := cfg.CqrsConfig.ExportConfig.Incremental.Directory
+	require.NoError(t, os.RemoveAll(directory))
+	defer os.RemoveAll(directory)
+
+	resetInfra(lgr, cfg)
+
+	var chat1Id int64
+	var events int64
+	createMessages := func(count int) {
+		runTestFunc(lgr, cfg, t, func(
+			lgr *logger.LoggerWrapper,
+			cfg *config.AppConfig,
+			restClient *client.RestClient,
+			saramaClient sarama.Client,
+			lc fx.Lifecycle,
+		) {
+			ctx := context.Background()
+
+			var err error
+			if chat1Id == 0 {
+				chat1Id, err = restClient.CreateChat(ctx, user1, "new chat 1")
+				require.NoError(t, err, "error in creating chat")
+			}
+			for range count {
+				_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message")
+				require.NoError(t, err, "error in creating message")
+			}
+			require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+			events = 0
+			for i := range cfg.KafkaConfig.NumPartitions {
+				offset, err := saramaClient.GetOffset(cfg.KafkaConfig.Topic, i, sarama.OffsetNewest)
+				require.NoError(t, err)
+				events += offset
+			}
+		})
+	}
+
+	// every event is exported once across the segments of all the runs
+	assertExported := func() []string {
+		segments, err := filepath.Glob(filepath.Join(directory, "event-*.json.gz"))
+		require.NoError(t, err)
+		exported := map[string]bool{}
+		for _, segment := range segments {
+			require.NoError(t, kafka.ValidateExport(lgr, segment))
+
+			f, err := os.Open(segment)
+			require.NoError(t, err)
+			gz, err := gzip.NewReader(f)
+			require.NoError(t, err)
+			scanner := bufio.NewScanner(gz)
+			for scanner.Scan() {
+				line := map[string]any{}
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+				metadata := line[kafka.MetadataKey].(map[string]any)
+				key := utils.ToString(metadata[kafka.MetadataPartitionKey]) + "/" + utils.ToString(metadata[kafka.MetadataOffsetKey])
+				assert.False(t, exported[key], "exported twice %v", key)
+				exported[key] = true
+			}
+			require.NoError(t, scanner.Err())
+			f.Close()
+		}
+		assert.Equal(t, int(events), len(exported))
+		return segments
+	}
+
+	options := &kafka.ExportOptions{Compression: kafka.CompressionGzip}
+
+	createMessages(3)
+	runIncrementalExport(lgr, cfg, options, false)
+	firstSegments := assertExported()
+	// rotated by cqrs.export.incremental.maxSegmentEvents
+	assert.True(t, len(firstSegments) > 1)
+
+	createMessages(2)
+	runIncrementalExport(lgr, cfg, options, false)
+	secondSegments := assertExported()
+	assert.True(t, len(secondSegments) > len(firstSegments))
+
+	// nothing new
+	runIncrementalExport(lgr, cfg, options, false)
+	assert.Equal(t, secondSegments, assertExported())
+}
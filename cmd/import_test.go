@@ -81,6 +81,7 @@ func TestImport(t *testing.T) {
 	appExportFx := fx.New(
 		fx.Supply(cfg),
 		fx.Supply(lgr),
+		fx.Supply(&kafka.ExportOptions{}),
 		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
 			return &fxevent.SlogLogger{Logger: lgr.Logger}
 		}),
@@ -0,0 +1,103 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/otel"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// rebuildCmd represents the rebuild command
+var rebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Rebuild the projections without downtime",
+	Long:  `Replays the topic into the tables of a fresh schema under a new consumer group while serve keeps answering from the current tables, then switches serve to the rebuilt tables in one transaction and drops the old ones. All the projections are rebuilt one by one unless --projection is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunRebuild(rebuildProjections)
+	},
+}
+
+var rebuildProjections []string
+
+func init() {
+	rootCmd.AddCommand(rebuildCmd)
+
+	rebuildCmd.Flags().StringSliceVar(&rebuildProjections, "projection", nil, "the projections to rebuild, any of chat, chatView, unreadMessages, blog")
+}
+
+func RunRebuild(projections []string) {
+	cfg, err := config.CreateTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	lgr.Info("Start rebuild command")
+
+	if len(projections) == 0 {
+		projections = config.AllProjections
+	}
+	// the chat projection goes first, the rest ones read its tables
+	for _, projection := range projections {
+		runRebuild(lgr, cfg, projection)
+	}
+
+	lgr.Info("Exit rebuild command")
+}
+
+func runRebuild(lgr *logger.LoggerWrapper, cfg *config.AppConfig, projection string) {
+	rebuild, err := cqrs.NewProjectionRebuild(cfg, projection)
+	if err != nil {
+		panic(err)
+	}
+	shadowCfg, err := rebuild.ShadowConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	appFx := fx.New(
+		fx.Supply(shadowCfg),
+		fx.Supply(lgr),
+		fx.Supply(rebuild),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			otel.ConfigureTracePropagator,
+			otel.ConfigureTraceProvider,
+			otel.ConfigureTraceExporter,
+			db.ConfigureDatabase,
+			kafka.ConfigureKafkaAdmin,
+			kafka.ConfigureSaramaClient,
+			cqrs.ConfigureKafkaMarshaller,
+			cqrs.ConfigureWatermillLogger,
+			cqrs.ConfigureSequenceChecker,
+			cqrs.ConfigureProjectionProgressRecorder,
+			cqrs.ConfigureProjectionSwitch,
+			cqrs.ConfigureReplayStop,
+			cqrs.ConfigureCqrsRouter,
+			cqrs.ConfigureCqrsMarshaller,
+			cqrs.ConfigureEventProcessor,
+			cqrs.ConfigureCommonProjection,
+		),
+		fx.Invoke(
+			cqrs.RunCreateShadowProjection,
+			cqrs.RunCqrsRouter,
+			cqrs.RunProjectionRebuild,
+			app.Shutdown,
+		),
+	)
+	appFx.Run()
+}
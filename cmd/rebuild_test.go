@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-cqrs-chat-example/client"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		dba *db.DB,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const chat1Name = "new chat 1"
+		const message1Text = "new message 1"
+		const message2Text = "new message 2"
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		message1Id, err := restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		for _, projection := range config.AllProjections {
+			runRebuild(lgr, cfg, projection)
+
+			consumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+			require.NoError(t, err)
+			var paused bool
+			var generation int64
+			require.NoError(t, dba.QueryRowContext(ctx, "select paused, generation from projection_switch where projection = $1", consumerGroup).Scan(&paused, &generation))
+			assert.False(t, paused, "projection %v", projection)
+			assert.Equal(t, int64(1), generation, "projection %v", projection)
+		}
+
+		var leftSchemas int64
+		require.NoError(t, dba.QueryRowContext(ctx, "select count(*) from information_schema.schemata where schema_name like 'rebuild_%' or schema_name like 'retired_%'").Scan(&leftSchemas))
+		assert.Equal(t, int64(0), leftSchemas)
+
+		// the data is served from the rebuilt tables
+		user1Chats, err := restClient.GetChatsByUserId(ctx, user1, nil)
+		require.NoError(t, err, "error in getting chats")
+		assert.Equal(t, 1, len(user1Chats))
+		assert.Equal(t, chat1Name, user1Chats[0].Title)
+
+		// the message ids continue and the live projection applies the new events
+		message2Id, err := restClient.CreateMessage(ctx, user1, chat1Id, message2Text)
+		require.NoError(t, err, "error in creating message")
+		assert.True(t, message2Id > message1Id)
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 2, len(chat1Messages))
+		assert.Equal(t, message1Text, chat1Messages[0].Content)
+		assert.Equal(t, message2Text, chat1Messages[1].Content)
+	})
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-cqrs-chat-example/client"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		dba *db.DB,
+		commonProjection *cqrs.CommonProjection,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		const user1 int64 = 1
+		const user2 int64 = 2
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, "new chat 1")
+		require.NoError(t, err, "error in creating chat")
+		chat2Id, err := restClient.CreateChat(ctx, user1, "new chat 2")
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat1Id, []int64{user2}), "error in adding participants")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat2Id, []int64{user2}), "error in adding participants")
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+		_, err = restClient.CreateMessage(ctx, user1, chat2Id, "new message 2")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		corrupt := func() {
+			_, err := dba.ExecContext(ctx, "update unread_messages_user_view set unread_messages = 42 where user_id = $1", user2)
+			require.NoError(t, err)
+		}
+		assertNoDifferences := func(chatIds ...int64) {
+			for _, chatId := range chatIds {
+				differences, err := cqrs.VerifyChat(ctx, dba, commonProjection, chatId)
+				require.NoError(t, err)
+				assert.Empty(t, differences)
+			}
+		}
+		assertUnreadCorrupted := func(chatId int64) {
+			differences, err := cqrs.VerifyChat(ctx, dba, commonProjection, chatId)
+			require.NoError(t, err)
+			assert.Equal(t, []cqrs.Difference{
+				{ChatId: chatId, UserId: user2, Field: cqrs.DifferenceUnreadMessages, Expected: int64(1), Actual: int64(42)},
+			}, differences)
+		}
+
+		corrupt()
+		require.NoError(t, restClient.RefreshChatParticipant(ctx, chat1Id, user2))
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+		assertNoDifferences(chat1Id)
+		assertUnreadCorrupted(chat2Id)
+
+		require.NoError(t, restClient.RefreshChat(ctx, chat2Id))
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+		assertNoDifferences(chat1Id, chat2Id)
+
+		corrupt()
+		require.NoError(t, restClient.RefreshUserChats(ctx, user2))
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+		assertNoDifferences(chat1Id, chat2Id)
+
+		const user3 int64 = 3
+		assert.Error(t, restClient.RefreshChatParticipant(ctx, chat1Id, user3))
+		assert.Error(t, restClient.RefreshChat(ctx, chat2Id+1000))
+
+		// the refresh doesn't create the absent view, it asks for the reset of the projection
+		_, err = dba.ExecContext(ctx, "delete from chat_user_view where user_id = $1 and id = $2", user2, chat1Id)
+		require.NoError(t, err)
+		err = restClient.RefreshChatParticipant(ctx, chat1Id, user2)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "409")
+	})
+}
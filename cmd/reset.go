@@ -14,6 +14,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -22,12 +23,17 @@ import (
 var resetCmd = &cobra.Command{
 	Use:   "reset",
 	Short: "Reset offsets and storage",
-	Long:  `Reset offsets in Kafka for configured topic and consumer group, drops all the tables, sequences from PostgreSQL and creates empty ones with help of migration.`,
+	Long:  `Reset offsets in Kafka for configured topic and consumer group, drops all the tables, sequences from PostgreSQL and creates empty ones with help of migration. With --projection only the tables and the consumer groups of the given projections are reset. With --stop-at-offset or --stop-at-time serve replays the events only up to the given point and becomes read-only, --clear-stop returns it to the normal mode without resetting anything.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		RunReset()
+		RunReset(resetProjections, resetStopAtOffsets, resetStopAtTime, resetClearStop)
 	},
 }
 
+var resetProjections []string
+var resetStopAtOffsets []string
+var resetStopAtTime string
+var resetClearStop bool
+
 func init() {
 	rootCmd.AddCommand(resetCmd)
 
@@ -40,9 +46,13 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// resetCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	resetCmd.Flags().StringSliceVar(&resetProjections, "projection", nil, "the projections to reset, any of chat, chatView, unreadMessages, blog")
+	resetCmd.Flags().StringSliceVar(&resetStopAtOffsets, "stop-at-offset", nil, "partition=offset, the last event to apply in the partition")
+	resetCmd.Flags().StringVar(&resetStopAtTime, "stop-at-time", "", "RFC 3339 time, the events created after it aren't applied")
+	resetCmd.Flags().BoolVar(&resetClearStop, "clear-stop", false, "remove the replay stop, so serve continues the projections from it")
 }
 
-func RunReset() {
+func RunReset(projections []string, stopAtOffsets []string, stopAtTime string, clearStop bool) {
 	cfg, err := config.CreateTypedConfig()
 	if err != nil {
 		panic(err)
@@ -52,9 +62,56 @@ func RunReset() {
 
 	lgr.Info("Start reset command")
 
+	replayStop, err := parseReplayStop(stopAtOffsets, stopAtTime)
+	if err != nil {
+		panic(err)
+	}
+
+	if clearStop {
+		if len(projections) > 0 || replayStop.IsSet() {
+			panic("the replay stop is cleared without resetting anything")
+		}
+		runClearReplayStop(lgr, cfg)
+		lgr.Info("Exit reset command")
+		return
+	}
+
+	if len(projections) > 0 {
+		if replayStop.IsSet() {
+			// the rest of the projections are ahead of the point
+			panic("the replay stop can be set only for the whole reset")
+		}
+		runResetProjections(lgr, cfg, projections)
+		lgr.Info("Exit reset command")
+		return
+	}
+
+	runReset(lgr, cfg, replayStop)
+	lgr.Info("Exit reset command")
+}
+
+func parseReplayStop(stopAtOffsets []string, stopAtTime string) (*cqrs.ReplayStop, error) {
+	offsets, err := cqrs.ParseReplayStopOffsets(stopAtOffsets)
+	if err != nil {
+		return nil, err
+	}
+	replayStop := &cqrs.ReplayStop{Offsets: offsets}
+	if stopAtTime != "" {
+		t, err := time.Parse(time.RFC3339, stopAtTime)
+		if err != nil {
+			return nil, err
+		}
+		t = t.UTC()
+		replayStop.CreatedAt = &t
+	}
+	return replayStop, nil
+}
+
+func runReset(lgr *logger.LoggerWrapper, cfg *config.AppConfig, replayStop *cqrs.ReplayStop) {
 	appFx := fx.New(
 		fx.Supply(cfg),
 		fx.Supply(lgr),
+		fx.Supply(replayStop),
 		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
 			return &fxevent.SlogLogger{Logger: lgr.Logger}
 		}),
@@ -71,10 +128,57 @@ func RunReset() {
 			kafka.RunResetPartitions,
 			db.RunMigrations,
 			kafka.RunCreateTopic,
+			cqrs.RunSetReplayStop,
 			cqrs.SetIsNeedToFastForwardSequences,
 			app.Shutdown,
 		),
 	)
 	appFx.Run()
-	lgr.Info("Exit reset command")
+}
+
+func runResetProjections(lgr *logger.LoggerWrapper, cfg *config.AppConfig, projections []string) {
+	appFx := fx.New(
+		fx.Supply(cfg),
+		fx.Supply(lgr),
+		fx.Supply(&cqrs.ProjectionReset{Projections: projections}),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			otel.ConfigureTracePropagator,
+			otel.ConfigureTraceProvider,
+			otel.ConfigureTraceExporter,
+			db.ConfigureDatabase,
+			kafka.ConfigureKafkaAdmin,
+			cqrs.ConfigureCommonProjection,
+		),
+		fx.Invoke(
+			cqrs.RunResetProjections,
+			app.Shutdown,
+		),
+	)
+	appFx.Run()
+}
+
+func runClearReplayStop(lgr *logger.LoggerWrapper, cfg *config.AppConfig) {
+	appFx := fx.New(
+		fx.Supply(cfg),
+		fx.Supply(lgr),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			otel.ConfigureTracePropagator,
+			otel.ConfigureTraceProvider,
+			otel.ConfigureTraceExporter,
+			db.ConfigureDatabase,
+			cqrs.ConfigureCommonProjection,
+		),
+		fx.Invoke(
+			db.RunMigrations,
+			cqrs.RunClearReplayStop,
+			app.Shutdown,
+		),
+	)
+	appFx.Run()
 }
@@ -17,6 +17,7 @@ import (
 	"go.uber.org/fx/fxevent"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestReset(t *testing.T) {
@@ -33,6 +34,7 @@ func TestReset(t *testing.T) {
 
 	var message1Id int64
 	var chat1Id int64
+	var subscription1Id int64
 
 	resetInfra(lgr, cfg)
 
@@ -75,6 +77,9 @@ func TestReset(t *testing.T) {
 		message1 := chat1Messages[0]
 		assert.Equal(t, message1Id, message1.Id)
 		assert.Equal(t, message1Text, message1.Content)
+
+		subscription1Id, err = restClient.CreateWebhookSubscription(ctx, "http://localhost:9000/hook", "s3cr3t", nil, nil)
+		require.NoError(t, err, "error in creating webhook subscription")
 	})
 
 	lgr.Info("Start reset command")
@@ -134,5 +139,240 @@ func TestReset(t *testing.T) {
 		message1 := chat1Messages[0]
 		assert.Equal(t, message1Id, message1.Id)
 		assert.Equal(t, message1Text, message1.Content)
+
+		// the subscriptions can't be rebuilt from the topic, so they are kept
+		subscriptions, err := restClient.GetWebhookSubscriptions(ctx)
+		require.NoError(t, err, "error in getting webhook subscriptions")
+		require.Equal(t, 1, len(subscriptions))
+		assert.Equal(t, subscription1Id, subscriptions[0].Id)
+	})
+}
+
+func TestResetProjections(t *testing.T) {
+	cfg, err := config.CreateTestTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	const user1 int64 = 1
+	const user2 int64 = 2
+	const chat1Name = "new chat 1"
+	const message1Text = "new message 1"
+
+	var chat1Id int64
+
+	resetInfra(lgr, cfg)
+
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		var err error
+		chat1Id, err = restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat1Id, []int64{user2}), "error in adding participants")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+	})
+
+	runResetProjections(lgr, cfg, []string{config.ChatViewProjection, config.UnreadMessagesProjection})
+
+	// the chat view and the unread messages are replayed, the chat projection is left as it is
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user2Chats, err := restClient.GetChatsByUserId(ctx, user2, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user2Chats))
+		assert.Equal(t, chat1Name, user2Chats[0].Title)
+		assert.Equal(t, int64(1), user2Chats[0].UnreadMessages)
+		assert.Equal(t, message1Text, *user2Chats[0].LastMessageContent)
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		assert.Equal(t, 1, len(chat1Messages))
+	})
+}
+
+func TestResetReplayStop(t *testing.T) {
+	cfg, err := config.CreateTestTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	const user1 int64 = 1
+	const user2 int64 = 2
+	const chat1Name = "new chat 1"
+	const message1Text = "new message 1"
+	const message2Text = "new message 2"
+
+	var chat1Id int64
+	var stopAt time.Time
+
+	resetInfra(lgr, cfg)
+
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		var err error
+		chat1Id, err = restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat1Id, []int64{user2}), "error in adding participants")
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		stopAt = time.Now().UTC()
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, message2Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+	})
+
+	runReset(lgr, cfg, &cqrs.ReplayStop{CreatedAt: &stopAt})
+
+	// the state before the second message, the commands are rejected
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		startupState *app.StartupState,
+		isPartitionStopped kafka.IsPartitionStopped,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		require.NoError(t, kafka.WaitForCatchingUp(lgr, cfg, saramaClient, startupState, isPartitionStopped, lc), "error in waiting for reaching the stop")
+
+		user2Chats, err := restClient.GetChatsByUserId(ctx, user2, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user2Chats))
+		assert.Equal(t, int64(1), user2Chats[0].UnreadMessages)
+		assert.Equal(t, message1Text, *user2Chats[0].LastMessageContent)
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 1, len(chat1Messages))
+		assert.Equal(t, message1Text, chat1Messages[0].Content)
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 3")
+		assert.Error(t, err, "the commands should be rejected")
+	})
+
+	runClearReplayStop(lgr, cfg)
+
+	// the projections continue from the stop and the commands are accepted again
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user2Chats, err := restClient.GetChatsByUserId(ctx, user2, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user2Chats))
+		assert.Equal(t, int64(2), user2Chats[0].UnreadMessages)
+		assert.Equal(t, message2Text, *user2Chats[0].LastMessageContent)
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 3")
+		require.NoError(t, err, "the commands should be accepted after clearing the stop")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 3, len(chat1Messages))
+		assert.Equal(t, message2Text, chat1Messages[1].Content)
+	})
+}
+
+func TestChatVersionAfterReset(t *testing.T) {
+	cfg, err := config.CreateTestTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	const user1 int64 = 1
+	const chat1Name = "new chat 1"
+
+	var chat1Id int64
+
+	resetInfra(lgr, cfg)
+
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		var err error
+		chat1Id, err = restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+
+		newVersion, err := restClient.EditChatIfMatch(ctx, chat1Id, "renamed chat 1", false, 1)
+		require.NoError(t, err, "error in changing chat")
+		assert.Equal(t, int64(2), newVersion)
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+	})
+
+	runReset(lgr, cfg, &cqrs.ReplayStop{})
+
+	// the aggregate continues from the replayed version, so the version seen by the client is accepted
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user1Chats, err := restClient.GetChatsByUserId(ctx, user1, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user1Chats))
+		seenVersion := user1Chats[0].Version
+		assert.Equal(t, int64(2), seenVersion)
+
+		newVersion, err := restClient.EditChatIfMatch(ctx, chat1Id, "renamed chat 1 after reset", false, seenVersion)
+		require.NoError(t, err, "the version seen after reset should be accepted")
+		assert.Equal(t, seenVersion+1, newVersion)
 	})
 }
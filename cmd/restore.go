@@ -0,0 +1,76 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/otel"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore the projections from a snapshot",
+	Long:  `Reset the storage and the consumer groups like reset does, load the configured snapshot file and commit its offsets, so serve continues consuming from them instead of the beginning of the topic.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunRestore()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func RunRestore() {
+	cfg, err := config.CreateTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	lgr.Info("Start restore command")
+	runRestore(lgr, cfg)
+	lgr.Info("Exit restore command")
+}
+
+func runRestore(lgr *logger.LoggerWrapper, cfg *config.AppConfig) {
+	appFx := fx.New(
+		fx.Supply(cfg),
+		fx.Supply(lgr),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			otel.ConfigureTracePropagator,
+			otel.ConfigureTraceProvider,
+			otel.ConfigureTraceExporter,
+			db.ConfigureDatabase,
+			kafka.ConfigureKafkaAdmin,
+			kafka.ConfigureSaramaClient,
+			cqrs.ConfigureCommonProjection,
+		),
+		fx.Invoke(
+			cqrs.RunCheckSnapshot,
+			db.RunResetDatabase,
+			kafka.RunResetPartitions,
+			db.RunMigrations,
+			kafka.RunCreateTopic,
+			cqrs.RunRestoreSnapshot,
+			cqrs.SetIsNeedToFastForwardSequences,
+			app.Shutdown,
+		),
+	)
+	appFx.Run()
+}
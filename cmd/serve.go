@@ -5,13 +5,17 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"go-cqrs-chat-example/app"
 	"go-cqrs-chat-example/config"
 	"go-cqrs-chat-example/cqrs"
 	"go-cqrs-chat-example/db"
 	"go-cqrs-chat-example/handlers"
+	"go-cqrs-chat-example/idempotency"
 	"go-cqrs-chat-example/kafka"
 	"go-cqrs-chat-example/logger"
 	"go-cqrs-chat-example/otel"
+	"go-cqrs-chat-example/ratelimit"
+	"go-cqrs-chat-example/rpc"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"os"
@@ -58,33 +62,70 @@ func RunServe() {
 			return &fxevent.SlogLogger{Logger: lgr.Logger}
 		}),
 		fx.Provide(
+			app.NewStartupState,
 			otel.ConfigureTracePropagator,
 			otel.ConfigureTraceProvider,
 			otel.ConfigureTraceExporter,
+			otel.ConfigureMeterProvider,
 			db.ConfigureDatabase,
 			kafka.ConfigureKafkaAdmin,
 			cqrs.ConfigureKafkaMarshaller,
 			cqrs.ConfigureWatermillLogger,
 			cqrs.ConfigurePublisher,
+			cqrs.ConfigureSequenceChecker,
+			cqrs.ConfigureProjectionProgressRecorder,
+			cqrs.ConfigureProjectionSwitch,
+			cqrs.ConfigureReplayStop,
+			cqrs.ConfigureIsPartitionStopped,
 			cqrs.ConfigureCqrsRouter,
 			cqrs.ConfigureCqrsMarshaller,
+			cqrs.ConfigureOutbox,
 			cqrs.ConfigureEventBus,
 			cqrs.ConfigureEventProcessor,
 			cqrs.ConfigureCommonProjection,
+			cqrs.ConfigureIdGenerator,
+			cqrs.ConfigureChatRepository,
+			cqrs.ConfigureWebhookProjection,
+			cqrs.ConfigureAuditLogProjection,
+			ratelimit.NewRateLimiter,
+			idempotency.NewStore,
+			handlers.LoadOpenApi,
 			handlers.NewChatHandler,
 			handlers.NewParticipantHandler,
 			handlers.NewMessageHandler,
 			handlers.NewBlogHandler,
+			handlers.NewWebhookHandler,
+			handlers.NewAuditLogHandler,
+			handlers.NewAdminHandler,
+			handlers.NewHealthHandler,
 			handlers.ConfigureHttpServer,
+			rpc.ConfigureChatEventsBroadcaster,
+			rpc.NewChatService,
+			rpc.NewParticipantService,
+			rpc.NewMessageService,
+			rpc.NewBlogService,
+			rpc.ConfigureGrpcServer,
 			kafka.ConfigureSaramaClient,
 		),
 		fx.Invoke(
 			db.RunMigrations,
 			kafka.RunCreateTopic,
+			cqrs.RegisterWebhookHandler,
+			cqrs.RegisterAuditLogHandler,
+			cqrs.RunProjectionSwitchWatcher,
+			cqrs.RunProjectionOffsetInheritance,
 			cqrs.RunCqrsRouter,
-			kafka.WaitForAllEventsProcessed,
-			cqrs.RunSequenceFastforwarder,
+			cqrs.RegisterConsumerLagMetrics,
+			// the probes and the stale queries are answered during the catching up, the commands respond 503 till MarkStarted
 			handlers.RunHttpServer,
+			kafka.WaitForCatchingUp,
+			cqrs.RunSequenceFastforwarder,
+			app.MarkStarted,
+			cqrs.RunOutboxRelay,
+			cqrs.RunMessageRetention,
+			cqrs.RunWebhookDispatcher,
+			idempotency.RunKeysCleaner,
+			rpc.RunGrpcServer,
 		),
 	)
 	appFx.Run()
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"github.com/IBM/sarama"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -12,10 +14,21 @@ import (
 	"go-cqrs-chat-example/handlers"
 	"go-cqrs-chat-example/kafka"
 	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/rpc"
 	"go-cqrs-chat-example/utils"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -396,7 +409,7 @@ func TestAddParticipant(t *testing.T) {
 		assert.Equal(t, []int64{2, 1}, chat1OfUser2.ParticipantIds)
 
 		const chat1NewName = "new chat 1 renamed"
-		err = restClient.EditChat(ctx, user1, chat1NewName, false)
+		err = restClient.EditChat(ctx, chat1Id, chat1NewName, false)
 		require.NoError(t, err, "error in changing chat")
 		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
 
@@ -630,7 +643,7 @@ func TestBlog(t *testing.T) {
 		require.NoError(t, err, "error in creating chat")
 		assert.True(t, chat1Id > 0)
 
-		err = restClient.EditChat(ctx, user1, chat1Name, false)
+		err = restClient.EditChat(ctx, chat1Id, chat1Name, false)
 		require.NoError(t, err)
 		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
 
@@ -784,3 +797,917 @@ func TestMessagePaginate(t *testing.T) {
 		assert.Equal(t, int64(12), resp2[2].Id)
 	})
 }
+
+func TestMessageRetention(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		dba *db.DB,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+		const retentionSeconds = 5
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		assert.True(t, chat1Id > 0)
+
+		err = restClient.AddChatParticipants(ctx, chat1Id, []int64{user2})
+		require.NoError(t, err, "error in adding participants")
+
+		const user3 int64 = 3
+		err = restClient.EditChatRetention(ctx, user3, chat1Id, retentionSeconds)
+		require.Error(t, err, "non-participant should not edit the retention")
+		assert.Contains(t, err.Error(), "403")
+
+		err = restClient.EditChatRetention(ctx, user2, chat1Id, retentionSeconds)
+		require.NoError(t, err, "error in editing chat retention")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		const message1Text = "new message 1"
+		message1Id, err := restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user2Chats, err := restClient.GetChatsByUserId(ctx, user2, nil)
+		require.NoError(t, err, "error in getting chats")
+		assert.Equal(t, 1, len(user2Chats))
+		assert.Equal(t, int64(1), user2Chats[0].UnreadMessages)
+
+		// wait for the retention job removes the expired message
+		time.Sleep(retentionSeconds*time.Second + 2*cfg.CqrsConfig.RetentionConfig.CheckInterval)
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		exists, err := isMessageExists(ctx, dba, chat1Id, message1Id)
+		require.NoError(t, err, "error in checking message")
+		assert.False(t, exists)
+
+		const message2Text = "new message 2"
+		message2Id, err := restClient.CreateMessage(ctx, user1, chat1Id, message2Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		assert.Equal(t, 1, len(chat1Messages))
+		assert.Equal(t, message2Id, chat1Messages[0].Id)
+
+		user2ChatsNew, err := restClient.GetChatsByUserId(ctx, user2, nil)
+		require.NoError(t, err, "error in getting chats")
+		assert.Equal(t, 1, len(user2ChatsNew))
+		chat1OfUser2 := user2ChatsNew[0]
+		assert.Equal(t, int64(1), chat1OfUser2.UnreadMessages)
+		assert.Equal(t, message2Id, *chat1OfUser2.LastMessageId)
+		assert.Equal(t, message2Text, *chat1OfUser2.LastMessageContent)
+	})
+}
+
+func TestIdempotentMessageCreate(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const chat1Name = "new chat 1"
+		const message1Text = "new message 1"
+		const idempotencyKey = "message-1"
+		const concurrentRequests = 5
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		messageIds := make(chan int64, concurrentRequests)
+		errs := make(chan error, concurrentRequests)
+		var wg sync.WaitGroup
+		for range concurrentRequests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mid, err := restClient.CreateMessageIdempotent(ctx, user1, chat1Id, message1Text, idempotencyKey)
+				messageIds <- mid
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(messageIds)
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err, "error in creating message")
+		}
+		var message1Id int64
+		for mid := range messageIds {
+			if message1Id == 0 {
+				message1Id = mid
+			}
+			assert.Equal(t, message1Id, mid)
+		}
+
+		// a retry after a while
+		retriedMessageId, err := restClient.CreateMessageIdempotent(ctx, user1, chat1Id, message1Text, idempotencyKey)
+		require.NoError(t, err, "error in creating message")
+		assert.Equal(t, message1Id, retriedMessageId)
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		assert.Equal(t, 1, len(chat1Messages))
+		assert.Equal(t, message1Id, chat1Messages[0].Id)
+
+		// the query is a part of the request
+		const pinIdempotencyKey = "pin-1"
+		err = restClient.PinChatIdempotent(ctx, user1, chat1Id, true, pinIdempotencyKey)
+		require.NoError(t, err, "error in pinning chat")
+		err = restClient.PinChatIdempotent(ctx, user1, chat1Id, false, pinIdempotencyKey)
+		require.Error(t, err, "idempotency key should not be reused with another query")
+		assert.Contains(t, err.Error(), "422")
+	})
+}
+
+func TestSlowMode(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+		const slowModeSeconds = 2
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+
+		err = restClient.AddChatParticipants(ctx, chat1Id, []int64{user2})
+		require.NoError(t, err, "error in adding participants")
+
+		const user3 int64 = 3
+		err = restClient.EditChatSlowMode(ctx, user3, chat1Id, slowModeSeconds)
+		require.Error(t, err, "non-participant should not edit the slow mode")
+		assert.Contains(t, err.Error(), "403")
+
+		err = restClient.EditChatSlowMode(ctx, user1, chat1Id, slowModeSeconds)
+		require.NoError(t, err, "error in editing chat slow mode")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 2")
+		require.Error(t, err, "slow mode should reject the message")
+		assert.Contains(t, err.Error(), "429")
+
+		// other participant has their own slow mode window
+		_, err = restClient.CreateMessage(ctx, user2, chat1Id, "new message 3")
+		require.NoError(t, err, "error in creating message")
+
+		time.Sleep(slowModeSeconds * time.Second)
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 4")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		assert.Equal(t, 3, len(chat1Messages))
+	})
+}
+
+func TestErrorStatuses(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+		const absentChatId = 100500
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		message1Id, err := restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		err = restClient.EditMessage(ctx, user2, chat1Id, message1Id, "edited by a stranger")
+		require.Error(t, err, "only the owner can edit the message")
+		assert.Contains(t, err.Error(), "403")
+
+		err = restClient.DeleteMessage(ctx, user1, chat1Id, message1Id+1)
+		require.Error(t, err, "absent message can't be deleted")
+		assert.Contains(t, err.Error(), "404")
+
+		_, err = restClient.CreateMessage(ctx, user1, absentChatId, "new message 2")
+		require.Error(t, err, "message can't be created in absent chat")
+		assert.Contains(t, err.Error(), "404")
+
+		httpResp, err := http.Get("http://localhost" + cfg.HttpServerConfig.Address + "/blog/" + utils.ToString(absentChatId))
+		require.NoError(t, err)
+		defer httpResp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, httpResp.StatusCode)
+		assert.Equal(t, handlers.ProblemContentType, httpResp.Header.Get("Content-Type"))
+		problem := handlers.ProblemDto{}
+		require.NoError(t, json.NewDecoder(httpResp.Body).Decode(&problem))
+		assert.Equal(t, http.StatusNotFound, problem.Status)
+		assert.Equal(t, "blog 100500", problem.Detail)
+		assert.Equal(t, httpResp.Header.Get("trace-id"), problem.TraceId)
+	})
+}
+
+func TestChatInvariants(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		_, err = restClient.CreateMessage(ctx, user2, chat1Id, "not a participant yet")
+		require.Error(t, err, "non-participant can't write")
+		assert.Contains(t, err.Error(), "403")
+
+		err = restClient.AddChatParticipants(ctx, chat1Id, []int64{user2})
+		require.NoError(t, err, "error in adding participants")
+		err = restClient.AddChatParticipants(ctx, chat1Id, []int64{user2})
+		require.NoError(t, err, "adding the participant twice should be no-op")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		participants, err := restClient.GetChatParticipants(ctx, chat1Id)
+		require.NoError(t, err, "error in getting participants")
+		assert.Equal(t, []int64{user1, user2}, participants)
+
+		_, err = restClient.CreateMessage(ctx, user2, chat1Id, "now a participant")
+		require.NoError(t, err, "participant can write")
+
+		err = restClient.DeleteChat(ctx, chat1Id)
+		require.NoError(t, err, "error in deleting chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		err = restClient.EditChat(ctx, chat1Id, "renamed deleted chat", false)
+		require.Error(t, err, "deleted chat can't be edited")
+		assert.Contains(t, err.Error(), "404")
+
+		err = restClient.DeleteChat(ctx, chat1Id)
+		require.Error(t, err, "deleted chat can't be deleted twice")
+		assert.Contains(t, err.Error(), "404")
+	})
+}
+
+func TestChatVersion(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const chat1Name = "new chat 1"
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user1Chats, err := restClient.GetChatsByUserId(ctx, user1, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user1Chats))
+		seenVersion := user1Chats[0].Version
+		assert.Equal(t, int64(1), seenVersion)
+
+		const firstAdminTitle = "renamed by the first admin"
+		newVersion, err := restClient.EditChatIfMatch(ctx, chat1Id, firstAdminTitle, false, seenVersion)
+		require.NoError(t, err, "error in changing chat")
+		assert.Equal(t, seenVersion+1, newVersion)
+
+		_, err = restClient.EditChatIfMatch(ctx, chat1Id, "renamed by the second admin", false, seenVersion)
+		require.Error(t, err, "stale version should be rejected")
+		assert.Contains(t, err.Error(), "409")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user1ChatsNew, err := restClient.GetChatsByUserId(ctx, user1, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user1ChatsNew))
+		assert.Equal(t, firstAdminTitle, user1ChatsNew[0].Title)
+		assert.Equal(t, newVersion, user1ChatsNew[0].Version)
+	})
+}
+
+func TestChatVersionIsKeptByMessages(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, "new chat 1")
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat1Id, []int64{user2}), "error in adding participants")
+		message1Id, err := restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user1Chats, err := restClient.GetChatsByUserId(ctx, user1, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user1Chats))
+		seenChatVersion := user1Chats[0].Version
+
+		messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 1, len(messages))
+		seenMessageVersion := messages[0].Version
+		assert.Equal(t, int64(1), seenMessageVersion)
+
+		// someone writes into the active chat between reading and editing
+		message2Id, err := restClient.CreateMessage(ctx, user2, chat1Id, "new message 2")
+		require.NoError(t, err, "error in creating message")
+		err = restClient.EditMessage(ctx, user2, chat1Id, message2Id, "edited message 2")
+		require.NoError(t, err, "error in editing message")
+
+		const newTitle = "renamed in the active chat"
+		newChatVersion, err := restClient.EditChatIfMatch(ctx, chat1Id, newTitle, false, seenChatVersion)
+		require.NoError(t, err, "the messages shouldn't change the version of the chat")
+		assert.Equal(t, seenChatVersion+1, newChatVersion)
+
+		// the edit of the chat doesn't change the version of the message either
+		newMessageVersion, err := restClient.EditMessageIfMatch(ctx, user1, chat1Id, message1Id, "edited message 1", seenMessageVersion)
+		require.NoError(t, err, "error in editing message")
+		assert.Equal(t, seenMessageVersion+1, newMessageVersion)
+
+		_, err = restClient.EditMessageIfMatch(ctx, user1, chat1Id, message1Id, "edited message 1 by the stale version", seenMessageVersion)
+		require.Error(t, err, "stale version of the message should be rejected")
+		assert.Contains(t, err.Error(), "409")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user1ChatsNew, err := restClient.GetChatsByUserId(ctx, user1, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user1ChatsNew))
+		assert.Equal(t, newTitle, user1ChatsNew[0].Title)
+		assert.Equal(t, newChatVersion, user1ChatsNew[0].Version)
+
+		messagesNew, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 2, len(messagesNew))
+		assert.Equal(t, message1Id, messagesNew[0].Id)
+		assert.Equal(t, "edited message 1", messagesNew[0].Content)
+		assert.Equal(t, newMessageVersion, messagesNew[0].Version)
+		assert.Equal(t, int64(2), messagesNew[1].Version)
+	})
+}
+
+func TestChatSequences(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		dba *db.DB,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const chat1Name = "new chat 1"
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		var published, handled int64
+		require.NoError(t, dba.QueryRowContext(ctx, "select last_seq from chat_event_sequence where chat_id = $1", chat1Id).Scan(&published))
+		require.NoError(t, dba.QueryRowContext(ctx, "select last_seq from projection_chat_sequence where chat_id = $1", chat1Id).Scan(&handled))
+		// ChatCreated, ParticipantsAdded, MessageCreated and ChatViewRefreshed at least
+		assert.GreaterOrEqual(t, published, int64(4))
+		assert.Equal(t, published, handled, "the projection should have handled all the events of the chat")
+	})
+}
+
+func TestChatSequencesOfRolledBackAndResentEvents(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		dba *db.DB,
+		eventBus *cqrs.PartitionAwareEventBus,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, "new chat 1")
+		require.NoError(t, err, "error in creating chat")
+		message1Id, err := restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		editedEvent := func(content string) *cqrs.MessageEdited {
+			return &cqrs.MessageEdited{
+				AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+				Id:             message1Id,
+				ChatId:         chat1Id,
+				Content:        content,
+			}
+		}
+
+		var publishedBefore int64
+		require.NoError(t, dba.QueryRowContext(ctx, "select last_seq from chat_event_sequence where chat_id = $1", chat1Id).Scan(&publishedBefore))
+
+		// the commit fails after the event has been written, its number is given to the next event
+		errRollback := errors.New("rollback")
+		err = db.Transact(ctx, dba, func(tx *db.Tx) error {
+			err := eventBus.Publish(cqrs.WithTx(ctx, tx), editedEvent("rolled back message 1"))
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		require.ErrorIs(t, err, errRollback)
+		eventBus.Flush(ctx, chat1Id)
+
+		// the event has been sent, but the outbox hasn't removed it, so it's sent once more with the same number
+		var outboxRow struct {
+			seq         int64
+			messageUuid string
+			metadata    []byte
+			payload     []byte
+		}
+		err = db.Transact(ctx, dba, func(tx *db.Tx) error {
+			err := eventBus.Publish(cqrs.WithTx(ctx, tx), editedEvent("resent message 1"))
+			if err != nil {
+				return err
+			}
+			return tx.QueryRowContext(ctx, "select seq, message_uuid, metadata, payload from chat_event_outbox where chat_id = $1", chat1Id).
+				Scan(&outboxRow.seq, &outboxRow.messageUuid, &outboxRow.metadata, &outboxRow.payload)
+		})
+		require.NoError(t, err, "error in publishing event")
+		eventBus.Flush(ctx, chat1Id)
+		_, err = dba.ExecContext(ctx, `
+			insert into chat_event_outbox(chat_id, seq, message_uuid, metadata, payload, create_date_time)
+			values ($1, $2, $3, $4, $5, $6)
+		`, chat1Id, outboxRow.seq, outboxRow.messageUuid, outboxRow.metadata, outboxRow.payload, time.Now().UTC())
+		require.NoError(t, err, "error in restoring the sent event")
+		eventBus.Flush(ctx, chat1Id)
+
+		err = restClient.EditMessage(ctx, user1, chat1Id, message1Id, "edited message 1")
+		require.NoError(t, err, "error in editing message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		var outboxEvents int64
+		require.NoError(t, dba.QueryRowContext(ctx, "select count(*) from chat_event_outbox where chat_id = $1", chat1Id).Scan(&outboxEvents))
+		assert.Equal(t, int64(0), outboxEvents, "all the events should have been sent")
+
+		var published, handled int64
+		require.NoError(t, dba.QueryRowContext(ctx, "select last_seq from chat_event_sequence where chat_id = $1", chat1Id).Scan(&published))
+		require.NoError(t, dba.QueryRowContext(ctx, "select last_seq from projection_chat_sequence where chat_id = $1", chat1Id).Scan(&handled))
+		assert.Equal(t, publishedBefore+1, outboxRow.seq, "the number of the rolled back event should be given to the next one")
+		assert.Greater(t, published, outboxRow.seq)
+		assert.Equal(t, published, handled, "the projection should have handled all the events of the chat")
+
+		// the event after the duplicate isn't taken for a duplicate
+		messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 1, len(messages))
+		assert.Equal(t, "edited message 1", messages[0].Content)
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const chat1Name = "new chat 1"
+		const message1Text = "new message 1"
+		const secret = "s3cr3t"
+
+		ctx := context.Background()
+
+		// the first attempt fails in order to check the retry
+		var mu sync.Mutex
+		var receivedBodies [][]byte
+		var signatureErrors int
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			timestamp, _ := utils.ParseInt64(r.Header.Get(cqrs.WebhookTimestampHeader))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Header.Get(cqrs.WebhookSignatureHeader) != cqrs.SignWebhook(secret, timestamp, body) {
+				signatureErrors++
+			}
+			receivedBodies = append(receivedBodies, body)
+			if len(receivedBodies) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer receiver.Close()
+		receivedCount := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(receivedBodies)
+		}
+
+		subscriptionId, err := restClient.CreateWebhookSubscription(ctx, receiver.URL, secret, []string{"messageCreated"}, nil)
+		require.NoError(t, err, "error in creating webhook subscription")
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+
+		message1Id, err := restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		require.Eventually(t, func() bool {
+			deliveries, err := restClient.GetWebhookDeliveries(ctx, subscriptionId)
+			return err == nil && len(deliveries) == 1 && deliveries[0].Status == cqrs.WebhookDeliveryStatusDelivered
+		}, 30*time.Second, 100*time.Millisecond)
+
+		deliveries, err := restClient.GetWebhookDeliveries(ctx, subscriptionId)
+		require.NoError(t, err, "error in getting webhook deliveries")
+		assert.Equal(t, 1, len(deliveries))
+		delivery := deliveries[0]
+		assert.Equal(t, "messageCreated", delivery.EventType)
+		assert.Equal(t, chat1Id, *delivery.ChatId)
+		assert.Equal(t, int32(2), delivery.Attempts)
+		assert.Equal(t, int32(http.StatusOK), *delivery.LastResponseStatus)
+		assert.Equal(t, 2, receivedCount())
+
+		mu.Lock()
+		var payload cqrs.WebhookPayload
+		require.NoError(t, json.Unmarshal(receivedBodies[1], &payload))
+		assert.Equal(t, 0, signatureErrors)
+		mu.Unlock()
+		assert.Equal(t, "messageCreated", payload.Type)
+		var messageCreated cqrs.MessageCreated
+		require.NoError(t, json.Unmarshal(payload.Data, &messageCreated))
+		assert.Equal(t, message1Id, messageCreated.Id)
+		assert.Equal(t, message1Text, messageCreated.Content)
+
+		err = restClient.RedeliverWebhook(ctx, delivery.Id)
+		require.NoError(t, err, "error in redelivering webhook")
+		require.Eventually(t, func() bool {
+			return receivedCount() == 3
+		}, 30*time.Second, 100*time.Millisecond)
+
+		err = restClient.RedeliverWebhook(ctx, delivery.Id+1000)
+		require.Error(t, err, "redelivery of an absent delivery should fail")
+		assert.Contains(t, err.Error(), "404")
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+		const message1Text = "new message 1"
+
+		ctx := context.Background()
+		startTime := time.Now().UTC()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+
+		err = restClient.AddChatParticipants(ctx, chat1Id, []int64{user2})
+		require.NoError(t, err, "error in adding participants")
+
+		message1Id, err := restClient.CreateMessage(ctx, user2, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+
+		err = restClient.DeleteMessage(ctx, user2, chat1Id, message1Id)
+		require.NoError(t, err, "error in deleting message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		// the audit log has its own consumer group
+		require.Eventually(t, func() bool {
+			entries, err := restClient.SearchAuditLog(ctx, &url.Values{
+				"chatId": []string{utils.ToString(chat1Id)},
+			})
+			return err == nil && len(entries) == 5
+		}, 30*time.Second, 100*time.Millisecond)
+
+		entries, err := restClient.SearchAuditLog(ctx, &url.Values{
+			"chatId": []string{utils.ToString(chat1Id)},
+		})
+		require.NoError(t, err, "error in getting audit log")
+		eventTypes := []string{}
+		for _, entry := range entries {
+			eventTypes = append(eventTypes, entry.EventType)
+		}
+		// the newest first, without chatViewRefreshed
+		assert.Equal(t, []string{"messageDeleted", "messageCreated", "participantsAdded", "participantsAdded", "chatCreated"}, eventTypes)
+
+		entries, err = restClient.SearchAuditLog(ctx, &url.Values{
+			"chatId":    []string{utils.ToString(chat1Id)},
+			"actorId":   []string{utils.ToString(user2)},
+			"eventType": []string{"messageDeleted"},
+			"from":      []string{startTime.Format(time.RFC3339Nano)},
+		})
+		require.NoError(t, err, "error in getting audit log")
+		require.Equal(t, 1, len(entries))
+		assert.Equal(t, []int64{message1Id}, entries[0].TargetIds)
+		assert.NotNil(t, entries[0].CorrelationId)
+		var messageDeleted cqrs.MessageDeleted
+		require.NoError(t, json.Unmarshal(entries[0].Data, &messageDeleted))
+		assert.Equal(t, message1Id, messageDeleted.MessageId)
+		assert.Equal(t, entries[0].EventId, messageDeleted.AdditionalData.EventId)
+
+		entries, err = restClient.SearchAuditLog(ctx, &url.Values{
+			"chatId": []string{utils.ToString(chat1Id)},
+			"to":     []string{startTime.Format(time.RFC3339Nano)},
+		})
+		require.NoError(t, err, "error in getting audit log")
+		assert.Equal(t, 0, len(entries))
+
+		_, err = restClient.SearchAuditLog(ctx, &url.Values{
+			"from": []string{"yesterday"},
+		})
+		require.Error(t, err, "wrong time should be rejected")
+		assert.Contains(t, err.Error(), "400")
+	})
+}
+
+func TestProjectionsStatus(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const chat1Name = "new chat 1"
+
+		ctx := context.Background()
+
+		_, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		status, err := restClient.GetProjectionsStatus(ctx)
+		require.NoError(t, err, "error in getting projections status")
+		assert.False(t, status.NeedToFastForwardSequences)
+
+		projectionNames := []string{}
+		for _, projection := range status.Projections {
+			projectionNames = append(projectionNames, projection.Name)
+		}
+		assert.Equal(t, []string{
+			cfg.ProjectionsConfig.ChatConfig.ConsumerGroup,
+			cfg.ProjectionsConfig.ChatViewConfig.ConsumerGroup,
+			cfg.ProjectionsConfig.UnreadMessagesConfig.ConsumerGroup,
+			cfg.ProjectionsConfig.BlogConfig.ConsumerGroup,
+			cfg.CqrsConfig.WebhookConfig.ConsumerGroup,
+			cfg.CqrsConfig.AuditLogConfig.ConsumerGroup,
+		}, projectionNames)
+
+		common := status.Projections[0]
+		assert.Equal(t, int64(0), common.Lag)
+		assert.Equal(t, int(cfg.KafkaConfig.NumPartitions), len(common.Partitions))
+
+		var handledPartitions int
+		for _, partition := range common.Partitions {
+			assert.Equal(t, partition.LatestOffset, partition.CommittedOffset)
+			if partition.LastEvent != nil {
+				handledPartitions++
+				// ChatCreated and ParticipantsAdded of the chat are in the same partition
+				assert.Equal(t, partition.LatestOffset-1, partition.LastEvent.Offset)
+				assert.Equal(t, "participantsAdded", partition.LastEvent.EventType)
+				assert.NotNil(t, partition.LastEvent.TraceId)
+			}
+		}
+		assert.Equal(t, 1, handledPartitions)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+		const message1Text = "new message 1"
+
+		ctx := context.Background()
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+
+		err = restClient.AddChatParticipants(ctx, chat1Id, []int64{user2})
+		require.NoError(t, err, "error in adding participants")
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		metrics, err := restClient.GetMetrics(ctx)
+		require.NoError(t, err, "error in getting metrics")
+
+		assert.Contains(t, metrics, `http_server_request_duration_seconds_count{http_request_method="POST",http_response_status_code="200",http_route="/chat/:id/message"`)
+		assert.Contains(t, metrics, `chat_events_published_total{event_type="messageCreated"`)
+		assert.Contains(t, metrics, `chat_events_consumed_total{event_type="chatViewRefreshed",`)
+		assert.Contains(t, metrics, `chat_events_handler_duration_seconds_bucket{`)
+		assert.Contains(t, metrics, `chat_fanout_participants_bucket{`)
+		assert.Contains(t, metrics, `chat_consumer_lag{consumer_group="`+cfg.ProjectionsConfig.ChatConfig.ConsumerGroup+`",`)
+	})
+}
+
+func TestGrpc(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const user3 int64 = 3
+		const chat1Name = "new chat 1"
+		const message1Text = "new message 1"
+		const message2Text = "new message 2"
+
+		conn, err := grpc.NewClient(
+			"localhost"+cfg.GrpcServerConfig.Address,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		)
+		require.NoError(t, err, "error in creating grpc client")
+		defer conn.Close()
+
+		chatClient := rpc.NewChatServiceClient(conn)
+		participantClient := rpc.NewParticipantServiceClient(conn)
+		messageClient := rpc.NewMessageServiceClient(conn)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), rpc.UserIdMetadata, utils.ToString(user1))
+
+		chat1, err := chatClient.CreateChat(ctx, &rpc.CreateChatRequest{Title: chat1Name})
+		require.NoError(t, err, "error in creating chat")
+		assert.True(t, chat1.Id > 0)
+
+		_, err = participantClient.AddParticipants(ctx, &rpc.ParticipantsRequest{ChatId: chat1.Id, ParticipantIds: []int64{user2}})
+		require.NoError(t, err, "error in adding participants")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		streamCtx, cancelStream := context.WithCancel(ctx)
+		defer cancelStream()
+		stream, err := chatClient.SubscribeChatEvents(streamCtx, &rpc.ChatIdRequest{ChatId: chat1.Id})
+		require.NoError(t, err, "error in subscribing to chat events")
+		// the subscription is established asynchronously
+		time.Sleep(500 * time.Millisecond)
+
+		message1, err := messageClient.CreateMessage(ctx, &rpc.CreateMessageRequest{ChatId: chat1.Id, Content: message1Text})
+		require.NoError(t, err, "error in creating message")
+
+		var messageCreated cqrs.MessageCreated
+		for {
+			event, err := stream.Recv()
+			require.NoError(t, err, "error in receiving chat event")
+			assert.Equal(t, chat1.Id, event.ChatId)
+			if event.Type == "messageCreated" {
+				require.NoError(t, json.Unmarshal(event.Data, &messageCreated))
+				break
+			}
+		}
+		assert.Equal(t, message1.Id, messageCreated.Id)
+		assert.Equal(t, message1Text, messageCreated.Content)
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		messages, err := messageClient.SearchMessages(ctx, &rpc.SearchMessagesRequest{ChatId: chat1.Id})
+		require.NoError(t, err, "error in getting messages")
+		assert.Equal(t, 1, len(messages.Messages))
+		assert.Equal(t, message1Text, messages.Messages[0].Content)
+
+		user2Ctx := metadata.AppendToOutgoingContext(context.Background(), rpc.UserIdMetadata, utils.ToString(user2))
+		user2Chats, err := chatClient.SearchChats(user2Ctx, &rpc.SearchChatsRequest{})
+		require.NoError(t, err, "error in getting chats")
+		assert.Equal(t, 1, len(user2Chats.Chats))
+		assert.Equal(t, int64(1), user2Chats.Chats[0].UnreadMessages)
+
+		// the retry with the same key gets the first response instead of creating one more message
+		idempotentCtx := metadata.AppendToOutgoingContext(ctx, rpc.IdempotencyKeyMetadata, "message-2")
+		message2, err := messageClient.CreateMessage(idempotentCtx, &rpc.CreateMessageRequest{ChatId: chat1.Id, Content: message2Text})
+		require.NoError(t, err, "error in creating message")
+		var replayedHeader metadata.MD
+		retriedMessage2, err := messageClient.CreateMessage(idempotentCtx, &rpc.CreateMessageRequest{ChatId: chat1.Id, Content: message2Text}, grpc.Header(&replayedHeader))
+		require.NoError(t, err, "error in creating message")
+		assert.Equal(t, message2.Id, retriedMessage2.Id)
+		assert.Equal(t, []string{"true"}, replayedHeader.Get(rpc.IdempotentReplayedMetadata))
+		_, err = messageClient.CreateMessage(idempotentCtx, &rpc.CreateMessageRequest{ChatId: chat1.Id, Content: "another content"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		messages, err = messageClient.SearchMessages(ctx, &rpc.SearchMessagesRequest{ChatId: chat1.Id})
+		require.NoError(t, err, "error in getting messages")
+		assert.Equal(t, 2, len(messages.Messages))
+
+		// only the participants receive the events of the chat
+		user3Ctx := metadata.AppendToOutgoingContext(context.Background(), rpc.UserIdMetadata, utils.ToString(user3))
+		user3Stream, err := chatClient.SubscribeChatEvents(user3Ctx, &rpc.ChatIdRequest{ChatId: chat1.Id})
+		require.NoError(t, err, "error in subscribing to chat events")
+		_, err = user3Stream.Recv()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = chatClient.CreateChat(context.Background(), &rpc.CreateChatRequest{Title: chat1Name})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestHealthProbes(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+	) {
+		ctx := context.Background()
+
+		liveness, err := restClient.Liveness(ctx)
+		require.NoError(t, err, "error in liveness")
+		assert.Equal(t, handlers.HealthStatusUp, liveness.Status)
+
+		readiness, err := restClient.Readiness(ctx)
+		require.NoError(t, err, "error in readiness")
+		assert.Equal(t, handlers.HealthStatusUp, readiness.Status)
+
+		checkNames := []string{}
+		for _, check := range readiness.Checks {
+			checkNames = append(checkNames, check.Name)
+			assert.Equal(t, handlers.HealthStatusUp, check.Status, "check %v", check.Name)
+			assert.Nil(t, check.Error, "check %v", check.Name)
+		}
+		assert.Equal(t, []string{
+			handlers.StartupCheck,
+			handlers.PostgresCheck,
+			handlers.KafkaCheck,
+			handlers.RouterCheck,
+			handlers.ProjectionLagCheck + ":" + config.ChatProjection,
+			handlers.ProjectionLagCheck + ":" + config.ChatViewProjection,
+			handlers.ProjectionLagCheck + ":" + config.UnreadMessagesProjection,
+			handlers.ProjectionLagCheck + ":" + config.BlogProjection,
+		}, checkNames)
+
+		require.NoError(t, restClient.HealthCheck(ctx), "error in the former health check")
+	})
+}
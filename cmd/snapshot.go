@@ -0,0 +1,68 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/otel"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Make a snapshot of the projections",
+	Long:  `Pause the projections and write their tables along with the offsets to continue from into the configured snapshot file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunSnapshot()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+}
+
+func RunSnapshot() {
+	cfg, err := config.CreateTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	lgr.Info("Start snapshot command")
+	runSnapshot(lgr, cfg)
+	lgr.Info("Exit snapshot command")
+}
+
+func runSnapshot(lgr *logger.LoggerWrapper, cfg *config.AppConfig) {
+	appFx := fx.New(
+		fx.Supply(cfg),
+		fx.Supply(lgr),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			otel.ConfigureTracePropagator,
+			otel.ConfigureTraceProvider,
+			otel.ConfigureTraceExporter,
+			db.ConfigureDatabase,
+			kafka.ConfigureSaramaClient,
+		),
+		fx.Invoke(
+			cqrs.RunSnapshot,
+			app.Shutdown,
+		),
+	)
+	appFx.Run()
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-cqrs-chat-example/client"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"os"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	cfg, err := config.CreateTestTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	const user1 int64 = 1
+	const user2 int64 = 2
+	const chat1Name = "new chat 1"
+	const message1Text = "new message 1"
+	const message2Text = "new message 2"
+
+	var chat1Id int64
+
+	resetInfra(lgr, cfg)
+	defer os.Remove(cfg.CqrsConfig.SnapshotConfig.File)
+
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		var err error
+		chat1Id, err = restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat1Id, []int64{user2}), "error in adding participants")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, message1Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+	})
+
+	runSnapshot(lgr, cfg)
+
+	// the event after the snapshot is consumed after the restoring
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		_, err := restClient.CreateMessage(ctx, user1, chat1Id, message2Text)
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+	})
+
+	runRestore(lgr, cfg)
+
+	runTestFunc(lgr, cfg, t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		user2Chats, err := restClient.GetChatsByUserId(ctx, user2, nil)
+		require.NoError(t, err, "error in getting chats")
+		require.Equal(t, 1, len(user2Chats))
+		assert.Equal(t, chat1Name, user2Chats[0].Title)
+		assert.Equal(t, int64(2), user2Chats[0].UnreadMessages)
+		assert.Equal(t, message2Text, *user2Chats[0].LastMessageContent)
+
+		chat1Messages, err := restClient.GetMessages(ctx, user1, chat1Id, nil)
+		require.NoError(t, err, "error in getting messages")
+		require.Equal(t, 2, len(chat1Messages))
+		assert.Equal(t, message1Text, chat1Messages[0].Content)
+		assert.Equal(t, message2Text, chat1Messages[1].Content)
+	})
+}
@@ -9,9 +9,12 @@ import (
 	"go-cqrs-chat-example/cqrs"
 	"go-cqrs-chat-example/db"
 	"go-cqrs-chat-example/handlers"
+	"go-cqrs-chat-example/idempotency"
 	"go-cqrs-chat-example/kafka"
 	"go-cqrs-chat-example/logger"
 	"go-cqrs-chat-example/otel"
+	"go-cqrs-chat-example/ratelimit"
+	"go-cqrs-chat-example/rpc"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/fx/fxtest"
@@ -50,7 +53,7 @@ func resetInfra(lgr *logger.LoggerWrapper, cfg *config.AppConfig) {
 			kafka.ConfigureKafkaAdmin,
 		),
 		fx.Invoke(
-			db.RunResetDatabase,
+			db.RunDropDatabase,
 			kafka.RunDeleteTopic,
 			db.RunMigrations,
 			kafka.RunCreateTopic,
@@ -71,30 +74,66 @@ func runTestFunc(lgr *logger.LoggerWrapper, cfg *config.AppConfig, t *testing.T,
 		}),
 		fx.Populate(&s),
 		fx.Provide(
+			app.NewStartupState,
 			otel.ConfigureTracePropagator,
 			otel.ConfigureTraceProvider,
 			otel.ConfigureTraceExporter,
+			otel.ConfigureMeterProvider,
 			db.ConfigureDatabase,
 			kafka.ConfigureKafkaAdmin,
 			cqrs.ConfigureKafkaMarshaller,
 			cqrs.ConfigureWatermillLogger,
 			cqrs.ConfigurePublisher,
+			cqrs.ConfigureSequenceChecker,
+			cqrs.ConfigureProjectionProgressRecorder,
+			cqrs.ConfigureProjectionSwitch,
+			cqrs.ConfigureReplayStop,
+			cqrs.ConfigureIsPartitionStopped,
 			cqrs.ConfigureCqrsRouter,
 			cqrs.ConfigureCqrsMarshaller,
+			cqrs.ConfigureOutbox,
 			cqrs.ConfigureEventBus,
 			cqrs.ConfigureEventProcessor,
 			cqrs.ConfigureCommonProjection,
+			cqrs.ConfigureIdGenerator,
+			cqrs.ConfigureChatRepository,
+			cqrs.ConfigureWebhookProjection,
+			cqrs.ConfigureAuditLogProjection,
+			ratelimit.NewRateLimiter,
+			idempotency.NewStore,
+			handlers.LoadOpenApi,
 			handlers.NewChatHandler,
 			handlers.NewParticipantHandler,
 			handlers.NewMessageHandler,
 			handlers.NewBlogHandler,
+			handlers.NewWebhookHandler,
+			handlers.NewAuditLogHandler,
+			handlers.NewAdminHandler,
+			handlers.NewHealthHandler,
 			handlers.ConfigureHttpServer,
+			rpc.ConfigureChatEventsBroadcaster,
+			rpc.NewChatService,
+			rpc.NewParticipantService,
+			rpc.NewMessageService,
+			rpc.NewBlogService,
+			rpc.ConfigureGrpcServer,
 			kafka.ConfigureSaramaClient,
 			client.NewRestClient,
 		),
 		fx.Invoke(
+			cqrs.RegisterWebhookHandler,
+			cqrs.RegisterAuditLogHandler,
+			cqrs.RunProjectionSwitchWatcher,
+			cqrs.RunProjectionOffsetInheritance,
 			cqrs.RunCqrsRouter,
+			cqrs.RegisterConsumerLagMetrics,
+			app.MarkStarted,
+			cqrs.RunOutboxRelay,
+			cqrs.RunMessageRetention,
+			cqrs.RunWebhookDispatcher,
+			idempotency.RunKeysCleaner,
 			handlers.RunHttpServer,
+			rpc.RunGrpcServer,
 			waitForHealthCheck,
 			testFunc,
 		),
@@ -123,7 +162,7 @@ func waitForHealthCheck(lgr *logger.LoggerWrapper, restClient *client.RestClient
 	const maxAttempts = 60
 	success := false
 	for ; i <= maxAttempts; i++ {
-		err := restClient.HealthCheck(ctx)
+		_, err := restClient.Readiness(ctx)
 		if err != nil {
 			lgr.Info("Awaiting while chat have been started")
 			time.Sleep(time.Second * 1)
@@ -0,0 +1,79 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/otel"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the per-user views",
+	Long:  `Recompute the titles, the participant counts, the last messages and the unread counters of chat_user_view and unread_messages_user_view from chat_common, chat_participant and message, and report the differences by chat and user. With --repair ChatViewRefreshed is published for the differing participants.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunVerify(verifyRepair)
+	},
+}
+
+var verifyRepair bool
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().BoolVar(&verifyRepair, "repair", false, "publish the refresh events for the differing participants")
+}
+
+func RunVerify(repair bool) {
+	cfg, err := config.CreateTypedConfig()
+	if err != nil {
+		panic(err)
+	}
+	baseLogger := logger.NewBaseLogger(os.Stdout, cfg)
+	lgr := logger.NewLogger(baseLogger)
+
+	lgr.Info("Start verify command")
+	runVerify(lgr, cfg, &cqrs.Verify{Repair: repair})
+	lgr.Info("Exit verify command")
+}
+
+func runVerify(lgr *logger.LoggerWrapper, cfg *config.AppConfig, verify *cqrs.Verify) {
+	appFx := fx.New(
+		fx.Supply(cfg),
+		fx.Supply(lgr),
+		fx.Supply(verify),
+		fx.WithLogger(func(lgr *logger.LoggerWrapper) fxevent.Logger {
+			return &fxevent.SlogLogger{Logger: lgr.Logger}
+		}),
+		fx.Provide(
+			otel.ConfigureTracePropagator,
+			otel.ConfigureTraceProvider,
+			otel.ConfigureTraceExporter,
+			db.ConfigureDatabase,
+			cqrs.ConfigureKafkaMarshaller,
+			cqrs.ConfigureWatermillLogger,
+			cqrs.ConfigurePublisher,
+			cqrs.ConfigureCqrsMarshaller,
+			cqrs.ConfigureReplayStop,
+			cqrs.ConfigureOutbox,
+			cqrs.ConfigureEventBus,
+			cqrs.ConfigureCommonProjection,
+		),
+		fx.Invoke(
+			cqrs.RunVerify,
+			app.Shutdown,
+		),
+	)
+	appFx.Run()
+}
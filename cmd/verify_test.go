@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-cqrs-chat-example/client"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	startAppFull(t, func(
+		lgr *logger.LoggerWrapper,
+		cfg *config.AppConfig,
+		restClient *client.RestClient,
+		saramaClient sarama.Client,
+		dba *db.DB,
+		eventBus *cqrs.PartitionAwareEventBus,
+		commonProjection *cqrs.CommonProjection,
+		lc fx.Lifecycle,
+	) {
+		ctx := context.Background()
+
+		const user1 int64 = 1
+		const user2 int64 = 2
+		const chat1Name = "new chat 1"
+
+		chat1Id, err := restClient.CreateChat(ctx, user1, chat1Name)
+		require.NoError(t, err, "error in creating chat")
+		require.NoError(t, restClient.AddChatParticipants(ctx, chat1Id, []int64{user2}), "error in adding participants")
+		_, err = restClient.CreateMessage(ctx, user1, chat1Id, "new message 1")
+		require.NoError(t, err, "error in creating message")
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		differences, err := cqrs.VerifyChat(ctx, dba, commonProjection, chat1Id)
+		require.NoError(t, err)
+		assert.Empty(t, differences)
+
+		// the drift
+		_, err = dba.ExecContext(ctx, "update unread_messages_user_view set unread_messages = 42 where (user_id, chat_id) = ($1, $2)", user2, chat1Id)
+		require.NoError(t, err)
+		_, err = dba.ExecContext(ctx, "update chat_user_view set title = 'stale' where (user_id, id) = ($1, $2)", user1, chat1Id)
+		require.NoError(t, err)
+
+		differences, err = cqrs.VerifyChat(ctx, dba, commonProjection, chat1Id)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []cqrs.Difference{
+			{ChatId: chat1Id, UserId: user2, Field: cqrs.DifferenceUnreadMessages, Expected: int64(1), Actual: int64(42)},
+			{ChatId: chat1Id, UserId: user1, Field: cqrs.DifferenceTitle, Expected: chat1Name, Actual: "stale"},
+		}, differences)
+
+		require.NoError(t, cqrs.RefreshChatViews(ctx, eventBus, dba, chat1Id, []int64{user1, user2}))
+		require.NoError(t, kafka.WaitForAllEventsProcessed(lgr, cfg, saramaClient, lc), "error in waiting for processing events")
+
+		differences, err = cqrs.VerifyChat(ctx, dba, commonProjection, chat1Id)
+		require.NoError(t, err)
+		assert.Empty(t, differences)
+	})
+}
@@ -18,7 +18,6 @@ type KafkaConfig struct {
 	NumPartitions       int32               `mapstructure:"numPartitions"`
 	ReplicationFactor   int16               `mapstructure:"replicationFactor"`
 	Retention           string              `mapstructure:"retention"`
-	ConsumerGroup       string              `mapstructure:"consumerGroup"`
 	KafkaProducerConfig KafkaProducerConfig `mapstructure:"producer"`
 	KafkaConsumerConfig KafkaConsumerConfig `mapstructure:"consumer"`
 }
@@ -39,14 +38,63 @@ type KafkaConsumerConfig struct {
 }
 
 type OtlpConfig struct {
-	Endpoint string `mapstructure:"endpoint"`
+	Endpoint      string            `mapstructure:"endpoint"`
+	MetricsConfig OtlpMetricsConfig `mapstructure:"metrics"`
+}
+
+type OtlpMetricsConfig struct {
+	Enabled  bool          `mapstructure:"enabled"` // push the metrics to the endpoint besides serving them on /metrics
+	Interval time.Duration `mapstructure:"interval"`
 }
 
 type HttpServerConfig struct {
-	Address        string        `mapstructure:"address"`
-	ReadTimeout    time.Duration `mapstructure:"readTimeout"`
-	WriteTimeout   time.Duration `mapstructure:"writeTimeout"`
-	MaxHeaderBytes int           `mapstructure:"maxHeaderBytes"`
+	Address           string            `mapstructure:"address"`
+	ReadTimeout       time.Duration     `mapstructure:"readTimeout"`
+	WriteTimeout      time.Duration     `mapstructure:"writeTimeout"`
+	MaxHeaderBytes    int               `mapstructure:"maxHeaderBytes"`
+	IdempotencyConfig IdempotencyConfig `mapstructure:"idempotency"`
+	RateLimitConfig   RateLimitConfig   `mapstructure:"rateLimit"`
+	ReadinessConfig   ReadinessConfig   `mapstructure:"readiness"`
+	StartupConfig     StartupConfig     `mapstructure:"startup"`
+}
+
+type StartupConfig struct {
+	// the queries are answered with the stale data while serve is catching up with the events, otherwise they respond 503 as the commands do
+	ServeStaleQueries bool `mapstructure:"serveStaleQueries"`
+}
+
+type ReadinessConfig struct {
+	// the instance isn't ready when the common projection is behind the topic for more events than this
+	MaxProjectionLag int64 `mapstructure:"maxProjectionLag"`
+	// every check fails after this time
+	CheckTimeout time.Duration `mapstructure:"checkTimeout"`
+}
+
+type GrpcServerConfig struct {
+	Address string `mapstructure:"address"`
+	// the buffer of events for a slow SubscribeChatEvents client, the events are dropped after it's full
+	SubscriberBufferSize int `mapstructure:"subscriberBufferSize"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// a limiter is forgotten after it hasn't been used for this time
+	IdleTimeout time.Duration     `mapstructure:"idleTimeout"`
+	User        TokenBucketConfig `mapstructure:"user"`
+	Chat        TokenBucketConfig `mapstructure:"chat"`
+}
+
+type TokenBucketConfig struct {
+	// tokens per second
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+type IdempotencyConfig struct {
+	Ttl           time.Duration `mapstructure:"ttl"`
+	CleanInterval time.Duration `mapstructure:"cleanInterval"`
+	WaitTimeout   time.Duration `mapstructure:"waitTimeout"`
+	PollInterval  time.Duration `mapstructure:"pollInterval"`
 }
 
 type MigrationConfig struct {
@@ -65,12 +113,21 @@ type PostgreSQLConfig struct {
 }
 
 type CqrsConfig struct {
-	SleepBeforeEvent                time.Duration `mapstructure:"sleepBeforeEvent"`
-	CheckAreEventsProcessedInterval time.Duration `mapstructure:"checkAreEventsProcessedInterval"`
-	Dump                            bool          `mapstructure:"dump"`
-	PrettyLog                       bool          `mapstructure:"prettyLog"`
-	ExportConfig                    ExportConfig  `mapstructure:"export"`
-	ImportConfig                    ImportConfig  `mapstructure:"import"`
+	SleepBeforeEvent                time.Duration       `mapstructure:"sleepBeforeEvent"`
+	CheckAreEventsProcessedInterval time.Duration       `mapstructure:"checkAreEventsProcessedInterval"`
+	Dump                            bool                `mapstructure:"dump"`
+	PrettyLog                       bool                `mapstructure:"prettyLog"`
+	ExportConfig                    ExportConfig        `mapstructure:"export"`
+	ImportConfig                    ImportConfig        `mapstructure:"import"`
+	SnapshotConfig                  SnapshotConfig      `mapstructure:"snapshot"`
+	RetentionConfig                 RetentionConfig     `mapstructure:"retention"`
+	RebuildConfig                   RebuildConfig       `mapstructure:"rebuild"`
+	WebhookConfig                   WebhookConfig       `mapstructure:"webhook"`
+	IdGeneratorConfig               IdGeneratorConfig   `mapstructure:"idGenerator"`
+	ChatAggregateConfig             ChatAggregateConfig `mapstructure:"chatAggregate"`
+	SequenceConfig                  SequenceConfig      `mapstructure:"sequence"`
+	OutboxConfig                    OutboxConfig        `mapstructure:"outbox"`
+	AuditLogConfig                  AuditLogConfig      `mapstructure:"auditLog"`
 }
 
 type RestClientConfig struct {
@@ -85,16 +142,151 @@ type ImportConfig struct {
 	File string `mapstructure:"file"`
 }
 
+type SnapshotConfig struct {
+	File string `mapstructure:"file"` // gzipped json lines
+}
+
+type RetentionConfig struct {
+	CheckInterval time.Duration `mapstructure:"checkInterval"`
+	BatchSize     int32         `mapstructure:"batchSize"`
+}
+
+type RebuildConfig struct {
+	// the live projection is paused for the switch when the rebuilt one is behind the topic for not more events than this
+	MaxLag int64 `mapstructure:"maxLag"`
+	// how often serve checks whether its projection is paused or switched
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+	// the time for all the serve instances to notice the pause and finish the current event
+	HandoffGracePeriod time.Duration `mapstructure:"handoffGracePeriod"`
+	// the rebuild is aborted and the live projection is resumed if the rebuilt one hasn't reached the end of the topic during the pause
+	CatchUpTimeout time.Duration `mapstructure:"catchUpTimeout"`
+}
+
+type WebhookConfig struct {
+	ConsumerGroup    string        `mapstructure:"consumerGroup"`
+	DispatchInterval time.Duration `mapstructure:"dispatchInterval"`
+	BatchSize        int32         `mapstructure:"batchSize"`
+	RequestTimeout   time.Duration `mapstructure:"requestTimeout"`
+	MaxAttempts      int32         `mapstructure:"maxAttempts"`
+	InitialBackoff   time.Duration `mapstructure:"initialBackoff"`
+	MaxBackoff       time.Duration `mapstructure:"maxBackoff"`
+}
+
+type IdGeneratorConfig struct {
+	Type   string `mapstructure:"type"`   // db or snowflake
+	NodeId int64  `mapstructure:"nodeId"` // snowflake only, 0-31, should be unique among the running instances
+}
+
+type ChatAggregateConfig struct {
+	MaxAttempts int `mapstructure:"maxAttempts"` // how many times a command is repeated on the concurrent modification of the chat
+}
+
+type OutboxConfig struct {
+	RelayInterval time.Duration `mapstructure:"relayInterval"` // how often the events which weren't sent after their commit are looked for
+	BatchSize     int           `mapstructure:"batchSize"`
+}
+
+type SequenceConfig struct {
+	HaltOnInconsistency bool `mapstructure:"haltOnInconsistency"` // stop the partition on a gap or a reordering in the chat's events instead of applying them
+}
+
+type AuditLogConfig struct {
+	ConsumerGroup string `mapstructure:"consumerGroup"`
+}
+
 type ExportConfig struct {
-	File string `mapstructure:"file"`
+	File        string                  `mapstructure:"file"`
+	Incremental IncrementalExportConfig `mapstructure:"incremental"`
+}
+
+// IncrementalExportConfig is of the continuous backups, every run continues from the offsets where the previous one has finished
+type IncrementalExportConfig struct {
+	Directory        string        `mapstructure:"directory"`        // of the segments and the state file
+	MaxSegmentEvents int64         `mapstructure:"maxSegmentEvents"` // the next segment is started after it, 0 means a segment per run
+	Interval         time.Duration `mapstructure:"interval"`         // of the daemon
 }
 
 type ChatUserViewConfig struct {
 	MaxViewableParticipants int32 `mapstructure:"maxViewableParticipants"`
 }
 
+// the projections, every one has its own consumer group, so they are reset, rebuilt and scaled independently
+const (
+	ChatProjection           = "chat"           // chat_common, chat_participant, message
+	ChatViewProjection       = "chatView"       // chat_user_view
+	UnreadMessagesProjection = "unreadMessages" // unread_messages_user_view
+	BlogProjection           = "blog"           // blog
+)
+
+var AllProjections = []string{ChatProjection, ChatViewProjection, UnreadMessagesProjection, BlogProjection}
+
+type ProjectionConfig struct {
+	ConsumerGroup string `mapstructure:"consumerGroup"`
+}
+
 type ProjectionsConfig struct {
 	ChatUserViewConfig ChatUserViewConfig `mapstructure:"chatUserView"`
+	// the projections run by this instance, the rest of them are expected to be run by the other instances
+	Enabled              []string         `mapstructure:"enabled"`
+	ChatConfig           ProjectionConfig `mapstructure:"chat"`
+	ChatViewConfig       ProjectionConfig `mapstructure:"chatView"`
+	UnreadMessagesConfig ProjectionConfig `mapstructure:"unreadMessages"`
+	BlogConfig           ProjectionConfig `mapstructure:"blog"`
+}
+
+// ConsumerGroup of the projection is also the name of its handler in the router
+func (pc *ProjectionsConfig) ConsumerGroup(projection string) (string, error) {
+	switch projection {
+	case ChatProjection:
+		return pc.ChatConfig.ConsumerGroup, nil
+	case ChatViewProjection:
+		return pc.ChatViewConfig.ConsumerGroup, nil
+	case UnreadMessagesProjection:
+		return pc.UnreadMessagesConfig.ConsumerGroup, nil
+	case BlogProjection:
+		return pc.BlogConfig.ConsumerGroup, nil
+	default:
+		return "", fmt.Errorf("unknown projection %v, the known ones are %v", projection, AllProjections)
+	}
+}
+
+func (pc *ProjectionsConfig) SetConsumerGroup(projection, consumerGroup string) error {
+	switch projection {
+	case ChatProjection:
+		pc.ChatConfig.ConsumerGroup = consumerGroup
+	case ChatViewProjection:
+		pc.ChatViewConfig.ConsumerGroup = consumerGroup
+	case UnreadMessagesProjection:
+		pc.UnreadMessagesConfig.ConsumerGroup = consumerGroup
+	case BlogProjection:
+		pc.BlogConfig.ConsumerGroup = consumerGroup
+	default:
+		return fmt.Errorf("unknown projection %v, the known ones are %v", projection, AllProjections)
+	}
+	return nil
+}
+
+func (pc *ProjectionsConfig) ConsumerGroups(projections []string) ([]string, error) {
+	ret := []string{}
+	for _, projection := range projections {
+		consumerGroup, err := pc.ConsumerGroup(projection)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, consumerGroup)
+	}
+	return ret, nil
+}
+
+// EnabledConsumerGroups are the consumer groups of the projections run by this instance
+func (pc *ProjectionsConfig) EnabledConsumerGroups() ([]string, error) {
+	return pc.ConsumerGroups(pc.Enabled)
+}
+
+// AllConsumerGroups are the consumer groups of the projections run by any instance
+func (pc *ProjectionsConfig) AllConsumerGroups() []string {
+	ret, _ := pc.ConsumerGroups(AllProjections)
+	return ret
 }
 
 type LoggerConfig struct {
@@ -116,6 +308,7 @@ type AppConfig struct {
 	OtlpConfig        OtlpConfig        `mapstructure:"otlp"`
 	PostgreSQLConfig  PostgreSQLConfig  `mapstructure:"postgresql"`
 	HttpServerConfig  HttpServerConfig  `mapstructure:"server"`
+	GrpcServerConfig  GrpcServerConfig  `mapstructure:"grpc"`
 	CqrsConfig        CqrsConfig        `mapstructure:"cqrs"`
 	RestClientConfig  RestClientConfig  `mapstructure:"http"`
 	ProjectionsConfig ProjectionsConfig `mapstructure:"projections"`
@@ -0,0 +1,633 @@
+package cqrs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"slices"
+)
+
+// Chat is the command side aggregate.
+// Its methods check the invariants and record the events, ChatRepository saves them with the version check
+// together with writing them into the outbox, so the concurrent commands on the same chat can't interleave invalid transitions.
+// Participants and messages are looked up on demand, because a chat can have lots of them.
+// Version is of the chat's own state, the changes of the messages and the participants don't change it,
+// every message has its own version instead
+type Chat struct {
+	Id      int64
+	Version int64 // 0 means there is no such chat
+	Deleted bool
+
+	co             db.CommonOperations
+	changes        []PartitionableMessage
+	versionChanged bool
+}
+
+var errConcurrentModification = errors.New("chat was modified concurrently")
+
+func (c *Chat) record(event PartitionableMessage) {
+	c.changes = append(c.changes, event)
+}
+
+// chatEnvelope returns the envelope of the next event which changes the chat itself, with the version the chat will have after saving
+func (c *Chat) chatEnvelope(additionalData *AdditionalData) *AdditionalData {
+	ret := additionalData.ForEvent()
+	ret.ChatVersion = c.Version + 1
+	c.versionChanged = true
+	return ret
+}
+
+// envelope returns the envelope of the next event which doesn't change the chat's version
+func (c *Chat) envelope(additionalData *AdditionalData) *AdditionalData {
+	return additionalData.ForEvent()
+}
+
+// Cause returns the envelope of the first recorded event, the events which are derived from the command refer to it
+func (c *Chat) Cause() *AdditionalData {
+	if len(c.changes) == 0 {
+		return nil
+	}
+	return c.changes[0].GetAdditionalData()
+}
+
+// CheckVersion rejects the command which was made upon the stale state of the chat, nil expectedVersion means no check
+func (c *Chat) CheckVersion(expectedVersion *int64) error {
+	if err := c.requireExists(); err != nil {
+		return err
+	}
+	if expectedVersion != nil && *expectedVersion != c.Version {
+		return NewConflictError("chat %v has version %v, expected %v", c.Id, c.Version, *expectedVersion)
+	}
+	return nil
+}
+
+func (c *Chat) requireExists() error {
+	if c.Version == 0 || c.Deleted {
+		return NewNotFoundError("chat %v", c.Id)
+	}
+	return nil
+}
+
+func (c *Chat) isParticipant(ctx context.Context, userId int64) (bool, error) {
+	var exists bool
+	err := c.co.QueryRowContext(ctx, "select exists(select * from chat_aggregate_participant where (chat_id, user_id) = ($1, $2))", c.Id, userId).Scan(&exists)
+	return exists, err
+}
+
+func (c *Chat) requireParticipant(ctx context.Context, userId int64) error {
+	isParticipant, err := c.isParticipant(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return NewForbiddenError("user %v is not a participant of chat %v", userId, c.Id)
+	}
+	return nil
+}
+
+// lockShared is for the changes of the messages and the participants, they keep the version, but still check it.
+// They take the shared lock of the chat's row instead of updating it, so they don't wait for each other,
+// but they can't interleave with the changes of the chat itself, e. g. with its deletion
+func (c *Chat) lockShared(ctx context.Context) error {
+	var version int64
+	err := c.co.QueryRowContext(ctx, "select version from chat_aggregate where id = $1 for share", c.Id).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version != c.Version {
+		return errConcurrentModification
+	}
+	return nil
+}
+
+// lockParticipant takes the shared lock of the participant till the end of the command, so the participant can't be removed concurrently
+func (c *Chat) lockParticipant(ctx context.Context, userId int64) error {
+	var lockedUserId int64
+	err := c.co.QueryRowContext(ctx, "select user_id from chat_aggregate_participant where (chat_id, user_id) = ($1, $2) for share", c.Id, userId).Scan(&lockedUserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewForbiddenError("user %v is not a participant of chat %v", userId, c.Id)
+	}
+	return err
+}
+
+// filterParticipants returns those of userIds which are (or aren't) the participants
+func (c *Chat) filterParticipants(ctx context.Context, userIds []int64, areParticipants bool) ([]int64, error) {
+	ret := []int64{}
+	for _, userId := range userIds {
+		isParticipant, err := c.isParticipant(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		if isParticipant == areParticipants && !slices.Contains(ret, userId) {
+			ret = append(ret, userId)
+		}
+	}
+	return ret, nil
+}
+
+func (c *Chat) getParticipantIds(ctx context.Context, size int32, offset int64) ([]int64, error) {
+	rows, err := c.co.QueryContext(ctx, "select user_id from chat_aggregate_participant where chat_id = $1 order by user_id limit $2 offset $3", c.Id, size, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []int64{}
+	for rows.Next() {
+		var userId int64
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		ret = append(ret, userId)
+	}
+	return ret, rows.Err()
+}
+
+// requireMessage returns the owner and the version of the message
+func (c *Chat) requireMessage(ctx context.Context, messageId int64) (int64, int64, error) {
+	var ownerId, version int64
+	err := c.co.QueryRowContext(ctx, "select owner_id, version from chat_aggregate_message where (chat_id, id) = ($1, $2)", c.Id, messageId).Scan(&ownerId, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, NewNotFoundError("message %v in chat %v", messageId, c.Id)
+	}
+	return ownerId, version, err
+}
+
+// requireMessageOwner returns the version of the message
+func (c *Chat) requireMessageOwner(ctx context.Context, messageId, userId int64) (int64, error) {
+	ownerId, version, err := c.requireMessage(ctx, messageId)
+	if err != nil {
+		return 0, err
+	}
+	if ownerId != userId {
+		return 0, NewForbiddenError("user %v is not an owner of message %v in chat %v", userId, messageId, c.Id)
+	}
+	return version, nil
+}
+
+func (c *Chat) Create(ad *AdditionalData, title string, participantIds []int64) error {
+	if c.Version != 0 {
+		return NewConflictError("chat %v already exists", c.Id)
+	}
+	c.record(&ChatCreated{
+		AdditionalData: c.chatEnvelope(ad),
+		ChatId:         c.Id,
+		Title:          title,
+	})
+	c.record(&ParticipantsAdded{
+		AdditionalData: c.envelope(ad),
+		ParticipantIds: participantIds,
+		ChatId:         c.Id,
+	})
+	return nil
+}
+
+// Edit returns the participants which were actually added
+func (c *Chat) Edit(ctx context.Context, ad *AdditionalData, title string, blog bool, participantIdsToAdd []int64) ([]int64, error) {
+	if err := c.requireExists(); err != nil {
+		return nil, err
+	}
+	newParticipantIds, err := c.filterParticipants(ctx, participantIdsToAdd, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.record(&ChatEdited{
+		AdditionalData: c.chatEnvelope(ad),
+		ChatId:         c.Id,
+		Title:          title,
+		Blog:           blog,
+	})
+	if len(newParticipantIds) > 0 {
+		c.record(&ParticipantsAdded{
+			AdditionalData: c.envelope(ad),
+			ParticipantIds: newParticipantIds,
+			ChatId:         c.Id,
+		})
+	}
+	return newParticipantIds, nil
+}
+
+func (c *Chat) EditRetention(ctx context.Context, ad *AdditionalData, userId, retentionSeconds int64) error {
+	if err := c.CheckParticipant(ctx, userId); err != nil {
+		return err
+	}
+	c.record(&ChatRetentionEdited{
+		AdditionalData:   c.chatEnvelope(ad),
+		ChatId:           c.Id,
+		RetentionSeconds: retentionSeconds,
+	})
+	return nil
+}
+
+func (c *Chat) EditSlowMode(ctx context.Context, ad *AdditionalData, userId, slowModeSeconds int64) error {
+	if err := c.CheckParticipant(ctx, userId); err != nil {
+		return err
+	}
+	c.record(&ChatSlowModeEdited{
+		AdditionalData:  c.chatEnvelope(ad),
+		ChatId:          c.Id,
+		SlowModeSeconds: slowModeSeconds,
+	})
+	return nil
+}
+
+func (c *Chat) Delete(ctx context.Context, ad *AdditionalData) error {
+	if err := c.requireExists(); err != nil {
+		return err
+	}
+	shouldContinue := true
+	for page := int64(0); shouldContinue; page++ {
+		participantIdsPortion, err := c.getParticipantIds(ctx, utils.DefaultSize, utils.GetOffset(page, utils.DefaultSize))
+		if err != nil {
+			return err
+		}
+		if len(participantIdsPortion) < utils.DefaultSize {
+			shouldContinue = false
+		}
+		if len(participantIdsPortion) > 0 {
+			c.record(&ParticipantDeleted{
+				AdditionalData: c.envelope(ad),
+				ParticipantIds: participantIdsPortion,
+				ChatId:         c.Id,
+			})
+		}
+	}
+	c.record(&ChatDeleted{
+		AdditionalData: c.chatEnvelope(ad),
+		ChatId:         c.Id,
+	})
+	return nil
+}
+
+// AddParticipants skips the already added participants and returns the rest of them
+func (c *Chat) AddParticipants(ctx context.Context, ad *AdditionalData, participantIds []int64) ([]int64, error) {
+	if err := c.requireExists(); err != nil {
+		return nil, err
+	}
+	newParticipantIds, err := c.filterParticipants(ctx, participantIds, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(newParticipantIds) > 0 {
+		c.record(&ParticipantsAdded{
+			AdditionalData: c.envelope(ad),
+			ParticipantIds: newParticipantIds,
+			ChatId:         c.Id,
+		})
+	}
+	return newParticipantIds, nil
+}
+
+// DeleteParticipants skips the non-participants and returns the rest of them
+func (c *Chat) DeleteParticipants(ctx context.Context, ad *AdditionalData, participantIds []int64) ([]int64, error) {
+	if err := c.requireExists(); err != nil {
+		return nil, err
+	}
+	existingParticipantIds, err := c.filterParticipants(ctx, participantIds, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(existingParticipantIds) > 0 {
+		c.record(&ParticipantDeleted{
+			AdditionalData: c.envelope(ad),
+			ParticipantIds: existingParticipantIds,
+			ChatId:         c.Id,
+		})
+	}
+	return existingParticipantIds, nil
+}
+
+// CheckParticipant is for the commands which change the participant's own state rather than the chat's,
+// so they don't need the version check
+func (c *Chat) CheckParticipant(ctx context.Context, userId int64) error {
+	if err := c.requireExists(); err != nil {
+		return err
+	}
+	return c.requireParticipant(ctx, userId)
+}
+
+// allocateMessageId returns generatedId if it's greater than the last message id of the chat, otherwise the next one after the last.
+// The generated ids of the different nodes are ordered only up to their clock skew, but the unread counters and the last message
+// rely on the ids of the chat being increasing in the order of the events.
+// The row is locked till the end of the command, so the concurrent creations of the same chat wait for each other
+func (c *Chat) allocateMessageId(ctx context.Context, generatedId int64) (int64, error) {
+	var messageId int64
+	err := c.co.QueryRowContext(ctx, `
+		insert into chat_aggregate_message_id(chat_id, last_id) values ($1, $2)
+		on conflict (chat_id) do update set last_id = greatest(chat_aggregate_message_id.last_id + 1, excluded.last_id)
+		returning last_id
+	`, c.Id, generatedId).Scan(&messageId)
+	return messageId, err
+}
+
+// CreateMessage returns the id of the message, which can differ from generatedId, see allocateMessageId
+func (c *Chat) CreateMessage(ctx context.Context, ad *AdditionalData, generatedId, ownerId int64, content string) (int64, error) {
+	if err := c.requireExists(); err != nil {
+		return 0, err
+	}
+	// the chat's row is locked before the participant's one, in the same order as the deletion of the chat does
+	if err := c.lockShared(ctx); err != nil {
+		return 0, err
+	}
+	if err := c.lockParticipant(ctx, ownerId); err != nil {
+		return 0, err
+	}
+	messageId, err := c.allocateMessageId(ctx, generatedId)
+	if err != nil {
+		return 0, err
+	}
+	envelope := c.envelope(ad)
+	envelope.MessageVersion = 1
+	c.record(&MessageCreated{
+		AdditionalData: envelope,
+		Id:             messageId,
+		OwnerId:        ownerId,
+		ChatId:         c.Id,
+		Content:        content,
+	})
+	return messageId, nil
+}
+
+// EditMessage rejects the edit which was made upon the stale version of the message, nil expectedVersion means no check.
+// It returns the new version of the message
+func (c *Chat) EditMessage(ctx context.Context, ad *AdditionalData, messageId, userId int64, content string, expectedVersion *int64) (int64, error) {
+	if err := c.requireExists(); err != nil {
+		return 0, err
+	}
+	version, err := c.requireMessageOwner(ctx, messageId, userId)
+	if err != nil {
+		return 0, err
+	}
+	if expectedVersion != nil && *expectedVersion != version {
+		return 0, NewConflictError("message %v in chat %v has version %v, expected %v", messageId, c.Id, version, *expectedVersion)
+	}
+	envelope := c.envelope(ad)
+	envelope.MessageVersion = version + 1
+	c.record(&MessageEdited{
+		AdditionalData: envelope,
+		ChatId:         c.Id,
+		Id:             messageId,
+		Content:        content,
+	})
+	return envelope.MessageVersion, nil
+}
+
+func (c *Chat) DeleteMessage(ctx context.Context, ad *AdditionalData, messageId, userId int64) error {
+	if err := c.requireExists(); err != nil {
+		return err
+	}
+	if _, err := c.requireMessageOwner(ctx, messageId, userId); err != nil {
+		return err
+	}
+	c.record(&MessageDeleted{
+		AdditionalData: c.envelope(ad),
+		ChatId:         c.Id,
+		MessageId:      messageId,
+	})
+	return nil
+}
+
+// ExpireMessages is for the retention, it skips the already deleted messages and returns the rest of them
+func (c *Chat) ExpireMessages(ctx context.Context, ad *AdditionalData, messageIds []int64) ([]int64, error) {
+	if err := c.requireExists(); err != nil {
+		return nil, err
+	}
+	existingMessageIds := []int64{}
+	for _, messageId := range messageIds {
+		_, _, err := c.requireMessage(ctx, messageId)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		existingMessageIds = append(existingMessageIds, messageId)
+		c.record(&MessageDeleted{
+			AdditionalData: c.envelope(ad),
+			ChatId:         c.Id,
+			MessageId:      messageId,
+		})
+	}
+	return existingMessageIds, nil
+}
+
+func (c *Chat) MakeBlogPost(ctx context.Context, ad *AdditionalData, messageId int64, blogPost bool) error {
+	if err := c.requireExists(); err != nil {
+		return err
+	}
+	if _, _, err := c.requireMessage(ctx, messageId); err != nil {
+		return err
+	}
+	c.record(&MessageBlogPostMade{
+		AdditionalData: c.envelope(ad),
+		ChatId:         c.Id,
+		MessageId:      messageId,
+		BlogPost:       blogPost,
+	})
+	return nil
+}
+
+// refreshViews records ChatViewRefreshed for every portion of the participants, except excluding ones, derived from the first recorded event.
+// The participants are read from the projection on the command's transaction, so the refreshes are written into the outbox
+// together with the events they are derived from and can't be lost after the commit. It does nothing when nothing is recorded
+func (c *Chat) refreshViews(ctx context.Context, commonProjection *CommonProjection, excluding []int64, refresh func(participantIdsPortion []int64) *ChatViewRefreshed) error {
+	cause := c.Cause()
+	if cause == nil {
+		return nil
+	}
+	return commonProjection.IterateOverChatParticipantIds(ctx, c.co, c.Id, excluding, func(participantIdsPortion []int64) error {
+		ui := refresh(participantIdsPortion)
+		ui.AdditionalData = cause.Derived()
+		c.record(ui)
+		return nil
+	})
+}
+
+type ChatRepository struct {
+	lgr         *logger.LoggerWrapper
+	dba         *db.DB
+	maxAttempts int
+}
+
+func ConfigureChatRepository(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+) *ChatRepository {
+	return &ChatRepository{
+		lgr:         lgr,
+		dba:         dba,
+		maxAttempts: max(cfg.CqrsConfig.ChatAggregateConfig.MaxAttempts, 1),
+	}
+}
+
+func (r *ChatRepository) load(ctx context.Context, co db.CommonOperations, chatId int64) (*Chat, error) {
+	chat := &Chat{Id: chatId, co: co}
+	err := co.QueryRowContext(ctx, "select version, deleted from chat_aggregate where id = $1", chatId).Scan(&chat.Version, &chat.Deleted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// Load is for the checks which don't record anything
+func (r *ChatRepository) Load(ctx context.Context, chatId int64) (*Chat, error) {
+	return r.load(ctx, r.dba, chatId)
+}
+
+// save applies the recorded events to the aggregate's tables, if the chat or the edited message was saved by someone else since it was loaded,
+// then it returns errConcurrentModification
+func (r *ChatRepository) save(ctx context.Context, tx *db.Tx, chat *Chat) error {
+	var res sql.Result
+	var err error
+	newVersion := chat.Version
+	if chat.versionChanged {
+		newVersion++
+	}
+	deleted := chat.Deleted
+	for _, event := range chat.changes {
+		if _, ok := event.(*ChatDeleted); ok {
+			deleted = true
+		}
+	}
+
+	if chat.Version == 0 {
+		res, err = tx.ExecContext(ctx, "insert into chat_aggregate(id, version, deleted) values ($1, $2, $3) on conflict (id) do nothing", chat.Id, newVersion, deleted)
+	} else if chat.versionChanged {
+		res, err = tx.ExecContext(ctx, "update chat_aggregate set version = $3, deleted = $4 where id = $1 and version = $2", chat.Id, chat.Version, newVersion, deleted)
+	} else {
+		err = chat.lockShared(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return errConcurrentModification
+		}
+	}
+
+	for _, event := range chat.changes {
+		if e, ok := event.(*MessageEdited); ok {
+			err = r.saveMessageVersion(ctx, tx, chat.Id, e.Id, e.AdditionalData.MessageVersion)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		switch e := event.(type) {
+		case *ParticipantsAdded:
+			_, err = tx.ExecContext(ctx, "insert into chat_aggregate_participant(chat_id, user_id) select $1, unnest(cast($2 as bigint[])) on conflict do nothing", chat.Id, e.ParticipantIds)
+		case *ParticipantDeleted:
+			_, err = tx.ExecContext(ctx, "delete from chat_aggregate_participant where chat_id = $1 and user_id = any($2)", chat.Id, e.ParticipantIds)
+		case *MessageCreated:
+			_, err = tx.ExecContext(ctx, "insert into chat_aggregate_message(chat_id, id, owner_id, version) values ($1, $2, $3, $4)", chat.Id, e.Id, e.OwnerId, e.AdditionalData.MessageVersion)
+		case *MessageDeleted:
+			_, err = tx.ExecContext(ctx, "delete from chat_aggregate_message where (chat_id, id) = ($1, $2)", chat.Id, e.MessageId)
+		case *ChatDeleted:
+			_, err = tx.ExecContext(ctx, "delete from chat_aggregate_message where chat_id = $1", chat.Id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	chat.Version = newVersion
+	chat.Deleted = deleted
+	return nil
+}
+
+// saveMessageVersion returns errConcurrentModification if the message was edited by someone else since it was read
+func (r *ChatRepository) saveMessageVersion(ctx context.Context, tx *db.Tx, chatId, messageId, newVersion int64) error {
+	res, err := tx.ExecContext(ctx, "update chat_aggregate_message set version = $3 where (chat_id, id) = ($1, $2) and version = $3 - 1", chatId, messageId, newVersion)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errConcurrentModification
+	}
+	return nil
+}
+
+// Execute loads the chat, runs the command, saves the recorded events and writes them into the outbox in one transaction,
+// including the refreshes of the participants' views, see refreshViews, then sends them after the commit. If the sending fails, they are sent by RunOutboxRelay, so kafka gets exactly the saved events.
+// On the concurrent modification the command is repeated on the fresh state of the chat, up to cqrs.chatAggregate.maxAttempts times.
+func (r *ChatRepository) Execute(ctx context.Context, eventBus EventBusInterface, chatId int64, command func(chat *Chat) error) (*Chat, error) {
+	for attempt := 1; ; attempt++ {
+		chat, err := db.TransactWithResult(ctx, r.dba, func(tx *db.Tx) (*Chat, error) {
+			chat, err := r.load(ctx, tx, chatId)
+			if err != nil {
+				return nil, err
+			}
+			err = command(chat)
+			if err != nil {
+				return nil, err
+			}
+			if len(chat.changes) == 0 {
+				return chat, nil
+			}
+
+			err = r.save(ctx, tx, chat)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, event := range chat.changes {
+				err = eventBus.Publish(WithTx(ctx, tx), event)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return chat, nil
+		})
+		if errors.Is(err, errConcurrentModification) {
+			if attempt < r.maxAttempts {
+				r.lgr.WithTrace(ctx).Info("Chat was modified concurrently, retrying", "chat_id", chatId, "attempt", attempt)
+				continue
+			}
+			return nil, NewConflictError("chat %v was modified concurrently", chatId)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(chat.changes) > 0 {
+			markCommitted(ctx)
+			eventBus.Flush(ctx, chatId)
+		}
+		return chat, nil
+	}
+}
+
+// InitializeChatAggregatesIfNeed fills the aggregates from the projections, e. g. after import.
+// The version continues from the replayed one, so If-Match with the version shown by the chat search still matches
+func (r *ChatRepository) InitializeChatAggregatesIfNeed(ctx context.Context, tx *db.Tx) error {
+	_, err := tx.ExecContext(ctx, "insert into chat_aggregate(id, version) select id, greatest(version, 1) from chat_common on conflict (id) do nothing")
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert into chat_aggregate_participant(chat_id, user_id) select chat_id, user_id from chat_participant on conflict do nothing")
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert into chat_aggregate_message(chat_id, id, owner_id, version) select chat_id, id, owner_id, coalesce(version, 1) from message on conflict do nothing")
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		insert into chat_aggregate_message_id(chat_id, last_id)
+		select chat_id, max(id) from message group by chat_id
+		on conflict (chat_id) do update set last_id = greatest(chat_aggregate_message_id.last_id, excluded.last_id)
+	`)
+	return err
+}
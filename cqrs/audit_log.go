@@ -0,0 +1,188 @@
+package cqrs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jackc/pgtype"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"time"
+)
+
+type AuditLogEntry struct {
+	Id             int64           `json:"id"`
+	EventId        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	ChatId         *int64          `json:"chatId"`
+	ActorId        *int64          `json:"actorId"`
+	TargetIds      []int64         `json:"targetIds"`
+	CorrelationId  *string         `json:"correlationId"`
+	Data           json.RawMessage `json:"data"`
+	CreateDateTime time.Time       `json:"createDateTime"`
+}
+
+type AuditLogFilter struct {
+	ChatId    *int64
+	ActorId   *int64
+	EventType *string
+	From      *time.Time // inclusive
+	To        *time.Time // exclusive
+}
+
+// AuditLogProjection records who did what with the chats.
+// It has its own consumer group, so it can be rebuilt from the topic without touching the common projection.
+type AuditLogProjection struct {
+	db            *db.DB
+	lgr           *logger.LoggerWrapper
+	cqrsMarshaler *CqrsMarshalerDecorator
+}
+
+func ConfigureAuditLogProjection(
+	dba *db.DB,
+	lgr *logger.LoggerWrapper,
+	cqrsMarshaler *CqrsMarshalerDecorator,
+) *AuditLogProjection {
+	return &AuditLogProjection{
+		db:            dba,
+		lgr:           lgr,
+		cqrsMarshaler: cqrsMarshaler,
+	}
+}
+
+// RegisterAuditLogHandler should be invoked before RunCqrsRouter
+func RegisterAuditLogHandler(
+	cfg *config.AppConfig,
+	cqrsRouter *message.Router,
+	watermillLoggerAdapter watermill.LoggerAdapter,
+	kafkaMarshaler kafka.MarshalerUnmarshaler,
+	auditLogProjection *AuditLogProjection,
+) error {
+	subscriber, err := newKafkaSubscriber(cfg, watermillLoggerAdapter, kafkaMarshaler, cfg.CqrsConfig.AuditLogConfig.ConsumerGroup, nil)
+	if err != nil {
+		return err
+	}
+
+	cqrsRouter.AddNoPublisherHandler(
+		cfg.CqrsConfig.AuditLogConfig.ConsumerGroup,
+		cfg.KafkaConfig.Topic,
+		subscriber,
+		auditLogProjection.OnEvent,
+	)
+	return nil
+}
+
+// auditedEvent has the fields of all the events, which say what the event is about
+type auditedEvent struct {
+	AdditionalData *AdditionalData `json:"additionalData"`
+	ChatId         *int64          `json:"chatId"`
+	ParticipantId  *int64          `json:"participantId"`
+	ParticipantIds []int64         `json:"participantIds"`
+	Id             *int64          `json:"id"` // message id of MessageCreated and MessageEdited
+	MessageId      *int64          `json:"messageId"`
+}
+
+func (e *auditedEvent) targetIds() []int64 {
+	ret := []int64{}
+	ret = append(ret, e.ParticipantIds...)
+	for _, id := range []*int64{e.ParticipantId, e.Id, e.MessageId} {
+		if id != nil {
+			ret = append(ret, *id)
+		}
+	}
+	return ret
+}
+
+func isAudited(eventType string) bool {
+	// ChatViewRefreshed is a technical event which only fans out the changes to the participants' views
+	return eventType != (&ChatViewRefreshed{}).Name()
+}
+
+func (m *AuditLogProjection) OnEvent(msg *message.Message) error {
+	ctx := msg.Context()
+
+	eventType := m.cqrsMarshaler.NameFromMessage(msg)
+	if !isAudited(eventType) {
+		return nil
+	}
+
+	var ae auditedEvent
+	err := json.Unmarshal(msg.Payload, &ae)
+	if err != nil {
+		m.lgr.WithTrace(ctx).Error("Unable to parse the event, skipping", "event_type", eventType, "err", err)
+		return nil
+	}
+
+	var actorId *int64
+	var correlationId *string
+	createdAt := time.Now().UTC()
+	if ts, ok := kafka.MessageTimestampFromCtx(ctx); ok {
+		createdAt = ts.UTC()
+	}
+	if ae.AdditionalData != nil {
+		if ae.AdditionalData.ActorId != 0 {
+			actorId = &ae.AdditionalData.ActorId
+		}
+		if ae.AdditionalData.CorrelationId != "" {
+			correlationId = &ae.AdditionalData.CorrelationId
+		}
+		if !ae.AdditionalData.CreatedAt.IsZero() {
+			createdAt = ae.AdditionalData.CreatedAt.UTC()
+		}
+	}
+
+	// the uniqueness of the event id makes the insertion idempotent in case kafka redelivers the message or the log is rebuilt
+	_, err = m.db.ExecContext(ctx, `
+		insert into audit_log(event_id, event_type, chat_id, actor_id, target_ids, correlation_id, payload, create_date_time)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		on conflict(event_id) do nothing
+	`, msg.UUID, eventType, ae.ChatId, actorId, ae.targetIds(), correlationId, string(msg.Payload), createdAt)
+	return err
+}
+
+// GetAuditLog returns the newest entries first, nil fields of the filter match everything
+func (m *AuditLogProjection) GetAuditLog(ctx context.Context, filter AuditLogFilter, size int32, offset int64) ([]AuditLogEntry, error) {
+	ma := []AuditLogEntry{}
+	rows, err := m.db.QueryContext(ctx, `
+		select a.id, a.event_id, a.event_type, a.chat_id, a.actor_id, a.target_ids, a.correlation_id, a.payload, a.create_date_time
+		from audit_log a
+		where ($1::bigint is null or a.chat_id = $1)
+			and ($2::bigint is null or a.actor_id = $2)
+			and ($3::varchar is null or a.event_type = $3)
+			and ($4::timestamp is null or a.create_date_time >= $4)
+			and ($5::timestamp is null or a.create_date_time < $5)
+		order by a.create_date_time desc, a.id desc
+		limit $6 offset $7
+	`, filter.ChatId, filter.ActorId, filter.EventType, utcOrNil(filter.From), utcOrNil(filter.To), size, offset)
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ae AuditLogEntry
+		var targetIds = pgtype.Int8Array{}
+		var payload string
+		err = rows.Scan(&ae.Id, &ae.EventId, &ae.EventType, &ae.ChatId, &ae.ActorId, &targetIds, &ae.CorrelationId, &payload, &ae.CreateDateTime)
+		if err != nil {
+			return ma, err
+		}
+		ae.TargetIds = []int64{}
+		for _, targetId := range targetIds.Elements {
+			ae.TargetIds = append(ae.TargetIds, targetId.Int)
+		}
+		ae.Data = json.RawMessage(payload)
+		ma = append(ma, ae)
+	}
+	return ma, nil
+}
+
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
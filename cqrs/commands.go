@@ -2,8 +2,6 @@ package cqrs
 
 import (
 	"context"
-	"fmt"
-	"go-cqrs-chat-example/db"
 )
 
 type ChatCreate struct {
@@ -17,7 +15,20 @@ type ChatEdit struct {
 	AdditionalData      *AdditionalData
 	Title               string
 	ParticipantIdsToAdd []int64
-	Blog                bool // desired state
+	Blog                bool   // desired state
+	ExpectedVersion     *int64 // nil means last write wins
+}
+
+type ChatRetentionEdit struct {
+	ChatId           int64
+	AdditionalData   *AdditionalData
+	RetentionSeconds int64
+}
+
+type ChatSlowModeEdit struct {
+	ChatId          int64
+	AdditionalData  *AdditionalData
+	SlowModeSeconds int64
 }
 
 type ChatDelete struct {
@@ -45,10 +56,11 @@ type MessageCreate struct {
 }
 
 type MessageEdit struct {
-	AdditionalData *AdditionalData
-	ChatId         int64
-	MessageId      int64
-	Content        string
+	AdditionalData  *AdditionalData
+	ChatId          int64
+	MessageId       int64
+	Content         string
+	ExpectedVersion *int64 // of the message, nil means last write wins
 }
 
 type MessageDelete struct {
@@ -78,27 +90,15 @@ type MakeMessageBlogPost struct {
 	BlogPost       bool
 }
 
-func (s *ChatCreate) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection) (int64, error) {
-	chatId, err := db.TransactWithResult(ctx, dba, func(tx *db.Tx) (int64, error) {
-		return commonProjection.GetNextChatId(ctx, tx)
-	})
-
-	cc := &ChatCreated{
-		AdditionalData: s.AdditionalData,
-		ChatId:         chatId,
-		Title:          s.Title,
-	}
-	err = eventBus.Publish(ctx, cc)
+func (s *ChatCreate) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, idGenerator IdGenerator) (int64, error) {
+	chatId, err := idGenerator.NextChatId(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	pa := &ParticipantsAdded{
-		AdditionalData: s.AdditionalData,
-		ParticipantIds: s.ParticipantIds,
-		ChatId:         chatId,
-	}
-	err = eventBus.Publish(ctx, pa)
+	_, err = chatRepository.Execute(ctx, eventBus, chatId, func(chat *Chat) error {
+		return chat.Create(s.AdditionalData, s.Title, s.ParticipantIds)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -106,145 +106,108 @@ func (s *ChatCreate) Handle(ctx context.Context, eventBus EventBusInterface, dba
 	return chatId, nil
 }
 
-func (s *ChatEdit) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection) error {
-	cc := &ChatEdited{
-		AdditionalData: s.AdditionalData,
-		ChatId:         s.ChatId,
-		Title:          s.Title,
-		Blog:           s.Blog,
-	}
-	err := eventBus.Publish(ctx, cc)
-	if err != nil {
-		return err
-	}
-
-	if len(s.ParticipantIdsToAdd) > 0 {
-		pa := &ParticipantsAdded{
-			AdditionalData: s.AdditionalData,
-			ParticipantIds: s.ParticipantIdsToAdd,
-			ChatId:         s.ChatId,
+// Handle returns the new version of the chat
+func (s *ChatEdit) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection) (int64, error) {
+	chat, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		cerr := chat.CheckVersion(s.ExpectedVersion)
+		if cerr != nil {
+			return cerr
 		}
-		err = eventBus.Publish(ctx, pa)
-		if err != nil {
-			return err
-		}
-	}
-
-	errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, nil, func(participantIdsPortion []int64) error {
-		ui := &ChatViewRefreshed{
-			AdditionalData:   s.AdditionalData,
-			ParticipantIds:   participantIdsPortion,
-			ChatId:           s.ChatId,
-			ChatCommonAction: ChatCommonActionRefresh,
-			Title:            s.Title,
-		}
-
-		if len(s.ParticipantIdsToAdd) > 0 {
-			ui.ParticipantsAction = ParticipantsActionRefresh
+		addedParticipantIds, cerr := chat.Edit(ctx, s.AdditionalData, s.Title, s.Blog, s.ParticipantIdsToAdd)
+		if cerr != nil {
+			return cerr
 		}
+		return chat.refreshViews(ctx, commonProjection, nil, func(participantIdsPortion []int64) *ChatViewRefreshed {
+			ui := &ChatViewRefreshed{
+				ParticipantIds:   participantIdsPortion,
+				ChatId:           s.ChatId,
+				ChatCommonAction: ChatCommonActionRefresh,
+				Title:            s.Title,
+			}
 
-		errInner := eventBus.Publish(ctx, ui)
-		if errInner != nil {
-			return errInner
-		}
-		return nil
+			if len(addedParticipantIds) > 0 {
+				ui.ParticipantsAction = ParticipantsActionRefresh
+			}
+			return ui
+		})
 	})
+	if err != nil {
+		return 0, err
+	}
 
-	return errOuter
+	return chat.Version, nil
 }
 
-func (s *ChatDelete) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection) error {
-	errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, nil, func(participantIdsPortion []int64) error {
-		pa := &ParticipantDeleted{
-			AdditionalData: s.AdditionalData,
-			ParticipantIds: participantIdsPortion,
-			ChatId:         s.ChatId,
-		}
-		errInner := eventBus.Publish(ctx, pa)
-		return errInner
-
+func (s *ChatRetentionEdit) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, userId int64) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		return chat.EditRetention(ctx, s.AdditionalData, userId, s.RetentionSeconds)
 	})
-	if errOuter != nil {
-		return errOuter
-	}
+	return err
+}
 
-	cc := &ChatDeleted{
-		AdditionalData: s.AdditionalData,
-		ChatId:         s.ChatId,
-	}
-	err := eventBus.Publish(ctx, cc)
-	if err != nil {
-		return err
-	}
-	return nil
+func (s *ChatSlowModeEdit) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, userId int64) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		return chat.EditSlowMode(ctx, s.AdditionalData, userId, s.SlowModeSeconds)
+	})
+	return err
 }
 
-func (s *ParticipantAdd) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection) error {
-	pa := &ParticipantsAdded{
-		AdditionalData: s.AdditionalData,
-		ParticipantIds: s.ParticipantIds,
-		ChatId:         s.ChatId,
-	}
-	err := eventBus.Publish(ctx, pa)
-	if err != nil {
-		return err
-	}
+func (s *ChatDelete) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		return chat.Delete(ctx, s.AdditionalData)
+	})
+	return err
+}
 
-	// excluding => s.ParticipantIds is an optimization in order not to re-refresh views for the recently added
-	errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, s.ParticipantIds, func(participantIdsPortion []int64) error {
-		if len(participantIdsPortion) > 0 {
-			ui := &ChatViewRefreshed{
-				AdditionalData:     s.AdditionalData,
+func (s *ParticipantAdd) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		addedParticipantIds, cerr := chat.AddParticipants(ctx, s.AdditionalData, s.ParticipantIds)
+		if cerr != nil {
+			return cerr
+		}
+		// excluding => addedParticipantIds is an optimization in order not to re-refresh views for the recently added
+		return chat.refreshViews(ctx, commonProjection, addedParticipantIds, func(participantIdsPortion []int64) *ChatViewRefreshed {
+			return &ChatViewRefreshed{
 				ParticipantIds:     participantIdsPortion, // chat_user_views for newly added participants will be created from scratch including already added, see ParticipantsAdded handler
 				ChatId:             s.ChatId,
 				ParticipantsAction: ParticipantsActionRefresh,
 			}
-			errInner := eventBus.Publish(ctx, ui)
-			if errInner != nil {
-				return errInner
-			}
-		}
-		return nil
+		})
 	})
-
-	return errOuter
+	return err
 }
 
-func (s *ParticipantDelete) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection) error {
-	pa := &ParticipantDeleted{
-		AdditionalData: s.AdditionalData,
-		ParticipantIds: s.ParticipantIds,
-		ChatId:         s.ChatId,
-	}
-	err := eventBus.Publish(ctx, pa)
-	if err != nil {
-		return err
-	}
-
-	// excluding => s.ParticipantIds is an optimization - we don't need to refresh views for deleted participants
-	errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, s.ParticipantIds, func(participantIdsPortion []int64) error {
-		if len(participantIdsPortion) > 0 {
-			ui := &ChatViewRefreshed{
-				AdditionalData:     s.AdditionalData,
+func (s *ParticipantDelete) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		deletedParticipantIds, cerr := chat.DeleteParticipants(ctx, s.AdditionalData, s.ParticipantIds)
+		if cerr != nil {
+			return cerr
+		}
+		// excluding => deletedParticipantIds is an optimization - we don't need to refresh views for deleted participants
+		return chat.refreshViews(ctx, commonProjection, deletedParticipantIds, func(participantIdsPortion []int64) *ChatViewRefreshed {
+			return &ChatViewRefreshed{
 				ParticipantIds:     participantIdsPortion,
 				ChatId:             s.ChatId,
 				ParticipantsAction: ParticipantsActionRefresh,
 			}
-			errInner := eventBus.Publish(ctx, ui)
-			if errInner != nil {
-				return errInner
-			}
-			return nil
-		}
-		return nil
+		})
 	})
-
-	return errOuter
+	return err
 }
 
-func (s *ChatPin) Handle(ctx context.Context, eventBus EventBusInterface) error {
+// ChatPin changes only the participant's own state, so it doesn't bump the chat's version
+func (s *ChatPin) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository) error {
+	chat, err := chatRepository.Load(ctx, s.ChatId)
+	if err != nil {
+		return err
+	}
+	err = chat.CheckParticipant(ctx, s.ParticipantId)
+	if err != nil {
+		return err
+	}
+
 	cp := &ChatPinned{
-		AdditionalData: s.AdditionalData,
+		AdditionalData: s.AdditionalData.ForEvent(),
 		ParticipantId:  s.ParticipantId,
 		ChatId:         s.ChatId,
 		Pinned:         s.Pin,
@@ -252,57 +215,51 @@ func (s *ChatPin) Handle(ctx context.Context, eventBus EventBusInterface) error
 	return eventBus.Publish(ctx, cp)
 }
 
-func (s *MessageCreate) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection) (int64, bool, error) {
-	messageId, err := db.TransactWithResult(ctx, dba, func(tx *db.Tx) (int64, error) {
-		return commonProjection.GetNextMessageId(ctx, tx, s.ChatId)
-	})
+func (s *MessageCreate) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection, idGenerator IdGenerator) (int64, error) {
+	generatedId, err := idGenerator.NextMessageId(ctx, s.ChatId)
 	if err != nil {
-		return 0, false, err
-	}
-
-	if messageId == ChatStillNotExists {
-		return 0, false, nil
-	}
-
-	mc := &MessageCreated{
-		AdditionalData: s.AdditionalData,
-		Id:             messageId,
-		OwnerId:        s.OwnerId,
-		ChatId:         s.ChatId,
-		Content:        s.Content,
+		return 0, err
 	}
 
-	err = eventBus.Publish(ctx, mc)
-	if err != nil {
-		return 0, false, err
+	if generatedId == ChatStillNotExists {
+		return 0, NewNotFoundError("chat %v", s.ChatId)
 	}
 
-	errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, nil, func(participantIdsPortion []int64) error {
-		ui := &ChatViewRefreshed{
-			AdditionalData:       s.AdditionalData,
-			ParticipantIds:       participantIdsPortion,
-			ChatId:               s.ChatId,
-			UnreadMessagesAction: UnreadMessagesActionIncrease,
-			IncreaseOn:           1,
-			OwnerId:              s.OwnerId,
-			LastMessageAction:    LastMessageActionRefresh,
+	var messageId int64
+	_, err = chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		var cerr error
+		messageId, cerr = chat.CreateMessage(ctx, s.AdditionalData, generatedId, s.OwnerId, s.Content)
+		if cerr != nil {
+			return cerr
 		}
-
-		errInner := eventBus.Publish(ctx, ui)
-		if errInner != nil {
-			return errInner
-		}
-		return nil
+		return chat.refreshViews(ctx, commonProjection, nil, func(participantIdsPortion []int64) *ChatViewRefreshed {
+			return &ChatViewRefreshed{
+				ParticipantIds:       participantIdsPortion,
+				ChatId:               s.ChatId,
+				UnreadMessagesAction: UnreadMessagesActionIncrease,
+				IncreaseOn:           1,
+				OwnerId:              s.OwnerId,
+				LastMessageAction:    LastMessageActionRefresh,
+			}
+		})
 	})
-
-	if errOuter != nil {
-		return 0, false, errOuter
+	if err != nil {
+		return 0, err
 	}
 
-	return messageId, true, nil
+	return messageId, nil
 }
 
-func (s *MessageRead) Handle(ctx context.Context, eventBus EventBusInterface, commonProjection *CommonProjection) error {
+// MessageRead changes only the participant's own state, so it doesn't bump the chat's version
+func (s *MessageRead) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection) error {
+	chat, err := chatRepository.Load(ctx, s.ChatId)
+	if err != nil {
+		return err
+	}
+	err = chat.CheckParticipant(ctx, s.ParticipantId)
+	if err != nil {
+		return err
+	}
 
 	lastMessageReadedId, lastMessgeReadedExists, maxMessageId, err := commonProjection.GetLastMessageReaded(ctx, s.ChatId, s.ParticipantId)
 	if err != nil {
@@ -317,7 +274,7 @@ func (s *MessageRead) Handle(ctx context.Context, eventBus EventBusInterface, co
 
 	if (lastMessgeReadedExists && messageIdToMark > lastMessageReadedId) || (!lastMessgeReadedExists && lastMessageReadedId == 0) {
 		cp := &MessageReaded{
-			AdditionalData: s.AdditionalData,
+			AdditionalData: s.AdditionalData.ForEvent(),
 			ParticipantId:  s.ParticipantId,
 			ChatId:         s.ChatId,
 			MessageId:      messageIdToMark,
@@ -328,99 +285,64 @@ func (s *MessageRead) Handle(ctx context.Context, eventBus EventBusInterface, co
 	return nil
 }
 
-func (s *MakeMessageBlogPost) Handle(ctx context.Context, eventBus EventBusInterface) error {
-	ev := MessageBlogPostMade{
-		AdditionalData: s.AdditionalData,
-		ChatId:         s.ChatId,
-		MessageId:      s.MessageId,
-		BlogPost:       s.BlogPost,
-	}
-
-	return eventBus.Publish(ctx, &ev)
+func (s *MakeMessageBlogPost) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		return chat.MakeBlogPost(ctx, s.AdditionalData, s.MessageId, s.BlogPost)
+	})
+	return err
 }
 
-func (s *MessageDelete) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection, userId int64) error {
-
-	ownerId, err := commonProjection.GetMessageOwner(ctx, s.ChatId, s.MessageId)
-	if err != nil {
-		return err
-	}
-
-	if ownerId != userId {
-		return fmt.Errorf("User %v is not an owner of message %v in chat %v", userId, s.MessageId, s.ChatId)
-	}
-
-	cp := &MessageDeleted{
-		AdditionalData: s.AdditionalData,
-		ChatId:         s.ChatId,
-		MessageId:      s.MessageId,
-	}
-	err = eventBus.Publish(ctx, cp)
-	if err != nil {
-		return err
-	}
+func (s *MessageDelete) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection, userId int64) error {
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		cerr := chat.DeleteMessage(ctx, s.AdditionalData, s.MessageId, userId)
+		if cerr != nil {
+			return cerr
+		}
+		return refreshViewsAfterMessagesDeleted(ctx, chat, commonProjection)
+	})
+	return err
+}
 
-	errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, nil, func(participantIdsPortion []int64) error {
-		ui := &ChatViewRefreshed{
-			AdditionalData:       s.AdditionalData,
+// refreshViewsAfterMessagesDeleted is shared between the user's deletion and the retention job
+// so both of them leave unread counters, the last message and blog in the same state
+func refreshViewsAfterMessagesDeleted(ctx context.Context, chat *Chat, commonProjection *CommonProjection) error {
+	return chat.refreshViews(ctx, commonProjection, nil, func(participantIdsPortion []int64) *ChatViewRefreshed {
+		return &ChatViewRefreshed{
 			ParticipantIds:       participantIdsPortion,
-			ChatId:               s.ChatId,
+			ChatId:               chat.Id,
 			UnreadMessagesAction: UnreadMessagesActionRefresh,
-			OwnerId:              userId,
 			LastMessageAction:    LastMessageActionRefresh,
 		}
-
-		errInner := eventBus.Publish(ctx, ui)
-		if errInner != nil {
-			return errInner
-		}
-		return nil
 	})
-
-	return errOuter
 }
 
-func (s *MessageEdit) Handle(ctx context.Context, eventBus EventBusInterface, dba *db.DB, commonProjection *CommonProjection, userId int64) error {
-	ownerId, err := commonProjection.GetMessageOwner(ctx, s.ChatId, s.MessageId)
-	if err != nil {
-		return err
-	}
-
-	if ownerId != userId {
-		return fmt.Errorf("User %v is not an owner of message %v in chat %v", userId, s.MessageId, s.ChatId)
-	}
-
-	cp := &MessageEdited{
-		AdditionalData: s.AdditionalData,
-		ChatId:         s.ChatId,
-		Id:             s.MessageId,
-		Content:        s.Content,
-	}
-	err = eventBus.Publish(ctx, cp)
-	if err != nil {
-		return err
-	}
-
-	lastMessageId, err := commonProjection.GetLastMessageId(ctx, s.ChatId)
-	if lastMessageId == s.MessageId {
+// Handle returns the new version of the message
+func (s *MessageEdit) Handle(ctx context.Context, eventBus EventBusInterface, chatRepository *ChatRepository, commonProjection *CommonProjection, userId int64) (int64, error) {
+	var version int64
+	_, err := chatRepository.Execute(ctx, eventBus, s.ChatId, func(chat *Chat) error {
+		var cerr error
+		version, cerr = chat.EditMessage(ctx, s.AdditionalData, s.MessageId, userId, s.Content, s.ExpectedVersion)
+		if cerr != nil {
+			return cerr
+		}
+		lastMessageId, cerr := commonProjection.GetLastMessageId(ctx, s.ChatId)
+		if cerr != nil {
+			return cerr
+		}
+		if lastMessageId != s.MessageId {
+			return nil
+		}
 		// if it's the last chat message then update ChatView
-		errOuter := commonProjection.IterateOverChatParticipantIds(ctx, dba, s.ChatId, nil, func(participantIdsPortion []int64) error {
-			ui := &ChatViewRefreshed{
-				AdditionalData:    s.AdditionalData,
+		return chat.refreshViews(ctx, commonProjection, nil, func(participantIdsPortion []int64) *ChatViewRefreshed {
+			return &ChatViewRefreshed{
 				ParticipantIds:    participantIdsPortion,
 				ChatId:            s.ChatId,
 				LastMessageAction: LastMessageActionRefresh,
 			}
-
-			errInner := eventBus.Publish(ctx, ui)
-			if errInner != nil {
-				return errInner
-			}
-			return nil
 		})
-		if errOuter != nil {
-			return errOuter
-		}
+	})
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return version, nil
 }
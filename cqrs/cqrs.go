@@ -81,6 +81,10 @@ func ConfigureCqrsRouter(
 	propagator propagation.TextMapPropagator,
 	tp *sdktrace.TracerProvider,
 	cfg *config.AppConfig,
+	sequenceChecker *SequenceChecker,
+	projectionProgressRecorder *ProjectionProgressRecorder,
+	projectionSwitch *ProjectionSwitch,
+	cqrsMarshaler *CqrsMarshalerDecorator,
 	lc fx.Lifecycle,
 ) (*message.Router, error) {
 	// CQRS is built on messages router. Detailed documentation: https://watermill.io/docs/messages-router/
@@ -91,6 +95,11 @@ func ConfigureCqrsRouter(
 
 	tr := tp.Tracer("chat-subscriber")
 
+	handlerMetrics, err := newHandlerMetricsMiddleware(cqrsMarshaler)
+	if err != nil {
+		return nil, err
+	}
+
 	// Simple middleware which will recover panics from event or command handlers.
 	// More about router middlewares you can find in the documentation:
 	// https://watermill.io/docs/messages-router/#middleware
@@ -98,6 +107,13 @@ func ConfigureCqrsRouter(
 	// List of available middlewares you can find in message/router/middleware.
 	cqrsRouter.AddMiddleware(middleware.Recoverer)
 	cqrsRouter.AddMiddleware(wotel.Trace(wotel.WithTextMapPropagator(propagator), wotel.WithTracer(tr)))
+	// before the metrics and the progress, the skipped events aren't counted as handled
+	cqrsRouter.AddMiddleware(projectionSwitch.Middleware)
+	// the waiting for the chat projection isn't counted as handling either
+	cqrsRouter.AddMiddleware(sequenceChecker.ChatProjectionMiddleware)
+	cqrsRouter.AddMiddleware(handlerMetrics)
+	cqrsRouter.AddMiddleware(projectionProgressRecorder.Middleware)
+	cqrsRouter.AddMiddleware(sequenceChecker.Middleware)
 	cqrsRouter.AddMiddleware(func(h message.HandlerFunc) message.HandlerFunc {
 		return func(msg *message.Message) ([]*message.Message, error) {
 			if cfg.CqrsConfig.SleepBeforeEvent > 0 {
@@ -161,11 +177,15 @@ func ConfigureCqrsMarshaller() *CqrsMarshalerDecorator {
 func ConfigureEventBus(
 	lgr *logger.LoggerWrapper,
 	cfg *config.AppConfig,
-	publisher message.Publisher,
+	propagator propagation.TextMapPropagator,
+	outbox *Outbox,
 	cqrsMarshaler *CqrsMarshalerDecorator,
 	watermillLoggerAdapter watermill.LoggerAdapter,
+	dba *db.DB,
+	replayStop *ReplayStop,
 ) (*PartitionAwareEventBus, error) {
-	eventBusRoot, err := cqrs.NewEventBusWithConfig(publisher, cqrs.EventBusConfig{
+	// the events are sent by the outbox after the commit
+	eventBusRoot, err := cqrs.NewEventBusWithConfig(&outboxPublisher{propagator: propagator}, cqrs.EventBusConfig{
 		GeneratePublishTopic: func(params cqrs.GenerateEventPublishTopicParams) (string, error) {
 			// We are using one topic for all events to maintain the order of events.
 			return cfg.KafkaConfig.Topic, nil
@@ -173,11 +193,14 @@ func ConfigureEventBus(
 		Marshaler: cqrsMarshaler,
 		Logger:    watermillLoggerAdapter,
 		OnPublish: func(params cqrs.OnEventSendParams) error {
+			setChatSequenceMetadata(params.Message)
+			setEnvelopeMetadata(params.Message, params.Event)
+
 			if cfg.CqrsConfig.Dump {
 				if cfg.CqrsConfig.PrettyLog {
-					fmt.Printf("[kafka publisher] Sending message: trace_id=%s, metadata=%v, body: %v\n", logger.GetTraceId(params.Message.Context()), params.Message.Metadata, string(params.Message.Payload))
+					fmt.Printf("[kafka publisher] Writing message into the outbox: trace_id=%s, metadata=%v, body: %v\n", logger.GetTraceId(params.Message.Context()), params.Message.Metadata, string(params.Message.Payload))
 				} else {
-					lgr.Info(fmt.Sprintf("[kafka publisher] Sending message: trace_id=%s, metadata=%v, body: %v\n", logger.GetTraceId(params.Message.Context()), params.Message.Metadata, string(params.Message.Payload)))
+					lgr.Info(fmt.Sprintf("[kafka publisher] Writing message into the outbox: trace_id=%s, metadata=%v, body: %v\n", logger.GetTraceId(params.Message.Context()), params.Message.Metadata, string(params.Message.Payload)))
 				}
 			}
 			return nil
@@ -187,17 +210,16 @@ func ConfigureEventBus(
 		return nil, err
 	}
 
-	return &PartitionAwareEventBus{eventBusRoot}, nil
+	return &PartitionAwareEventBus{lgr: lgr, eventBus: eventBusRoot, dba: dba, outbox: outbox, replayStop: replayStop}, nil
 }
 
-func ConfigureEventProcessor(
+func newKafkaSubscriber(
 	cfg *config.AppConfig,
-	cqrsRouter *message.Router,
 	watermillLoggerAdapter watermill.LoggerAdapter,
 	kafkaMarshaler kafka.MarshalerUnmarshaler,
-	cqrsMarshaler *CqrsMarshalerDecorator,
-	commonProjection *CommonProjection,
-) (*cqrs.EventGroupProcessor, error) {
+	consumerGroup string,
+	tracer kafka.SaramaTracer,
+) (message.Subscriber, error) {
 	kafkaConsumerConfig := sarama.NewConfig()
 	kafkaConsumerConfig.Consumer.Return.Errors = cfg.KafkaConfig.KafkaConsumerConfig.ReturnErrors
 	kafkaConsumerConfig.Version = sarama.V4_0_0_0
@@ -205,6 +227,29 @@ func ConfigureEventProcessor(
 	kafkaConsumerConfig.Consumer.Offsets.Initial = sarama.OffsetOldest // need for to work after import
 	kafkaConsumerConfig.Consumer.Offsets.AutoCommit.Interval = cfg.KafkaConfig.KafkaConsumerConfig.OffsetCommitInterval
 
+	return kafka.NewSubscriber(
+		kafka.SubscriberConfig{
+			Brokers:               cfg.KafkaConfig.BootstrapServers,
+			OverwriteSaramaConfig: kafkaConsumerConfig,
+			ConsumerGroup:         consumerGroup,
+			Unmarshaler:           kafkaMarshaler,
+			NackResendSleep:       cfg.KafkaConfig.KafkaConsumerConfig.NackResendSleep,
+			ReconnectRetrySleep:   cfg.KafkaConfig.KafkaConsumerConfig.ReconnectRetrySleep,
+			Tracer:                tracer,
+		},
+		watermillLoggerAdapter,
+	)
+}
+
+func ConfigureEventProcessor(
+	cfg *config.AppConfig,
+	cqrsRouter *message.Router,
+	watermillLoggerAdapter watermill.LoggerAdapter,
+	kafkaMarshaler kafka.MarshalerUnmarshaler,
+	cqrsMarshaler *CqrsMarshalerDecorator,
+	commonProjection *CommonProjection,
+	replayStop *ReplayStop,
+) (*cqrs.EventGroupProcessor, error) {
 	eventProcessor, err := cqrs.NewEventGroupProcessorWithConfig(
 		cqrsRouter,
 		cqrs.EventGroupProcessorConfig{
@@ -212,45 +257,64 @@ func ConfigureEventProcessor(
 				return cfg.KafkaConfig.Topic, nil
 			},
 			SubscriberConstructor: func(params cqrs.EventGroupProcessorSubscriberConstructorParams) (message.Subscriber, error) {
-				return kafka.NewSubscriber(
-					kafka.SubscriberConfig{
-						Brokers:               cfg.KafkaConfig.BootstrapServers,
-						OverwriteSaramaConfig: kafkaConsumerConfig,
-						ConsumerGroup:         params.EventGroupName,
-						Unmarshaler:           kafkaMarshaler,
-						NackResendSleep:       cfg.KafkaConfig.KafkaConsumerConfig.NackResendSleep,
-						ReconnectRetrySleep:   cfg.KafkaConfig.KafkaConsumerConfig.ReconnectRetrySleep,
-					},
-					watermillLoggerAdapter,
-				)
+				// the events past the replay stop are neither handled nor acknowledged
+				return newKafkaSubscriber(cfg, watermillLoggerAdapter, kafkaMarshaler, params.EventGroupName, replayStop.SubscriberTracer(params.EventGroupName))
 			},
-			Marshaler: cqrsMarshaler,
-			Logger:    watermillLoggerAdapter,
+			// every projection handles only the events it needs
+			AckOnUnknownEvent: true,
+			Marshaler:         cqrsMarshaler,
+			Logger:            watermillLoggerAdapter,
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// All messages from this group will have one subscription.
-	// When message arrives, Watermill will match it with the correct handler.
-	err = eventProcessor.AddHandlersGroup(
-		cfg.KafkaConfig.ConsumerGroup,
-		cqrs.NewGroupEventHandler(commonProjection.OnChatCreated),
-		cqrs.NewGroupEventHandler(commonProjection.OnChatEdited),
-		cqrs.NewGroupEventHandler(commonProjection.OnChatRemoved),
-		cqrs.NewGroupEventHandler(commonProjection.OnParticipantAdded),
-		cqrs.NewGroupEventHandler(commonProjection.OnParticipantRemoved),
-		cqrs.NewGroupEventHandler(commonProjection.OnChatPinned),
-		cqrs.NewGroupEventHandler(commonProjection.OnMessageCreated),
-		cqrs.NewGroupEventHandler(commonProjection.OnMessageEdited),
-		cqrs.NewGroupEventHandler(commonProjection.OnChatViewRefreshed),
-		cqrs.NewGroupEventHandler(commonProjection.OnUnreadMessageReaded),
-		cqrs.NewGroupEventHandler(commonProjection.OnMessageBlogPostMade),
-		cqrs.NewGroupEventHandler(commonProjection.OnMessageRemoved),
-	)
-	if err != nil {
-		return nil, err
+	// Every projection is a group with its own consumer group, so it consumes the topic at its own pace.
+	// When message arrives, Watermill will match it with the correct handler of the group.
+	handlerGroups := map[string][]cqrs.GroupEventHandler{
+		config.ChatProjection: {
+			cqrs.NewGroupEventHandler(commonProjection.OnChatCreated),
+			cqrs.NewGroupEventHandler(commonProjection.OnChatEdited),
+			cqrs.NewGroupEventHandler(commonProjection.OnChatRetentionEdited),
+			cqrs.NewGroupEventHandler(commonProjection.OnChatSlowModeEdited),
+			cqrs.NewGroupEventHandler(commonProjection.OnChatRemoved),
+			cqrs.NewGroupEventHandler(commonProjection.OnParticipantAdded),
+			cqrs.NewGroupEventHandler(commonProjection.OnParticipantRemoved),
+			cqrs.NewGroupEventHandler(commonProjection.OnMessageCreated),
+			cqrs.NewGroupEventHandler(commonProjection.OnMessageEdited),
+			cqrs.NewGroupEventHandler(commonProjection.OnMessageBlogPostMade),
+			cqrs.NewGroupEventHandler(commonProjection.OnMessageRemoved),
+		},
+		config.ChatViewProjection: {
+			cqrs.NewGroupEventHandler(commonProjection.ChatViewOnParticipantAdded),
+			cqrs.NewGroupEventHandler(commonProjection.ChatViewOnParticipantRemoved),
+			cqrs.NewGroupEventHandler(commonProjection.OnChatPinned),
+			cqrs.NewGroupEventHandler(commonProjection.ChatViewOnChatViewRefreshed),
+		},
+		config.UnreadMessagesProjection: {
+			cqrs.NewGroupEventHandler(commonProjection.UnreadMessagesOnParticipantAdded),
+			cqrs.NewGroupEventHandler(commonProjection.UnreadMessagesOnChatViewRefreshed),
+			cqrs.NewGroupEventHandler(commonProjection.OnUnreadMessageReaded),
+		},
+		config.BlogProjection: {
+			cqrs.NewGroupEventHandler(commonProjection.BlogOnChatEdited),
+			cqrs.NewGroupEventHandler(commonProjection.BlogOnChatRemoved),
+			cqrs.NewGroupEventHandler(commonProjection.BlogOnMessageBlogPostMade),
+			cqrs.NewGroupEventHandler(commonProjection.BlogOnMessageEdited),
+			cqrs.NewGroupEventHandler(commonProjection.BlogOnMessageRemoved),
+		},
+	}
+
+	for _, projection := range cfg.ProjectionsConfig.Enabled {
+		consumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+		if err != nil {
+			return nil, err
+		}
+		err = eventProcessor.AddHandlersGroup(consumerGroup, handlerGroups[projection]...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return eventProcessor, nil
@@ -260,22 +324,24 @@ func ConfigureCommonProjection(
 	dba *db.DB,
 	lgr *logger.LoggerWrapper,
 	cfg *config.AppConfig,
-) *CommonProjection {
+) (*CommonProjection, error) {
 	return NewCommonProjection(dba, lgr, cfg)
 }
 
 func SetIsNeedToFastForwardSequences(commonProjection *CommonProjection) error {
-	return commonProjection.SetIsNeedToFastForwardSequences(context.Background())
+	return commonProjection.SetIsNeedToFastForwardSequences(context.Background(), commonProjection.db)
 }
 
 func RunSequenceFastforwarder(
 	lgr *logger.LoggerWrapper,
 	commonProjection *CommonProjection,
 	dba *db.DB,
+	idGenerator IdGenerator,
+	chatRepository *ChatRepository,
 ) error {
 	ctx := context.Background()
 
-	lgr.Info("Attempting to fast-forward sequences")
+	lgr.Info("Attempting to fast-forward sequences and chat aggregates")
 	txErr := db.Transact(ctx, dba, func(tx *db.Tx) error {
 		xerr := commonProjection.SetXactFastForwardSequenceLock(ctx, tx)
 		if xerr != nil {
@@ -291,31 +357,22 @@ func RunSequenceFastforwarder(
 			return nil
 		}
 
-		errI0 := commonProjection.InitializeChatIdSequenceIfNeed(ctx, tx)
-		if errI0 != nil {
-			lgr.Error("Error during setting message id sequences", "err", errI0)
-			return errI0
+		errA := chatRepository.InitializeChatAggregatesIfNeed(ctx, tx)
+		if errA != nil {
+			lgr.Error("Error during initializing chat aggregates", "err", errA)
+			return errA
 		}
 
-		shouldContinue := true
-		for page := int64(0); shouldContinue; page++ {
-			offset := utils.GetOffset(page, utils.DefaultSize)
-
-			chatIdsPortion, errI1 := commonProjection.GetChatIds(ctx, tx, utils.DefaultSize, offset)
-			if errI1 != nil {
-				lgr.Error("Error during getting all chats", "err", errI1)
-				return errI1
-			}
-			if len(chatIdsPortion) < utils.DefaultSize {
-				shouldContinue = false
-			}
+		errC := FastForwardChatSequences(ctx, tx)
+		if errC != nil {
+			lgr.Error("Error during fast-forwarding chat event sequences", "err", errC)
+			return errC
+		}
 
-			for _, chatId := range chatIdsPortion {
-				errI2 := commonProjection.InitializeMessageIdSequenceIfNeed(ctx, tx, chatId)
-				if errI2 != nil {
-					lgr.Error("Error during setting message id sequences", "err", errI2)
-					return errI2
-				}
+		if idGenerator.NeedsFastForward() {
+			errS := fastForwardSequences(ctx, lgr, commonProjection, tx)
+			if errS != nil {
+				return errS
 			}
 		}
 
@@ -325,7 +382,7 @@ func RunSequenceFastforwarder(
 			return errU
 		}
 
-		lgr.Info("All the sequences was fast-forwarded successfully")
+		lgr.Info("All the sequences and the chat aggregates were fast-forwarded successfully")
 
 		return nil
 	})
@@ -335,3 +392,34 @@ func RunSequenceFastforwarder(
 
 	return nil
 }
+
+func fastForwardSequences(ctx context.Context, lgr *logger.LoggerWrapper, commonProjection *CommonProjection, tx *db.Tx) error {
+	errI0 := commonProjection.InitializeChatIdSequenceIfNeed(ctx, tx)
+	if errI0 != nil {
+		lgr.Error("Error during setting message id sequences", "err", errI0)
+		return errI0
+	}
+
+	shouldContinue := true
+	for page := int64(0); shouldContinue; page++ {
+		offset := utils.GetOffset(page, utils.DefaultSize)
+
+		chatIdsPortion, errI1 := commonProjection.GetChatIds(ctx, tx, utils.DefaultSize, offset)
+		if errI1 != nil {
+			lgr.Error("Error during getting all chats", "err", errI1)
+			return errI1
+		}
+		if len(chatIdsPortion) < utils.DefaultSize {
+			shouldContinue = false
+		}
+
+		for _, chatId := range chatIdsPortion {
+			errI2 := commonProjection.InitializeMessageIdSequenceIfNeed(ctx, tx, chatId)
+			if errI2 != nil {
+				lgr.Error("Error during setting message id sequences", "err", errI2)
+				return errI2
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+	"go-cqrs-chat-example/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the envelope is duplicated into kafka headers, so the events can be looked up without parsing the payload
+const (
+	ActorIdMetadataKey       = "actor_id"
+	CorrelationIdMetadataKey = "correlation_id"
+	CausationIdMetadataKey   = "causation_id"
+)
+
+const requestInfoKey = "request_info"
+
+type ClientInfo struct {
+	UserAgent string `json:"userAgent,omitempty"`
+	Ip        string `json:"ip,omitempty"`
+}
+
+// RequestInfo describes who and where from has sent the command,
+// it is put into the context by the http middleware and the grpc interceptor
+type RequestInfo struct {
+	ActorId       int64 // 0 means the system, e.g. the retention job
+	CorrelationId string
+	ClientInfo    *ClientInfo
+}
+
+// NewCorrelationId uses the trace id, so the events can be found by the request's trace and vice versa
+func NewCorrelationId(ctx context.Context) string {
+	sc := trace.SpanFromContext(ctx).SpanContext()
+	if sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return uuid.NewString()
+}
+
+func MakeContextWithRequestInfo(parent context.Context, requestInfo *RequestInfo) context.Context {
+	return context.WithValue(parent, requestInfoKey, requestInfo)
+}
+
+func getRequestInfo(ctx context.Context) *RequestInfo {
+	requestInfo, ok := ctx.Value(requestInfoKey).(*RequestInfo)
+	if !ok {
+		return &RequestInfo{}
+	}
+	return requestInfo
+}
+
+// ForEvent returns a copy of the command's envelope for one of the events it produces
+func (a *AdditionalData) ForEvent() *AdditionalData {
+	ret := *a
+	ret.EventId = uuid.NewString()
+	return &ret
+}
+
+// Derived returns the envelope for the event which is published because of this one, e.g. ChatViewRefreshed after MessageCreated
+func (a *AdditionalData) Derived() *AdditionalData {
+	ret := a.ForEvent()
+	ret.CausationId = a.EventId
+	ret.ChatVersion = 0
+	ret.MessageVersion = 0
+	return ret
+}
+
+// setEnvelopeMetadata is called from OnPublish, the message's uuid becomes the event id
+func setEnvelopeMetadata(msg *message.Message, event any) {
+	pm, ok := event.(PartitionableMessage)
+	if !ok {
+		return
+	}
+	ad := pm.GetAdditionalData()
+	if ad == nil {
+		return
+	}
+	if ad.EventId != "" {
+		msg.UUID = ad.EventId
+	}
+	if ad.ActorId != 0 {
+		msg.Metadata.Set(ActorIdMetadataKey, utils.ToString(ad.ActorId))
+	}
+	if ad.CorrelationId != "" {
+		msg.Metadata.Set(CorrelationIdMetadataKey, ad.CorrelationId)
+	}
+	if ad.CausationId != "" {
+		msg.Metadata.Set(CausationIdMetadataKey, ad.CausationId)
+	}
+}
@@ -0,0 +1,52 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	ctx := MakeContextWithRequestInfo(context.Background(), &RequestInfo{
+		ActorId:       1,
+		CorrelationId: "request-1",
+		ClientInfo:    &ClientInfo{UserAgent: "curl/8.0", Ip: "127.0.0.1"},
+	})
+
+	commandData := GenerateMessageAdditionalData(ctx)
+	assert.Equal(t, int64(1), commandData.ActorId)
+	assert.Equal(t, "request-1", commandData.CorrelationId)
+	assert.Equal(t, "request-1", commandData.CausationId)
+	assert.Equal(t, "curl/8.0", commandData.ClientInfo.UserAgent)
+
+	first := commandData.ForEvent()
+	second := commandData.ForEvent()
+	assert.NotEmpty(t, first.EventId)
+	assert.NotEqual(t, first.EventId, second.EventId)
+	assert.Equal(t, "request-1", first.CausationId)
+
+	first.ChatVersion = 2
+	first.MessageVersion = 3
+	derived := first.Derived()
+	assert.NotEqual(t, first.EventId, derived.EventId)
+	assert.Equal(t, first.EventId, derived.CausationId)
+	assert.Equal(t, "request-1", derived.CorrelationId)
+	assert.Equal(t, int64(1), derived.ActorId)
+	assert.Equal(t, int64(0), derived.ChatVersion)
+	assert.Equal(t, int64(0), derived.MessageVersion)
+
+	msg := message.NewMessage("watermill-uuid", nil)
+	setEnvelopeMetadata(msg, &ChatEdited{AdditionalData: derived, ChatId: 1})
+	assert.Equal(t, derived.EventId, msg.UUID)
+	assert.Equal(t, "1", msg.Metadata.Get(ActorIdMetadataKey))
+	assert.Equal(t, "request-1", msg.Metadata.Get(CorrelationIdMetadataKey))
+	assert.Equal(t, first.EventId, msg.Metadata.Get(CausationIdMetadataKey))
+}
+
+func TestEnvelopeWithoutRequest(t *testing.T) {
+	commandData := GenerateMessageAdditionalData(context.Background())
+	assert.Equal(t, int64(0), commandData.ActorId)
+	assert.NotEmpty(t, commandData.CorrelationId)
+	assert.Nil(t, commandData.ClientInfo)
+}
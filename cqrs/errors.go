@@ -0,0 +1,50 @@
+package cqrs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of the domain errors, check them with errors.Is()
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrForbidden  = errors.New("forbidden")
+	ErrValidation = errors.New("validation failed")
+	ErrConflict   = errors.New("conflict")
+	ErrReadOnly   = errors.New("read-only") // the replay is stopped at a point in the past
+)
+
+// DomainError is an error which is caused by the request rather than by the infrastructure,
+// so its Detail is safe to show to the client
+type DomainError struct {
+	Kind   error
+	Detail string
+}
+
+func (e *DomainError) Error() string {
+	return e.Kind.Error() + ": " + e.Detail
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.Kind
+}
+
+func NewNotFoundError(format string, args ...any) error {
+	return &DomainError{Kind: ErrNotFound, Detail: fmt.Sprintf(format, args...)}
+}
+
+func NewForbiddenError(format string, args ...any) error {
+	return &DomainError{Kind: ErrForbidden, Detail: fmt.Sprintf(format, args...)}
+}
+
+func NewValidationError(format string, args ...any) error {
+	return &DomainError{Kind: ErrValidation, Detail: fmt.Sprintf(format, args...)}
+}
+
+func NewConflictError(format string, args ...any) error {
+	return &DomainError{Kind: ErrConflict, Detail: fmt.Sprintf(format, args...)}
+}
+
+func NewReadOnlyError(format string, args ...any) error {
+	return &DomainError{Kind: ErrReadOnly, Detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,23 @@
+package cqrs
+
+import (
+	"go-cqrs-chat-example/utils"
+	"strings"
+)
+
+// ParseIfMatch parses the version, passed as ETag in If-Match of REST or if-match metadata of gRPC, empty value and * mean no check
+func ParseIfMatch(value string) (*int64, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	if trimmed == "" || trimmed == "*" {
+		return nil, nil
+	}
+	version, err := utils.ParseInt64(strings.Trim(trimmed, `"`))
+	if err != nil {
+		return nil, NewValidationError("wrong If-Match: %q", value)
+	}
+	return &version, nil
+}
+
+func FormatETag(version int64) string {
+	return `"` + utils.ToString(version) + `"`
+}
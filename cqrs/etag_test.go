@@ -0,0 +1,29 @@
+package cqrs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	for _, value := range []string{"", "*", " "} {
+		version, err := ParseIfMatch(value)
+		require.NoError(t, err)
+		assert.Nil(t, version, "%q means no check", value)
+	}
+
+	for value, expected := range map[string]int64{`"5"`: 5, `W/"6"`: 6, "7": 7} {
+		version, err := ParseIfMatch(value)
+		require.NoError(t, err)
+		require.NotNil(t, version)
+		assert.Equal(t, expected, *version)
+	}
+
+	_, err := ParseIfMatch(`"abc"`)
+	assert.ErrorIs(t, err, ErrValidation)
+
+	parsed, err := ParseIfMatch(FormatETag(42))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), *parsed)
+}
@@ -1,12 +1,22 @@
 package cqrs
 
 import (
+	"context"
+	"github.com/google/uuid"
 	"go-cqrs-chat-example/utils"
 	"time"
 )
 
+// AdditionalData is the envelope of the event
 type AdditionalData struct {
-	CreatedAt time.Time `json:"createdAt"`
+	CreatedAt      time.Time   `json:"createdAt"`
+	ChatVersion    int64       `json:"chatVersion,omitempty"`    // the version of the chat after the event, set by the Chat aggregate for the events which change the chat itself
+	MessageVersion int64       `json:"messageVersion,omitempty"` // the version of the message after the event, set by the Chat aggregate for MessageCreated and MessageEdited
+	EventId        string      `json:"eventId,omitempty"`
+	ActorId        int64       `json:"actorId,omitempty"`       // the user who has sent the command, absent for the system
+	CorrelationId  string      `json:"correlationId,omitempty"` // the same for all the events of the http request or the command
+	CausationId    string      `json:"causationId,omitempty"`   // the event id of the parent event, or the correlation id for the events made by the command itself
+	ClientInfo     *ClientInfo `json:"clientInfo,omitempty"`
 }
 
 type ChatCreated struct {
@@ -22,6 +32,18 @@ type ChatEdited struct {
 	Blog           bool            `json:"blog"`
 }
 
+type ChatRetentionEdited struct {
+	AdditionalData   *AdditionalData `json:"additionalData"`
+	ChatId           int64           `json:"chatId"`
+	RetentionSeconds int64           `json:"retentionSeconds"` // 0 means messages are kept forever
+}
+
+type ChatSlowModeEdited struct {
+	AdditionalData  *AdditionalData `json:"additionalData"`
+	ChatId          int64           `json:"chatId"`
+	SlowModeSeconds int64           `json:"slowModeSeconds"` // 0 means slow mode is off
+}
+
 type ChatDeleted struct {
 	AdditionalData *AdditionalData `json:"additionalData"`
 	ChatId         int64           `json:"chatId"`
@@ -121,9 +143,19 @@ type MessageDeleted struct {
 	MessageId      int64           `json:"messageId"`
 }
 
-func GenerateMessageAdditionalData() *AdditionalData {
+// GenerateMessageAdditionalData makes the command's envelope from the request info in ctx
+func GenerateMessageAdditionalData(ctx context.Context) *AdditionalData {
+	requestInfo := getRequestInfo(ctx)
+	correlationId := requestInfo.CorrelationId
+	if correlationId == "" {
+		correlationId = uuid.NewString()
+	}
 	return &AdditionalData{
-		CreatedAt: time.Now().UTC(),
+		CreatedAt:     time.Now().UTC(),
+		ActorId:       requestInfo.ActorId,
+		CorrelationId: correlationId,
+		CausationId:   correlationId,
+		ClientInfo:    requestInfo.ClientInfo,
 	}
 }
 
@@ -135,6 +167,14 @@ func (s *ChatEdited) GetPartitionKey() string {
 	return utils.ToString(s.ChatId)
 }
 
+func (s *ChatRetentionEdited) GetPartitionKey() string {
+	return utils.ToString(s.ChatId)
+}
+
+func (s *ChatSlowModeEdited) GetPartitionKey() string {
+	return utils.ToString(s.ChatId)
+}
+
 func (s *ChatDeleted) GetPartitionKey() string {
 	return utils.ToString(s.ChatId)
 }
@@ -175,6 +215,62 @@ func (s *MessageDeleted) GetPartitionKey() string {
 	return utils.ToString(s.ChatId)
 }
 
+func (s *ChatCreated) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ChatEdited) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ChatRetentionEdited) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ChatSlowModeEdited) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ChatDeleted) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ParticipantsAdded) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ParticipantDeleted) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ChatPinned) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *MessageCreated) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *MessageEdited) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *ChatViewRefreshed) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *MessageReaded) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *MessageBlogPostMade) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
+func (s *MessageDeleted) GetAdditionalData() *AdditionalData {
+	return s.AdditionalData
+}
+
 func (s *ChatCreated) Name() string {
 	return "chatCreated"
 }
@@ -183,6 +279,14 @@ func (s *ChatEdited) Name() string {
 	return "chatEdited"
 }
 
+func (s *ChatRetentionEdited) Name() string {
+	return "chatRetentionEdited"
+}
+
+func (s *ChatSlowModeEdited) Name() string {
+	return "chatSlowModeEdited"
+}
+
 func (s *ChatDeleted) Name() string {
 	return "chatDeleted"
 }
@@ -0,0 +1,161 @@
+package cqrs
+
+import (
+	"context"
+	"fmt"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"sync"
+	"time"
+)
+
+const IdGeneratorTypeDb = "db"
+const IdGeneratorTypeSnowflake = "snowflake"
+
+type IdGenerator interface {
+	NextChatId(ctx context.Context) (int64, error)
+	// NextMessageId can return ChatStillNotExists when there is no such chat,
+	// otherwise the absence of the chat is found by the aggregate
+	NextMessageId(ctx context.Context, chatId int64) (int64, error)
+	// NeedsFastForward tells whether the generator should be fast-forwarded after import or reset, see RunSequenceFastforwarder
+	NeedsFastForward() bool
+}
+
+// DbIdGenerator uses chat_id_sequence and chat_common.last_generated_message_id,
+// so it produces the compact ids, but serializes the writers of a chat on its row lock
+type DbIdGenerator struct {
+	dba              *db.DB
+	commonProjection *CommonProjection
+}
+
+func (g *DbIdGenerator) NextChatId(ctx context.Context) (int64, error) {
+	return db.TransactWithResult(ctx, g.dba, func(tx *db.Tx) (int64, error) {
+		return g.commonProjection.GetNextChatId(ctx, tx)
+	})
+}
+
+func (g *DbIdGenerator) NextMessageId(ctx context.Context, chatId int64) (int64, error) {
+	return db.TransactWithResult(ctx, g.dba, func(tx *db.Tx) (int64, error) {
+		return g.commonProjection.GetNextMessageId(ctx, tx, chatId)
+	})
+}
+
+func (g *DbIdGenerator) NeedsFastForward() bool {
+	return true
+}
+
+// 41 bits of milliseconds since snowflakeEpoch (till 2094), 5 bits of node id and 7 bits of sequence within the millisecond.
+// The ids stay below 2^53, so they are exact as the numbers in JSON for the JavaScript clients, which parse them into float64
+const snowflakeMillisBits = 41
+const snowflakeNodeBits = 5
+const snowflakeSequenceBits = 7
+const snowflakeMaxNodeId = 1<<snowflakeNodeBits - 1
+const snowflakeMaxSequence = 1<<snowflakeSequenceBits - 1
+
+var snowflakeEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeIdGenerator makes the time-ordered ids in memory, so they survive import and reset without fast-forwarding.
+// The ids of a node are strictly increasing, even when the wall clock goes backwards, also across the restarts, see seed.
+// The ids of different nodes are ordered only up to the clock skew between them,
+// so the message ids are additionally made increasing within the chat by the aggregate, see Chat.allocateMessageId.
+type SnowflakeIdGenerator struct {
+	nodeId     int64
+	mu         sync.Mutex
+	lastMillis int64
+	sequence   int64
+}
+
+func NewSnowflakeIdGenerator(nodeId int64) (*SnowflakeIdGenerator, error) {
+	if nodeId < 0 || nodeId > snowflakeMaxNodeId {
+		return nil, fmt.Errorf("snowflake node id %v is out of range [0, %v]", nodeId, snowflakeMaxNodeId)
+	}
+	return &SnowflakeIdGenerator{
+		nodeId: nodeId,
+	}, nil
+}
+
+// seed continues after lastId, so the ids of the node don't repeat after a restart with the clock gone backwards
+func (g *SnowflakeIdGenerator) seed(lastId int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	millis := lastId >> (snowflakeNodeBits + snowflakeSequenceBits)
+	if millis > g.lastMillis {
+		g.lastMillis = millis
+		g.sequence = lastId & snowflakeMaxSequence
+	}
+}
+
+// getLastChatId returns the greatest chat id made by the node
+func getLastChatId(ctx context.Context, co db.CommonOperations, nodeId int64) (int64, error) {
+	var lastId int64
+	err := co.QueryRowContext(ctx, "select coalesce(max(id), 0) from chat_aggregate where (id >> $2) & $3 = $1", nodeId, snowflakeSequenceBits, snowflakeMaxNodeId).Scan(&lastId)
+	return lastId, err
+}
+
+func (g *SnowflakeIdGenerator) next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	millis := time.Since(snowflakeEpoch).Milliseconds()
+	if millis < g.lastMillis {
+		// the clock went backwards, keep counting from the last millisecond
+		millis = g.lastMillis
+	}
+
+	if millis == g.lastMillis {
+		g.sequence++
+		if g.sequence > snowflakeMaxSequence {
+			// borrow the next millisecond instead of sleeping, the clock will catch up
+			millis++
+			g.sequence = 0
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMillis = millis
+
+	return millis<<(snowflakeNodeBits+snowflakeSequenceBits) | g.nodeId<<snowflakeSequenceBits | g.sequence
+}
+
+func (g *SnowflakeIdGenerator) NextChatId(ctx context.Context) (int64, error) {
+	return g.next(), nil
+}
+
+// NextMessageId doesn't look into the projection, the aggregate rejects the message of the absent chat
+func (g *SnowflakeIdGenerator) NextMessageId(ctx context.Context, chatId int64) (int64, error) {
+	return g.next(), nil
+}
+
+func (g *SnowflakeIdGenerator) NeedsFastForward() bool {
+	return false
+}
+
+func ConfigureIdGenerator(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	commonProjection *CommonProjection,
+) (IdGenerator, error) {
+	igc := cfg.CqrsConfig.IdGeneratorConfig
+	switch igc.Type {
+	case IdGeneratorTypeDb, "":
+		lgr.Info("Using db id generator")
+		return &DbIdGenerator{dba: dba, commonProjection: commonProjection}, nil
+	case IdGeneratorTypeSnowflake:
+		lgr.Info("Using snowflake id generator", "node_id", igc.NodeId)
+		g, err := NewSnowflakeIdGenerator(igc.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		lastId, err := getLastChatId(context.Background(), dba, igc.NodeId)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the last chat id of the node: %w", err)
+		}
+		g.seed(lastId)
+		return g, nil
+	default:
+		return nil, fmt.Errorf("unknown id generator type %q", igc.Type)
+	}
+}
@@ -0,0 +1,88 @@
+package cqrs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnowflakeIdsAreIncreasing(t *testing.T) {
+	const nodeId = 5
+	g, err := NewSnowflakeIdGenerator(nodeId)
+	require.NoError(t, err)
+
+	// more than the sequence within a millisecond
+	const num = 3 * (snowflakeMaxSequence + 1)
+	var prev int64
+	for i := 0; i < num; i++ {
+		id := g.next()
+		require.Greater(t, id, prev)
+		assert.Equal(t, int64(nodeId), (id>>snowflakeSequenceBits)&snowflakeMaxNodeId)
+		prev = id
+	}
+}
+
+func TestSnowflakeIdsAreUniqueConcurrently(t *testing.T) {
+	g, err := NewSnowflakeIdGenerator(0)
+	require.NoError(t, err)
+
+	const goroutines = 8
+	const perGoroutine = 10000
+	ids := make(chan int64, goroutines*perGoroutine)
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				ids <- g.next()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[int64]struct{}{}
+	for id := range ids {
+		seen[id] = struct{}{}
+	}
+	assert.Equal(t, goroutines*perGoroutine, len(seen))
+}
+
+func TestSnowflakeNodeIdIsChecked(t *testing.T) {
+	_, err := NewSnowflakeIdGenerator(snowflakeMaxNodeId + 1)
+	assert.Error(t, err)
+}
+
+func TestSnowflakeIdsContinueAfterSeed(t *testing.T) {
+	const nodeId = 3
+	g, err := NewSnowflakeIdGenerator(nodeId)
+	require.NoError(t, err)
+
+	// the id made before the restart, when the clock was an hour ahead
+	aheadMillis := time.Since(snowflakeEpoch).Milliseconds() + time.Hour.Milliseconds()
+	lastId := aheadMillis<<(snowflakeNodeBits+snowflakeSequenceBits) | nodeId<<snowflakeSequenceBits | 7
+	g.seed(lastId)
+
+	id := g.next()
+	assert.Greater(t, id, lastId)
+	assert.Equal(t, int64(nodeId), (id>>snowflakeSequenceBits)&snowflakeMaxNodeId)
+
+	// the older id doesn't move it back
+	g.seed(1)
+	assert.Greater(t, g.next(), id)
+}
+
+func TestSnowflakeIdsAreSafeInJson(t *testing.T) {
+	const maxSafeInteger = 1<<53 - 1
+	g, err := NewSnowflakeIdGenerator(snowflakeMaxNodeId)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, g.next(), int64(maxSafeInteger))
+
+	// the last millisecond of the layout
+	lastMillis := int64(1)<<snowflakeMillisBits - 1
+	g.seed(lastMillis<<(snowflakeNodeBits+snowflakeSequenceBits) | snowflakeMaxNodeId<<snowflakeSequenceBits)
+	assert.LessOrEqual(t, g.next(), int64(maxSafeInteger))
+}
@@ -0,0 +1,107 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"time"
+)
+
+const meterName = "go-cqrs-chat-example/cqrs"
+
+// ProjectionNames are the consumer groups, which are also the names of the router's handlers
+func ProjectionNames(cfg *config.AppConfig) []string {
+	return append(
+		cfg.ProjectionsConfig.AllConsumerGroups(),
+		cfg.CqrsConfig.WebhookConfig.ConsumerGroup,
+		cfg.CqrsConfig.AuditLogConfig.ConsumerGroup,
+	)
+}
+
+// newHandlerMetricsMiddleware counts the events which come into the projections and measures their handling
+func newHandlerMetricsMiddleware(cqrsMarshaler *CqrsMarshalerDecorator) (message.HandlerMiddleware, error) {
+	meter := otel.Meter(meterName)
+	consumed, err := meter.Int64Counter(
+		"chat.events.consumed",
+		metric.WithDescription("The events handled by the projection, including the failed attempts"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	failed, err := meter.Int64Counter(
+		"chat.events.errors",
+		metric.WithDescription("The failed attempts to handle the event, the event is redelivered after them"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram(
+		"chat.events.handler.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("The time of handling of the event by the projection"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := msg.Context()
+			start := time.Now()
+
+			produced, err := h(msg)
+
+			attributes := metric.WithAttributes(
+				attribute.String("projection", message.HandlerNameFromCtx(ctx)),
+				attribute.String("event_type", cqrsMarshaler.NameFromMessage(msg)),
+			)
+			duration.Record(ctx, time.Since(start).Seconds(), attributes)
+			consumed.Add(ctx, 1, attributes)
+			if err != nil {
+				failed.Add(ctx, 1, attributes)
+			}
+			return produced, err
+		}
+	}, nil
+}
+
+// RegisterConsumerLagMetrics asks kafka for the offsets on every collection of the metrics
+func RegisterConsumerLagMetrics(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+) error {
+	meter := otel.Meter(meterName)
+	lag, err := meter.Int64ObservableGauge(
+		"chat.consumer.lag",
+		metric.WithDescription("The number of the events in the partition which the consumer group hasn't committed yet"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, consumerGroup := range ProjectionNames(cfg) {
+			offsets, err := kafka.GetPartitionOffsets(lgr, cfg, saramaClient, consumerGroup)
+			if err != nil {
+				lgr.Error("Unable to get the partition offsets for the lag metric", "consumer_group", consumerGroup, "err", err)
+				continue
+			}
+			for _, po := range offsets {
+				o.ObserveInt64(lag, po.Lag, metric.WithAttributes(
+					attribute.String("consumer_group", consumerGroup),
+					attribute.Int("partition", int(po.Partition)),
+				))
+			}
+		}
+		return nil
+	}, lag)
+	return err
+}
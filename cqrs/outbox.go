@@ -0,0 +1,288 @@
+package cqrs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/fx"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const txKey = "tx"
+const committedKey = "committed"
+
+// WithTx makes Publish write the events on the caller's transaction, so they are sent only if it commits.
+// The caller calls Flush after the commit
+func WithTx(parent context.Context, tx *db.Tx) context.Context {
+	return context.WithValue(parent, txKey, tx)
+}
+
+func getTx(ctx context.Context) (*db.Tx, bool) {
+	tx, ok := ctx.Value(txKey).(*db.Tx)
+	return tx, ok
+}
+
+// WithCommitTracking lets the idempotency tell a failed command from the one which has failed after committing its events,
+// the latter must not be released for the retry, otherwise the retry repeats the events. The returned func reports the commit
+func WithCommitTracking(parent context.Context) (context.Context, func() bool) {
+	committed := &atomic.Bool{}
+	return context.WithValue(parent, committedKey, committed), committed.Load
+}
+
+func markCommitted(ctx context.Context) {
+	if committed, ok := ctx.Value(committedKey).(*atomic.Bool); ok {
+		committed.Store(true)
+	}
+}
+
+// metadataCarrier lets the propagator keep the trace of the command in the metadata of the stored message
+type metadataCarrier message.Metadata
+
+func (c metadataCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	return slices.Collect(maps.Keys(c))
+}
+
+// outboxPublisher is the publisher of the cqrs event bus, instead of sending the marshaled events
+// it writes them into chat_event_outbox on the transaction from their context, Outbox sends them after the commit
+type outboxPublisher struct {
+	propagator propagation.TextMapPropagator
+}
+
+func (p *outboxPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		ctx := msg.Context()
+		tx, ok := getTx(ctx)
+		if !ok {
+			return errors.New("the event can be written into the outbox only on a transaction")
+		}
+		pk, ok := ctx.Value(partitionKey).(string)
+		if !ok {
+			return errors.New("unable to get partition key from context")
+		}
+		chatId, err := utils.ParseInt64(pk)
+		if err != nil {
+			return err
+		}
+		seq, ok := ctx.Value(chatSequenceKey).(int64)
+		if !ok {
+			return errors.New("unable to get chat sequence from context")
+		}
+
+		p.propagator.Inject(ctx, metadataCarrier(msg.Metadata))
+		metadata, err := json.Marshal(msg.Metadata)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			insert into chat_event_outbox(chat_id, seq, message_uuid, metadata, payload, create_date_time)
+			values ($1, $2, $3, $4, $5, $6)
+		`, chatId, seq, msg.UUID, metadata, []byte(msg.Payload), time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *outboxPublisher) Close() error {
+	return nil
+}
+
+// Outbox sends the committed events from chat_event_outbox to kafka and removes them.
+// The events of a chat are locked while they are being sent, so the concurrent flushes of the chat send them one by one in the order of their numbers.
+// If the removal fails after the sending, they are sent once more with the same numbers and the projections skip them as duplicates,
+// so the number is never given to another event.
+type Outbox struct {
+	lgr           *logger.LoggerWrapper
+	dba           *db.DB
+	publisher     message.Publisher
+	propagator    propagation.TextMapPropagator
+	cqrsMarshaler *CqrsMarshalerDecorator
+	topic         string
+	batchSize     int
+	published     metric.Int64Counter
+}
+
+func ConfigureOutbox(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	publisher message.Publisher,
+	propagator propagation.TextMapPropagator,
+	cqrsMarshaler *CqrsMarshalerDecorator,
+) (*Outbox, error) {
+	published, err := otel.Meter(meterName).Int64Counter(
+		"chat.events.published",
+		metric.WithDescription("The events sent to kafka"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{
+		lgr:           lgr,
+		dba:           dba,
+		publisher:     publisher,
+		propagator:    propagator,
+		cqrsMarshaler: cqrsMarshaler,
+		topic:         cfg.KafkaConfig.Topic,
+		batchSize:     max(cfg.CqrsConfig.OutboxConfig.BatchSize, 1),
+		published:     published,
+	}, nil
+}
+
+// flushChat sends all the committed events of the chat
+func (o *Outbox) flushChat(ctx context.Context, chatId int64) error {
+	for {
+		sent, err := db.TransactWithResult(ctx, o.dba, func(tx *db.Tx) (int, error) {
+			return o.sendBatch(ctx, tx, chatId)
+		})
+		if err != nil {
+			return err
+		}
+		if sent < o.batchSize {
+			return nil
+		}
+	}
+}
+
+func (o *Outbox) sendBatch(ctx context.Context, tx *db.Tx, chatId int64) (int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select id, message_uuid, metadata, payload from chat_event_outbox
+		where chat_id = $1
+		order by seq
+		limit $2
+		for update
+	`, chatId, o.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	messages := []*message.Message{}
+	for rows.Next() {
+		var id int64
+		var messageUuid string
+		var metadata []byte
+		var payload []byte
+		err = rows.Scan(&id, &messageUuid, &metadata, &payload)
+		if err != nil {
+			return 0, err
+		}
+		msg := message.NewMessage(messageUuid, payload)
+		err = json.Unmarshal(metadata, &msg.Metadata)
+		if err != nil {
+			return 0, err
+		}
+		// the sending continues the trace of the command, the partition key is the chat
+		msgCtx := o.propagator.Extract(context.Background(), metadataCarrier(msg.Metadata))
+		msg.SetContext(context.WithValue(msgCtx, partitionKey, utils.ToString(chatId)))
+		ids = append(ids, id)
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	err = o.publisher.Publish(o.topic, messages...)
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range messages {
+		o.published.Add(ctx, 1, metric.WithAttributes(attribute.String("event_type", o.cqrsMarshaler.NameFromMessage(msg))))
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from chat_event_outbox where id = any($1)", ids)
+	if err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
+
+// getStaleChatIds returns the chats whose events have been committed before createdBefore, but still aren't sent
+func (o *Outbox) getStaleChatIds(ctx context.Context, createdBefore time.Time) ([]int64, error) {
+	rows, err := o.dba.QueryContext(ctx, "select distinct chat_id from chat_event_outbox where create_date_time < $1 limit $2", createdBefore, o.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []int64{}
+	for rows.Next() {
+		var chatId int64
+		if err := rows.Scan(&chatId); err != nil {
+			return nil, err
+		}
+		ret = append(ret, chatId)
+	}
+	return ret, rows.Err()
+}
+
+// RunOutboxRelay sends the events which weren't sent after their commit, e. g. because kafka was unavailable or the instance has crashed.
+// It takes only those which are older than the interval, the fresh ones are being sent by their commands
+func RunOutboxRelay(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	outbox *Outbox,
+	lc fx.Lifecycle,
+) {
+	interval := cfg.CqrsConfig.OutboxConfig.RelayInterval
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStop: func(c context.Context) error {
+			lgr.Info("Stopping outbox relay")
+			cancelFunc()
+			return nil
+		},
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				chatIds, err := outbox.getStaleChatIds(ctx, time.Now().UTC().Add(-interval))
+				if err != nil {
+					lgr.Error("Error during getting the unsent events", "err", err)
+					continue
+				}
+				for _, chatId := range chatIds {
+					lgr.Warn("Sending the events which weren't sent after their commit", "chat_id", chatId)
+					err = outbox.flushChat(ctx, chatId)
+					if err != nil {
+						lgr.Error("Error during sending the events from the outbox", "chat_id", chatId, "err", err)
+					}
+				}
+			}
+		}
+	}()
+}
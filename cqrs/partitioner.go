@@ -6,26 +6,77 @@ import (
 	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
 	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/db"
 	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
 )
 
 const partitionKey = "partition_key"
 
 type EventBusInterface interface {
 	Publish(ctx context.Context, event PartitionableMessage) error
+	Flush(ctx context.Context, chatId int64)
 }
 
 type PartitionAwareEventBus struct {
-	eventBus *cqrs.EventBus
+	lgr        *logger.LoggerWrapper
+	eventBus   *cqrs.EventBus // writes into chat_event_outbox, see outboxPublisher
+	dba        *db.DB
+	outbox     *Outbox
+	replayStop *ReplayStop
 }
 
+// Publish takes the sequence number of the event and writes the event into chat_event_outbox.
+// With the transaction in ctx, see WithTx, they are done on it and the caller flushes the chat after the commit,
+// otherwise they are committed at once and the chat is flushed.
+// No transaction waits for kafka, and the number of the event which was rolled back is never sent
 func (w *PartitionAwareEventBus) Publish(ctx context.Context, pm PartitionableMessage) error {
+	err := w.replayStop.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	chatId, err := utils.ParseInt64(pm.GetPartitionKey())
+	if err != nil {
+		return err
+	}
+
+	if tx, ok := getTx(ctx); ok {
+		return w.write(ctx, tx, chatId, pm)
+	}
+	err = db.Transact(ctx, w.dba, func(tx *db.Tx) error {
+		return w.write(ctx, tx, chatId, pm)
+	})
+	if err != nil {
+		return err
+	}
+	markCommitted(ctx)
+	w.Flush(ctx, chatId)
+	return nil
+}
+
+// write takes the row lock of the chat's sequence till the end of tx, so the events of the same chat are committed in the order of their numbers
+func (w *PartitionAwareEventBus) write(ctx context.Context, tx *db.Tx, chatId int64, pm PartitionableMessage) error {
+	seq, err := nextChatSequence(ctx, tx, chatId)
+	if err != nil {
+		return err
+	}
 	// we put partition key into context in order tot to duplicate partition key, stored in kafka key into headers
-	return w.eventBus.Publish(makeContextWithPartitionKey(ctx, pm), pm)
+	return w.eventBus.Publish(makeContextWithChatSequence(makeContextWithPartitionKey(WithTx(ctx, tx), pm), seq), pm)
+}
+
+// Flush sends the committed events of the chat. They are already durable, so the error is only logged,
+// and the events are sent later by RunOutboxRelay
+func (w *PartitionAwareEventBus) Flush(ctx context.Context, chatId int64) {
+	err := w.outbox.flushChat(context.WithoutCancel(ctx), chatId)
+	if err != nil {
+		w.lgr.WithTrace(ctx).Warn("Unable to send the committed events, they will be sent by the relay", "chat_id", chatId, "err", err)
+	}
 }
 
 type PartitionableMessage interface {
 	GetPartitionKey() string
+	GetAdditionalData() *AdditionalData
 }
 
 // GenerateKafkaPartitionKey is a function that generates a partition key for Kafka messages.
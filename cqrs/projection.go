@@ -8,20 +8,31 @@ import (
 	"go-cqrs-chat-example/config"
 	"go-cqrs-chat-example/db"
 	"go-cqrs-chat-example/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type CommonProjection struct {
 	db                 *db.DB
 	lgr                *logger.LoggerWrapper
 	chatUserViewConfig *config.ChatUserViewConfig
+	fanOutSize         metric.Int64Histogram
 }
 
-func NewCommonProjection(db *db.DB, lgr *logger.LoggerWrapper, cfg *config.AppConfig) *CommonProjection {
+func NewCommonProjection(db *db.DB, lgr *logger.LoggerWrapper, cfg *config.AppConfig) (*CommonProjection, error) {
+	fanOutSize, err := otel.Meter(meterName).Int64Histogram(
+		"chat.fanout.participants",
+		metric.WithDescription("The number of the participants the command's change is fanned out to"),
+	)
+	if err != nil {
+		return nil, err
+	}
 	return &CommonProjection{
 		db:                 db,
 		lgr:                lgr,
 		chatUserViewConfig: &cfg.ProjectionsConfig.ChatUserViewConfig,
-	}
+		fanOutSize:         fanOutSize,
+	}, nil
 }
 
 func (m *CommonProjection) GetNextChatId(ctx context.Context, tx *db.Tx) (int64, error) {
@@ -122,8 +133,8 @@ func (m *CommonProjection) InitializeMessageIdSequenceIfNeed(ctx context.Context
 	return nil
 }
 
-func (m *CommonProjection) SetIsNeedToFastForwardSequences(ctx context.Context) error {
-	_, err := m.db.ExecContext(ctx, "insert into technical(id, need_to_fast_forward_sequences) values (1, true) on conflict (id) do update set need_to_fast_forward_sequences = excluded.need_to_fast_forward_sequences")
+func (m *CommonProjection) SetIsNeedToFastForwardSequences(ctx context.Context, co db.CommonOperations) error {
+	_, err := co.ExecContext(ctx, "insert into technical(id, need_to_fast_forward_sequences) values (1, true) on conflict (id) do update set need_to_fast_forward_sequences = excluded.need_to_fast_forward_sequences")
 	return err
 }
 
@@ -132,8 +143,8 @@ func (m *CommonProjection) UnsetIsNeedToFastForwardSequences(ctx context.Context
 	return err
 }
 
-func (m *CommonProjection) GetIsNeedToFastForwardSequences(ctx context.Context, tx *db.Tx) (bool, error) {
-	r := tx.QueryRowContext(ctx, "select exists(select * from technical where need_to_fast_forward_sequences = true)")
+func (m *CommonProjection) GetIsNeedToFastForwardSequences(ctx context.Context, co db.CommonOperations) (bool, error) {
+	r := co.QueryRowContext(ctx, "select exists(select * from technical where need_to_fast_forward_sequences = true)")
 	var e bool
 	err := r.Scan(&e)
 	if err != nil {
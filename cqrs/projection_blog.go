@@ -32,6 +32,11 @@ func (m *CommonProjection) refreshBlog(ctx context.Context, tx *db.Tx, chatId in
 
 func (m *CommonProjection) OnMessageBlogPostMade(ctx context.Context, event *MessageBlogPostMade) error {
 	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
+		}
+
 		chatExists, errInner := m.checkChatExists(ctx, tx, event.ChatId)
 		if errInner != nil {
 			return errInner
@@ -60,28 +65,110 @@ func (m *CommonProjection) OnMessageBlogPostMade(ctx context.Context, event *Mes
 		if errInner != nil {
 			return errInner
 		}
+		return nil
+	})
 
-		errInner = m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
+	return errOuter
+}
+
+// the handlers of the blog projection, it writes blog from chat_common and message of the chat projection
+
+func (m *CommonProjection) BlogOnChatEdited(ctx context.Context, event *ChatEdited) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		chatExists, errInner := m.checkChatExists(ctx, tx, event.ChatId)
 		if errInner != nil {
 			return errInner
 		}
-		return nil
+		if !chatExists {
+			m.lgr.WithTrace(ctx).Info("Skipping ChatEdited because there is no chat", "chat_id", event.ChatId)
+			return nil
+		}
+
+		if event.Blog {
+			// add or update blog
+			return m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
+		}
+
+		// rm blog
+		_, errInner = tx.ExecContext(ctx, `
+			delete from blog
+			where id = $1
+		`, event.ChatId)
+		return errInner
 	})
 
 	return errOuter
 }
 
-func (m *CommonProjection) isChatBlog(ctx context.Context, co db.CommonOperations, chatId int64) (bool, error) {
-	r := co.QueryRowContext(ctx, "select exists(select * from chat_common where id = $1 and blog = true)", chatId)
-	if r.Err() != nil {
-		return false, r.Err()
-	}
-	var blog bool
-	err := r.Scan(&blog)
+func (m *CommonProjection) BlogOnChatRemoved(ctx context.Context, event *ChatDeleted) error {
+	_, err := m.db.ExecContext(ctx, `
+		delete from blog
+		where id = $1
+	`, event.ChatId)
+	return err
+}
+
+func (m *CommonProjection) BlogOnMessageBlogPostMade(ctx context.Context, event *MessageBlogPostMade) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		chatExists, errInner := m.checkChatExists(ctx, tx, event.ChatId)
+		if errInner != nil {
+			return errInner
+		}
+		if !chatExists {
+			m.lgr.WithTrace(ctx).Info("Skipping MessageBlogPostMade because there is no chat", "chat_id", event.ChatId)
+			return nil
+		}
+
+		return m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
+	})
+
+	return errOuter
+}
+
+func (m *CommonProjection) BlogOnMessageEdited(ctx context.Context, event *MessageEdited) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		messageBlogPost, err := m.isMessageBlogPost(ctx, tx, event.ChatId, event.Id)
+		if err != nil {
+			return err
+		}
+		if !messageBlogPost {
+			return nil
+		}
+
+		return m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
+	})
+
+	return errOuter
+}
+
+func (m *CommonProjection) BlogOnMessageRemoved(ctx context.Context, event *MessageDeleted) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		// the message is already removed by the chat projection, so the blog is refreshed if its post has gone
+		postRemoved, err := m.isBlogPostRemoved(ctx, tx, event.ChatId)
+		if err != nil {
+			return err
+		}
+		if !postRemoved {
+			return nil
+		}
+
+		return m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
+	})
+
+	return errOuter
+}
+
+func (m *CommonProjection) isBlogPostRemoved(ctx context.Context, co db.CommonOperations, chatId int64) (bool, error) {
+	r := co.QueryRowContext(ctx, `
+		select exists(select * from blog where id = $1 and post is not null)
+			and not exists(select * from message where chat_id = $1 and blog_post = true)
+	`, chatId)
+	var removed bool
+	err := r.Scan(&removed)
 	if err != nil {
 		return false, err
 	}
-	return blog, nil
+	return removed, nil
 }
 
 func (m *CommonProjection) isMessageBlogPost(ctx context.Context, co db.CommonOperations, chatId, messageId int64) (bool, error) {
@@ -158,16 +245,15 @@ func (m *CommonProjection) GetBlog(ctx context.Context, blogId int64) (*BlogDto,
 		order by b.create_date_time desc 
 	`, blogId)
 	if row.Err() != nil {
-		if errors.Is(row.Err(), sql.ErrNoRows) {
-			// there were no rows, but otherwise no error occurred
-			return nil, nil
-		}
 		return nil, row.Err()
 	}
 
 	var cd BlogDto
 	err := row.Scan(&cd.Id, &cd.OwnerId, &cd.Title, &cd.Post, &cd.CreateDateTime)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NewNotFoundError("blog %v", blogId)
+		}
 		return nil, err
 	}
 
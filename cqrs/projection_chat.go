@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"github.com/jackc/pgtype"
 	"go-cqrs-chat-example/db"
-	"go-cqrs-chat-example/utils"
-	"slices"
 	"time"
 )
 
@@ -36,9 +34,9 @@ func (m *CommonProjection) GetChatIds(ctx context.Context, tx *db.Tx, size int32
 
 func (m *CommonProjection) OnChatCreated(ctx context.Context, event *ChatCreated) error {
 	_, err := m.db.ExecContext(ctx, `
-		insert into chat_common(id, title, create_date_time) values ($1, $2, $3)
-		on conflict(id) do update set title = excluded.title, create_date_time = excluded.create_date_time
-	`, event.ChatId, event.Title, event.AdditionalData.CreatedAt)
+		insert into chat_common(id, title, create_date_time, version) values ($1, $2, $3, $4)
+		on conflict(id) do update set title = excluded.title, create_date_time = excluded.create_date_time, version = excluded.version
+	`, event.ChatId, event.Title, event.AdditionalData.CreatedAt, event.AdditionalData.ChatVersion)
 	if err != nil {
 		return err
 	}
@@ -53,6 +51,11 @@ func (m *CommonProjection) OnChatCreated(ctx context.Context, event *ChatCreated
 
 func (m *CommonProjection) OnChatEdited(ctx context.Context, event *ChatEdited) error {
 	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
+		}
+
 		chatExists, err := m.checkChatExists(ctx, tx, event.ChatId)
 		if err != nil {
 			return err
@@ -62,12 +65,7 @@ func (m *CommonProjection) OnChatEdited(ctx context.Context, event *ChatEdited)
 			return nil
 		}
 
-		blog, errInner := m.isChatBlog(ctx, tx, event.ChatId)
-		if errInner != nil {
-			return errInner
-		}
-
-		_, errInner = tx.ExecContext(ctx, `
+		_, errInner := tx.ExecContext(ctx, `
 			update chat_common
 			set title = $2,
 			    blog = $3
@@ -82,29 +80,6 @@ func (m *CommonProjection) OnChatEdited(ctx context.Context, event *ChatEdited)
 			"title", event.Title,
 		)
 
-		if blog && !event.Blog {
-			// rm blog
-			_, errInner = tx.ExecContext(ctx, `
-				delete from blog
-				where id = $1
-			`, event.ChatId)
-			if errInner != nil {
-				return errInner
-			}
-		} else if !blog && event.Blog {
-			// add blog
-			errInner = m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
-			if errInner != nil {
-				return errInner
-			}
-		} else if blog && event.Blog {
-			// update blog
-			errInner = m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
-			if errInner != nil {
-				return errInner
-			}
-		}
-
 		return nil
 	})
 
@@ -115,163 +90,28 @@ func (m *CommonProjection) OnChatEdited(ctx context.Context, event *ChatEdited)
 	return nil
 }
 
-func (m *CommonProjection) OnChatRemoved(ctx context.Context, event *ChatDeleted) error {
-	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
-
-		blog, errInner := m.isChatBlog(ctx, tx, event.ChatId)
-		if errInner != nil {
-			return errInner
-		}
-
-		_, errInner = m.db.ExecContext(ctx, `
-			delete from chat_common
-			where id = $1
-		`, event.ChatId)
-		if errInner != nil {
-			return errInner
-		}
-
-		if blog {
-			_, errInner = m.db.ExecContext(ctx, `
-			delete from blog
-			where id = $1
-		`, event.ChatId)
-			if errInner != nil {
-				return errInner
-			}
-		}
-
-		m.lgr.WithTrace(ctx).Info(
-			"Common chat removed",
-			"chat_id", event.ChatId,
-		)
-		return nil
-	})
-
-	if errOuter != nil {
-		return errOuter
+// setChatVersion is called by the handlers of the events which are recorded by the Chat aggregate
+func (m *CommonProjection) setChatVersion(ctx context.Context, co db.CommonOperations, chatId int64, additionalData *AdditionalData) error {
+	if additionalData.ChatVersion == 0 {
+		return nil // the event was published before the versioning
 	}
-	return nil
+	_, err := co.ExecContext(ctx, "update chat_common set version = greatest(version, $2) where id = $1", chatId, additionalData.ChatVersion)
+	return err
 }
 
-func (m *CommonProjection) OnChatPinned(ctx context.Context, event *ChatPinned) error {
+func (m *CommonProjection) OnChatRemoved(ctx context.Context, event *ChatDeleted) error {
 	_, err := m.db.ExecContext(ctx, `
-		update chat_user_view
-		set pinned = $3
-		where (id, user_id) = ($1, $2)
-	`, event.ChatId, event.ParticipantId, event.Pinned)
+		delete from chat_common
+		where id = $1
+	`, event.ChatId)
 	if err != nil {
 		return err
 	}
 
 	m.lgr.WithTrace(ctx).Info(
-		"Chat pinned",
-		"user_id", event.ParticipantId,
+		"Common chat removed",
 		"chat_id", event.ChatId,
-		"pinned", event.Pinned,
 	)
-
-	return nil
-}
-
-func (m *CommonProjection) OnChatViewRefreshed(ctx context.Context, event *ChatViewRefreshed) error {
-	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
-		// in oder not to have a potential race condition
-		// for example "by upserting refresh view we can resurrect view of the newly removed participant in case message add"
-		// we shouldn't upsert into chat_user_view
-		// we can only update it here
-
-		if event.UnreadMessagesAction == UnreadMessagesActionIncrease {
-			participantIdsWithoutOwner := utils.GetSliceWithout(event.OwnerId, event.ParticipantIds)
-			var ownerId *int64
-			if slices.Contains(event.ParticipantIds, event.OwnerId) { // for batches without owner
-				ownerId = &event.OwnerId
-			}
-
-			// not owners
-			if len(participantIdsWithoutOwner) > 0 {
-				_, err := tx.ExecContext(ctx, `
-					UPDATE unread_messages_user_view 
-					SET unread_messages = unread_messages + $3
-					WHERE user_id = any($1) and chat_id = $2;
-				`, participantIdsWithoutOwner, event.ChatId, event.IncreaseOn)
-				if err != nil {
-					return fmt.Errorf("error during increasing unread messages: %w", err)
-				}
-			}
-
-			// owner
-			if ownerId != nil {
-				_, err := tx.ExecContext(ctx, `
-					UPDATE unread_messages_user_view 
-					SET last_message_id = (select max(id) from message where chat_id = $2)
-					WHERE (user_id, chat_id) = ($1, $2);
-				`, *ownerId, event.ChatId)
-				if err != nil {
-					return fmt.Errorf("error during increasing unread messages: %w", err)
-				}
-			}
-		} else if event.UnreadMessagesAction == UnreadMessagesActionRefresh {
-			err := m.setUnreadMessages(ctx, tx, event.ParticipantIds, event.ChatId, 0, true, true)
-			if err != nil {
-				return err
-			}
-		}
-
-		if event.LastMessageAction == LastMessageActionRefresh {
-			err := m.setLastMessage(ctx, tx, event.ParticipantIds, event.ChatId)
-			if err != nil {
-				return err
-			}
-		}
-
-		if event.ChatCommonAction == ChatCommonActionRefresh {
-			_, err := tx.ExecContext(ctx, `
-					UPDATE chat_user_view 
-					SET title = $3
-					WHERE user_id = any($1) and id = $2;
-				`, event.ParticipantIds, event.ChatId, event.Title)
-			if err != nil {
-				return fmt.Errorf("error during increasing unread messages: %w", err)
-			}
-		}
-
-		if event.ParticipantsAction == ParticipantsActionRefresh {
-			_, err := tx.ExecContext(ctx, `
-					with
-					this_chat_participants as (
-						select user_id, create_date_time from chat_participant where chat_id = $2
-					),
-					chat_participant_count as (
-						select count (*) as count from this_chat_participants
-					),
-					chat_participants_last_n as (
-						select user_id from this_chat_participants order by create_date_time desc limit $3
-					)
-					UPDATE chat_user_view 
-					SET 
-						participants_count = (select count from chat_participant_count),
-						participant_ids = (select array_agg(user_id) from chat_participants_last_n)
-					WHERE user_id = any($1) and id = $2;
-				`, event.ParticipantIds, event.ChatId, m.chatUserViewConfig.MaxViewableParticipants)
-			if err != nil {
-				return fmt.Errorf("error during increasing unread messages: %w", err)
-			}
-		}
-
-		_, err := tx.ExecContext(ctx, `
-				update chat_user_view set update_date_time = $3 where user_id = any($1) and id = $2
-			`, event.ParticipantIds, event.ChatId, event.AdditionalData.CreatedAt)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if errOuter != nil {
-		return errOuter
-	}
 	return nil
 }
 
@@ -300,6 +140,7 @@ type ChatViewDto struct {
 	ParticipantIds     []int64    `json:"participantIds"` // ids of last N participants
 	Blog               bool       `json:"blog"`
 	UpdateDateTime     *time.Time `json:"lastUpdateDateTime"` // for sake compatibility
+	Version            int64      `json:"version"`            // pass it in If-Match in order not to overwrite someone else's changes
 }
 
 type ChatId struct {
@@ -349,9 +190,11 @@ func (m *CommonProjection) GetChats(ctx context.Context, participantId int64, si
 		    ch.participants_count,
 		    ch.participant_ids,
 		    b.id is not null as blog,
-		    ch.update_date_time
+		    ch.update_date_time,
+		    coalesce(c.version, 0)
 		from chat_user_view ch
 		join unread_messages_user_view m on (ch.id = m.chat_id and m.user_id = $1)
+		left join chat_common c on ch.id = c.id
 		left join blog b on ch.id = b.id
 		where ch.user_id = $1 %s
 		order by (ch.pinned, ch.update_date_time, ch.id) %s
@@ -366,7 +209,7 @@ func (m *CommonProjection) GetChats(ctx context.Context, participantId int64, si
 	for rows.Next() {
 		var cd ChatViewDto
 		var participantIds = pgtype.Int8Array{}
-		err = rows.Scan(&cd.Id, &cd.Title, &cd.Pinned, &cd.UnreadMessages, &cd.LastMessageId, &cd.LastMessageOwnerId, &cd.LastMessageContent, &cd.ParticipantsCount, &participantIds, &cd.Blog, &cd.UpdateDateTime)
+		err = rows.Scan(&cd.Id, &cd.Title, &cd.Pinned, &cd.UnreadMessages, &cd.LastMessageId, &cd.LastMessageOwnerId, &cd.LastMessageContent, &cd.ParticipantsCount, &participantIds, &cd.Blog, &cd.UpdateDateTime, &cd.Version)
 		if err != nil {
 			return ma, err
 		}
@@ -0,0 +1,185 @@
+package cqrs
+
+import (
+	"context"
+	"fmt"
+	"go-cqrs-chat-example/db"
+)
+
+// the handlers of the chat view projection, it writes chat_user_view
+
+func (m *CommonProjection) ChatViewOnParticipantAdded(ctx context.Context, event *ParticipantsAdded) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		chatExists, err := m.checkChatExists(ctx, tx, event.ChatId)
+		if err != nil {
+			return err
+		}
+		if !chatExists {
+			m.lgr.WithTrace(ctx).Info("Skipping ParticipantsAdded because there is no chat", "chat_id", event.ChatId)
+			return nil
+		}
+
+		// no problems here because
+		// a) we've already added participants in the previous step
+		// b) there is no batching-with-pagination among addable participants
+		//      which would cause gaps in participants_count for the participants of current and previous iterations
+
+		// chat_common and chat_participant are already filled by the chat projection, see SequenceChecker.ChatProjectionMiddleware
+		_, err = tx.ExecContext(ctx, `
+		with 
+		this_chat_participants as (
+			select user_id, create_date_time from chat_participant where chat_id = $2
+		),
+		chat_participant_count as (
+			select count (*) as count from this_chat_participants
+		),
+		chat_participants_last_n as (
+			select user_id from this_chat_participants order by create_date_time desc limit $4
+		),
+		user_input as (
+			select unnest(cast ($1 as bigint[])) as user_id
+		),
+		input_data as (
+			select 
+				c.id as chat_id, 
+				c.title as title, 
+				false as pinned, 
+				u.user_id as user_id, 
+				cast ($3 as timestamp) as update_date_time,
+				(select count from chat_participant_count) as participants_count, 
+				(select array_agg(user_id) from chat_participants_last_n) as participant_ids
+			from user_input u
+			cross join (select cc.id, cc.title from chat_common cc where cc.id = $2) c 
+		)
+		insert into chat_user_view(id, title, pinned, user_id, update_date_time, participants_count, participant_ids) 
+			select chat_id, title, pinned, user_id, update_date_time, participants_count, participant_ids from input_data
+		on conflict(user_id, id) do update set
+			pinned = excluded.pinned, 
+			title = excluded.title, 
+			update_date_time = excluded.update_date_time, 
+			participants_count = excluded.participants_count, 
+			participant_ids = excluded.participant_ids
+		`, event.ParticipantIds, event.ChatId, event.AdditionalData.CreatedAt, m.chatUserViewConfig.MaxViewableParticipants)
+		if err != nil {
+			return err
+		}
+
+		err = m.setLastMessage(ctx, tx, event.ParticipantIds, event.ChatId)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if errOuter != nil {
+		return errOuter
+	}
+
+	m.lgr.WithTrace(ctx).Info(
+		"Participant added into chat view",
+		"user_id", event.ParticipantIds,
+		"chat_id", event.ChatId,
+	)
+
+	return nil
+}
+
+func (m *CommonProjection) ChatViewOnParticipantRemoved(ctx context.Context, event *ParticipantDeleted) error {
+	_, err := m.db.ExecContext(ctx, `
+		delete from chat_user_view where user_id = any($1) and id = $2
+	`, event.ParticipantIds, event.ChatId)
+	if err != nil {
+		return err
+	}
+
+	m.lgr.WithTrace(ctx).Info(
+		"Participant removed from chat view",
+		"user_id", event.ParticipantIds,
+		"chat_id", event.ChatId,
+	)
+
+	return nil
+}
+
+func (m *CommonProjection) OnChatPinned(ctx context.Context, event *ChatPinned) error {
+	_, err := m.db.ExecContext(ctx, `
+		update chat_user_view
+		set pinned = $3
+		where (id, user_id) = ($1, $2)
+	`, event.ChatId, event.ParticipantId, event.Pinned)
+	if err != nil {
+		return err
+	}
+
+	m.lgr.WithTrace(ctx).Info(
+		"Chat pinned",
+		"user_id", event.ParticipantId,
+		"chat_id", event.ChatId,
+		"pinned", event.Pinned,
+	)
+
+	return nil
+}
+
+func (m *CommonProjection) ChatViewOnChatViewRefreshed(ctx context.Context, event *ChatViewRefreshed) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		// in oder not to have a potential race condition
+		// for example "by upserting refresh view we can resurrect view of the newly removed participant in case message add"
+		// we shouldn't upsert into chat_user_view
+		// we can only update it here
+
+		if event.LastMessageAction == LastMessageActionRefresh {
+			err := m.setLastMessage(ctx, tx, event.ParticipantIds, event.ChatId)
+			if err != nil {
+				return err
+			}
+		}
+
+		if event.ChatCommonAction == ChatCommonActionRefresh {
+			_, err := tx.ExecContext(ctx, `
+					UPDATE chat_user_view 
+					SET title = $3
+					WHERE user_id = any($1) and id = $2;
+				`, event.ParticipantIds, event.ChatId, event.Title)
+			if err != nil {
+				return fmt.Errorf("error during increasing unread messages: %w", err)
+			}
+		}
+
+		if event.ParticipantsAction == ParticipantsActionRefresh {
+			_, err := tx.ExecContext(ctx, `
+					with
+					this_chat_participants as (
+						select user_id, create_date_time from chat_participant where chat_id = $2
+					),
+					chat_participant_count as (
+						select count (*) as count from this_chat_participants
+					),
+					chat_participants_last_n as (
+						select user_id from this_chat_participants order by create_date_time desc limit $3
+					)
+					UPDATE chat_user_view 
+					SET 
+						participants_count = (select count from chat_participant_count),
+						participant_ids = (select array_agg(user_id) from chat_participants_last_n)
+					WHERE user_id = any($1) and id = $2;
+				`, event.ParticipantIds, event.ChatId, m.chatUserViewConfig.MaxViewableParticipants)
+			if err != nil {
+				return fmt.Errorf("error during increasing unread messages: %w", err)
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, `
+				update chat_user_view set update_date_time = $3 where user_id = any($1) and id = $2
+			`, event.ParticipantIds, event.ChatId, event.AdditionalData.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if errOuter != nil {
+		return errOuter
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+)
+
+// RunProjectionOffsetInheritance copies the committed offsets and the chat sequences of the chat projection, which has kept the consumer group of the former single projection,
+// into the groups of the projections split out of it. The groups are taken from the config, the migration only records which projections are to inherit.
+// It should be invoked before RunCqrsRouter, the new groups mustn't have members at this moment
+func RunProjectionOffsetInheritance(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	saramaClient sarama.Client,
+) error {
+	ctx := context.Background()
+
+	// the concurrently starting instances wait on the row locks and then find nothing to do
+	return db.Transact(ctx, dba, func(tx *db.Tx) error {
+		rows, err := tx.QueryContext(ctx, "select projection from projection_offset_inheritance for update")
+		if err != nil {
+			return err
+		}
+		projections := []string{}
+		for rows.Next() {
+			var projection string
+			err = rows.Scan(&projection)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			projections = append(projections, projection)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+
+		fromConsumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(config.ChatProjection)
+		if err != nil {
+			return err
+		}
+		for _, projection := range projections {
+			consumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+			if err != nil {
+				return err
+			}
+			lgr.Info("Inheriting the offsets", "consumer_group", consumerGroup, "from_consumer_group", fromConsumerGroup)
+			err = kafka.CopyCommittedOffsets(lgr, cfg, saramaClient, fromConsumerGroup, consumerGroup)
+			if err != nil {
+				return err
+			}
+
+			// otherwise the first event of every chat looks like a gap
+			_, err = tx.ExecContext(ctx, `
+				insert into projection_chat_sequence(projection, chat_id, last_seq)
+				select $1, chat_id, last_seq from projection_chat_sequence where projection = $2
+				on conflict (projection, chat_id) do nothing
+			`, consumerGroup, fromConsumerGroup)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "delete from projection_offset_inheritance where projection = $1", projection)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
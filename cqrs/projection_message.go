@@ -2,6 +2,8 @@ package cqrs
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"go-cqrs-chat-example/db"
 	"time"
@@ -9,6 +11,11 @@ import (
 
 func (m *CommonProjection) OnMessageCreated(ctx context.Context, event *MessageCreated) error {
 	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
+		}
+
 		chatExists, err := m.checkChatExists(ctx, tx, event.ChatId)
 		if err != nil {
 			return err
@@ -19,10 +26,10 @@ func (m *CommonProjection) OnMessageCreated(ctx context.Context, event *MessageC
 		}
 
 		_, err = tx.ExecContext(ctx, `
-		insert into message(id, chat_id, owner_id, content, create_date_time, update_date_time) 
-			values ($1, $2, $3, $4, $5, $6)
-		on conflict(chat_id, id) do update set owner_id = excluded.owner_id, content = excluded.content, create_date_time = excluded.create_date_time, update_date_time = excluded.update_date_time
-	`, event.Id, event.ChatId, event.OwnerId, event.Content, event.AdditionalData.CreatedAt, nil)
+		insert into message(id, chat_id, owner_id, content, create_date_time, update_date_time, version) 
+			values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict(chat_id, id) do update set owner_id = excluded.owner_id, content = excluded.content, create_date_time = excluded.create_date_time, update_date_time = excluded.update_date_time, version = excluded.version
+	`, event.Id, event.ChatId, event.OwnerId, event.Content, event.AdditionalData.CreatedAt, nil, max(event.AdditionalData.MessageVersion, 1))
 		if err != nil {
 			return err
 		}
@@ -40,6 +47,11 @@ func (m *CommonProjection) OnMessageCreated(ctx context.Context, event *MessageC
 
 func (m *CommonProjection) OnMessageEdited(ctx context.Context, event *MessageEdited) error {
 	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
+		}
+
 		messageExists, errInner := m.checkMessageExists(ctx, tx, event.ChatId, event.Id)
 		if errInner != nil {
 			return errInner
@@ -49,27 +61,16 @@ func (m *CommonProjection) OnMessageEdited(ctx context.Context, event *MessageEd
 			return nil
 		}
 
-		messageBlogPost, err := m.isMessageBlogPost(ctx, tx, event.ChatId, event.Id)
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.ExecContext(ctx, `
+		// the events published before the versioning of the messages increment it
+		_, err := tx.ExecContext(ctx, `
 			update message
-			set	content = $3, update_date_time = $4
+			set	content = $3, update_date_time = $4, version = case when cast($5 as bigint) > 0 then cast($5 as bigint) else coalesce(version, 1) + 1 end
 			where chat_id = $2 and id = $1 
-		`, event.Id, event.ChatId, event.Content, event.AdditionalData.CreatedAt)
+		`, event.Id, event.ChatId, event.Content, event.AdditionalData.CreatedAt, event.AdditionalData.MessageVersion)
 		if err != nil {
 			return err
 		}
 
-		if messageBlogPost {
-			err = m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
-			if err != nil {
-				return err
-			}
-		}
-
 		m.lgr.WithTrace(ctx).Info(
 			"Handling message edited",
 			"id", event.Id,
@@ -82,31 +83,24 @@ func (m *CommonProjection) OnMessageEdited(ctx context.Context, event *MessageEd
 	return errOuter
 }
 
-func (m *CommonProjection) initializeMessageUnreadMultipleParticipants(ctx context.Context, tx *db.Tx, participantIds []int64, chatId int64) error {
-	return m.setUnreadMessages(ctx, tx, participantIds, chatId, 0, true, false)
+func (m *CommonProjection) initializeMessageUnreadMultipleParticipants(ctx context.Context, tx *db.Tx, participantIds []int64, chatId int64, asOf time.Time) error {
+	return m.setUnreadMessages(ctx, tx, participantIds, chatId, 0, true, false, asOf)
 }
 
 func (m *CommonProjection) OnMessageRemoved(ctx context.Context, event *MessageDeleted) error {
 	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
-		messageBlogPost, err := m.isMessageBlogPost(ctx, tx, event.ChatId, event.MessageId)
-		if err != nil {
-			return err
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
 		}
 
-		_, err = tx.ExecContext(ctx, `
+		_, err := tx.ExecContext(ctx, `
 			delete from message where (id, chat_id) = ($1, $2)
 		`, event.MessageId, event.ChatId)
 		if err != nil {
 			return err
 		}
 
-		if messageBlogPost {
-			err = m.refreshBlog(ctx, tx, event.ChatId, event.AdditionalData.CreatedAt)
-			if err != nil {
-				return err
-			}
-		}
-
 		return nil
 	})
 	if errOuter != nil {
@@ -146,11 +140,13 @@ func (m *CommonProjection) setLastMessage(ctx context.Context, tx *db.Tx, partic
 	return nil
 }
 
-func (m *CommonProjection) setUnreadMessages(ctx context.Context, co db.CommonOperations, participantIds []int64, chatId, messageId int64, needSet, needRefresh bool) error {
+// setUnreadMessages counts only the messages created before asOf, the time of the event,
+// because the chat projection may have already handled the following MessageCreated, which come here as the increases
+func (m *CommonProjection) setUnreadMessages(ctx context.Context, co db.CommonOperations, participantIds []int64, chatId, messageId int64, needSet, needRefresh bool, asOf time.Time) error {
 	_, err := co.ExecContext(ctx, `
 		with 
 		chat_messages as (
-			select m.id from message m where m.chat_id = $2
+			select m.id from message m where m.chat_id = $2 and m.create_date_time <= $6
 		),
 		max_message as (
 			select max(m.id) as max from chat_messages m
@@ -212,7 +208,7 @@ func (m *CommonProjection) setUnreadMessages(ctx context.Context, co db.CommonOp
 			idt.last_message_id
 		from input_data idt
 		on conflict (user_id, chat_id) do update set unread_messages = excluded.unread_messages, last_message_id = excluded.last_message_id
-	`, participantIds, chatId, messageId, needSet, needRefresh)
+	`, participantIds, chatId, messageId, needSet, needRefresh, asOf)
 	return err
 }
 
@@ -220,7 +216,7 @@ func (m *CommonProjection) OnUnreadMessageReaded(ctx context.Context, event *Mes
 	// actually it should be an update
 	// but we give a chance to create a row unread_messages_user_view in case lack of it
 	// so message read event has a self-healing effect
-	err := m.setUnreadMessages(ctx, m.db, []int64{event.ParticipantId}, event.ChatId, event.MessageId, false, false)
+	err := m.setUnreadMessages(ctx, m.db, []int64{event.ParticipantId}, event.ChatId, event.MessageId, false, false, event.AdditionalData.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("error during read messages: %w", err)
 	}
@@ -248,6 +244,9 @@ func (m *CommonProjection) GetMessageOwner(ctx context.Context, chatId, messageI
 	var ownerId int64
 	err := r.Scan(&ownerId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, NewNotFoundError("message %v in chat %v", messageId, chatId)
+		}
 		return 0, err
 	}
 	return ownerId, nil
@@ -302,6 +301,7 @@ type MessageViewDto struct {
 	BlogPost       bool       `json:"blogPost"`
 	CreateDateTime time.Time  `json:"createDateTime"`
 	UpdateDateTime *time.Time `json:"editDateTime"` // for sake compatibility
+	Version        int64      `json:"version"`      // pass it in If-Match of the edit in order not to overwrite someone else's changes
 }
 
 func (m *CommonProjection) GetMessages(ctx context.Context, chatId int64, size int32, startingFromItemId *int64, includeStartingFrom, reverse bool) ([]MessageViewDto, error) {
@@ -334,7 +334,7 @@ func (m *CommonProjection) GetMessages(ctx context.Context, chatId int64, size i
 	}
 
 	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`
-			select m.id, m.owner_id, m.content, m.blog_post, m.create_date_time, m.update_date_time
+			select m.id, m.owner_id, m.content, m.blog_post, m.create_date_time, m.update_date_time, coalesce(m.version, 1)
 			from message m
 			where chat_id = $1 %s
 			order by m.id %s 
@@ -347,7 +347,7 @@ func (m *CommonProjection) GetMessages(ctx context.Context, chatId int64, size i
 	defer rows.Close()
 	for rows.Next() {
 		var cd MessageViewDto
-		err = rows.Scan(&cd.Id, &cd.OwnerId, &cd.Content, &cd.BlogPost, &cd.CreateDateTime, &cd.UpdateDateTime)
+		err = rows.Scan(&cd.Id, &cd.OwnerId, &cd.Content, &cd.BlogPost, &cd.CreateDateTime, &cd.UpdateDateTime, &cd.Version)
 		if err != nil {
 			return ma, err
 		}
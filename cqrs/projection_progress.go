@@ -0,0 +1,100 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"time"
+)
+
+type LastProcessedEvent struct {
+	Offset            int64      `json:"offset"`
+	EventType         string     `json:"eventType"`
+	EventDateTime     *time.Time `json:"eventDateTime"` // kafka timestamp of the event
+	TraceId           *string    `json:"traceId"`
+	ProcessedDateTime time.Time  `json:"processedDateTime"`
+}
+
+// ProjectionProgressRecorder remembers the last event every projection has handled in every partition,
+// the projection is the name of the router's handler, which is the same as its consumer group
+type ProjectionProgressRecorder struct {
+	lgr           *logger.LoggerWrapper
+	dba           *db.DB
+	cqrsMarshaler *CqrsMarshalerDecorator
+}
+
+func ConfigureProjectionProgressRecorder(
+	lgr *logger.LoggerWrapper,
+	dba *db.DB,
+	cqrsMarshaler *CqrsMarshalerDecorator,
+) *ProjectionProgressRecorder {
+	return &ProjectionProgressRecorder{
+		lgr:           lgr,
+		dba:           dba,
+		cqrsMarshaler: cqrsMarshaler,
+	}
+}
+
+func (pr *ProjectionProgressRecorder) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		produced, err := h(msg)
+		if err != nil {
+			return produced, err
+		}
+
+		ctx := msg.Context()
+		partition, hasPartition := kafka.MessagePartitionFromCtx(ctx)
+		offset, hasOffset := kafka.MessagePartitionOffsetFromCtx(ctx)
+		if !hasPartition || !hasOffset {
+			return produced, nil
+		}
+		var eventDateTime *time.Time
+		if ts, ok := kafka.MessageTimestampFromCtx(ctx); ok {
+			utc := ts.UTC()
+			eventDateTime = &utc
+		}
+
+		// the progress is only informational, so its failure doesn't make the event to be redelivered
+		_, errR := pr.dba.ExecContext(ctx, `
+			insert into projection_partition_progress(projection, partition, event_offset, event_type, event_date_time, trace_id, processed_date_time)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			on conflict (projection, partition) do update set
+				event_offset = excluded.event_offset,
+				event_type = excluded.event_type,
+				event_date_time = excluded.event_date_time,
+				trace_id = excluded.trace_id,
+				processed_date_time = excluded.processed_date_time
+			where projection_partition_progress.event_offset <= excluded.event_offset
+		`, message.HandlerNameFromCtx(ctx), partition, offset, pr.cqrsMarshaler.NameFromMessage(msg), eventDateTime, logger.GetTraceId(ctx), time.Now().UTC())
+		if errR != nil {
+			pr.lgr.WithTrace(ctx).Error("Unable to record the projection's progress", "err", errR)
+		}
+		return produced, nil
+	}
+}
+
+// GetLastProcessedEvents returns the last events by partition
+func (pr *ProjectionProgressRecorder) GetLastProcessedEvents(ctx context.Context, projection string) (map[int32]LastProcessedEvent, error) {
+	ma := map[int32]LastProcessedEvent{}
+	rows, err := pr.dba.QueryContext(ctx, `
+		select p.partition, p.event_offset, p.event_type, p.event_date_time, p.trace_id, p.processed_date_time
+		from projection_partition_progress p
+		where p.projection = $1
+	`, projection)
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var partition int32
+		var le LastProcessedEvent
+		err = rows.Scan(&partition, &le.Offset, &le.EventType, &le.EventDateTime, &le.TraceId, &le.ProcessedDateTime)
+		if err != nil {
+			return ma, err
+		}
+		ma[partition] = le
+	}
+	return ma, nil
+}
@@ -0,0 +1,107 @@
+package cqrs
+
+import (
+	"context"
+	"go-cqrs-chat-example/db"
+	"time"
+)
+
+func (m *CommonProjection) OnChatRetentionEdited(ctx context.Context, event *ChatRetentionEdited) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
+		}
+
+		chatExists, err := m.checkChatExists(ctx, tx, event.ChatId)
+		if err != nil {
+			return err
+		}
+		if !chatExists {
+			m.lgr.WithTrace(ctx).Info("Skipping ChatRetentionEdited because there is no chat", "chat_id", event.ChatId)
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			update chat_common
+			set retention_seconds = $2
+			where id = $1
+		`, event.ChatId, event.RetentionSeconds)
+		if err != nil {
+			return err
+		}
+		m.lgr.WithTrace(ctx).Info(
+			"Common chat retention edited",
+			"chat_id", event.ChatId,
+			"retention_seconds", event.RetentionSeconds,
+		)
+		return nil
+	})
+
+	return errOuter
+}
+
+type ChatRetention struct {
+	ChatId           int64
+	RetentionSeconds int64
+}
+
+func (m *CommonProjection) GetChatRetentions(ctx context.Context, co db.CommonOperations, size int32, offset int64) ([]ChatRetention, error) {
+	ma := []ChatRetention{}
+	rows, err := co.QueryContext(ctx, `
+		select c.id, c.retention_seconds
+		from chat_common c
+		where c.retention_seconds > 0
+		order by c.id asc
+		limit $1 offset $2
+	`, size, offset)
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cr ChatRetention
+		err = rows.Scan(&cr.ChatId, &cr.RetentionSeconds)
+		if err != nil {
+			return ma, err
+		}
+		ma = append(ma, cr)
+	}
+	return ma, nil
+}
+
+func (m *CommonProjection) GetExpiredMessageIds(ctx context.Context, co db.CommonOperations, chatId int64, createdBefore time.Time, size int32) ([]int64, error) {
+	ma := []int64{}
+	rows, err := co.QueryContext(ctx, `
+		select m.id
+		from message m
+		where m.chat_id = $1 and m.create_date_time < $2
+		order by m.id asc
+		limit $3
+	`, chatId, createdBefore, size)
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ii int64
+		err = rows.Scan(&ii)
+		if err != nil {
+			return ma, err
+		}
+		ma = append(ma, ii)
+	}
+	return ma, nil
+}
+
+const lockIdKeyRetention = 3
+
+func (m *CommonProjection) TryXactRetentionLock(ctx context.Context, tx *db.Tx) (bool, error) {
+	r := tx.QueryRowContext(ctx, "select pg_try_advisory_xact_lock($1, $2)", lockIdKey1, lockIdKeyRetention)
+	var acquired bool
+	err := r.Scan(&acquired)
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
@@ -0,0 +1,57 @@
+package cqrs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cqrs-chat-example/db"
+)
+
+func (m *CommonProjection) OnChatSlowModeEdited(ctx context.Context, event *ChatSlowModeEdited) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		errV := m.setChatVersion(ctx, tx, event.ChatId, event.AdditionalData)
+		if errV != nil {
+			return errV
+		}
+
+		chatExists, err := m.checkChatExists(ctx, tx, event.ChatId)
+		if err != nil {
+			return err
+		}
+		if !chatExists {
+			m.lgr.WithTrace(ctx).Info("Skipping ChatSlowModeEdited because there is no chat", "chat_id", event.ChatId)
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			update chat_common
+			set slow_mode_seconds = $2
+			where id = $1
+		`, event.ChatId, event.SlowModeSeconds)
+		if err != nil {
+			return err
+		}
+		m.lgr.WithTrace(ctx).Info(
+			"Common chat slow mode edited",
+			"chat_id", event.ChatId,
+			"slow_mode_seconds", event.SlowModeSeconds,
+		)
+		return nil
+	})
+
+	return errOuter
+}
+
+func (m *CommonProjection) GetChatSlowModeSeconds(ctx context.Context, chatId int64) (int64, error) {
+	r := m.db.QueryRowContext(ctx, "select slow_mode_seconds from chat_common where id = $1", chatId)
+	var slowModeSeconds int64
+	err := r.Scan(&slowModeSeconds)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// there were no rows, but otherwise no error occurred
+			return 0, nil
+		}
+		return 0, err
+	}
+	return slowModeSeconds, nil
+}
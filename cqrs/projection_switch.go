@@ -0,0 +1,196 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"sync"
+	"time"
+)
+
+// ProjectionSwitch hands the live projection over to the tables built by the rebuild command.
+// While the projection is paused its handler waits before every event, so nothing is written into the tables being replaced.
+// After the switch the handler skips the events which the rebuilt tables already contain,
+// so the consumer group stays the same and continues from its own offsets.
+type ProjectionSwitch struct {
+	lgr    *logger.LoggerWrapper
+	cfg    *config.AppConfig
+	dba    *db.DB
+	lock   sync.RWMutex
+	states map[string]projectionSwitchState // by projection
+}
+
+type projectionSwitchState struct {
+	paused     bool
+	generation int64
+	skipUpTo   map[int32]int64 // by partition
+}
+
+func ConfigureProjectionSwitch(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+) *ProjectionSwitch {
+	return &ProjectionSwitch{
+		lgr:    lgr,
+		cfg:    cfg,
+		dba:    dba,
+		states: map[string]projectionSwitchState{},
+	}
+}
+
+// RunProjectionSwitchWatcher should be invoked before RunCqrsRouter, so the state is known before the first event
+func RunProjectionSwitchWatcher(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	projectionSwitch *ProjectionSwitch,
+	lc fx.Lifecycle,
+) error {
+	err := projectionSwitch.refresh(context.Background())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStop: func(c context.Context) error {
+			lgr.Info("Stopping projection switch watcher")
+			cancelFunc()
+			return nil
+		},
+	})
+
+	go func() {
+		ticker := time.NewTicker(cfg.CqrsConfig.RebuildConfig.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				errR := projectionSwitch.refresh(ctx)
+				if errR != nil {
+					lgr.Error("Error during refreshing the projection switch state", "err", errR)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (ps *ProjectionSwitch) refresh(ctx context.Context) error {
+	rows, err := ps.dba.QueryContext(ctx, "select projection, paused, generation from projection_switch")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	loaded := map[string]projectionSwitchState{}
+	for rows.Next() {
+		var projection string
+		var st projectionSwitchState
+		err = rows.Scan(&projection, &st.paused, &st.generation)
+		if err != nil {
+			return err
+		}
+		loaded[projection] = st
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	for projection, st := range loaded {
+		ps.lock.RLock()
+		prev, known := ps.states[projection]
+		ps.lock.RUnlock()
+
+		if known && prev.generation == st.generation {
+			st.skipUpTo = prev.skipUpTo
+		} else {
+			// the offsets are loaded before the pause is lifted, so no event is applied twice
+			st.skipUpTo, err = ps.getSkipOffsets(ctx, projection)
+			if err != nil {
+				return err
+			}
+		}
+		if known && prev.paused != st.paused {
+			ps.lgr.Info("The projection switch state has changed", "projection", projection, "paused", st.paused, "generation", st.generation)
+		}
+
+		ps.lock.Lock()
+		ps.states[projection] = st
+		ps.lock.Unlock()
+	}
+	return nil
+}
+
+func (ps *ProjectionSwitch) getSkipOffsets(ctx context.Context, projection string) (map[int32]int64, error) {
+	ret := map[int32]int64{}
+	rows, err := ps.dba.QueryContext(ctx, "select partition, event_offset from projection_switch_offset where projection = $1", projection)
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var partition int32
+		var offset int64
+		err = rows.Scan(&partition, &offset)
+		if err != nil {
+			return ret, err
+		}
+		ret[partition] = offset
+	}
+	return ret, rows.Err()
+}
+
+func (ps *ProjectionSwitch) getState(projection string) (projectionSwitchState, bool) {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	st, ok := ps.states[projection]
+	return st, ok
+}
+
+func (ps *ProjectionSwitch) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		projection := message.HandlerNameFromCtx(ctx)
+
+		for {
+			st, ok := ps.getState(projection)
+			if !ok {
+				return h(msg)
+			}
+			if st.paused {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(ps.cfg.CqrsConfig.RebuildConfig.PollInterval):
+					continue
+				}
+			}
+
+			partition, hasPartition := kafka.MessagePartitionFromCtx(ctx)
+			offset, hasOffset := kafka.MessagePartitionOffsetFromCtx(ctx)
+			if hasPartition && hasOffset {
+				if skipUpTo, has := st.skipUpTo[partition]; has && offset <= skipUpTo {
+					ps.lgr.WithTrace(ctx).Debug("Skipping the event which is already in the rebuilt projection", "projection", projection, "partition", partition, "offset", offset)
+					return nil, nil
+				}
+			}
+			return h(msg)
+		}
+	}
+}
+
+// SetProjectionPaused is used by the rebuild command, serve notices the change within cqrs.rebuild.pollInterval
+func SetProjectionPaused(ctx context.Context, co db.CommonOperations, projection string, paused bool) error {
+	_, err := co.ExecContext(ctx, `
+		insert into projection_switch(projection, paused) values ($1, $2)
+		on conflict (projection) do update set paused = excluded.paused
+	`, projection, paused)
+	return err
+}
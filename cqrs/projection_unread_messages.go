@@ -0,0 +1,71 @@
+package cqrs
+
+import (
+	"context"
+	"fmt"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/utils"
+	"slices"
+)
+
+// the handlers of the unread messages projection, it writes unread_messages_user_view
+
+func (m *CommonProjection) UnreadMessagesOnParticipantAdded(ctx context.Context, event *ParticipantsAdded) error {
+	errOuter := db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		chatExists, err := m.checkChatExists(ctx, tx, event.ChatId)
+		if err != nil {
+			return err
+		}
+		if !chatExists {
+			m.lgr.WithTrace(ctx).Info("Skipping ParticipantsAdded because there is no chat", "chat_id", event.ChatId)
+			return nil
+		}
+
+		// recalc in case an user was added after
+		return m.initializeMessageUnreadMultipleParticipants(ctx, tx, event.ParticipantIds, event.ChatId, event.AdditionalData.CreatedAt)
+	})
+	return errOuter
+}
+
+func (m *CommonProjection) UnreadMessagesOnChatViewRefreshed(ctx context.Context, event *ChatViewRefreshed) error {
+	return db.Transact(ctx, m.db, func(tx *db.Tx) error {
+		if event.UnreadMessagesAction == UnreadMessagesActionIncrease {
+			participantIdsWithoutOwner := utils.GetSliceWithout(event.OwnerId, event.ParticipantIds)
+			var ownerId *int64
+			if slices.Contains(event.ParticipantIds, event.OwnerId) { // for batches without owner
+				ownerId = &event.OwnerId
+			}
+
+			// not owners
+			if len(participantIdsWithoutOwner) > 0 {
+				_, err := tx.ExecContext(ctx, `
+					UPDATE unread_messages_user_view 
+					SET unread_messages = unread_messages + $3
+					WHERE user_id = any($1) and chat_id = $2;
+				`, participantIdsWithoutOwner, event.ChatId, event.IncreaseOn)
+				if err != nil {
+					return fmt.Errorf("error during increasing unread messages: %w", err)
+				}
+			}
+
+			// owner
+			if ownerId != nil {
+				_, err := tx.ExecContext(ctx, `
+					UPDATE unread_messages_user_view 
+					SET last_message_id = (select max(id) from message where chat_id = $2 and create_date_time <= $3)
+					WHERE (user_id, chat_id) = ($1, $2);
+				`, *ownerId, event.ChatId, event.AdditionalData.CreatedAt)
+				if err != nil {
+					return fmt.Errorf("error during increasing unread messages: %w", err)
+				}
+			}
+		} else if event.UnreadMessagesAction == UnreadMessagesActionRefresh {
+			err := m.setUnreadMessages(ctx, tx, event.ParticipantIds, event.ChatId, 0, true, true, event.AdditionalData.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,352 @@
+package cqrs
+
+import (
+	"context"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ProjectionTables are written by every projection, the rest of the tables belong to the command side or to the other consumer groups
+var ProjectionTables = map[string][]string{
+	config.ChatProjection:           {"chat_common", "chat_participant", "message"},
+	config.ChatViewProjection:       {"chat_user_view"},
+	config.UnreadMessagesProjection: {"unread_messages_user_view"},
+	config.BlogProjection:           {"blog"},
+}
+
+// the distribution columns of the citus tables
+var projectionDistributedTables = map[string]string{
+	"chat_participant":          "chat_id",
+	"message":                   "chat_id",
+	"chat_user_view":            "user_id",
+	"unread_messages_user_view": "user_id",
+}
+
+// ProjectionRebuild is a blue/green rebuild of one projection:
+// the topic is replayed into the tables of a fresh schema under a new consumer group while the live projection keeps serving,
+// then the tables are switched in one transaction and the replaced ones are dropped
+type ProjectionRebuild struct {
+	Name          string   // one of config.AllProjections
+	Tables        []string // the tables of the projection
+	Projection    string   // the live consumer group, it stays the same after the switch
+	ConsumerGroup string   // the consumer group of the rebuilt projection, it's deleted after the switch
+	Schema        string   // the rebuilt tables till the switch
+	RetiredSchema string   // the replaced tables after the switch till the dropping
+}
+
+func NewProjectionRebuild(cfg *config.AppConfig, projection string) (*ProjectionRebuild, error) {
+	liveConsumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+	if err != nil {
+		return nil, err
+	}
+	suffix := utils.ToString(time.Now().Unix())
+	return &ProjectionRebuild{
+		Name:          projection,
+		Tables:        ProjectionTables[projection],
+		Projection:    liveConsumerGroup,
+		ConsumerGroup: liveConsumerGroup + "Rebuild" + suffix,
+		Schema:        "rebuild_" + suffix,
+		RetiredSchema: "retired_" + suffix,
+	}, nil
+}
+
+// ShadowConfig makes the rebuild command run only the rebuilt projection with the new consumer group into the new schema,
+// the unqualified table names are resolved by search_path, so the projection's code stays the same
+// and the tables of the other projections it reads are taken from public
+func (r *ProjectionRebuild) ShadowConfig(cfg *config.AppConfig) (*config.AppConfig, error) {
+	u, err := url.Parse(cfg.PostgreSQLConfig.Url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("search_path", r.Schema+",public")
+	u.RawQuery = q.Encode()
+
+	shadowCfg := *cfg
+	shadowCfg.PostgreSQLConfig.Url = u.String()
+	shadowCfg.ProjectionsConfig.Enabled = []string{r.Name}
+	err = shadowCfg.ProjectionsConfig.SetConsumerGroup(r.Name, r.ConsumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	return &shadowCfg, nil
+}
+
+// RunCreateShadowProjection should be invoked before RunCqrsRouter
+func RunCreateShadowProjection(
+	lgr *logger.LoggerWrapper,
+	dba *db.DB,
+	rebuild *ProjectionRebuild,
+) error {
+	ctx := context.Background()
+	lgr.Info("Creating the tables of the rebuilt projection", "schema", rebuild.Schema)
+
+	return db.Transact(ctx, dba, func(tx *db.Tx) error {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("create schema %s", rebuild.Schema))
+		if err != nil {
+			return err
+		}
+		for _, table := range rebuild.Tables {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("create table %s.%s (like public.%s including all)", rebuild.Schema, table, table))
+			if err != nil {
+				return err
+			}
+			if column, ok := projectionDistributedTables[table]; ok {
+				_, err = tx.ExecContext(ctx, "select create_distributed_table($1, $2)", rebuild.Schema+"."+table, column)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// RunProjectionRebuild waits for the rebuilt projection to catch up, pauses the live one, switches the tables and drops the replaced ones
+func RunProjectionRebuild(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	saramaClient sarama.Client,
+	kafkaAdmin sarama.ClusterAdmin,
+	cqrsRouter *message.Router,
+	rebuild *ProjectionRebuild,
+) error {
+	ctx := context.Background()
+	rebuildCfg := cfg.CqrsConfig.RebuildConfig
+
+	<-cqrsRouter.Running()
+
+	err := rebuild.waitForCatchingUp(lgr, cfg, saramaClient, rebuildCfg.MaxLag, 0)
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, false)
+		return err
+	}
+
+	lgr.Info("Pausing the live projection", "projection", rebuild.Projection, "grace_period", rebuildCfg.HandoffGracePeriod)
+	err = SetProjectionPaused(ctx, dba, rebuild.Projection, true)
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, true)
+		return err
+	}
+	time.Sleep(rebuildCfg.HandoffGracePeriod)
+
+	// the events keep coming during the pause, so the rebuilt projection is awaited up to the end of the topic at this moment instead of the zero lag,
+	// the later ones are applied by the live projection after the switch
+	handoffOffsets, err := kafka.GetPartitionOffsets(lgr, cfg, saramaClient, rebuild.ConsumerGroup)
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, true)
+		return err
+	}
+	err = rebuild.waitForReaching(lgr, cfg, saramaClient, handoffOffsets, rebuildCfg.CatchUpTimeout)
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, true)
+		return err
+	}
+
+	// after this the rebuilt projection commits its last offsets and doesn't consume anymore
+	err = cqrsRouter.Close()
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, true)
+		return err
+	}
+	committedOffsets, err := kafka.GetPartitionOffsets(lgr, cfg, saramaClient, rebuild.ConsumerGroup)
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, true)
+		return err
+	}
+
+	lgr.Info("Switching the projection", "projection", rebuild.Projection, "schema", rebuild.Schema)
+	err = db.Transact(ctx, dba, func(tx *db.Tx) error {
+		return rebuild.switchTables(ctx, tx, committedOffsets)
+	})
+	if err != nil {
+		rebuild.abort(ctx, lgr, dba, kafkaAdmin, cqrsRouter, true)
+		return err
+	}
+
+	lgr.Info("Dropping the replaced tables", "schema", rebuild.RetiredSchema)
+	_, err = dba.ExecContext(ctx, fmt.Sprintf("drop schema %s cascade", rebuild.RetiredSchema))
+	if err != nil {
+		return err
+	}
+	err = kafkaAdmin.DeleteConsumerGroup(rebuild.ConsumerGroup)
+	if err != nil {
+		return err
+	}
+
+	lgr.Info("The projection has been rebuilt", "projection", rebuild.Projection)
+	return nil
+}
+
+func (r *ProjectionRebuild) waitForCatchingUp(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	maxLag int64,
+	timeout time.Duration, // 0 means forever
+) error {
+	started := time.Now()
+	for {
+		offsets, err := kafka.GetPartitionOffsets(lgr, cfg, saramaClient, r.ConsumerGroup)
+		if err != nil {
+			return err
+		}
+		var lag int64
+		for _, po := range offsets {
+			lag += po.Lag
+		}
+		lgr.Info("Rebuilding the projection", "consumer_group", r.ConsumerGroup, "lag", lag, "percent", fmt.Sprintf("%.1f", kafka.ConsumedPercent(offsets)))
+		if lag <= maxLag {
+			return nil
+		}
+		if timeout > 0 && time.Since(started) > timeout {
+			return fmt.Errorf("the rebuilt projection hasn't caught up in %v, the lag is %v", timeout, lag)
+		}
+		time.Sleep(cfg.CqrsConfig.CheckAreEventsProcessedInterval)
+	}
+}
+
+// waitForReaching waits for the rebuilt projection to commit the given latest offsets of every partition
+func (r *ProjectionRebuild) waitForReaching(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	targets []kafka.PartitionOffsets,
+	timeout time.Duration,
+) error {
+	started := time.Now()
+	for {
+		offsets, err := kafka.GetPartitionOffsets(lgr, cfg, saramaClient, r.ConsumerGroup)
+		if err != nil {
+			return err
+		}
+		var remaining int64
+		for i, po := range offsets {
+			remaining += max(targets[i].LatestOffset-max(po.CommittedOffset, 0), 0)
+		}
+		lgr.Info("Catching up the paused projection", "consumer_group", r.ConsumerGroup, "remaining", remaining)
+		if remaining == 0 {
+			return nil
+		}
+		if time.Since(started) > timeout {
+			return fmt.Errorf("the rebuilt projection hasn't caught up in %v, %v events remain", timeout, remaining)
+		}
+		time.Sleep(cfg.CqrsConfig.CheckAreEventsProcessedInterval)
+	}
+}
+
+// switchTables is done in one transaction, so serve sees either the old tables or the rebuilt ones.
+// The live projection is paused at this moment, after the resuming it skips the events before the offsets committed by the rebuilt projection,
+// they are taken from kafka because the progress table is written before the commit of the offset and may be ahead of it
+func (r *ProjectionRebuild) switchTables(ctx context.Context, tx *db.Tx, committedOffsets []kafka.PartitionOffsets) error {
+	liveTables := []string{}
+	for _, table := range r.Tables {
+		liveTables = append(liveTables, "public."+table)
+	}
+
+	statements := []string{
+		// the commands and the queries wait for the end of the switch
+		fmt.Sprintf("lock table %s in access exclusive mode", strings.Join(liveTables, ", ")),
+	}
+	if slices.Contains(r.Tables, "chat_common") {
+		// the message ids are generated by the command side from chat_common
+		statements = append(statements, fmt.Sprintf(`update %s.chat_common n set last_generated_message_id = o.last_generated_message_id
+			from public.chat_common o where o.id = n.id and o.last_generated_message_id > n.last_generated_message_id`, r.Schema))
+	}
+	statements = append(statements, fmt.Sprintf("create schema %s", r.RetiredSchema))
+	for _, table := range r.Tables {
+		statements = append(statements, fmt.Sprintf("alter table public.%s set schema %s", table, r.RetiredSchema))
+	}
+	for _, table := range r.Tables {
+		statements = append(statements, fmt.Sprintf("alter table %s.%s set schema public", r.Schema, table))
+	}
+	statements = append(statements, fmt.Sprintf("drop schema %s", r.Schema))
+	for _, statement := range statements {
+		_, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the rebuilt projection's state becomes the live one's
+	for _, statement := range []string{
+		"delete from projection_chat_sequence where projection = $1",
+		"update projection_chat_sequence set projection = $1 where projection = $2",
+		"delete from projection_partition_progress where projection = $1",
+		"update projection_partition_progress set projection = $1 where projection = $2",
+		"delete from projection_switch_offset where projection = $1",
+		"update projection_switch set paused = false, generation = generation + 1, switch_date_time = (now() at time zone 'utc') where projection = $1",
+	} {
+		args := []any{r.Projection}
+		if strings.Contains(statement, "$2") {
+			args = append(args, r.ConsumerGroup)
+		}
+		_, err := tx.ExecContext(ctx, statement, args...)
+		if err != nil {
+			return err
+		}
+	}
+	for _, po := range committedOffsets {
+		if po.CommittedOffset <= 0 {
+			// the rebuilt projection hasn't consumed anything of the partition
+			continue
+		}
+		_, err := tx.ExecContext(ctx, "insert into projection_switch_offset(projection, partition, event_offset) values ($1, $2, $3)", r.Projection, po.Partition, po.CommittedOffset-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abort resumes the live projection and removes everything of the rebuilt one
+func (r *ProjectionRebuild) abort(
+	ctx context.Context,
+	lgr *logger.LoggerWrapper,
+	dba *db.DB,
+	kafkaAdmin sarama.ClusterAdmin,
+	cqrsRouter *message.Router,
+	paused bool,
+) {
+	lgr.Error("Aborting the rebuild", "projection", r.Projection)
+	if paused {
+		err := SetProjectionPaused(ctx, dba, r.Projection, false)
+		if err != nil {
+			lgr.Error("Unable to resume the live projection, resume it manually", "projection", r.Projection, "err", err)
+		}
+	}
+	err := cqrsRouter.Close()
+	if err != nil {
+		lgr.Error("Error during closing the router", "err", err)
+	}
+	for _, statement := range []string{
+		fmt.Sprintf("drop schema if exists %s cascade", r.Schema),
+		"delete from projection_chat_sequence where projection = $1",
+		"delete from projection_partition_progress where projection = $1",
+	} {
+		var errE error
+		if strings.Contains(statement, "$1") {
+			_, errE = dba.ExecContext(ctx, statement, r.ConsumerGroup)
+		} else {
+			_, errE = dba.ExecContext(ctx, statement)
+		}
+		if errE != nil {
+			lgr.Error("Error during removing the rebuilt projection", "err", errE)
+		}
+	}
+	err = kafkaAdmin.DeleteConsumerGroup(r.ConsumerGroup)
+	if err != nil {
+		lgr.Error("Error during deleting the consumer group", "consumer_group", r.ConsumerGroup, "err", err)
+	}
+}
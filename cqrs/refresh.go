@@ -0,0 +1,143 @@
+package cqrs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/utils"
+	"slices"
+)
+
+// RefreshChatViews publishes ChatViewRefreshed with all the refresh actions,
+// so the chat view and the unread messages projections recompute the rows of the participants from the tables of the chat projection.
+// The absent rows of chat_user_view aren't created by it, because an upsert could resurrect the view of a concurrently removed participant,
+// the conflict error is returned for them instead, the chatView projection should be reset then
+func RefreshChatViews(ctx context.Context, eventBus EventBusInterface, co db.CommonOperations, chatId int64, participantIds []int64) error {
+	var title string
+	err := co.QueryRowContext(ctx, "select title from chat_common where id = $1", chatId).Scan(&title)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewNotFoundError("chat %v is not found", chatId)
+	} else if err != nil {
+		return err
+	}
+
+	absentUserIds, err := getAbsentChatViews(ctx, co, chatId, participantIds)
+	if err != nil {
+		return err
+	}
+	if len(absentUserIds) > 0 {
+		return NewConflictError("the views of chat %v are absent for users %v, the refresh doesn't create them, reset the chatView projection", chatId, absentUserIds)
+	}
+
+	additionalData := GenerateMessageAdditionalData(ctx)
+	for portion := range slices.Chunk(participantIds, utils.DefaultSize) {
+		err = eventBus.Publish(ctx, &ChatViewRefreshed{
+			AdditionalData:       additionalData.ForEvent(),
+			ParticipantIds:       portion,
+			ChatId:               chatId,
+			Title:                title,
+			UnreadMessagesAction: UnreadMessagesActionRefresh,
+			LastMessageAction:    LastMessageActionRefresh,
+			ChatCommonAction:     ChatCommonActionRefresh,
+			ParticipantsAction:   ParticipantsActionRefresh,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getAbsentChatViews(ctx context.Context, co db.CommonOperations, chatId int64, participantIds []int64) ([]int64, error) {
+	rows, err := co.QueryContext(ctx, "select user_id from chat_user_view where id = $1 and user_id = any($2)", chatId, participantIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	present := map[int64]bool{}
+	for rows.Next() {
+		var userId int64
+		err = rows.Scan(&userId)
+		if err != nil {
+			return nil, err
+		}
+		present[userId] = true
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	ret := []int64{}
+	for _, userId := range participantIds {
+		if !present[userId] {
+			ret = append(ret, userId)
+		}
+	}
+	return ret, nil
+}
+
+// RefreshChat refreshes the views of all the participants of the chat
+func RefreshChat(ctx context.Context, eventBus EventBusInterface, co db.CommonOperations, commonProjection *CommonProjection, chatId int64) error {
+	exists, err := commonProjection.checkChatExists(ctx, co, chatId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return NewNotFoundError("chat %v is not found", chatId)
+	}
+	return commonProjection.IterateOverChatParticipantIds(ctx, co, chatId, nil, func(participantIdsPortion []int64) error {
+		return RefreshChatViews(ctx, eventBus, co, chatId, participantIdsPortion)
+	})
+}
+
+// RefreshChatParticipant refreshes the views of one participant of the chat
+func RefreshChatParticipant(ctx context.Context, eventBus EventBusInterface, co db.CommonOperations, chatId, userId int64) error {
+	var isParticipant bool
+	err := co.QueryRowContext(ctx, "select exists(select * from chat_participant where (chat_id, user_id) = ($1, $2))", chatId, userId).Scan(&isParticipant)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return NewNotFoundError("user %v is not a participant of chat %v", userId, chatId)
+	}
+	return RefreshChatViews(ctx, eventBus, co, chatId, []int64{userId})
+}
+
+// RefreshUserChats refreshes the views of the user in all the user's chats
+func RefreshUserChats(ctx context.Context, eventBus EventBusInterface, co db.CommonOperations, userId int64) error {
+	var lastChatId int64
+	for {
+		chatIds, err := getUserChatIdsAfter(ctx, co, userId, lastChatId, utils.DefaultSize)
+		if err != nil {
+			return err
+		}
+		if len(chatIds) == 0 {
+			return nil
+		}
+		for _, chatId := range chatIds {
+			lastChatId = chatId
+			err = RefreshChatViews(ctx, eventBus, co, chatId, []int64{userId})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func getUserChatIdsAfter(ctx context.Context, co db.CommonOperations, userId, chatId int64, limit int) ([]int64, error) {
+	rows, err := co.QueryContext(ctx, "select chat_id from chat_participant where user_id = $1 and chat_id > $2 order by chat_id limit $3", userId, chatId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, id)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,268 @@
+package cqrs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	wkafka "github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"sync"
+	"time"
+)
+
+// ReplayStop is the point in the past where the router stops applying the events, so the state of the projections at that moment can be queried.
+// It's set by reset and is loaded by serve, which becomes read-only: the commands and the retention are disabled.
+// The consumption of a partition is paused at the first event past the point, so the consumer groups continue from it after the stop is cleared
+type ReplayStop struct {
+	Offsets   map[int32]int64 // the last applied offset by partition, the partitions absent here aren't limited by the offset
+	CreatedAt *time.Time      // the events created after it aren't applied
+
+	lgr     *logger.LoggerWrapper
+	lock    sync.RWMutex
+	reached map[string]map[int32]bool // the partitions which have got an event past the point, by consumer group
+}
+
+func (s *ReplayStop) IsSet() bool {
+	return len(s.Offsets) > 0 || s.CreatedAt != nil
+}
+
+// ParseReplayStopOffsets parses the "partition=offset" pairs
+func ParseReplayStopOffsets(pairs []string) (map[int32]int64, error) {
+	return kafka.ParsePartitionOffsets(pairs)
+}
+
+// RunSetReplayStop should be invoked by reset after the migrations
+func RunSetReplayStop(
+	lgr *logger.LoggerWrapper,
+	dba *db.DB,
+	replayStop *ReplayStop,
+) error {
+	if !replayStop.IsSet() {
+		return nil
+	}
+	var offsets []byte
+	if len(replayStop.Offsets) > 0 {
+		var err error
+		offsets, err = json.Marshal(replayStop.Offsets)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := dba.ExecContext(context.Background(), `
+		insert into replay_stop(event_offsets, created_at) values ($1, $2)
+		on conflict (id) do update set event_offsets = excluded.event_offsets, created_at = excluded.created_at
+	`, offsets, replayStop.CreatedAt)
+	if err != nil {
+		return err
+	}
+	lgr.Info("The replay is going to stop", "offsets", replayStop.Offsets, "created_at", replayStop.CreatedAt)
+	return nil
+}
+
+// RunClearReplayStop is invoked by reset --clear-stop, the next serve continues the projections from the point and accepts the commands.
+// The chat aggregates have been built from the projections at the point, so they are removed and rebuilt after the projections have caught up
+func RunClearReplayStop(
+	lgr *logger.LoggerWrapper,
+	dba *db.DB,
+	commonProjection *CommonProjection,
+) error {
+	ctx := context.Background()
+	return db.Transact(ctx, dba, func(tx *db.Tx) error {
+		res, err := tx.ExecContext(ctx, "delete from replay_stop")
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			lgr.Info("The replay stop isn't set")
+			return nil
+		}
+		for _, table := range []string{"chat_aggregate", "chat_aggregate_participant", "chat_aggregate_message"} {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("delete from %s", table))
+			if err != nil {
+				return err
+			}
+		}
+		err = commonProjection.SetIsNeedToFastForwardSequences(ctx, tx)
+		if err != nil {
+			return err
+		}
+		lgr.Info("The replay stop has been cleared, the projections continue from it on the next start")
+		return nil
+	})
+}
+
+func ConfigureReplayStop(
+	lgr *logger.LoggerWrapper,
+	dba *db.DB,
+) (*ReplayStop, error) {
+	ret := &ReplayStop{
+		lgr:     lgr,
+		reached: map[string]map[int32]bool{},
+	}
+
+	var offsets []byte
+	var createdAt sql.NullTime
+	err := dba.QueryRowContext(context.Background(), "select event_offsets, created_at from replay_stop").Scan(&offsets, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if offsets != nil {
+		err = json.Unmarshal(offsets, &ret.Offsets)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if createdAt.Valid {
+		t := createdAt.Time.UTC()
+		ret.CreatedAt = &t
+	}
+	lgr.Warn("The replay stops at the point in the past, serving read-only", "offsets", ret.Offsets, "created_at", ret.CreatedAt)
+	return ret, nil
+}
+
+// IsReached tells that the consumer group has stopped in the partition on purpose, so it's considered caught up there
+func (s *ReplayStop) IsReached(consumerGroup string, partition int32) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.reached[consumerGroup][partition]
+}
+
+// ConfigureIsPartitionStopped lets the catching up finish when the replay has reached the stop
+func ConfigureIsPartitionStopped(replayStop *ReplayStop) kafka.IsPartitionStopped {
+	return replayStop.IsReached
+}
+
+func (s *ReplayStop) setReached(consumerGroup string, partition int32) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.reached[consumerGroup] == nil {
+		s.reached[consumerGroup] = map[int32]bool{}
+	}
+	wasReached := s.reached[consumerGroup][partition]
+	s.reached[consumerGroup][partition] = true
+	return !wasReached
+}
+
+type eventCreatedAt struct {
+	AdditionalData *struct {
+		CreatedAt time.Time `json:"createdAt"`
+	} `json:"additionalData"`
+}
+
+func (s *ReplayStop) isPast(kafkaMessage *sarama.ConsumerMessage) bool {
+	if stopOffset, ok := s.Offsets[kafkaMessage.Partition]; ok && kafkaMessage.Offset > stopOffset {
+		return true
+	}
+	if s.CreatedAt == nil {
+		return false
+	}
+	ec := eventCreatedAt{}
+	err := json.Unmarshal(kafkaMessage.Value, &ec)
+	if err == nil && ec.AdditionalData != nil && !ec.AdditionalData.CreatedAt.IsZero() {
+		return ec.AdditionalData.CreatedAt.After(*s.CreatedAt)
+	}
+	// the events without the envelope are compared by the time they were sent to kafka
+	if !kafkaMessage.Timestamp.IsZero() {
+		return kafkaMessage.Timestamp.After(*s.CreatedAt)
+	}
+	return false
+}
+
+// SubscriberTracer pauses the consumption of the partitions of the consumer group at the first event past the point.
+// The event isn't passed to the router, so the handler isn't blocked and the rebalances aren't held by it,
+// sarama stops fetching the partition when its messages aren't taken. It returns nil when the stop isn't set
+func (s *ReplayStop) SubscriberTracer(consumerGroup string) wkafka.SaramaTracer {
+	if !s.IsSet() {
+		return nil
+	}
+	return &replayStopTracer{replayStop: s, consumerGroup: consumerGroup}
+}
+
+// replayStopTracer only wraps the handler of the consumer group, the rest is left untouched
+type replayStopTracer struct {
+	replayStop    *ReplayStop
+	consumerGroup string
+}
+
+func (t *replayStopTracer) WrapConsumer(c sarama.Consumer) sarama.Consumer {
+	return c
+}
+
+func (t *replayStopTracer) WrapPartitionConsumer(pc sarama.PartitionConsumer) sarama.PartitionConsumer {
+	return pc
+}
+
+func (t *replayStopTracer) WrapConsumerGroupHandler(h sarama.ConsumerGroupHandler) sarama.ConsumerGroupHandler {
+	return &replayStopHandler{ConsumerGroupHandler: h, replayStop: t.replayStop, consumerGroup: t.consumerGroup}
+}
+
+func (t *replayStopTracer) WrapSyncProducer(cfg *sarama.Config, p sarama.SyncProducer) sarama.SyncProducer {
+	return p
+}
+
+type replayStopHandler struct {
+	sarama.ConsumerGroupHandler
+	replayStop    *ReplayStop
+	consumerGroup string
+}
+
+// replayStopClaim passes the messages of the claim only up to the point
+type replayStopClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *replayStopClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func (h *replayStopHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	stoppedClaim := &replayStopClaim{ConsumerGroupClaim: claim, messages: make(chan *sarama.ConsumerMessage)}
+	go func() {
+		// the wrapped handler finishes the claim when the channel is closed
+		defer close(stoppedClaim.messages)
+		for {
+			select {
+			case <-sess.Context().Done():
+				return
+			case kafkaMessage, ok := <-claim.Messages():
+				if !ok {
+					return
+				}
+				if h.replayStop.isPast(kafkaMessage) {
+					if h.replayStop.setReached(h.consumerGroup, kafkaMessage.Partition) {
+						h.replayStop.lgr.Info("The replay has reached the stop", "consumer_group", h.consumerGroup, "partition", kafkaMessage.Partition, "offset", kafkaMessage.Offset)
+					}
+					// neither this event nor the following ones are taken till the end of the session
+					<-sess.Context().Done()
+					return
+				}
+				select {
+				case stoppedClaim.messages <- kafkaMessage:
+				case <-sess.Context().Done():
+					return
+				}
+			}
+		}
+	}()
+	return h.ConsumerGroupHandler.ConsumeClaim(sess, stoppedClaim)
+}
+
+// checkWritable is called before publishing, so neither the commands nor the retention change anything while the replay is stopped
+func (s *ReplayStop) checkWritable() error {
+	if s.IsSet() {
+		return NewReadOnlyError("the server shows the state at the replay stop, the commands are disabled")
+	}
+	return nil
+}
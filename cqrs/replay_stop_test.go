@@ -0,0 +1,109 @@
+package cqrs
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-cqrs-chat-example/logger"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestParseReplayStopOffsets(t *testing.T) {
+	offsets, err := ParseReplayStopOffsets([]string{"0=120", "3=7"})
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]int64{0: 120, 3: 7}, offsets)
+
+	_, err = ParseReplayStopOffsets([]string{"120"})
+	assert.Error(t, err)
+	_, err = ParseReplayStopOffsets([]string{"a=1"})
+	assert.Error(t, err)
+}
+
+func TestReplayStopIsPast(t *testing.T) {
+	stopAt := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	replayStop := &ReplayStop{Offsets: map[int32]int64{0: 10}, CreatedAt: &stopAt}
+
+	before := []byte(`{"additionalData":{"createdAt":"2025-06-01T09:59:59Z"},"chatId":1}`)
+	after := []byte(`{"additionalData":{"createdAt":"2025-06-01T10:00:01Z"},"chatId":1}`)
+
+	assert.False(t, replayStop.isPast(&sarama.ConsumerMessage{Value: before, Partition: 0, Offset: 10}))
+	assert.True(t, replayStop.isPast(&sarama.ConsumerMessage{Value: before, Partition: 0, Offset: 11}), "past the offset")
+	assert.False(t, replayStop.isPast(&sarama.ConsumerMessage{Value: before, Partition: 1, Offset: 11}), "the partition isn't limited by the offset")
+	assert.True(t, replayStop.isPast(&sarama.ConsumerMessage{Value: after, Partition: 1, Offset: 0}), "past the time")
+	assert.True(t, replayStop.isPast(&sarama.ConsumerMessage{Value: []byte(`{}`), Partition: 1, Offset: 0, Timestamp: stopAt.Add(time.Second)}), "the event without the envelope is past the time of sending")
+}
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+}
+
+func (s *testSession) Context() context.Context {
+	return s.ctx
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+type recordingHandler struct {
+	sarama.ConsumerGroupHandler
+	offsets []int64
+}
+
+func (h *recordingHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for kafkaMessage := range claim.Messages() {
+		h.offsets = append(h.offsets, kafkaMessage.Offset)
+	}
+	return nil
+}
+
+func TestReplayStopPausesPartition(t *testing.T) {
+	replayStop := &ReplayStop{
+		Offsets: map[int32]int64{0: 10},
+		lgr:     logger.NewLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		reached: map[string]map[int32]bool{},
+	}
+	recorder := &recordingHandler{}
+	handler := replayStop.SubscriberTracer("ChatProjection").WrapConsumerGroupHandler(recorder)
+
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 4)}
+	for offset := int64(9); offset <= 12; offset++ {
+		claim.messages <- &sarama.ConsumerMessage{Value: []byte(`{}`), Partition: 0, Offset: offset}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- handler.ConsumeClaim(&testSession{ctx: ctx}, claim)
+	}()
+
+	require.Eventually(t, func() bool {
+		return replayStop.IsReached("ChatProjection", 0)
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, replayStop.IsReached("ChatProjection", 1))
+	select {
+	case <-done:
+		t.Fatal("the claim should be held till the end of the session")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the rebalance isn't blocked by the paused partition
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the claim should be finished with the session")
+	}
+	assert.Equal(t, []int64{9, 10}, recorder.offsets)
+	assert.Len(t, claim.messages, 1, "the events after the first past one aren't taken from the claim")
+}
@@ -0,0 +1,71 @@
+package cqrs
+
+import (
+	"context"
+	"fmt"
+	"github.com/IBM/sarama"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"slices"
+	"strings"
+)
+
+// ProjectionReset are the projections the reset command empties, unlike the full reset the other tables and consumer groups are left as they are
+type ProjectionReset struct {
+	Projections []string
+}
+
+// RunResetProjections truncates the tables of the projections and deletes their consumer groups, so serve replays the topic into them.
+// The instances running these projections should be stopped
+func RunResetProjections(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	kafkaAdmin sarama.ClusterAdmin,
+	commonProjection *CommonProjection,
+	projectionReset *ProjectionReset,
+) error {
+	ctx := context.Background()
+
+	consumerGroups, err := cfg.ProjectionsConfig.ConsumerGroups(projectionReset.Projections)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transact(ctx, dba, func(tx *db.Tx) error {
+		for i, projection := range projectionReset.Projections {
+			lgr.Warn("Resetting the projection", "projection", projection, "tables", ProjectionTables[projection])
+			_, err := tx.ExecContext(ctx, fmt.Sprintf("truncate table %s", strings.Join(ProjectionTables[projection], ", ")))
+			if err != nil {
+				return err
+			}
+			for _, statement := range []string{
+				"delete from projection_chat_sequence where projection = $1",
+				"delete from projection_partition_progress where projection = $1",
+				"delete from projection_switch_offset where projection = $1",
+			} {
+				_, err = tx.ExecContext(ctx, statement, consumerGroups[i])
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = kafka.DeleteConsumerGroups(lgr, kafkaAdmin, consumerGroups)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(projectionReset.Projections, config.ChatProjection) {
+		// the message ids are continued from the replayed messages
+		return commonProjection.SetIsNeedToFastForwardSequences(ctx, dba)
+	}
+	return nil
+}
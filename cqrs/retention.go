@@ -0,0 +1,131 @@
+package cqrs
+
+import (
+	"context"
+	"errors"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"go.uber.org/fx"
+	"time"
+)
+
+// RunMessageRetention periodically emits MessageDeleted for the messages which are older than their chat's retention.
+// We remove messages only through the events, so the projections and the replay stay consistent.
+func RunMessageRetention(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	eventBus *PartitionAwareEventBus,
+	dba *db.DB,
+	commonProjection *CommonProjection,
+	chatRepository *ChatRepository,
+	replayStop *ReplayStop,
+	lc fx.Lifecycle,
+) {
+	interval := cfg.CqrsConfig.RetentionConfig.CheckInterval
+	if interval <= 0 {
+		lgr.Info("Message retention is disabled")
+		return
+	}
+	if replayStop.IsSet() {
+		lgr.Info("Message retention is disabled while the replay is stopped")
+		return
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStop: func(c context.Context) error {
+			lgr.Info("Stopping message retention")
+			cancelFunc()
+			return nil
+		},
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := EnforceMessageRetention(ctx, lgr, cfg, eventBus, dba, commonProjection, chatRepository)
+				if err != nil {
+					lgr.Error("Error during enforcing message retention", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+func EnforceMessageRetention(
+	ctx context.Context,
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	eventBus EventBusInterface,
+	dba *db.DB,
+	commonProjection *CommonProjection,
+	chatRepository *ChatRepository,
+) error {
+	return db.Transact(ctx, dba, func(tx *db.Tx) error {
+		// only one instance emits the deletions at the moment
+		acquired, err := commonProjection.TryXactRetentionLock(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			lgr.Debug("Message retention is being enforced by another instance")
+			return nil
+		}
+
+		now := time.Now().UTC()
+		shouldContinue := true
+		for page := int64(0); shouldContinue; page++ {
+			offset := utils.GetOffset(page, utils.DefaultSize)
+
+			retentions, err := commonProjection.GetChatRetentions(ctx, tx, utils.DefaultSize, offset)
+			if err != nil {
+				return err
+			}
+			if len(retentions) < utils.DefaultSize {
+				shouldContinue = false
+			}
+
+			for _, cr := range retentions {
+				createdBefore := now.Add(-time.Duration(cr.RetentionSeconds) * time.Second)
+				// the rest of them will be taken on the next iteration
+				// the projection may not have applied the previous deletions yet, the aggregate skips them
+				messageIds, err := commonProjection.GetExpiredMessageIds(ctx, tx, cr.ChatId, createdBefore, cfg.CqrsConfig.RetentionConfig.BatchSize)
+				if err != nil {
+					return err
+				}
+				if len(messageIds) == 0 {
+					continue
+				}
+
+				additionalData := GenerateMessageAdditionalData(ctx)
+				var expiredMessageIds []int64
+				_, err = chatRepository.Execute(ctx, eventBus, cr.ChatId, func(chat *Chat) error {
+					var cerr error
+					expiredMessageIds, cerr = chat.ExpireMessages(ctx, additionalData, messageIds)
+					if cerr != nil {
+						return cerr
+					}
+					return refreshViewsAfterMessagesDeleted(ctx, chat, commonProjection)
+				})
+				if errors.Is(err, ErrNotFound) {
+					continue
+				} else if err != nil {
+					return err
+				}
+				if len(expiredMessageIds) == 0 {
+					continue
+				}
+
+				lgr.Info("Removed expired messages", "chat_id", cr.ChatId, "count", len(expiredMessageIds))
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,246 @@
+package cqrs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"slices"
+	"time"
+)
+
+// ChatSequenceMetadataKey is the kafka header with the number of the event within its chat, starting from 1
+const ChatSequenceMetadataKey = "chat_seq"
+
+const chatSequenceKey = "chat_sequence"
+
+type SequenceAnomaly string
+
+const (
+	SequenceAnomalyNone      SequenceAnomaly = ""
+	SequenceAnomalyGap       SequenceAnomaly = "gap"       // some events between the last seen and this one are missing
+	SequenceAnomalyDuplicate SequenceAnomaly = "duplicate" // this event has already been handled
+	SequenceAnomalyReorder   SequenceAnomaly = "reorder"   // this event is older than the last seen one
+)
+
+// classifySequence compares the event's sequence number with the last handled one of its chat
+func classifySequence(lastSeq int64, lastExists bool, seq int64) SequenceAnomaly {
+	if !lastExists {
+		lastSeq = 0
+	}
+	switch {
+	case seq == lastSeq+1:
+		return SequenceAnomalyNone
+	case seq > lastSeq+1:
+		return SequenceAnomalyGap
+	case seq == lastSeq:
+		return SequenceAnomalyDuplicate
+	default:
+		return SequenceAnomalyReorder
+	}
+}
+
+// nextChatSequence takes the row lock till the end of tx, so the events of the same chat are published in the order of their numbers
+func nextChatSequence(ctx context.Context, tx *db.Tx, chatId int64) (int64, error) {
+	var seq int64
+	err := tx.QueryRowContext(ctx, `
+		insert into chat_event_sequence(chat_id, last_seq) values ($1, 1)
+		on conflict (chat_id) do update set last_seq = chat_event_sequence.last_seq + 1
+		returning last_seq
+	`, chatId).Scan(&seq)
+	return seq, err
+}
+
+func makeContextWithChatSequence(parent context.Context, seq int64) context.Context {
+	return context.WithValue(parent, chatSequenceKey, seq)
+}
+
+// setChatSequenceMetadata is called from OnPublish, when the message has been already created
+func setChatSequenceMetadata(msg *message.Message) {
+	seq, ok := msg.Context().Value(chatSequenceKey).(int64)
+	if ok {
+		msg.Metadata.Set(ChatSequenceMetadataKey, utils.ToString(seq))
+	}
+}
+
+// SequenceChecker checks the sequence numbers of the events which come into the projections.
+// The duplicates are skipped, the gaps and the reorderings are logged and counted,
+// then they are either applied or, if cqrs.sequence.haltOnInconsistency is set, nacked over and over again, so the partition stops until someone looks into it.
+type SequenceChecker struct {
+	lgr             *logger.LoggerWrapper
+	dba             *db.DB
+	projectionNames []string // the consumer groups of the enabled projections
+	chatProjection  string   // the consumer group of the projection whose tables are read by the rest ones
+	waitInterval    time.Duration
+	halt            bool
+	anomalies       metric.Int64Counter
+}
+
+func ConfigureSequenceChecker(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+) (*SequenceChecker, error) {
+	anomalies, err := otel.Meter(meterName).Int64Counter(
+		"chat_event_sequence_anomalies",
+		metric.WithDescription("The events which came into the projection out of their chat's sequence"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	projectionNames, err := cfg.ProjectionsConfig.EnabledConsumerGroups()
+	if err != nil {
+		return nil, err
+	}
+	return &SequenceChecker{
+		lgr:             lgr,
+		dba:             dba,
+		projectionNames: projectionNames,
+		chatProjection:  cfg.ProjectionsConfig.ChatConfig.ConsumerGroup,
+		waitInterval:    cfg.KafkaConfig.KafkaConsumerConfig.NackResendSleep,
+		halt:            cfg.CqrsConfig.SequenceConfig.HaltOnInconsistency,
+		anomalies:       anomalies,
+	}, nil
+}
+
+func (sc *SequenceChecker) getLastSeq(ctx context.Context, projectionName string, chatId int64) (int64, bool, error) {
+	var lastSeq int64
+	err := sc.dba.QueryRowContext(ctx, "select last_seq from projection_chat_sequence where (projection, chat_id) = ($1, $2)", projectionName, chatId).Scan(&lastSeq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return lastSeq, err == nil, err
+}
+
+func (sc *SequenceChecker) setLastSeq(ctx context.Context, projectionName string, chatId, seq int64) error {
+	_, err := sc.dba.ExecContext(ctx, `
+		insert into projection_chat_sequence(projection, chat_id, last_seq) values ($1, $2, $3)
+		on conflict (projection, chat_id) do update set last_seq = greatest(projection_chat_sequence.last_seq, excluded.last_seq)
+	`, projectionName, chatId, seq)
+	return err
+}
+
+// getChatSequence returns false if the event was published before the sequencing
+func (sc *SequenceChecker) getChatSequence(msg *message.Message) (int64, int64, bool) {
+	ctx := msg.Context()
+	seqString := msg.Metadata.Get(ChatSequenceMetadataKey)
+	key, hasKey := kafka.MessageKeyFromCtx(ctx)
+	if seqString == "" || !hasKey {
+		return 0, 0, false
+	}
+	seq, err := utils.ParseInt64(seqString)
+	if err != nil {
+		sc.lgr.WithTrace(ctx).Error("Unable to parse the sequence number, skipping the check", "seq", seqString, "err", err)
+		return 0, 0, false
+	}
+	chatId, err := utils.ParseInt64(string(key))
+	if err != nil {
+		sc.lgr.WithTrace(ctx).Error("Unable to parse the chat id, skipping the check", "key", string(key), "err", err)
+		return 0, 0, false
+	}
+	return chatId, seq, true
+}
+
+func (sc *SequenceChecker) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		projectionName := message.HandlerNameFromCtx(ctx)
+		if !slices.Contains(sc.projectionNames, projectionName) {
+			return h(msg)
+		}
+
+		chatId, seq, ok := sc.getChatSequence(msg)
+		if !ok {
+			return h(msg)
+		}
+
+		lastSeq, lastExists, err := sc.getLastSeq(ctx, projectionName, chatId)
+		if err != nil {
+			return nil, err
+		}
+
+		anomaly := classifySequence(lastSeq, lastExists, seq)
+		if anomaly != SequenceAnomalyNone {
+			sc.anomalies.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("projection", projectionName),
+				attribute.String("kind", string(anomaly)),
+			))
+		}
+
+		switch anomaly {
+		case SequenceAnomalyDuplicate:
+			sc.lgr.WithTrace(ctx).Warn("Skipping the duplicated event", "projection", projectionName, "chat_id", chatId, "seq", seq)
+			return nil, nil
+		case SequenceAnomalyGap, SequenceAnomalyReorder:
+			if sc.halt {
+				sc.lgr.WithTrace(ctx).Error("Halting the partition because of the inconsistent sequence", "projection", projectionName, "anomaly", anomaly, "chat_id", chatId, "seq", seq, "last_seq", lastSeq)
+				return nil, fmt.Errorf("%v in the sequence of chat %v: got %v after %v", anomaly, chatId, seq, lastSeq)
+			}
+			sc.lgr.WithTrace(ctx).Error("Applying the event despite the inconsistent sequence", "projection", projectionName, "anomaly", anomaly, "chat_id", chatId, "seq", seq, "last_seq", lastSeq)
+		}
+
+		produced, err := h(msg)
+		if err != nil {
+			return produced, err
+		}
+
+		return produced, sc.setLastSeq(ctx, projectionName, chatId, seq)
+	}
+}
+
+// ChatProjectionMiddleware holds the event in the projections which read the tables of the chat projection
+// till the chat projection has handled the same event, so they never see the chat older than the event.
+// The chat projection may be ahead of them, in this case they see the newer chat, which is refreshed by the following events anyway
+func (sc *SequenceChecker) ChatProjectionMiddleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		projectionName := message.HandlerNameFromCtx(ctx)
+		if projectionName == sc.chatProjection || !slices.Contains(sc.projectionNames, projectionName) {
+			return h(msg)
+		}
+
+		chatId, seq, ok := sc.getChatSequence(msg)
+		if !ok {
+			return h(msg)
+		}
+
+		logged := false
+		for {
+			chatSeq, _, err := sc.getLastSeq(ctx, sc.chatProjection, chatId)
+			if err != nil {
+				return nil, err
+			}
+			if chatSeq >= seq {
+				return h(msg)
+			}
+			if !logged {
+				sc.lgr.WithTrace(ctx).Debug("Waiting for the chat projection to handle the event", "projection", projectionName, "chat_id", chatId, "seq", seq, "chat_projection_seq", chatSeq)
+				logged = true
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(sc.waitInterval):
+			}
+		}
+	}
+}
+
+// FastForwardChatSequences continues the numbering after the imported events
+func FastForwardChatSequences(ctx context.Context, tx *db.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		insert into chat_event_sequence(chat_id, last_seq)
+		select chat_id, max(last_seq) from projection_chat_sequence group by chat_id
+		on conflict (chat_id) do update set last_seq = greatest(chat_event_sequence.last_seq, excluded.last_seq)
+	`)
+	return err
+}
@@ -0,0 +1,18 @@
+package cqrs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClassifySequence(t *testing.T) {
+	assert.Equal(t, SequenceAnomalyNone, classifySequence(0, false, 1))
+	assert.Equal(t, SequenceAnomalyNone, classifySequence(5, true, 6))
+
+	assert.Equal(t, SequenceAnomalyGap, classifySequence(0, false, 2))
+	assert.Equal(t, SequenceAnomalyGap, classifySequence(5, true, 8))
+
+	assert.Equal(t, SequenceAnomalyDuplicate, classifySequence(5, true, 5))
+
+	assert.Equal(t, SequenceAnomalyReorder, classifySequence(5, true, 3))
+}
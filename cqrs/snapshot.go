@@ -0,0 +1,344 @@
+package cqrs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// SnapshotHeader is the first line of the snapshot file, the rows of the tables follow it
+type SnapshotHeader struct {
+	MigrationVersion uint                       `json:"migrationVersion"`
+	CreateDateTime   time.Time                  `json:"createDateTime"`
+	Topic            string                     `json:"topic"`
+	ConsumerGroups   map[string]string          `json:"consumerGroups"` // by projection at the moment of the snapshot
+	Offsets          map[string]map[int32]int64 `json:"offsets"`        // the next offsets to consume by partition, by projection
+}
+
+type snapshotRow struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// the projections' own state, only the rows of the projections' consumer groups are taken
+var snapshotStateTables = []string{"projection_chat_sequence", "projection_partition_progress"}
+
+const snapshotBatchSize = 1000
+
+func snapshotTables() []string {
+	tables := []string{}
+	for _, projection := range config.AllProjections {
+		tables = append(tables, ProjectionTables[projection]...)
+	}
+	return append(tables, snapshotStateTables...)
+}
+
+// RunSnapshot pauses the projections, so their tables and their progress correspond to each other,
+// and writes them in one repeatable read transaction along with the offsets to continue from
+func RunSnapshot(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	saramaClient sarama.Client,
+) error {
+	ctx := context.Background()
+
+	migrationVersion, err := db.MigrationVersion()
+	if err != nil {
+		return err
+	}
+	databaseVersion, dirty, err := dba.GetMigrationVersion(ctx, cfg.PostgreSQLConfig.MigrationConfig)
+	if err != nil {
+		return err
+	}
+	if dirty || databaseVersion != migrationVersion {
+		return fmt.Errorf("the database has migration %v (dirty %v), but the binary has %v", databaseVersion, dirty, migrationVersion)
+	}
+
+	consumerGroups := map[string]string{}
+	for _, projection := range config.AllProjections {
+		consumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+		if err != nil {
+			return err
+		}
+		consumerGroups[projection] = consumerGroup
+	}
+
+	lgr.Info("Pausing the projections", "grace_period", cfg.CqrsConfig.RebuildConfig.HandoffGracePeriod)
+	for _, consumerGroup := range consumerGroups {
+		err = SetProjectionPaused(ctx, dba, consumerGroup, true)
+		if err != nil {
+			resumeProjections(ctx, lgr, dba, consumerGroups)
+			return err
+		}
+	}
+	defer resumeProjections(ctx, lgr, dba, consumerGroups)
+	// the offsets of the events handled before the pause are committed within the commit interval
+	time.Sleep(cfg.CqrsConfig.RebuildConfig.HandoffGracePeriod + cfg.KafkaConfig.KafkaConsumerConfig.OffsetCommitInterval)
+
+	offsets := map[string]map[int32]int64{}
+	for projection, consumerGroup := range consumerGroups {
+		offsets[projection], err = getNextOffsets(lgr, cfg, saramaClient, consumerGroup)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(cfg.CqrsConfig.SnapshotConfig.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+
+	err = db.Transact(ctx, dba, func(tx *db.Tx) error {
+		_, err := tx.ExecContext(ctx, "set transaction isolation level repeatable read read only")
+		if err != nil {
+			return err
+		}
+
+		header := SnapshotHeader{
+			MigrationVersion: migrationVersion,
+			CreateDateTime:   time.Now().UTC(),
+			Topic:            cfg.KafkaConfig.Topic,
+			ConsumerGroups:   consumerGroups,
+			Offsets:          offsets,
+		}
+		err = enc.Encode(header)
+		if err != nil {
+			return err
+		}
+
+		projectionConsumerGroups := []string{}
+		for _, consumerGroup := range consumerGroups {
+			projectionConsumerGroups = append(projectionConsumerGroups, consumerGroup)
+		}
+		for _, table := range snapshotTables() {
+			var rows int64
+			if slices.Contains(snapshotStateTables, table) {
+				rows, err = writeSnapshotRows(ctx, tx, enc, table, fmt.Sprintf("select row_to_json(t) from %s t where t.projection = any($1)", table), projectionConsumerGroups)
+			} else {
+				rows, err = writeSnapshotRows(ctx, tx, enc, table, fmt.Sprintf("select row_to_json(t) from %s t", table))
+			}
+			if err != nil {
+				return err
+			}
+			lgr.Info("The table has been written into the snapshot", "table", table, "rows", rows)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	lgr.Info("The snapshot has been made", "file", cfg.CqrsConfig.SnapshotConfig.File)
+	return nil
+}
+
+func resumeProjections(ctx context.Context, lgr *logger.LoggerWrapper, dba *db.DB, consumerGroups map[string]string) {
+	for _, consumerGroup := range consumerGroups {
+		err := SetProjectionPaused(ctx, dba, consumerGroup, false)
+		if err != nil {
+			lgr.Error("Unable to resume the projection, resume it manually", "projection", consumerGroup, "err", err)
+		}
+	}
+}
+
+// getNextOffsets are the offsets committed by the paused projection into kafka, the partitions without them are consumed from the oldest offset.
+// projection_partition_progress isn't used, it's written before the commit of the offset and may be ahead of it.
+// The events which are in the tables, but not committed, are applied once more after the restoring and skipped as duplicates by their sequences
+func getNextOffsets(lgr *logger.LoggerWrapper, cfg *config.AppConfig, saramaClient sarama.Client, consumerGroup string) (map[int32]int64, error) {
+	offsets, err := kafka.GetPartitionOffsets(lgr, cfg, saramaClient, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[int32]int64{}
+	for _, po := range offsets {
+		if po.CommittedOffset >= 0 {
+			ret[po.Partition] = po.CommittedOffset
+		}
+	}
+	return ret, nil
+}
+
+func writeSnapshotRows(ctx context.Context, co db.CommonOperations, enc *json.Encoder, table, query string, args ...any) (int64, error) {
+	rows, err := co.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var count int64
+	for rows.Next() {
+		var row json.RawMessage
+		err = rows.Scan(&row)
+		if err != nil {
+			return count, err
+		}
+		err = enc.Encode(snapshotRow{Table: table, Row: row})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+func openSnapshot(file string) (*os.File, *json.Decoder, *SnapshotHeader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	dec := json.NewDecoder(gz)
+	header := SnapshotHeader{}
+	err = dec.Decode(&header)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, fmt.Errorf("unable to read the header of the snapshot: %w", err)
+	}
+	return f, dec, &header, nil
+}
+
+// RunCheckSnapshot should be invoked before the database is reset, so an incompatible snapshot doesn't leave it empty
+func RunCheckSnapshot(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+) error {
+	f, _, header, err := openSnapshot(cfg.CqrsConfig.SnapshotConfig.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	migrationVersion, err := db.MigrationVersion()
+	if err != nil {
+		return err
+	}
+	if header.MigrationVersion != migrationVersion {
+		return fmt.Errorf("the snapshot has migration %v, but the binary has %v", header.MigrationVersion, migrationVersion)
+	}
+	if header.Topic != cfg.KafkaConfig.Topic {
+		return fmt.Errorf("the snapshot was made from topic %v, but the configured one is %v", header.Topic, cfg.KafkaConfig.Topic)
+	}
+	lgr.Info("The snapshot is compatible", "file", cfg.CqrsConfig.SnapshotConfig.File, "create_date_time", header.CreateDateTime, "migration_version", header.MigrationVersion)
+	return nil
+}
+
+// RunRestoreSnapshot loads the snapshot into the empty tables and commits its offsets, so the projections continue from them instead of the oldest ones.
+// It should be invoked after the database and the consumer groups are reset
+func RunRestoreSnapshot(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	saramaClient sarama.Client,
+) error {
+	ctx := context.Background()
+
+	f, dec, header, err := openSnapshot(cfg.CqrsConfig.SnapshotConfig.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	knownTables := snapshotTables()
+	err = db.Transact(ctx, dba, func(tx *db.Tx) error {
+		var table string
+		batch := []json.RawMessage{}
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			rows, err := json.Marshal(batch)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("insert into %s select * from json_populate_recordset(null::%s, $1)", table, table), string(rows))
+			batch = batch[:0]
+			return err
+		}
+
+		for {
+			row := snapshotRow{}
+			err := dec.Decode(&row)
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("unable to read the snapshot: %w", err)
+			}
+			if !slices.Contains(knownTables, row.Table) {
+				return fmt.Errorf("unknown table %v in the snapshot", row.Table)
+			}
+			if row.Table != table || len(batch) >= snapshotBatchSize {
+				err = flush()
+				if err != nil {
+					return err
+				}
+				if row.Table != table {
+					lgr.Info("Restoring the table", "table", row.Table)
+				}
+				table = row.Table
+			}
+			batch = append(batch, row.Row)
+		}
+		err := flush()
+		if err != nil {
+			return err
+		}
+
+		// the consumer groups may have been renamed since the snapshot
+		for projection, snapshotConsumerGroup := range header.ConsumerGroups {
+			consumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+			if err != nil {
+				return err
+			}
+			if consumerGroup == snapshotConsumerGroup {
+				continue
+			}
+			for _, stateTable := range snapshotStateTables {
+				_, err = tx.ExecContext(ctx, fmt.Sprintf("update %s set projection = $1 where projection = $2", stateTable), consumerGroup, snapshotConsumerGroup)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for projection, offsets := range header.Offsets {
+		consumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(projection)
+		if err != nil {
+			return err
+		}
+		err = kafka.CommitOffsets(lgr, cfg, saramaClient, consumerGroup, offsets)
+		if err != nil {
+			return err
+		}
+	}
+
+	lgr.Info("The snapshot has been restored", "file", cfg.CqrsConfig.SnapshotConfig.File, "create_date_time", header.CreateDateTime)
+	return nil
+}
@@ -0,0 +1,323 @@
+package cqrs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"slices"
+)
+
+// the fields of chat_user_view and unread_messages_user_view which are compared with the tables of the chat projection
+const (
+	DifferenceChatView          = "chatView" // the row is absent for a participant or is present for a non-participant
+	DifferenceTitle             = "title"
+	DifferenceParticipantsCount = "participantsCount"
+	DifferenceLastMessage       = "lastMessageId"
+	DifferenceUnreadMessages    = "unreadMessages" // the expected count is taken from the last read message of the row
+)
+
+// Verify is the flags of the verify command
+type Verify struct {
+	Repair bool
+}
+
+type Difference struct {
+	ChatId   int64
+	UserId   int64
+	Field    string
+	Expected any
+	Actual   any
+}
+
+// isRepairable tells whether ChatViewRefreshed fixes the difference, it only updates the existing rows of chat_user_view
+func (d Difference) isRepairable() bool {
+	return d.Field != DifferenceChatView
+}
+
+// RunVerify recomputes the per-user views of every chat from chat_common, chat_participant and message and reports the differences.
+// The chats whose events are being handled by the dependent projections at the moment are skipped, so it can run alongside serve
+func RunVerify(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	eventBus *PartitionAwareEventBus,
+	commonProjection *CommonProjection,
+	verify *Verify,
+) error {
+	ctx := context.Background()
+
+	chatConsumerGroup, err := cfg.ProjectionsConfig.ConsumerGroup(config.ChatProjection)
+	if err != nil {
+		return err
+	}
+	dependentConsumerGroups, err := cfg.ProjectionsConfig.ConsumerGroups([]string{config.ChatViewProjection, config.UnreadMessagesProjection})
+	if err != nil {
+		return err
+	}
+
+	var chats, skipped, differences, repaired int
+	var lastChatId int64
+	for {
+		chatIds, err := getChatIdsAfter(ctx, dba, lastChatId, utils.DefaultSize)
+		if err != nil {
+			return err
+		}
+		if len(chatIds) == 0 {
+			break
+		}
+		for _, chatId := range chatIds {
+			lastChatId = chatId
+			chats++
+
+			inFlight, chatDifferences, err := verifyChatInSnapshot(ctx, dba, commonProjection, chatId, chatConsumerGroup, dependentConsumerGroups)
+			if err != nil {
+				return err
+			}
+			if inFlight {
+				lgr.Info("Skipping the chat whose events are being handled", "chat_id", chatId)
+				skipped++
+				continue
+			}
+			if len(chatDifferences) == 0 {
+				continue
+			}
+
+			repairableUserIds := []int64{}
+			for _, d := range chatDifferences {
+				lgr.Warn("The projection differs", "chat_id", d.ChatId, "user_id", d.UserId, "field", d.Field, "expected", d.Expected, "actual", d.Actual)
+				if d.isRepairable() && !slices.Contains(repairableUserIds, d.UserId) {
+					repairableUserIds = append(repairableUserIds, d.UserId)
+				} else if !d.isRepairable() {
+					lgr.Warn("The difference can't be repaired by the refresh, reset the chatView projection", "chat_id", d.ChatId, "user_id", d.UserId)
+				}
+			}
+			lgr.Warn("The chat has differences", "chat_id", chatId, "differences", len(chatDifferences), "user_ids", repairableUserIds)
+			differences += len(chatDifferences)
+
+			if verify.Repair && len(repairableUserIds) > 0 {
+				err = RefreshChatViews(ctx, eventBus, dba, chatId, repairableUserIds)
+				if err != nil {
+					return err
+				}
+				repaired += len(repairableUserIds)
+			}
+		}
+	}
+
+	lgr.Info("The verification has finished", "chats", chats, "skipped_chats", skipped, "differences", differences, "refreshed_users", repaired)
+	if differences > 0 && !verify.Repair {
+		return fmt.Errorf("found %v differences", differences)
+	}
+	return nil
+}
+
+// verifyChatInSnapshot checks the sequences and compares the tables in one repeatable read transaction,
+// otherwise an event handled between them would be reported as a difference
+func verifyChatInSnapshot(
+	ctx context.Context,
+	dba *db.DB,
+	commonProjection *CommonProjection,
+	chatId int64,
+	chatConsumerGroup string,
+	dependentConsumerGroups []string,
+) (bool, []Difference, error) {
+	var inFlight bool
+	var differences []Difference
+	err := db.Transact(ctx, dba, func(tx *db.Tx) error {
+		_, err := tx.ExecContext(ctx, "set transaction isolation level repeatable read read only")
+		if err != nil {
+			return err
+		}
+		inFlight, err = isChatInFlight(ctx, tx, chatId, chatConsumerGroup, dependentConsumerGroups)
+		if err != nil || inFlight {
+			return err
+		}
+		differences, err = VerifyChat(ctx, tx, commonProjection, chatId)
+		return err
+	})
+	return inFlight, differences, err
+}
+
+func getChatIdsAfter(ctx context.Context, co db.CommonOperations, chatId int64, limit int) ([]int64, error) {
+	rows, err := co.QueryContext(ctx, "select id from chat_common where id > $1 order by id limit $2", chatId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, id)
+	}
+	return ret, rows.Err()
+}
+
+// isChatInFlight tells that the dependent projections haven't handled all the events of the chat which the chat projection has
+func isChatInFlight(ctx context.Context, co db.CommonOperations, chatId int64, chatConsumerGroup string, dependentConsumerGroups []string) (bool, error) {
+	rows, err := co.QueryContext(ctx, "select projection, last_seq from projection_chat_sequence where chat_id = $1 and projection = any($2)", chatId, append([]string{chatConsumerGroup}, dependentConsumerGroups...))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	lastSeqs := map[string]int64{}
+	for rows.Next() {
+		var projection string
+		var lastSeq int64
+		err = rows.Scan(&projection, &lastSeq)
+		if err != nil {
+			return false, err
+		}
+		lastSeqs[projection] = lastSeq
+	}
+	if rows.Err() != nil {
+		return false, rows.Err()
+	}
+	for _, consumerGroup := range dependentConsumerGroups {
+		if lastSeqs[consumerGroup] != lastSeqs[chatConsumerGroup] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type chatUserViewRow struct {
+	title             string
+	participantsCount sql.NullInt64
+	lastMessageId     sql.NullInt64
+}
+
+// VerifyChat compares the rows of chat_user_view and unread_messages_user_view of the chat's participants with the values recomputed from the chat projection
+func VerifyChat(ctx context.Context, co db.CommonOperations, commonProjection *CommonProjection, chatId int64) ([]Difference, error) {
+	var title string
+	var participantsCount int64
+	var lastMessageId sql.NullInt64
+	err := co.QueryRowContext(ctx, "select title from chat_common where id = $1", chatId).Scan(&title)
+	if err != nil {
+		return nil, err
+	}
+	err = co.QueryRowContext(ctx, "select count(*) from chat_participant where chat_id = $1", chatId).Scan(&participantsCount)
+	if err != nil {
+		return nil, err
+	}
+	err = co.QueryRowContext(ctx, "select max(id) from message where chat_id = $1", chatId).Scan(&lastMessageId)
+	if err != nil {
+		return nil, err
+	}
+
+	views, err := getChatUserViews(ctx, co, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Difference{}
+	// the counts are cached by the last read message, most of the participants have read either nothing or everything
+	unreadByLastRead := map[int64]int64{}
+	err = commonProjection.IterateOverChatParticipantIds(ctx, co, chatId, nil, func(participantIdsPortion []int64) error {
+		unreads, err := getUnreadMessagesViews(ctx, co, chatId, participantIdsPortion)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range participantIdsPortion {
+			view, ok := views[userId]
+			delete(views, userId)
+			if !ok {
+				ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceChatView, Expected: true, Actual: false})
+			} else {
+				if view.title != title {
+					ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceTitle, Expected: title, Actual: view.title})
+				}
+				if view.participantsCount.Int64 != participantsCount {
+					ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceParticipantsCount, Expected: participantsCount, Actual: view.participantsCount.Int64})
+				}
+				if view.lastMessageId != lastMessageId {
+					ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceLastMessage, Expected: nullableInt64(lastMessageId), Actual: nullableInt64(view.lastMessageId)})
+				}
+			}
+
+			// without the row nothing has been read
+			unread, ok := unreads[userId]
+			expected, cached := unreadByLastRead[unread.lastMessageId]
+			if !cached {
+				err = co.QueryRowContext(ctx, "select count(*) from message where chat_id = $1 and id > $2", chatId, unread.lastMessageId).Scan(&expected)
+				if err != nil {
+					return err
+				}
+				unreadByLastRead[unread.lastMessageId] = expected
+			}
+			if !ok {
+				ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceUnreadMessages, Expected: expected, Actual: nil})
+			} else if unread.unreadMessages != expected {
+				ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceUnreadMessages, Expected: expected, Actual: unread.unreadMessages})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the rest are left after the removed participants
+	for userId := range views {
+		ret = append(ret, Difference{ChatId: chatId, UserId: userId, Field: DifferenceChatView, Expected: false, Actual: true})
+	}
+	return ret, nil
+}
+
+func getChatUserViews(ctx context.Context, co db.CommonOperations, chatId int64) (map[int64]chatUserViewRow, error) {
+	rows, err := co.QueryContext(ctx, "select user_id, title, participants_count, last_message_id from chat_user_view where id = $1", chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := map[int64]chatUserViewRow{}
+	for rows.Next() {
+		var userId int64
+		var row chatUserViewRow
+		err = rows.Scan(&userId, &row.title, &row.participantsCount, &row.lastMessageId)
+		if err != nil {
+			return nil, err
+		}
+		ret[userId] = row
+	}
+	return ret, rows.Err()
+}
+
+type unreadMessagesViewRow struct {
+	unreadMessages int64
+	lastMessageId  int64 // the last read one
+}
+
+func getUnreadMessagesViews(ctx context.Context, co db.CommonOperations, chatId int64, userIds []int64) (map[int64]unreadMessagesViewRow, error) {
+	rows, err := co.QueryContext(ctx, "select user_id, unread_messages, last_message_id from unread_messages_user_view where chat_id = $1 and user_id = any($2)", chatId, userIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := map[int64]unreadMessagesViewRow{}
+	for rows.Next() {
+		var userId int64
+		var row unreadMessagesViewRow
+		err = rows.Scan(&userId, &row.unreadMessages, &row.lastMessageId)
+		if err != nil {
+			return nil, err
+		}
+		ret[userId] = row
+	}
+	return ret, rows.Err()
+}
+
+func nullableInt64(v sql.NullInt64) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.Int64
+}
@@ -0,0 +1,307 @@
+package cqrs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jackc/pgtype"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"time"
+)
+
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusDelivered = "delivered"
+	WebhookDeliveryStatusFailed    = "failed"
+)
+
+type WebhookSubscription struct {
+	Id             int64     `json:"id"`
+	Url            string    `json:"url"`
+	EventTypes     []string  `json:"eventTypes"` // empty means all the events
+	ChatId         *int64    `json:"chatId"`     // nil means all the chats
+	CreateDateTime time.Time `json:"createDateTime"`
+}
+
+type WebhookDelivery struct {
+	Id                  int64      `json:"id"`
+	SubscriptionId      int64      `json:"subscriptionId"`
+	EventType           string     `json:"eventType"`
+	ChatId              *int64     `json:"chatId"`
+	Status              string     `json:"status"`
+	Attempts            int32      `json:"attempts"`
+	NextAttemptDateTime time.Time  `json:"nextAttemptDateTime"`
+	LastAttemptDateTime *time.Time `json:"lastAttemptDateTime"`
+	LastResponseStatus  *int32     `json:"lastResponseStatus"`
+	LastError           *string    `json:"lastError"`
+	CreateDateTime      time.Time  `json:"createDateTime"`
+}
+
+// WebhookPayload is the body which is sent to the subscriber
+type WebhookPayload struct {
+	Id        string          `json:"id"` // the same for all the subscriptions, can be used by the receiver for deduplication
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookProjection stores a delivery per each matched subscription.
+// It has its own consumer group, so a slow subscriber doesn't delay the common projection.
+type WebhookProjection struct {
+	db            *db.DB
+	lgr           *logger.LoggerWrapper
+	cqrsMarshaler *CqrsMarshalerDecorator
+}
+
+func ConfigureWebhookProjection(
+	dba *db.DB,
+	lgr *logger.LoggerWrapper,
+	cqrsMarshaler *CqrsMarshalerDecorator,
+) *WebhookProjection {
+	return &WebhookProjection{
+		db:            dba,
+		lgr:           lgr,
+		cqrsMarshaler: cqrsMarshaler,
+	}
+}
+
+// RegisterWebhookHandler should be invoked before RunCqrsRouter
+func RegisterWebhookHandler(
+	cfg *config.AppConfig,
+	cqrsRouter *message.Router,
+	watermillLoggerAdapter watermill.LoggerAdapter,
+	kafkaMarshaler kafka.MarshalerUnmarshaler,
+	webhookProjection *WebhookProjection,
+) error {
+	subscriber, err := newKafkaSubscriber(cfg, watermillLoggerAdapter, kafkaMarshaler, cfg.CqrsConfig.WebhookConfig.ConsumerGroup, nil)
+	if err != nil {
+		return err
+	}
+
+	// we need all the events regardless of their types, so it's a plain handler instead of the event group one
+	cqrsRouter.AddNoPublisherHandler(
+		cfg.CqrsConfig.WebhookConfig.ConsumerGroup,
+		cfg.KafkaConfig.Topic,
+		subscriber,
+		webhookProjection.OnEvent,
+	)
+	return nil
+}
+
+type chatIdHolder struct {
+	ChatId *int64 `json:"chatId"`
+}
+
+func (m *WebhookProjection) OnEvent(msg *message.Message) error {
+	ctx := msg.Context()
+
+	eventType := m.cqrsMarshaler.NameFromMessage(msg)
+
+	var holder chatIdHolder
+	err := json.Unmarshal(msg.Payload, &holder)
+	if err != nil {
+		m.lgr.WithTrace(ctx).Error("Unable to get chatId from the event, skipping", "event_type", eventType, "err", err)
+		return nil
+	}
+
+	// a new subscription doesn't receive the events which were published before it
+	createdAt := time.Now().UTC()
+	if ts, ok := kafka.MessageTimestampFromCtx(ctx); ok {
+		createdAt = ts.UTC()
+	}
+
+	body, err := json.Marshal(WebhookPayload{
+		Id:        msg.UUID,
+		Type:      eventType,
+		CreatedAt: createdAt,
+		Data:      json.RawMessage(msg.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	// the uniqueness of the message id makes the insertion idempotent in case kafka redelivers the message
+	res, err := m.db.ExecContext(ctx, `
+		insert into webhook_delivery(subscription_id, message_id, event_type, chat_id, payload, status, next_attempt_date_time, create_date_time)
+		select s.id, $1, $2, $3, $4, $5, $6, $6
+		from webhook_subscription s
+		where (cardinality(s.event_types) = 0 or $2 = any(s.event_types))
+			and (s.chat_id is null or s.chat_id = $3)
+			and s.create_date_time <= $7
+		on conflict(subscription_id, message_id) do nothing
+	`, msg.UUID, eventType, holder.ChatId, string(body), WebhookDeliveryStatusPending, now, createdAt)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		m.lgr.WithTrace(ctx).Info("Webhook deliveries were scheduled", "event_type", eventType, "count", affected)
+	}
+	return nil
+}
+
+func (m *WebhookProjection) CreateSubscription(ctx context.Context, url, secret string, eventTypes []string, chatId *int64) (int64, error) {
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	r := m.db.QueryRowContext(ctx, `
+		insert into webhook_subscription(url, secret, event_types, chat_id, create_date_time)
+		values ($1, $2, $3, $4, $5)
+		returning id
+	`, url, secret, eventTypes, chatId, time.Now().UTC())
+	var id int64
+	err := r.Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// DeleteSubscription returns false if there is no such subscription
+func (m *WebhookProjection) DeleteSubscription(ctx context.Context, id int64) error {
+	res, err := m.db.ExecContext(ctx, "delete from webhook_subscription where id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return NewNotFoundError("webhook subscription %v", id)
+	}
+	return nil
+}
+
+func (m *WebhookProjection) GetSubscriptions(ctx context.Context, size int32, offset int64) ([]WebhookSubscription, error) {
+	ma := []WebhookSubscription{}
+	rows, err := m.db.QueryContext(ctx, `
+		select s.id, s.url, s.event_types, s.chat_id, s.create_date_time
+		from webhook_subscription s
+		order by s.id asc
+		limit $1 offset $2
+	`, size, offset)
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ws WebhookSubscription
+		var eventTypes = pgtype.TextArray{}
+		err = rows.Scan(&ws.Id, &ws.Url, &eventTypes, &ws.ChatId, &ws.CreateDateTime)
+		if err != nil {
+			return ma, err
+		}
+		ws.EventTypes = []string{}
+		for _, anEventType := range eventTypes.Elements {
+			ws.EventTypes = append(ws.EventTypes, anEventType.String)
+		}
+		ma = append(ma, ws)
+	}
+	return ma, nil
+}
+
+func (m *WebhookProjection) GetDeliveries(ctx context.Context, subscriptionId int64, size int32, offset int64) ([]WebhookDelivery, error) {
+	ma := []WebhookDelivery{}
+	rows, err := m.db.QueryContext(ctx, `
+		select d.id, d.subscription_id, d.event_type, d.chat_id, d.status, d.attempts, d.next_attempt_date_time, d.last_attempt_date_time, d.last_response_status, d.last_error, d.create_date_time
+		from webhook_delivery d
+		where d.subscription_id = $1
+		order by d.id desc
+		limit $2 offset $3
+	`, subscriptionId, size, offset)
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wd WebhookDelivery
+		err = rows.Scan(&wd.Id, &wd.SubscriptionId, &wd.EventType, &wd.ChatId, &wd.Status, &wd.Attempts, &wd.NextAttemptDateTime, &wd.LastAttemptDateTime, &wd.LastResponseStatus, &wd.LastError, &wd.CreateDateTime)
+		if err != nil {
+			return ma, err
+		}
+		ma = append(ma, wd)
+	}
+	return ma, nil
+}
+
+// Redeliver schedules the delivery again with the full number of attempts. Returns false if there is no such delivery.
+func (m *WebhookProjection) Redeliver(ctx context.Context, deliveryId int64) error {
+	res, err := m.db.ExecContext(ctx, `
+		update webhook_delivery
+		set status = $2, attempts = 0, next_attempt_date_time = $3, last_error = null
+		where id = $1
+	`, deliveryId, WebhookDeliveryStatusPending, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return NewNotFoundError("webhook delivery %v", deliveryId)
+	}
+	return nil
+}
+
+type pendingWebhookDelivery struct {
+	id        int64
+	eventType string
+	payload   []byte
+	attempts  int32
+	url       string
+	secret    string
+}
+
+// leasePendingDeliveries moves next_attempt_date_time of the taken deliveries forward,
+// so another instance doesn't send them while this one is waiting for the response
+func (m *WebhookProjection) leasePendingDeliveries(ctx context.Context, size int32, leaseDuration time.Duration) ([]pendingWebhookDelivery, error) {
+	ma := []pendingWebhookDelivery{}
+	now := time.Now().UTC()
+	rows, err := m.db.QueryContext(ctx, `
+		with taken as (
+			select d.id
+			from webhook_delivery d
+			where d.status = $1 and d.next_attempt_date_time <= $2
+			order by d.next_attempt_date_time asc
+			limit $3
+			for update skip locked
+		)
+		update webhook_delivery d
+		set next_attempt_date_time = $4
+		from taken, webhook_subscription s
+		where d.id = taken.id and s.id = d.subscription_id
+		returning d.id, d.event_type, d.payload, d.attempts, s.url, s.secret
+	`, WebhookDeliveryStatusPending, now, size, now.Add(leaseDuration))
+	if err != nil {
+		return ma, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pd pendingWebhookDelivery
+		err = rows.Scan(&pd.id, &pd.eventType, &pd.payload, &pd.attempts, &pd.url, &pd.secret)
+		if err != nil {
+			return ma, err
+		}
+		ma = append(ma, pd)
+	}
+	return ma, nil
+}
+
+func (m *WebhookProjection) finishAttempt(ctx context.Context, deliveryId int64, status string, attempts int32, nextAttempt time.Time, responseStatus *int32, lastError *string) error {
+	_, err := m.db.ExecContext(ctx, `
+		update webhook_delivery
+		set status = $2, attempts = $3, next_attempt_date_time = $4, last_attempt_date_time = $5, last_response_status = $6, last_error = $7
+		where id = $1
+	`, deliveryId, status, attempts, nextAttempt, time.Now().UTC(), responseStatus, lastError)
+	return err
+}
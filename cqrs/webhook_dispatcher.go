@@ -0,0 +1,165 @@
+package cqrs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.uber.org/fx"
+	"io"
+	"net/http"
+	"time"
+)
+
+const WebhookIdHeader = "X-Webhook-Id"
+const WebhookEventHeader = "X-Webhook-Event"
+const WebhookTimestampHeader = "X-Webhook-Timestamp"
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+const maxStoredErrorLength = 1024
+
+// SignWebhook calculates HMAC-SHA256 of "timestamp.body", the timestamp prevents replaying of the old deliveries.
+// The receiver should calculate the same and compare it with X-Webhook-Signature.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(utils.ToString(timestamp)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookBackoff(cfg *config.WebhookConfig, attempts int32) time.Duration {
+	backoff := cfg.InitialBackoff
+	for i := int32(1); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= cfg.MaxBackoff {
+			return cfg.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+func RunWebhookDispatcher(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	webhookProjection *WebhookProjection,
+	lc fx.Lifecycle,
+) {
+	webhookConfig := &cfg.CqrsConfig.WebhookConfig
+	interval := webhookConfig.DispatchInterval
+	if interval <= 0 {
+		lgr.Info("Webhook dispatcher is disabled")
+		return
+	}
+
+	httpClient := &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   webhookConfig.RequestTimeout,
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStop: func(c context.Context) error {
+			lgr.Info("Stopping webhook dispatcher")
+			cancelFunc()
+			return nil
+		},
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := dispatchWebhooks(ctx, lgr, webhookConfig, httpClient, webhookProjection)
+				if err != nil {
+					lgr.Error("Error during dispatching webhooks", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+func dispatchWebhooks(
+	ctx context.Context,
+	lgr *logger.LoggerWrapper,
+	webhookConfig *config.WebhookConfig,
+	httpClient *http.Client,
+	webhookProjection *WebhookProjection,
+) error {
+	// the lease is longer than a sending of the whole batch can take
+	leaseDuration := webhookConfig.RequestTimeout*time.Duration(webhookConfig.BatchSize) + webhookConfig.DispatchInterval
+	deliveries, err := webhookProjection.leasePendingDeliveries(ctx, webhookConfig.BatchSize, leaseDuration)
+	if err != nil {
+		return err
+	}
+
+	for _, pd := range deliveries {
+		responseStatus, sendErr := sendWebhook(ctx, httpClient, &pd)
+
+		attempts := pd.attempts + 1
+		status := WebhookDeliveryStatusDelivered
+		nextAttempt := time.Now().UTC()
+		var lastError *string
+		if sendErr != nil {
+			errString := sendErr.Error()
+			if len(errString) > maxStoredErrorLength {
+				errString = errString[:maxStoredErrorLength]
+			}
+			lastError = &errString
+
+			if attempts >= webhookConfig.MaxAttempts {
+				status = WebhookDeliveryStatusFailed
+				lgr.Warn("Webhook delivery has failed", "delivery_id", pd.id, "attempts", attempts, "err", sendErr)
+			} else {
+				status = WebhookDeliveryStatusPending
+				nextAttempt = nextAttempt.Add(webhookBackoff(webhookConfig, attempts))
+				lgr.Info("Webhook delivery will be retried", "delivery_id", pd.id, "attempts", attempts, "next_attempt", nextAttempt, "err", sendErr)
+			}
+		} else {
+			lgr.Info("Webhook was delivered", "delivery_id", pd.id, "event_type", pd.eventType, "attempts", attempts)
+		}
+
+		err = webhookProjection.finishAttempt(ctx, pd.id, status, attempts, nextAttempt, responseStatus, lastError)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendWebhook(ctx context.Context, httpClient *http.Client, pd *pendingWebhookDelivery) (*int32, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pd.url, bytes.NewReader(pd.payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIdHeader, utils.ToString(pd.id))
+	req.Header.Set(WebhookEventHeader, pd.eventType)
+	req.Header.Set(WebhookTimestampHeader, utils.ToString(timestamp))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(pd.secret, timestamp, pd.payload))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	status := int32(resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &status, fmt.Errorf("webhook responded non-2xx code: %v", resp.StatusCode)
+	}
+	return &status, nil
+}
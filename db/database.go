@@ -17,7 +17,9 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"go.uber.org/fx"
+	"io/fs"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -249,6 +251,36 @@ func (db *DB) Migrate(mc config.MigrationConfig) error {
 	return nil
 }
 
+// MigrationVersion is the version of the latest migration embedded into the binary
+func MigrationVersion() (uint, error) {
+	entries, err := fs.ReadDir(embeddedMigrationFiles, "migrations")
+	if err != nil {
+		return 0, err
+	}
+	var version uint
+	for _, entry := range entries {
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		if !found {
+			continue
+		}
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse the version of migration %v: %w", entry.Name(), err)
+		}
+		version = max(version, uint(v))
+	}
+	return version, nil
+}
+
+// GetMigrationVersion returns the version of the migration applied to the database, the dirty one has failed in the middle
+func (db *DB) GetMigrationVersion(ctx context.Context, mc config.MigrationConfig) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("select version, dirty from %s", mc.MigrationTable)).Scan(&version, &dirty)
+	return version, dirty, err
+}
+
+// Reset drops everything which can be rebuilt from the topic, the webhook subscriptions are the users' configuration, so they are kept
 func (db *DB) Reset(mc config.MigrationConfig) error {
 	_, err := db.Exec(fmt.Sprintf(`
 	drop sequence if exists chat_id_sequence;
@@ -262,6 +294,26 @@ func (db *DB) Reset(mc config.MigrationConfig) error {
 
 	drop table if exists blog;
 
+	drop table if exists idempotency_key;
+
+	drop table if exists webhook_delivery;
+
+	drop table if exists chat_aggregate;
+	drop table if exists chat_aggregate_participant;
+	drop table if exists chat_aggregate_message;
+	drop table if exists chat_aggregate_message_id;
+
+	drop table if exists chat_event_sequence;
+	drop table if exists chat_event_outbox;
+	drop table if exists projection_chat_sequence;
+	drop table if exists projection_partition_progress;
+	drop table if exists projection_switch;
+	drop table if exists projection_switch_offset;
+	drop table if exists projection_offset_inheritance;
+	drop table if exists replay_stop;
+
+	drop table if exists audit_log;
+
 	drop table if exists %s;
 	
 	-- test
@@ -270,6 +322,15 @@ func (db *DB) Reset(mc config.MigrationConfig) error {
 	return err
 }
 
+// Drop is Reset together with the webhook subscriptions
+func (db *DB) Drop(mc config.MigrationConfig) error {
+	_, err := db.Exec("drop table if exists webhook_subscription")
+	if err != nil {
+		return err
+	}
+	return db.Reset(mc)
+}
+
 func RunMigrations(db *DB, cfg *config.AppConfig) error {
 	return db.Migrate(cfg.PostgreSQLConfig.MigrationConfig)
 }
@@ -277,3 +338,7 @@ func RunMigrations(db *DB, cfg *config.AppConfig) error {
 func RunResetDatabase(db *DB, cfg *config.AppConfig) error {
 	return db.Reset(cfg.PostgreSQLConfig.MigrationConfig)
 }
+
+func RunDropDatabase(db *DB, cfg *config.AppConfig) error {
+	return db.Drop(cfg.PostgreSQLConfig.MigrationConfig)
+}
@@ -0,0 +1,2 @@
+alter table chat_common add column retention_seconds bigint not null default 0;
+create index message_create_date_time_idx on message(chat_id, create_date_time);
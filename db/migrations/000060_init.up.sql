@@ -0,0 +1,14 @@
+create table idempotency_key(
+    key varchar(256) not null,
+    user_id bigint not null,
+    method varchar(16) not null,
+    path varchar(512) not null,
+    request_hash varchar(64) not null,
+    response_status int not null,
+    response_content_type varchar(256) not null,
+    response_body bytea not null,
+    create_date_time timestamp not null,
+    expire_date_time timestamp not null,
+    primary key (key, user_id, method, path)
+);
+create index idempotency_key_expire_idx on idempotency_key(expire_date_time);
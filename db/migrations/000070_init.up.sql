@@ -0,0 +1 @@
+alter table chat_common add column slow_mode_seconds bigint not null default 0;
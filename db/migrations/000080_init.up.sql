@@ -0,0 +1,30 @@
+-- it survives the reset, see DB.Reset
+create table if not exists webhook_subscription(
+    id bigserial primary key,
+    url varchar(2048) not null,
+    secret varchar(256) not null,
+    -- empty means all the events
+    event_types text[] not null default '{}',
+    -- null means all the chats
+    chat_id bigint,
+    create_date_time timestamp not null
+);
+
+create table webhook_delivery(
+    id bigserial primary key,
+    subscription_id bigint not null references webhook_subscription(id) on delete cascade,
+    -- uuid of the watermill message, is used for deduplication of the redelivered kafka messages
+    message_id varchar(64) not null,
+    event_type varchar(256) not null,
+    chat_id bigint,
+    payload jsonb not null,
+    status varchar(16) not null,
+    attempts int not null default 0,
+    next_attempt_date_time timestamp not null,
+    last_attempt_date_time timestamp,
+    last_response_status int,
+    last_error text,
+    create_date_time timestamp not null,
+    unique (subscription_id, message_id)
+);
+create index webhook_delivery_pending_idx on webhook_delivery(next_attempt_date_time) where status = 'pending';
@@ -0,0 +1,25 @@
+-- the command side state of the chats, the commands check their invariants against it
+-- unlike the projections it's written synchronously, in the same transaction as the version
+create table chat_aggregate(
+    id bigint primary key,
+    version bigint not null,
+    deleted boolean not null default false
+);
+
+create table chat_aggregate_participant(
+    chat_id bigint not null,
+    user_id bigint not null,
+    primary key (chat_id, user_id)
+);
+
+create table chat_aggregate_message(
+    chat_id bigint not null,
+    id bigint not null,
+    owner_id bigint not null,
+    primary key (chat_id, id)
+);
+
+-- the chats which were created before
+insert into chat_aggregate(id, version) select id, 1 from chat_common;
+insert into chat_aggregate_participant(chat_id, user_id) select chat_id, user_id from chat_participant;
+insert into chat_aggregate_message(chat_id, id, owner_id) select chat_id, id, owner_id from message;
@@ -0,0 +1,4 @@
+-- the version of the chat, clients pass it back in If-Match in order not to overwrite each other's changes
+alter table chat_common add column version bigint not null default 0;
+
+update chat_common c set version = a.version from chat_aggregate a where a.id = c.id;
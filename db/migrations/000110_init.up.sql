@@ -0,0 +1,13 @@
+-- the last sequence number given to the event of the chat at publish time
+create table chat_event_sequence(
+    chat_id bigint primary key,
+    last_seq bigint not null
+);
+
+-- the last sequence number of the chat's event, handled by the projection
+create table projection_chat_sequence(
+    projection varchar(256) not null,
+    chat_id bigint not null,
+    last_seq bigint not null,
+    primary key (projection, chat_id)
+);
@@ -0,0 +1,18 @@
+-- the domain events for the support, see AuditLogProjection
+create table audit_log(
+    id bigserial primary key,
+    -- uuid of the watermill message, which is the event id since the envelope, makes the insertion idempotent
+    event_id varchar(64) not null unique,
+    event_type varchar(256) not null,
+    chat_id bigint,
+    -- null for the events made by the system and the ones published before the envelope
+    actor_id bigint,
+    -- the participants or the message the event is about
+    target_ids bigint[] not null default '{}',
+    correlation_id varchar(64),
+    payload jsonb not null,
+    create_date_time timestamp not null
+);
+create index audit_log_create_date_time_idx on audit_log(create_date_time);
+create index audit_log_chat_id_idx on audit_log(chat_id, create_date_time);
+create index audit_log_actor_id_idx on audit_log(actor_id, create_date_time);
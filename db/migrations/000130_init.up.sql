@@ -0,0 +1,11 @@
+-- the last event handled by the projection in the partition, is shown by the admin api
+create table projection_partition_progress(
+    projection varchar(256) not null,
+    partition int not null,
+    event_offset bigint not null,
+    event_type varchar(256) not null,
+    event_date_time timestamp,
+    trace_id varchar(64),
+    processed_date_time timestamp not null,
+    primary key (projection, partition)
+);
@@ -0,0 +1,17 @@
+-- the handover of the live projection's consumer group to the tables built by the rebuild command
+create table projection_switch(
+    projection varchar(256) primary key,
+    -- the live projection waits before every event, so the rebuild can replace its tables
+    paused boolean not null,
+    -- is incremented by every switch
+    generation bigint not null default 0,
+    switch_date_time timestamp
+);
+
+-- the rebuilt tables already contain the events up to this offset, the live projection skips them after the switch
+create table projection_switch_offset(
+    projection varchar(256) not null,
+    partition int not null,
+    event_offset bigint not null,
+    primary key (projection, partition)
+);
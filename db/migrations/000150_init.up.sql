@@ -0,0 +1,10 @@
+-- the projections split out of CommonProjection continue from its offsets instead of replaying the topic into the already filled tables,
+-- the rows are only inserted into the existing installation and are removed after the offsets have been copied.
+-- The chat projection keeps the consumer group of CommonProjection, the consumer groups are taken from the config by RunProjectionOffsetInheritance
+create table projection_offset_inheritance(
+    projection varchar(256) primary key
+);
+
+insert into projection_offset_inheritance(projection)
+select p from unnest(array['chatView', 'unreadMessages', 'blog']) as p
+where exists(select * from chat_common);
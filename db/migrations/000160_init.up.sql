@@ -0,0 +1,7 @@
+-- the point in the past where the projections stop applying the events, it's set by reset and makes serve read-only,
+-- at most one row
+create table replay_stop(
+    id boolean primary key default true check (id),
+    event_offsets jsonb, -- the last applied offset by partition, the partitions absent here aren't limited by the offset
+    created_at timestamp -- the events created after it aren't applied
+);
@@ -0,0 +1,4 @@
+-- the key is claimed before the handler runs, the response is stored after it has finished
+alter table idempotency_key alter column response_status drop not null;
+alter table idempotency_key alter column response_content_type drop not null;
+alter table idempotency_key alter column response_body drop not null;
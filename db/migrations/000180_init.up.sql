@@ -0,0 +1,13 @@
+-- the last message id of the chat taken by the aggregate, the new message gets a greater one,
+-- so the ids of the chat increase in the order of the events whatever the id generator is
+create table chat_aggregate_message_id(
+    chat_id bigint primary key,
+    last_id bigint not null
+);
+
+insert into chat_aggregate_message_id(chat_id, last_id)
+select id, last_generated_message_id from chat_common;
+
+insert into chat_aggregate_message_id(chat_id, last_id)
+select chat_id, max(id) from message group by chat_id
+on conflict (chat_id) do update set last_id = greatest(chat_aggregate_message_id.last_id, excluded.last_id);
@@ -0,0 +1,4 @@
+-- the version of the message, only its edits change it, so they don't conflict with the rest of the chat
+alter table chat_aggregate_message add column version bigint not null default 1;
+-- nullable, so the snapshots made before the column can be restored, null means 1
+alter table message add column version bigint default 1;
@@ -0,0 +1,12 @@
+-- the events which are committed together with the command, but haven't been sent to kafka yet
+create table chat_event_outbox(
+    id bigserial primary key,
+    chat_id bigint not null,
+    seq bigint not null,
+    message_uuid varchar(64) not null,
+    metadata jsonb not null,
+    payload bytea not null,
+    create_date_time timestamp not null
+);
+
+create index chat_event_outbox_chat_id_seq_idx on chat_event_outbox(chat_id, seq);
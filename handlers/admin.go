@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"net/http"
+)
+
+type AdminHandler struct {
+	lgr                        *logger.LoggerWrapper
+	cfg                        *config.AppConfig
+	dbWrapper                  *db.DB
+	saramaClient               sarama.Client
+	commonProjection           *cqrs.CommonProjection
+	projectionProgressRecorder *cqrs.ProjectionProgressRecorder
+	eventBus                   *cqrs.PartitionAwareEventBus
+}
+
+func NewAdminHandler(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dbWrapper *db.DB,
+	saramaClient sarama.Client,
+	commonProjection *cqrs.CommonProjection,
+	projectionProgressRecorder *cqrs.ProjectionProgressRecorder,
+	eventBus *cqrs.PartitionAwareEventBus,
+) *AdminHandler {
+	return &AdminHandler{
+		lgr:                        lgr,
+		cfg:                        cfg,
+		dbWrapper:                  dbWrapper,
+		saramaClient:               saramaClient,
+		commonProjection:           commonProjection,
+		projectionProgressRecorder: projectionProgressRecorder,
+		eventBus:                   eventBus,
+	}
+}
+
+func (ah *AdminHandler) GetProjectionsStatus(g *gin.Context) {
+	ctx := g.Request.Context()
+
+	needToFastForward, err := ah.commonProjection.GetIsNeedToFastForwardSequences(ctx, ah.dbWrapper)
+	if err != nil {
+		respondError(g, ah.lgr, "Error getting fast-forward flag", err)
+		return
+	}
+
+	ret := ProjectionsStatusDto{
+		NeedToFastForwardSequences: needToFastForward,
+		Projections:                []ProjectionStatusDto{},
+	}
+	for _, name := range cqrs.ProjectionNames(ah.cfg) {
+		offsets, err := kafka.GetPartitionOffsets(ah.lgr, ah.cfg, ah.saramaClient, name)
+		if err != nil {
+			respondError(g, ah.lgr, "Error getting partition offsets", err)
+			return
+		}
+		lastEvents, err := ah.projectionProgressRecorder.GetLastProcessedEvents(ctx, name)
+		if err != nil {
+			respondError(g, ah.lgr, "Error getting last processed events", err)
+			return
+		}
+
+		ps := ProjectionStatusDto{
+			Name:       name,
+			Partitions: []PartitionStatusDto{},
+		}
+		for _, po := range offsets {
+			pst := PartitionStatusDto{
+				PartitionOffsets: po,
+			}
+			if le, ok := lastEvents[po.Partition]; ok {
+				pst.LastEvent = &le
+			}
+			ps.Lag += po.Lag
+			ps.Partitions = append(ps.Partitions, pst)
+		}
+		ret.Projections = append(ret.Projections, ps)
+	}
+
+	g.JSON(http.StatusOK, ret)
+}
+
+// RefreshChat makes the chat view and the unread messages projections recompute the rows of all the chat's participants through ChatViewRefreshed
+func (ah *AdminHandler) RefreshChat(g *gin.Context) {
+	chatId, err := getPathInt64(g, ChatIdParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding chatId", err)
+		return
+	}
+
+	err = cqrs.RefreshChat(g.Request.Context(), ah.eventBus, ah.dbWrapper, ah.commonProjection, chatId)
+	if err != nil {
+		respondError(g, ah.lgr, "Error refreshing chat", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
+
+func (ah *AdminHandler) RefreshChatParticipant(g *gin.Context) {
+	chatId, err := getPathInt64(g, ChatIdParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding chatId", err)
+		return
+	}
+	userId, err := getPathInt64(g, UserIdParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding userId", err)
+		return
+	}
+
+	err = cqrs.RefreshChatParticipant(g.Request.Context(), ah.eventBus, ah.dbWrapper, chatId, userId)
+	if err != nil {
+		respondError(g, ah.lgr, "Error refreshing chat participant", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
+
+func (ah *AdminHandler) RefreshUserChats(g *gin.Context) {
+	userId, err := getPathInt64(g, UserIdParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding userId", err)
+		return
+	}
+
+	err = cqrs.RefreshUserChats(g.Request.Context(), ah.eventBus, ah.dbWrapper, userId)
+	if err != nil {
+		respondError(g, ah.lgr, "Error refreshing user chats", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"net/http"
+	"time"
+)
+
+type AuditLogHandler struct {
+	lgr                *logger.LoggerWrapper
+	auditLogProjection *cqrs.AuditLogProjection
+}
+
+func NewAuditLogHandler(
+	lgr *logger.LoggerWrapper,
+	auditLogProjection *cqrs.AuditLogProjection,
+) *AuditLogHandler {
+	return &AuditLogHandler{
+		lgr:                lgr,
+		auditLogProjection: auditLogProjection,
+	}
+}
+
+func (ah *AuditLogHandler) SearchAuditLog(g *gin.Context) {
+	filter := cqrs.AuditLogFilter{}
+	var err error
+
+	filter.ChatId, err = getQueryInt64Nullable(g, ChatIdQueryParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding chatId", err)
+		return
+	}
+	filter.ActorId, err = getQueryInt64Nullable(g, ActorIdParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding actorId", err)
+		return
+	}
+	if eventType := g.Query(EventTypeParam); eventType != "" {
+		filter.EventType = &eventType
+	}
+	filter.From, err = getQueryTimeNullable(g, FromParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding from", err)
+		return
+	}
+	filter.To, err = getQueryTimeNullable(g, ToParam)
+	if err != nil {
+		respondError(g, ah.lgr, "Error binding to", err)
+		return
+	}
+
+	page := utils.FixPageString(g.Query(PageParam))
+	size := utils.FixSizeString(g.Query(SizeParam))
+	offset := utils.GetOffset(page, size)
+
+	entries, err := ah.auditLogProjection.GetAuditLog(g.Request.Context(), filter, size, offset)
+	if err != nil {
+		respondError(g, ah.lgr, "Error getting audit log", err)
+		return
+	}
+	g.JSON(http.StatusOK, entries)
+}
+
+func getQueryInt64Nullable(g *gin.Context, param string) (*int64, error) {
+	value := g.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := utils.ParseInt64(value)
+	if err != nil {
+		return nil, cqrs.NewValidationError("wrong query parameter %v: %q", param, value)
+	}
+	return &parsed, nil
+}
+
+func getQueryTimeNullable(g *gin.Context, param string) (*time.Time, error) {
+	value := g.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	parsed := utils.GetTimeNullable(value)
+	if parsed == nil {
+		return nil, cqrs.NewValidationError("wrong query parameter %v, RFC 3339 is expected: %q", param, value)
+	}
+	return parsed, nil
+}
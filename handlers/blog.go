@@ -38,32 +38,22 @@ func (ch *BlogHandler) SearchBlogs(g *gin.Context) {
 
 	chats, err := ch.commonProjection.GetBlogs(g.Request.Context(), size, offset, reverse)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error getting blogs", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error getting blogs", err)
 		return
 	}
 	g.JSON(http.StatusOK, chats)
 }
 
 func (ch *BlogHandler) GetBlog(g *gin.Context) {
-	cid := g.Param(BlogIdParam)
-
-	blogId, err := utils.ParseInt64(cid)
+	blogId, err := getPathInt64(g, BlogIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding blogId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding blogId", err)
 		return
 	}
 
 	blog, err := ch.commonProjection.GetBlog(g.Request.Context(), blogId)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error getting blog", "err", err)
-		g.Status(http.StatusInternalServerError)
-		return
-	}
-
-	if blog == nil {
-		g.Status(http.StatusNoContent)
+		respondError(g, ch.lgr, "Error getting blog", err)
 		return
 	}
 
@@ -71,11 +61,9 @@ func (ch *BlogHandler) GetBlog(g *gin.Context) {
 }
 
 func (ch *BlogHandler) SearchComments(g *gin.Context) {
-	cid := g.Param(BlogIdParam)
-	blogId, err := utils.ParseInt64(cid)
+	blogId, err := getPathInt64(g, BlogIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding blogId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding blogId", err)
 		return
 	}
 
@@ -86,8 +74,7 @@ func (ch *BlogHandler) SearchComments(g *gin.Context) {
 
 	chats, err := ch.commonProjection.GetComments(g.Request.Context(), blogId, size, offset, reverse)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error getting blog comments", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error getting blog comments", err)
 		return
 	}
 	g.JSON(http.StatusOK, chats)
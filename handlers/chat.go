@@ -16,6 +16,8 @@ type ChatHandler struct {
 	eventBus         *cqrs.PartitionAwareEventBus
 	dbWrapper        *db.DB
 	commonProjection *cqrs.CommonProjection
+	chatRepository   *cqrs.ChatRepository
+	idGenerator      cqrs.IdGenerator
 }
 
 func NewChatHandler(
@@ -23,34 +25,36 @@ func NewChatHandler(
 	eventBus *cqrs.PartitionAwareEventBus,
 	dbWrapper *db.DB,
 	commonProjection *cqrs.CommonProjection,
+	chatRepository *cqrs.ChatRepository,
+	idGenerator cqrs.IdGenerator,
 ) *ChatHandler {
 	return &ChatHandler{
 		lgr:              lgr,
 		eventBus:         eventBus,
 		dbWrapper:        dbWrapper,
 		commonProjection: commonProjection,
+		chatRepository:   chatRepository,
+		idGenerator:      idGenerator,
 	}
 }
 
 func (ch *ChatHandler) CreateChat(g *gin.Context) {
 	ccd := new(ChatCreateDto)
 
-	err := g.Bind(ccd)
+	err := bindBody(g, ccd)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding ChatCreateDto", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding ChatCreateDto", err)
 		return
 	}
 
 	userId, err := getUserId(g)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error parsing UserId", err)
 		return
 	}
 
 	cc := cqrs.ChatCreate{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		Title:          ccd.Title,
 		ParticipantIds: ccd.ParticipantIds,
 	}
@@ -59,10 +63,9 @@ func (ch *ChatHandler) CreateChat(g *gin.Context) {
 		cc.ParticipantIds = append(cc.ParticipantIds, userId)
 	}
 
-	chatId, err := cc.Handle(g.Request.Context(), ch.eventBus, ch.dbWrapper, ch.commonProjection)
+	chatId, err := cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository, ch.idGenerator)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error sending ChatCreate command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error sending ChatCreate command", err)
 		return
 	}
 
@@ -74,51 +77,53 @@ func (ch *ChatHandler) CreateChat(g *gin.Context) {
 func (ch *ChatHandler) EditChat(g *gin.Context) {
 	ccd := new(ChatEditDto)
 
-	err := g.Bind(ccd)
+	err := bindBody(g, ccd)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding ChatEditDto", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding ChatEditDto", err)
+		return
+	}
+
+	expectedVersion, err := getIfMatch(g)
+	if err != nil {
+		respondError(g, ch.lgr, "Error parsing If-Match", err)
 		return
 	}
 
 	cc := cqrs.ChatEdit{
-		AdditionalData:      cqrs.GenerateMessageAdditionalData(),
+		AdditionalData:      cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ChatId:              ccd.Id,
 		Title:               ccd.Title,
 		ParticipantIdsToAdd: ccd.ParticipantIds,
 		Blog:                ccd.Blog,
+		ExpectedVersion:     expectedVersion,
 	}
 
-	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.dbWrapper, ch.commonProjection)
+	version, err := cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository, ch.commonProjection)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error sending ChatEdit command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error sending ChatEdit command", err)
 		return
 	}
 
+	g.Header(ETagHeader, cqrs.FormatETag(version))
 	g.Status(http.StatusOK)
 }
 
 func (ch *ChatHandler) DeleteChat(g *gin.Context) {
 
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding chatId", err)
 		return
 	}
 
 	cc := cqrs.ChatDelete{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ChatId:         chatId,
 	}
 
-	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.dbWrapper, ch.commonProjection)
+	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error sending ChatDelete command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error sending ChatDelete command", err)
 		return
 	}
 
@@ -126,12 +131,9 @@ func (ch *ChatHandler) DeleteChat(g *gin.Context) {
 }
 
 func (ch *ChatHandler) PinChat(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding chatId", err)
 		return
 	}
 
@@ -141,22 +143,92 @@ func (ch *ChatHandler) PinChat(g *gin.Context) {
 
 	userId, err := getUserId(g)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error parsing UserId", err)
 		return
 	}
 
 	cc := cqrs.ChatPin{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ChatId:         chatId,
 		Pin:            pin,
 		ParticipantId:  userId,
 	}
 
-	err = cc.Handle(g.Request.Context(), ch.eventBus)
+	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository)
+	if err != nil {
+		respondError(g, ch.lgr, "Error sending ChatPin command", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
+
+func (ch *ChatHandler) EditChatRetention(g *gin.Context) {
+	chatId, err := getPathInt64(g, ChatIdParam)
+	if err != nil {
+		respondError(g, ch.lgr, "Error binding chatId", err)
+		return
+	}
+
+	userId, err := getUserId(g)
+	if err != nil {
+		respondError(g, ch.lgr, "Error parsing UserId", err)
+		return
+	}
+
+	crd := new(ChatRetentionEditDto)
+
+	err = bindBody(g, crd)
+	if err != nil {
+		respondError(g, ch.lgr, "Error binding ChatRetentionEditDto", err)
+		return
+	}
+
+	cc := cqrs.ChatRetentionEdit{
+		AdditionalData:   cqrs.GenerateMessageAdditionalData(g.Request.Context()),
+		ChatId:           chatId,
+		RetentionSeconds: crd.RetentionSeconds,
+	}
+
+	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository, userId)
+	if err != nil {
+		respondError(g, ch.lgr, "Error sending ChatRetentionEdit command", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
+
+func (ch *ChatHandler) EditChatSlowMode(g *gin.Context) {
+	chatId, err := getPathInt64(g, ChatIdParam)
+	if err != nil {
+		respondError(g, ch.lgr, "Error binding chatId", err)
+		return
+	}
+
+	userId, err := getUserId(g)
+	if err != nil {
+		respondError(g, ch.lgr, "Error parsing UserId", err)
+		return
+	}
+
+	csd := new(ChatSlowModeEditDto)
+
+	err = bindBody(g, csd)
+	if err != nil {
+		respondError(g, ch.lgr, "Error binding ChatSlowModeEditDto", err)
+		return
+	}
+
+	cc := cqrs.ChatSlowModeEdit{
+		AdditionalData:  cqrs.GenerateMessageAdditionalData(g.Request.Context()),
+		ChatId:          chatId,
+		SlowModeSeconds: csd.SlowModeSeconds,
+	}
+
+	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository, userId)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error sending ChatPin command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error sending ChatSlowModeEdit command", err)
 		return
 	}
 
@@ -166,8 +238,7 @@ func (ch *ChatHandler) PinChat(g *gin.Context) {
 func (ch *ChatHandler) SearchChats(g *gin.Context) {
 	userId, err := getUserId(g)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error parsing UserId", err)
 		return
 	}
 
@@ -183,8 +254,7 @@ func (ch *ChatHandler) SearchChats(g *gin.Context) {
 
 	chats, err := ch.commonProjection.GetChats(g.Request.Context(), userId, size, startingFromItemId, includeStartingFrom, reverse)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error getting chats", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error getting chats", err)
 		return
 	}
 	g.JSON(http.StatusOK, chats)
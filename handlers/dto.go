@@ -1,5 +1,10 @@
 package handlers
 
+import (
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/kafka"
+)
+
 type IdResponse struct {
 	Id int64 `json:"id"`
 }
@@ -15,6 +20,14 @@ type ChatEditDto struct {
 	Blog bool `json:"blog"`
 }
 
+type ChatRetentionEditDto struct {
+	RetentionSeconds int64 `json:"retentionSeconds"`
+}
+
+type ChatSlowModeEditDto struct {
+	SlowModeSeconds int64 `json:"slowModeSeconds"`
+}
+
 type MessageCreateDto struct {
 	Content string `json:"content"`
 }
@@ -31,3 +44,41 @@ type ParticipantAddDto struct {
 type ParticipantDeleteDto struct {
 	ParticipantIds []int64 `json:"participantIds"`
 }
+
+type WebhookSubscriptionCreateDto struct {
+	Url        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"eventTypes"` // empty means all the events
+	ChatId     *int64   `json:"chatId"`     // null means all the chats
+}
+
+type PartitionStatusDto struct {
+	kafka.PartitionOffsets
+	LastEvent *cqrs.LastProcessedEvent `json:"lastEvent"` // null if the projection hasn't handled any event of the partition since the start of the recording
+}
+
+type ProjectionStatusDto struct {
+	Name       string               `json:"name"` // the consumer group
+	Lag        int64                `json:"lag"`  // the sum over the partitions
+	Partitions []PartitionStatusDto `json:"partitions"`
+}
+
+type ProjectionsStatusDto struct {
+	NeedToFastForwardSequences bool                  `json:"needToFastForwardSequences"` // set by import and reset, till the start of serve
+	Projections                []ProjectionStatusDto `json:"projections"`
+}
+
+const HealthStatusUp = "UP"
+const HealthStatusDown = "DOWN"
+
+type HealthCheckDto struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Error      *string `json:"error,omitempty"`
+	DurationMs int64   `json:"durationMs"`
+}
+
+type HealthReportDto struct {
+	Status string           `json:"status"` // DOWN when any of the checks is DOWN
+	Checks []HealthCheckDto `json:"checks"`
+}
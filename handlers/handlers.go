@@ -3,10 +3,16 @@ package handlers
 import (
 	"context"
 	"errors"
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go-cqrs-chat-example/app"
 	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/idempotency"
 	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/ratelimit"
 	"go-cqrs-chat-example/utils"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/fx"
@@ -23,11 +29,24 @@ const LastUpdateDateTimeParam = "lastUpdateDateTime"
 const IncludeStartingFromParam = "includeStartingFrom"
 const StartingFromItemId = "startingFromItemId"
 const PinParam = "pin"
+const ChatIdQueryParam = "chatId"
+const ActorIdParam = "actorId"
+const EventTypeParam = "eventType"
+const FromParam = "from"
+const ToParam = "to"
 
 // path
 const ChatIdParam = "id"
 const MessageIdParam = "messageId"
 const BlogIdParam = "id"
+const WebhookSubscriptionIdParam = "id"
+const WebhookDeliveryIdParam = "id"
+const UserIdParam = "userId"
+
+// header
+const IfMatchHeader = "If-Match"
+const ETagHeader = "ETag"
+const CorrelationIdHeader = "X-Correlation-Id"
 
 func bindHttpHandlers(
 	ginRouter *gin.Engine,
@@ -35,11 +54,17 @@ func bindHttpHandlers(
 	participantHandler *ParticipantHandler,
 	messageHandler *MessageHandler,
 	blogHandler *BlogHandler,
+	webhookHandler *WebhookHandler,
+	auditLogHandler *AuditLogHandler,
+	adminHandler *AdminHandler,
+	healthHandler *HealthHandler,
 ) {
 	ginRouter.POST("/chat", chatHandler.CreateChat)
 	ginRouter.PUT("/chat", chatHandler.EditChat)
 	ginRouter.DELETE("/chat/:id", chatHandler.DeleteChat)
 	ginRouter.PUT("/chat/:id/pin", chatHandler.PinChat)
+	ginRouter.PUT("/chat/:id/retention", chatHandler.EditChatRetention)
+	ginRouter.PUT("/chat/:id/slow-mode", chatHandler.EditChatSlowMode)
 	ginRouter.GET("/chat/search", chatHandler.SearchChats)
 
 	ginRouter.PUT("/chat/:id/participant", participantHandler.AddParticipant)
@@ -57,34 +82,98 @@ func bindHttpHandlers(
 	ginRouter.GET("/blog/:id", blogHandler.GetBlog)
 	ginRouter.GET("/blog/:id/comment/search", blogHandler.SearchComments)
 
-	ginRouter.GET("/internal/health", func(g *gin.Context) {
-		g.Status(http.StatusOK)
-	})
+	ginRouter.POST("/webhook/subscription", webhookHandler.CreateSubscription)
+	ginRouter.GET("/webhook/subscription/search", webhookHandler.SearchSubscriptions)
+	ginRouter.DELETE("/webhook/subscription/:id", webhookHandler.DeleteSubscription)
+	ginRouter.GET("/webhook/subscription/:id/delivery/search", webhookHandler.SearchDeliveries)
+	ginRouter.PUT("/webhook/delivery/:id/redeliver", webhookHandler.Redeliver)
+
+	ginRouter.GET("/admin/audit-log/search", auditLogHandler.SearchAuditLog)
+	ginRouter.GET("/admin/projections", adminHandler.GetProjectionsStatus)
+	ginRouter.PUT("/admin/chat/:id/refresh", adminHandler.RefreshChat)
+	ginRouter.PUT("/admin/chat/:id/user/:userId/refresh", adminHandler.RefreshChatParticipant)
+	ginRouter.PUT("/admin/user/:userId/refresh", adminHandler.RefreshUserChats)
+
+	ginRouter.GET("/openapi.yml", ServeOpenApi)
+
+	// the former health check, it's kept for the existing deployments
+	ginRouter.GET("/internal/health", healthHandler.Liveness)
+	ginRouter.GET("/internal/health/liveness", healthHandler.Liveness)
+	ginRouter.GET("/internal/health/readiness", healthHandler.Readiness)
 }
 
 func getUserId(g *gin.Context) (int64, error) {
 	uh := g.Request.Header.Get("X-UserId")
-	return utils.ParseInt64(uh)
+	userId, err := utils.ParseInt64(uh)
+	if err != nil {
+		return 0, cqrs.NewValidationError("wrong X-UserId header: %q", uh)
+	}
+	return userId, nil
+}
+
+func getPathInt64(g *gin.Context, param string) (int64, error) {
+	value := g.Param(param)
+	parsed, err := utils.ParseInt64(value)
+	if err != nil {
+		return 0, cqrs.NewValidationError("wrong path parameter %v: %q", param, value)
+	}
+	return parsed, nil
+}
+
+func getIfMatch(g *gin.Context) (*int64, error) {
+	return cqrs.ParseIfMatch(g.GetHeader(IfMatchHeader))
+}
+
+func bindBody(g *gin.Context, obj any) error {
+	err := g.ShouldBind(obj)
+	if err != nil {
+		return cqrs.NewValidationError("wrong body: %v", err)
+	}
+	return nil
 }
 
 func ConfigureHttpServer(
 	cfg *config.AppConfig,
 	lgr *logger.LoggerWrapper,
 	lc fx.Lifecycle,
+	idempotencyStore *idempotency.Store,
+	rl *ratelimit.RateLimiter,
+	openApi *openapi3.T,
 	chatHandler *ChatHandler,
 	participantHandler *ParticipantHandler,
 	messageHandler *MessageHandler,
 	blogHandler *BlogHandler,
-) *http.Server {
+	webhookHandler *WebhookHandler,
+	auditLogHandler *AuditLogHandler,
+	adminHandler *AdminHandler,
+	healthHandler *HealthHandler,
+	startupState *app.StartupState,
+	replayStop *cqrs.ReplayStop,
+	metricsRegistry *prometheus.Registry,
+) (*http.Server, error) {
+	httpMetrics, err := HttpMetricsMiddleware()
+	if err != nil {
+		return nil, err
+	}
+
 	// https://gin-gonic.com/en/docs/examples/graceful-restart-or-stop/
 	gin.SetMode(gin.ReleaseMode)
 	ginRouter := gin.New()
 	ginRouter.Use(otelgin.Middleware(app.TRACE_RESOURCE))
+	ginRouter.Use(httpMetrics)
 	ginRouter.Use(StructuredLogMiddleware(lgr))
 	ginRouter.Use(WriteTraceToHeaderMiddleware())
+	ginRouter.Use(RequestInfoMiddleware())
 	ginRouter.Use(gin.Recovery())
+	ginRouter.Use(StartupGateMiddleware(cfg, startupState))
+	ginRouter.Use(ReadOnlyMiddleware(replayStop))
+	ginRouter.Use(OpenApiValidationMiddleware(lgr, openApi))
+	ginRouter.Use(RateLimitMiddleware(lgr, rl))
+	ginRouter.Use(IdempotencyMiddleware(lgr, idempotencyStore))
 
-	bindHttpHandlers(ginRouter, chatHandler, participantHandler, messageHandler, blogHandler)
+	bindHttpHandlers(ginRouter, chatHandler, participantHandler, messageHandler, blogHandler, webhookHandler, auditLogHandler, adminHandler, healthHandler)
+	// it isn't a part of the api, so it's out of bindHttpHandlers and openapi.yml
+	ginRouter.GET(MetricsPath, gin.WrapH(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})))
 
 	httpServer := &http.Server{
 		Addr:           cfg.HttpServerConfig.Address,
@@ -105,7 +194,7 @@ func ConfigureHttpServer(
 		},
 	})
 
-	return httpServer
+	return httpServer, nil
 }
 func StructuredLogMiddleware(lgr *logger.LoggerWrapper) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -153,6 +242,32 @@ func WriteTraceToHeaderMiddleware() gin.HandlerFunc {
 	}
 }
 
+// RequestInfoMiddleware puts the data for the events' envelope into the request's context,
+// X-UserId is optional here, the handlers which need it check it on their own
+func RequestInfoMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		correlationId := c.GetHeader(CorrelationIdHeader)
+		if correlationId == "" {
+			correlationId = cqrs.NewCorrelationId(c.Request.Context())
+		}
+		c.Writer.Header().Set(CorrelationIdHeader, correlationId)
+
+		actorId, _ := utils.ParseInt64(c.GetHeader("X-UserId"))
+
+		requestInfo := &cqrs.RequestInfo{
+			ActorId:       actorId,
+			CorrelationId: correlationId,
+			ClientInfo: &cqrs.ClientInfo{
+				UserAgent: c.Request.UserAgent(),
+				Ip:        c.ClientIP(),
+			},
+		}
+		c.Request = c.Request.WithContext(cqrs.MakeContextWithRequestInfo(c.Request.Context(), requestInfo))
+
+		c.Next()
+	}
+}
+
 func RunHttpServer(
 	lgr *logger.LoggerWrapper,
 	httpServer *http.Server,
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStartupGateMiddleware(t *testing.T) {
+	for _, serveStaleQueries := range []bool{false, true} {
+		cfg := &config.AppConfig{}
+		cfg.HttpServerConfig.StartupConfig.ServeStaleQueries = serveStaleQueries
+		startupState := app.NewStartupState()
+		startupState.SetProgress(42)
+
+		gin.SetMode(gin.ReleaseMode)
+		ginRouter := gin.New()
+		ginRouter.Use(StartupGateMiddleware(cfg, startupState))
+		ok := func(g *gin.Context) {
+			g.Status(http.StatusOK)
+		}
+		ginRouter.GET("/chat/search", ok)
+		ginRouter.POST("/chat", ok)
+		ginRouter.GET("/internal/health/readiness", ok)
+		ginRouter.GET(MetricsPath, ok)
+
+		do := func(method, path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			ginRouter.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			return w
+		}
+
+		w := do(http.MethodPost, "/chat")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		assert.Equal(t, "42.0", w.Header().Get(CatchUpProgressHeader))
+
+		w = do(http.MethodGet, "/chat/search")
+		if serveStaleQueries {
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "true", w.Header().Get(DataStaleHeader))
+			assert.Equal(t, "42.0", w.Header().Get(CatchUpProgressHeader))
+		} else {
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		}
+
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/internal/health/readiness").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, MetricsPath).Code)
+
+		app.MarkStarted(startupState)
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/chat").Code)
+		w = do(http.MethodGet, "/chat/search")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(DataStaleHeader))
+	}
+}
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	stopAt := time.Now().UTC()
+	for _, replayStop := range []*cqrs.ReplayStop{{}, {CreatedAt: &stopAt}} {
+		gin.SetMode(gin.ReleaseMode)
+		ginRouter := gin.New()
+		ginRouter.Use(ReadOnlyMiddleware(replayStop))
+		ok := func(g *gin.Context) {
+			g.Status(http.StatusOK)
+		}
+		ginRouter.GET("/chat/search", ok)
+		ginRouter.POST("/chat", ok)
+		ginRouter.PUT("/internal/projections", ok)
+
+		do := func(method, path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			ginRouter.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			return w
+		}
+
+		w := do(http.MethodPost, "/chat")
+		if replayStop.IsSet() {
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		} else {
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/chat/search").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodPut, "/internal/projections").Code)
+	}
+}
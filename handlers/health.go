@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/kafka"
+	"go-cqrs-chat-example/logger"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const InternalPathPrefix = "/internal/"
+
+const (
+	StartupCheck       = "startup"
+	PostgresCheck      = "postgres"
+	KafkaCheck         = "kafka"
+	RouterCheck        = "router"
+	ProjectionLagCheck = "projectionLag" // one per enabled projection and the chat projection they depend on, suffixed with ":<projection>"
+)
+
+type HealthHandler struct {
+	lgr          *logger.LoggerWrapper
+	cfg          *config.AppConfig
+	dbWrapper    *db.DB
+	saramaClient sarama.Client
+	cqrsRouter   *message.Router
+	startupState *app.StartupState
+	replayStop   *cqrs.ReplayStop
+}
+
+func NewHealthHandler(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dbWrapper *db.DB,
+	saramaClient sarama.Client,
+	cqrsRouter *message.Router,
+	startupState *app.StartupState,
+	replayStop *cqrs.ReplayStop,
+) *HealthHandler {
+	return &HealthHandler{
+		lgr:          lgr,
+		cfg:          cfg,
+		dbWrapper:    dbWrapper,
+		saramaClient: saramaClient,
+		cqrsRouter:   cqrsRouter,
+		startupState: startupState,
+		replayStop:   replayStop,
+	}
+}
+
+// Liveness only says the process is able to answer, the dependencies aren't checked,
+// so an orchestrator doesn't restart the instance because Kafka or Postgres is down
+func (hh *HealthHandler) Liveness(g *gin.Context) {
+	g.JSON(http.StatusOK, HealthReportDto{
+		Status: HealthStatusUp,
+		Checks: []HealthCheckDto{},
+	})
+}
+
+// Readiness says whether the instance should receive the traffic, responds 503 if any check fails
+func (hh *HealthHandler) Readiness(g *gin.Context) {
+	ctx := g.Request.Context()
+
+	ret := HealthReportDto{
+		Status: HealthStatusUp,
+		Checks: []HealthCheckDto{
+			hh.runCheck(ctx, StartupCheck, hh.checkStartup),
+			hh.runCheck(ctx, PostgresCheck, hh.checkPostgres),
+			hh.runCheck(ctx, KafkaCheck, hh.checkKafka),
+			hh.runCheck(ctx, RouterCheck, hh.checkRouter),
+		},
+	}
+	// the projections lag behind the replay stop on purpose
+	for _, projection := range hh.enabledLagProjections() {
+		ret.Checks = append(ret.Checks, hh.runCheck(ctx, ProjectionLagCheck+":"+projection, func(ctx context.Context) error {
+			return hh.checkProjectionLag(ctx, projection)
+		}))
+	}
+
+	status := http.StatusOK
+	for _, c := range ret.Checks {
+		if c.Status != HealthStatusUp {
+			ret.Status = HealthStatusDown
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	g.JSON(status, ret)
+}
+
+func (hh *HealthHandler) enabledLagProjections() []string {
+	if hh.replayStop.IsSet() {
+		return nil
+	}
+	ret := slices.Clone(hh.cfg.ProjectionsConfig.Enabled)
+	// the other projections wait for the chat projection, see cqrs.SequenceChecker.ChatProjectionMiddleware,
+	// so they stall when it's down, even if it's run by another instance
+	if len(ret) > 0 && !slices.Contains(ret, config.ChatProjection) {
+		ret = append(ret, config.ChatProjection)
+	}
+	return ret
+}
+
+func (hh *HealthHandler) runCheck(ctx context.Context, name string, check func(ctx context.Context) error) HealthCheckDto {
+	ctx, cancel := context.WithTimeout(ctx, hh.cfg.HttpServerConfig.ReadinessConfig.CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// sarama doesn't take a context, so the check is abandoned rather than cancelled on timeout
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %v", hh.cfg.HttpServerConfig.ReadinessConfig.CheckTimeout)
+	}
+
+	ret := HealthCheckDto{
+		Name:       name,
+		Status:     HealthStatusUp,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		hh.lgr.WithTrace(ctx).Warn("Readiness check has failed", "check", name, "err", err)
+		errStr := err.Error()
+		ret.Status = HealthStatusDown
+		ret.Error = &errStr
+	}
+	return ret
+}
+
+func (hh *HealthHandler) checkStartup(ctx context.Context) error {
+	if !hh.startupState.IsStarted() {
+		return fmt.Errorf("still catching up with the events, %v%% consumed", formatProgress(hh.startupState))
+	}
+	return nil
+}
+
+func (hh *HealthHandler) checkPostgres(ctx context.Context) error {
+	return hh.dbWrapper.PingContext(ctx)
+}
+
+func (hh *HealthHandler) checkKafka(ctx context.Context) error {
+	if hh.saramaClient.Closed() {
+		return errors.New("the client is closed")
+	}
+	// goes to the brokers, unlike the cached metadata
+	return hh.saramaClient.RefreshMetadata(hh.cfg.KafkaConfig.Topic)
+}
+
+func (hh *HealthHandler) checkRouter(ctx context.Context) error {
+	if hh.cqrsRouter.IsClosed() {
+		return errors.New("the router is closed")
+	}
+	if !hh.cqrsRouter.IsRunning() {
+		return errors.New("the router isn't running")
+	}
+	return nil
+}
+
+func (hh *HealthHandler) checkProjectionLag(ctx context.Context, projection string) error {
+	consumerGroup, err := hh.cfg.ProjectionsConfig.ConsumerGroup(projection)
+	if err != nil {
+		return err
+	}
+	offsets, err := kafka.GetPartitionOffsets(hh.lgr, hh.cfg, hh.saramaClient, consumerGroup)
+	if err != nil {
+		return err
+	}
+	var lag int64
+	for _, po := range offsets {
+		lag += po.Lag
+	}
+	maxLag := hh.cfg.HttpServerConfig.ReadinessConfig.MaxProjectionLag
+	if lag > maxLag {
+		return fmt.Errorf("the lag of %v is %v, which is more than %v", consumerGroup, lag, maxLag)
+	}
+	return nil
+}
+
+const DataStaleHeader = "X-Data-Stale"
+const CatchUpProgressHeader = "X-Catch-Up-Progress"
+
+func formatProgress(startupState *app.StartupState) string {
+	return fmt.Sprintf("%.1f", startupState.Progress())
+}
+
+// StartupGateMiddleware lets only the internal endpoints and, if enabled, the queries through until the app has caught up with the events.
+// The commands respond 503 because they would use the not fast-forwarded sequences and chat aggregates,
+// the queries are marked with DataStaleHeader and CatchUpProgressHeader
+func StartupGateMiddleware(cfg *config.AppConfig, startupState *app.StartupState) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if startupState.IsStarted() || strings.HasPrefix(g.Request.URL.Path, InternalPathPrefix) || g.Request.URL.Path == MetricsPath {
+			g.Next()
+			return
+		}
+		progress := formatProgress(startupState)
+		if cfg.HttpServerConfig.StartupConfig.ServeStaleQueries && isQuery(g.Request.Method) {
+			g.Header(DataStaleHeader, "true")
+			g.Header(CatchUpProgressHeader, progress)
+			g.Next()
+			return
+		}
+		g.Header("Retry-After", "5")
+		g.Header(CatchUpProgressHeader, progress)
+		abortWithProblem(g, http.StatusServiceUnavailable, "The server is catching up with the events, "+progress+"% consumed", nil)
+	}
+}
+
+func isQuery(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// ReadOnlyMiddleware rejects the commands while the replay is stopped at a point in the past, the queries show the state at that point
+func ReadOnlyMiddleware(replayStop *cqrs.ReplayStop) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if !replayStop.IsSet() || isQuery(g.Request.Method) || strings.HasPrefix(g.Request.URL.Path, InternalPathPrefix) {
+			g.Next()
+			return
+		}
+		abortWithProblem(g, http.StatusServiceUnavailable, "The server shows the state at the replay stop, the commands are disabled", nil)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/idempotency"
+	"go-cqrs-chat-example/logger"
+	"io"
+	"net/http"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// bodyRecorder tees the response in order to store it after the handler has finished
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func isIdempotentMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut
+}
+
+// IdempotencyMiddleware stores the first response of a command with Idempotency-Key header and replays it for the duplicates, see idempotency.Store
+func IdempotencyMiddleware(
+	lgr *logger.LoggerWrapper,
+	store *idempotency.Store,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isIdempotentMethod(c.Request.Method) || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+
+		if len(key) > idempotency.MaxKeyLength {
+			lgr.WithTrace(ctx).Info("Too long idempotency key", "length", len(key))
+			abortWithProblem(c, http.StatusBadRequest, "too long "+IdempotencyKeyHeader, nil)
+			return
+		}
+
+		requestBody, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, lgr, "Error reading request body", err)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+		userId, _ := getUserId(c)
+		k := &idempotency.Key{
+			Key:    key,
+			UserId: userId,
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+		}
+		requestHash := idempotency.HashRequest(k.Method, k.Path, c.Request.URL.RawQuery, c.GetHeader(IfMatchHeader), requestBody)
+
+		stored, err := store.Acquire(ctx, k, requestHash)
+		if errors.Is(err, idempotency.ErrKeyReused) {
+			lgr.WithTrace(ctx).Info("Idempotency key is reused with a different request", "user_id", userId, "path", k.Path)
+			abortWithProblem(c, http.StatusUnprocessableEntity, IdempotencyKeyHeader+" is reused with a different request", nil)
+			return
+		} else if errors.Is(err, idempotency.ErrInProgress) {
+			lgr.WithTrace(ctx).Info("The request with the same idempotency key is still in progress", "user_id", userId, "path", k.Path)
+			abortWithProblem(c, http.StatusConflict, "the request with the same "+IdempotencyKeyHeader+" is still in progress", nil)
+			return
+		} else if err != nil {
+			lgr.WithTrace(ctx).Error("Error during acquiring idempotency key", "err", err)
+			if ctx.Err() != nil {
+				c.Abort()
+				return
+			}
+			abortWithProblem(c, http.StatusInternalServerError, "", nil)
+			return
+		}
+		if stored != nil {
+			lgr.WithTrace(ctx).Info("Replaying the stored response", "user_id", userId, "path", k.Path, "status", stored.Status)
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+		trackingCtx, committed := cqrs.WithCommitTracking(ctx)
+		c.Request = c.Request.WithContext(trackingCtx)
+
+		c.Next()
+
+		// the request can already be cancelled by the client, but the outcome of the handler should be stored anyway
+		finishCtx := context.WithoutCancel(ctx)
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError && !committed() {
+			// a client should be able to retry a failed command, unless its events have been committed
+			err = store.Release(finishCtx, k)
+		} else {
+			err = store.Finish(finishCtx, k, &idempotency.Response{
+				RequestHash: requestHash,
+				Status:      status,
+				ContentType: recorder.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			lgr.WithTrace(ctx).Error("Error during storing the response of idempotency key", "err", err)
+		}
+	}
+}
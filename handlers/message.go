@@ -5,6 +5,7 @@ import (
 	"go-cqrs-chat-example/cqrs"
 	"go-cqrs-chat-example/db"
 	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/ratelimit"
 	"go-cqrs-chat-example/utils"
 	"net/http"
 )
@@ -14,6 +15,9 @@ type MessageHandler struct {
 	eventBus         *cqrs.PartitionAwareEventBus
 	dbWrapper        *db.DB
 	commonProjection *cqrs.CommonProjection
+	chatRepository   *cqrs.ChatRepository
+	rateLimiter      *ratelimit.RateLimiter
+	idGenerator      cqrs.IdGenerator
 }
 
 func NewMessageHandler(
@@ -21,57 +25,66 @@ func NewMessageHandler(
 	eventBus *cqrs.PartitionAwareEventBus,
 	dbWrapper *db.DB,
 	commonProjection *cqrs.CommonProjection,
+	chatRepository *cqrs.ChatRepository,
+	rateLimiter *ratelimit.RateLimiter,
+	idGenerator cqrs.IdGenerator,
 ) *MessageHandler {
 	return &MessageHandler{
 		lgr:              lgr,
 		eventBus:         eventBus,
 		dbWrapper:        dbWrapper,
 		commonProjection: commonProjection,
+		chatRepository:   chatRepository,
+		rateLimiter:      rateLimiter,
+		idGenerator:      idGenerator,
 	}
 }
 
 func (mc *MessageHandler) CreateMessage(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding chatId", err)
 		return
 	}
 
 	userId, err := getUserId(g)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error parsing UserId", err)
 		return
 	}
 
 	mcd := new(MessageCreateDto)
 
-	err = g.Bind(mcd)
+	err = bindBody(g, mcd)
+	if err != nil {
+		respondError(g, mc.lgr, "Error binding MessageCreateDto", err)
+		return
+	}
+
+	slowModeSeconds, err := mc.commonProjection.GetChatSlowModeSeconds(g.Request.Context(), chatId)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding MessageCreateDto", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error getting slow mode", err)
 		return
 	}
+	if slowModeSeconds > 0 {
+		allowed, retryAfter := mc.rateLimiter.AllowSlowMode(chatId, userId, slowModeSeconds)
+		if !allowed {
+			mc.lgr.WithTrace(g.Request.Context()).Info("Slow mode is active", "chat_id", chatId, "user_id", userId, "retry_after", retryAfter)
+			abortTooManyRequests(g, retryAfter)
+			return
+		}
+	}
 
 	cc := cqrs.MessageCreate{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ChatId:         chatId,
 		Content:        mcd.Content,
 		OwnerId:        userId,
 	}
 
-	mid, wasAdded, err := cc.Handle(g.Request.Context(), mc.eventBus, mc.dbWrapper, mc.commonProjection)
+	mid, err := cc.Handle(g.Request.Context(), mc.eventBus, mc.chatRepository, mc.commonProjection, mc.idGenerator)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error sending MessageCreate command", "err", err)
-		g.Status(http.StatusInternalServerError)
-		return
-	}
-
-	if !wasAdded {
-		g.Status(http.StatusTeapot)
+		respondError(g, mc.lgr, "Error sending MessageCreate command", err)
 		return
 	}
 
@@ -81,81 +94,78 @@ func (mc *MessageHandler) CreateMessage(g *gin.Context) {
 }
 
 func (mc *MessageHandler) EditMessage(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding chatId", err)
 		return
 	}
 
 	userId, err := getUserId(g)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error parsing UserId", err)
 		return
 	}
 
 	ccd := new(MessageEditDto)
 
-	err = g.Bind(ccd)
+	err = bindBody(g, ccd)
+	if err != nil {
+		respondError(g, mc.lgr, "Error binding MessageEditDto", err)
+		return
+	}
+
+	expectedVersion, err := getIfMatch(g)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding MessageEditDto", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error parsing If-Match", err)
 		return
 	}
 
 	cc := cqrs.MessageEdit{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
-		MessageId:      ccd.Id,
-		ChatId:         chatId,
-		Content:        ccd.Content,
+		AdditionalData:  cqrs.GenerateMessageAdditionalData(g.Request.Context()),
+		MessageId:       ccd.Id,
+		ChatId:          chatId,
+		Content:         ccd.Content,
+		ExpectedVersion: expectedVersion,
 	}
 
-	err = cc.Handle(g.Request.Context(), mc.eventBus, mc.dbWrapper, mc.commonProjection, userId)
+	version, err := cc.Handle(g.Request.Context(), mc.eventBus, mc.chatRepository, mc.commonProjection, userId)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error sending MessageEdit command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error sending MessageEdit command", err)
 		return
 	}
 
+	g.Header(ETagHeader, cqrs.FormatETag(version))
 	g.Status(http.StatusOK)
 }
 
 func (mc *MessageHandler) DeleteMessage(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding chatId", err)
 		return
 	}
 
-	mid := g.Param(MessageIdParam)
-	messageId, err := utils.ParseInt64(mid)
+	messageId, err := getPathInt64(g, MessageIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding messageId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding messageId", err)
 		return
 	}
 
 	userId, err := getUserId(g)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error parsing UserId", err)
 		return
 	}
 
 	cc := cqrs.MessageDelete{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		MessageId:      messageId,
 		ChatId:         chatId,
 	}
 
-	err = cc.Handle(g.Request.Context(), mc.eventBus, mc.dbWrapper, mc.commonProjection, userId)
+	err = cc.Handle(g.Request.Context(), mc.eventBus, mc.chatRepository, mc.commonProjection, userId)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error sending MessageDelete command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error sending MessageDelete command", err)
 		return
 	}
 
@@ -163,42 +173,34 @@ func (mc *MessageHandler) DeleteMessage(g *gin.Context) {
 }
 
 func (mc *MessageHandler) ReadMessage(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding chatId", err)
 		return
 	}
 
-	mid := g.Param(MessageIdParam)
-
-	messageId, err := utils.ParseInt64(mid)
+	messageId, err := getPathInt64(g, MessageIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding messageId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding messageId", err)
 		return
 	}
 
 	userId, err := getUserId(g)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error parsing UserId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error parsing UserId", err)
 		return
 	}
 
 	mr := cqrs.MessageRead{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ChatId:         chatId,
 		MessageId:      messageId,
 		ParticipantId:  userId,
 	}
 
-	err = mr.Handle(g.Request.Context(), mc.eventBus, mc.commonProjection)
+	err = mr.Handle(g.Request.Context(), mc.eventBus, mc.chatRepository, mc.commonProjection)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error sending MessageRead command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error sending MessageRead command", err)
 		return
 	}
 
@@ -206,34 +208,28 @@ func (mc *MessageHandler) ReadMessage(g *gin.Context) {
 }
 
 func (mc *MessageHandler) MakeBlogPost(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding chatId", err)
 		return
 	}
 
-	mid := g.Param(MessageIdParam)
-
-	messageId, err := utils.ParseInt64(mid)
+	messageId, err := getPathInt64(g, MessageIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding messageId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding messageId", err)
 		return
 	}
 
 	mr := cqrs.MakeMessageBlogPost{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ChatId:         chatId,
 		MessageId:      messageId,
 		BlogPost:       true,
 	}
 
-	err = mr.Handle(g.Request.Context(), mc.eventBus)
+	err = mr.Handle(g.Request.Context(), mc.eventBus, mc.chatRepository)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error sending MakeMessageBlogPost command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error sending MakeMessageBlogPost command", err)
 		return
 	}
 
@@ -241,12 +237,9 @@ func (mc *MessageHandler) MakeBlogPost(g *gin.Context) {
 }
 
 func (mc *MessageHandler) SearchMessages(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error binding chatId", err)
 		return
 	}
 
@@ -257,8 +250,7 @@ func (mc *MessageHandler) SearchMessages(g *gin.Context) {
 	if startingFromItemIdString != "" {
 		startingFromItemId2, err := utils.ParseInt64(startingFromItemIdString) // exclusive
 		if err != nil {
-			mc.lgr.WithTrace(g.Request.Context()).Error("Error parsing startingFromItemId", "err", err)
-			g.Status(http.StatusInternalServerError)
+			respondError(g, mc.lgr, "Error parsing startingFromItemId", cqrs.NewValidationError("wrong query parameter %v: %q", StartingFromItemId, startingFromItemIdString))
 			return
 		}
 		startingFromItemId = &startingFromItemId2
@@ -267,8 +259,7 @@ func (mc *MessageHandler) SearchMessages(g *gin.Context) {
 
 	messages, err := mc.commonProjection.GetMessages(g.Request.Context(), chatId, size, startingFromItemId, includeStartingFrom, reverse)
 	if err != nil {
-		mc.lgr.WithTrace(g.Request.Context()).Error("Error getting messages", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, mc.lgr, "Error getting messages", err)
 		return
 	}
 	g.JSON(http.StatusOK, messages)
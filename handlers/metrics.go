@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"time"
+)
+
+const MetricsPath = "/metrics"
+
+// HttpMetricsMiddleware measures the requests by the route template, so /chat/1 and /chat/2 are the same series
+func HttpMetricsMiddleware() (gin.HandlerFunc, error) {
+	duration, err := otel.Meter("go-cqrs-chat-example/handlers").Float64Histogram(
+		"http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("The duration of the http requests"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		duration.Record(c.Request.Context(), time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", c.Writer.Status()),
+		))
+	}, nil
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/logger"
+	"net/http"
+	"strings"
+)
+
+//go:embed openapi.yml
+var openApiSpec []byte
+
+type ValidationErrorDto struct {
+	In      string `json:"in"`             // path, query, header or body
+	Name    string `json:"name,omitempty"` // name of the parameter or JSON pointer to the field of the body
+	Message string `json:"message"`
+}
+
+func LoadOpenApi() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openApiSpec)
+	if err != nil {
+		return nil, err
+	}
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// openApiPath converts gin's /chat/:id to OpenAPI's /chat/{id}
+func openApiPath(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + strings.TrimPrefix(s, ":") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// OpenApiValidationMiddleware rejects requests which don't conform the specification with 400,
+// so the handlers and the events in Kafka never see them
+func OpenApiValidationMiddleware(lgr *logger.LoggerWrapper, doc *openapi3.T) gin.HandlerFunc {
+	options := &openapi3filter.Options{
+		MultiError: true,
+	}
+
+	return func(g *gin.Context) {
+		fullPath := g.FullPath()
+		if fullPath == "" { // 404, gin answers by itself
+			g.Next()
+			return
+		}
+
+		path := openApiPath(fullPath)
+		pathItem := doc.Paths.Find(path)
+		if pathItem == nil {
+			g.Next()
+			return
+		}
+		operation := pathItem.GetOperation(g.Request.Method)
+		if operation == nil {
+			g.Next()
+			return
+		}
+
+		pathParams := map[string]string{}
+		for _, p := range g.Params {
+			pathParams[p.Key] = p.Value
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    g.Request,
+			PathParams: pathParams,
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    g.Request.Method,
+				Operation: operation,
+			},
+			Options: options,
+		}
+
+		err := openapi3filter.ValidateRequest(g.Request.Context(), input)
+		if err != nil {
+			validationErrors := toValidationErrors(err)
+			lgr.WithTrace(g.Request.Context()).Info("Request doesn't conform the specification", "operation", operation.OperationID, "errors", validationErrors)
+			abortWithProblem(g, http.StatusBadRequest, "the request doesn't conform the specification", validationErrors)
+			return
+		}
+
+		g.Next()
+	}
+}
+
+func toValidationErrors(err error) []ValidationErrorDto {
+	if me, ok := err.(openapi3.MultiError); ok {
+		ret := []ValidationErrorDto{}
+		for _, e := range me {
+			ret = append(ret, toValidationErrors(e)...)
+		}
+		return ret
+	}
+
+	var re *openapi3filter.RequestError
+	if !errors.As(err, &re) {
+		return []ValidationErrorDto{{In: "request", Message: err.Error()}}
+	}
+
+	in, name := "body", ""
+	if re.Parameter != nil {
+		in, name = re.Parameter.In, re.Parameter.Name
+	}
+
+	// with MultiError option the schema errors are collected into the nested MultiError
+	causes := []error{re.Err}
+	var nested openapi3.MultiError
+	if errors.As(re.Err, &nested) {
+		causes = nested
+	}
+
+	ret := []ValidationErrorDto{}
+	for _, cause := range causes {
+		ve := ValidationErrorDto{In: in, Name: name, Message: re.Reason}
+		var se *openapi3.SchemaError
+		if errors.As(cause, &se) {
+			ve.Message = se.Reason
+			if re.Parameter == nil {
+				ve.Name = "/" + strings.Join(se.JSONPointer(), "/")
+			}
+		} else if cause != nil {
+			ve.Message = cause.Error()
+		}
+		ret = append(ret, ve)
+	}
+	return ret
+}
+
+func ServeOpenApi(g *gin.Context) {
+	g.Data(http.StatusOK, "application/yaml", openApiSpec)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go-cqrs-chat-example/logger"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestOpenApiDrift fails when a route is added or removed without updating openapi.yml, or vice versa
+func TestOpenApiDrift(t *testing.T) {
+	doc, err := LoadOpenApi()
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.ReleaseMode)
+	ginRouter := gin.New()
+	bindHttpHandlers(ginRouter, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	routes := []string{}
+	for _, r := range ginRouter.Routes() {
+		routes = append(routes, r.Method+" "+openApiPath(r.Path))
+	}
+	sort.Strings(routes)
+
+	operations := []string{}
+	for path, pathItem := range doc.Paths.Map() {
+		for method := range pathItem.Operations() {
+			operations = append(operations, method+" "+path)
+		}
+	}
+	sort.Strings(operations)
+
+	assert.Equal(t, operations, routes)
+}
+
+func TestOpenApiValidation(t *testing.T) {
+	doc, err := LoadOpenApi()
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.ReleaseMode)
+	ginRouter := gin.New()
+	ginRouter.Use(OpenApiValidationMiddleware(logger.NewLogger(slog.Default()), doc))
+	ginRouter.POST("/chat", func(g *gin.Context) {
+		g.Status(http.StatusOK)
+	})
+
+	post := func(userId, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-UserId", userId)
+		w := httptest.NewRecorder()
+		ginRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, post("1", `{"title":"new chat","participantIds":null}`).Code)
+
+	w := post("0", `{"title":"","participantIds":[0]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	resp := ProblemDto{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+	assert.ElementsMatch(t, []ValidationErrorDto{
+		{In: "header", Name: "X-UserId", Message: "number must be at least 1"},
+		{In: "body", Name: "/participantIds/0", Message: "number must be at least 1"},
+		{In: "body", Name: "/title", Message: "minimum string length is 1"},
+	}, resp.Errors)
+}
@@ -14,6 +14,7 @@ type ParticipantHandler struct {
 	eventBus         *cqrs.PartitionAwareEventBus
 	dbWrapper        *db.DB
 	commonProjection *cqrs.CommonProjection
+	chatRepository   *cqrs.ChatRepository
 }
 
 func NewParticipantHandler(
@@ -21,44 +22,41 @@ func NewParticipantHandler(
 	eventBus *cqrs.PartitionAwareEventBus,
 	dbWrapper *db.DB,
 	commonProjection *cqrs.CommonProjection,
+	chatRepository *cqrs.ChatRepository,
 ) *ParticipantHandler {
 	return &ParticipantHandler{
 		lgr:              lgr,
 		eventBus:         eventBus,
 		dbWrapper:        dbWrapper,
 		commonProjection: commonProjection,
+		chatRepository:   chatRepository,
 	}
 }
 
 func (ch *ParticipantHandler) AddParticipant(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding chatId", err)
 		return
 	}
 
 	ccd := new(ParticipantAddDto)
 
-	err = g.Bind(ccd)
+	err = bindBody(g, ccd)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding ParticipantAddDto", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding ParticipantAddDto", err)
 		return
 	}
 
 	cc := cqrs.ParticipantAdd{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ParticipantIds: ccd.ParticipantIds,
 		ChatId:         chatId,
 	}
 
-	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.dbWrapper, ch.commonProjection)
+	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository, ch.commonProjection)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error sending ParticipantAdd command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error sending ParticipantAdd command", err)
 		return
 	}
 
@@ -66,34 +64,29 @@ func (ch *ParticipantHandler) AddParticipant(g *gin.Context) {
 }
 
 func (ch *ParticipantHandler) DeleteParticipant(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding chatId", err)
 		return
 	}
 
 	ccd := new(ParticipantDeleteDto)
 
-	err = g.Bind(ccd)
+	err = bindBody(g, ccd)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding ParticipantDeleteDto", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding ParticipantDeleteDto", err)
 		return
 	}
 
 	cc := cqrs.ParticipantDelete{
-		AdditionalData: cqrs.GenerateMessageAdditionalData(),
+		AdditionalData: cqrs.GenerateMessageAdditionalData(g.Request.Context()),
 		ParticipantIds: ccd.ParticipantIds,
 		ChatId:         chatId,
 	}
 
-	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.dbWrapper, ch.commonProjection)
+	err = cc.Handle(g.Request.Context(), ch.eventBus, ch.chatRepository, ch.commonProjection)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error sending ParticipantDelete command", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error sending ParticipantDelete command", err)
 		return
 	}
 
@@ -101,12 +94,9 @@ func (ch *ParticipantHandler) DeleteParticipant(g *gin.Context) {
 }
 
 func (ch *ParticipantHandler) GetParticipants(g *gin.Context) {
-	cid := g.Param(ChatIdParam)
-
-	chatId, err := utils.ParseInt64(cid)
+	chatId, err := getPathInt64(g, ChatIdParam)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error binding chatId", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error binding chatId", err)
 		return
 	}
 
@@ -117,8 +107,7 @@ func (ch *ParticipantHandler) GetParticipants(g *gin.Context) {
 
 	participants, err := ch.commonProjection.GetParticipantIdsForExternal(g.Request.Context(), chatId, participantsSize, participantsOffset, reverse)
 	if err != nil {
-		ch.lgr.WithTrace(g.Request.Context()).Error("Error getting participants", "err", err)
-		g.Status(http.StatusInternalServerError)
+		respondError(g, ch.lgr, "Error getting participants", err)
 		return
 	}
 	g.JSON(http.StatusOK, participants)
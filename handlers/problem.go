@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/logger"
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemDto is the body of all the error responses, see RFC 9457
+type ProblemDto struct {
+	Type     string               `json:"type"`
+	Title    string               `json:"title"`
+	Status   int                  `json:"status"`
+	Detail   string               `json:"detail,omitempty"`
+	Instance string               `json:"instance"`
+	TraceId  string               `json:"traceId"`
+	Errors   []ValidationErrorDto `json:"errors,omitempty"` // only for the requests which don't conform openapi.yml
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, cqrs.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, cqrs.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, cqrs.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cqrs.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, cqrs.ErrReadOnly):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondError maps the domain errors to 4xx, or 503 for the read-only one, and shows their details to the client,
+// the rest of the errors are logged and hidden behind 500
+func respondError(g *gin.Context, lgr *logger.LoggerWrapper, msg string, err error) {
+	status := errorStatus(err)
+	detail := ""
+	if status == http.StatusInternalServerError {
+		lgr.WithTrace(g.Request.Context()).Error(msg, "err", err)
+	} else {
+		lgr.WithTrace(g.Request.Context()).Info(msg, "err", err)
+		var de *cqrs.DomainError
+		if errors.As(err, &de) {
+			detail = de.Detail
+		}
+	}
+	abortWithProblem(g, status, detail, nil)
+}
+
+func abortWithProblem(g *gin.Context, status int, detail string, validationErrors []ValidationErrorDto) {
+	problem := ProblemDto{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: g.Request.URL.Path,
+		TraceId:  logger.GetTraceId(g.Request.Context()),
+		Errors:   validationErrors,
+	}
+	// gin doesn't override the already set Content-Type
+	g.Header("Content-Type", ProblemContentType)
+	g.AbortWithStatusJSON(status, problem)
+}
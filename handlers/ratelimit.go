@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/ratelimit"
+	"go-cqrs-chat-example/utils"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func isCommandMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete
+}
+
+func abortTooManyRequests(g *gin.Context, retryAfter time.Duration) {
+	g.Header("Retry-After", utils.ToString(int64(math.Ceil(retryAfter.Seconds()))))
+	abortWithProblem(g, http.StatusTooManyRequests, "retry after "+retryAfter.String(), nil)
+}
+
+func RateLimitMiddleware(lgr *logger.LoggerWrapper, rl *ratelimit.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rl.Enabled() || !isCommandMethod(c.Request.Method) || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		var userIdPtr *int64
+		if userId, err := getUserId(c); err == nil {
+			userIdPtr = &userId
+		}
+
+		var chatIdPtr *int64
+		if strings.HasPrefix(c.FullPath(), "/chat/:"+ChatIdParam) {
+			chatIdPtr = utils.ParseInt64Nullable(c.Param(ChatIdParam))
+		}
+
+		allowed, retryAfter := rl.AllowCommand(userIdPtr, chatIdPtr)
+		if !allowed {
+			lgr.WithTrace(c.Request.Context()).Info("Rate limit is exceeded", "path", c.FullPath(), "retry_after", retryAfter)
+			abortTooManyRequests(c, retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"net/http"
+	"net/url"
+)
+
+type WebhookHandler struct {
+	lgr               *logger.LoggerWrapper
+	webhookProjection *cqrs.WebhookProjection
+}
+
+func NewWebhookHandler(
+	lgr *logger.LoggerWrapper,
+	webhookProjection *cqrs.WebhookProjection,
+) *WebhookHandler {
+	return &WebhookHandler{
+		lgr:               lgr,
+		webhookProjection: webhookProjection,
+	}
+}
+
+func (wh *WebhookHandler) CreateSubscription(g *gin.Context) {
+	wsd := new(WebhookSubscriptionCreateDto)
+
+	err := bindBody(g, wsd)
+	if err != nil {
+		respondError(g, wh.lgr, "Error binding WebhookSubscriptionCreateDto", err)
+		return
+	}
+
+	u, err := url.Parse(wsd.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondError(g, wh.lgr, "Wrong webhook url", cqrs.NewValidationError("url should be an absolute http or https url: %q", wsd.Url))
+		return
+	}
+	if wsd.Secret == "" {
+		respondError(g, wh.lgr, "Empty webhook secret", cqrs.NewValidationError("secret should not be empty"))
+		return
+	}
+
+	id, err := wh.webhookProjection.CreateSubscription(g.Request.Context(), wsd.Url, wsd.Secret, wsd.EventTypes, wsd.ChatId)
+	if err != nil {
+		respondError(g, wh.lgr, "Error creating webhook subscription", err)
+		return
+	}
+
+	g.JSON(http.StatusOK, IdResponse{Id: id})
+}
+
+func (wh *WebhookHandler) SearchSubscriptions(g *gin.Context) {
+	page := utils.FixPageString(g.Query(PageParam))
+	size := utils.FixSizeString(g.Query(SizeParam))
+	offset := utils.GetOffset(page, size)
+
+	subscriptions, err := wh.webhookProjection.GetSubscriptions(g.Request.Context(), size, offset)
+	if err != nil {
+		respondError(g, wh.lgr, "Error getting webhook subscriptions", err)
+		return
+	}
+	g.JSON(http.StatusOK, subscriptions)
+}
+
+func (wh *WebhookHandler) DeleteSubscription(g *gin.Context) {
+	subscriptionId, err := getPathInt64(g, WebhookSubscriptionIdParam)
+	if err != nil {
+		respondError(g, wh.lgr, "Error binding subscriptionId", err)
+		return
+	}
+
+	err = wh.webhookProjection.DeleteSubscription(g.Request.Context(), subscriptionId)
+	if err != nil {
+		respondError(g, wh.lgr, "Error deleting webhook subscription", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
+
+func (wh *WebhookHandler) SearchDeliveries(g *gin.Context) {
+	subscriptionId, err := getPathInt64(g, WebhookSubscriptionIdParam)
+	if err != nil {
+		respondError(g, wh.lgr, "Error binding subscriptionId", err)
+		return
+	}
+
+	page := utils.FixPageString(g.Query(PageParam))
+	size := utils.FixSizeString(g.Query(SizeParam))
+	offset := utils.GetOffset(page, size)
+
+	deliveries, err := wh.webhookProjection.GetDeliveries(g.Request.Context(), subscriptionId, size, offset)
+	if err != nil {
+		respondError(g, wh.lgr, "Error getting webhook deliveries", err)
+		return
+	}
+	g.JSON(http.StatusOK, deliveries)
+}
+
+func (wh *WebhookHandler) Redeliver(g *gin.Context) {
+	deliveryId, err := getPathInt64(g, WebhookDeliveryIdParam)
+	if err != nil {
+		respondError(g, wh.lgr, "Error binding deliveryId", err)
+		return
+	}
+
+	err = wh.webhookProjection.Redeliver(g.Request.Context(), deliveryId)
+	if err != nil {
+		respondError(g, wh.lgr, "Error scheduling webhook redelivery", err)
+		return
+	}
+
+	g.Status(http.StatusOK)
+}
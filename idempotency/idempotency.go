@@ -0,0 +1,216 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"time"
+)
+
+const MaxKeyLength = 256
+
+var ErrKeyReused = errors.New("idempotency key is reused with a different request")
+var ErrInProgress = errors.New("the request with the same idempotency key is still in progress")
+
+// Key is scoped to the user and the route, so clients don't need to make keys globally unique
+type Key struct {
+	Key    string
+	UserId int64
+	Method string
+	Path   string
+}
+
+type Response struct {
+	RequestHash string
+	Pending     bool // the first request is still being handled
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps the first responses of the commands, it's shared by REST and gRPC.
+// The key is claimed by the pending row before the command runs and the response is stored after it,
+// so no transaction is held during the command. The concurrent duplicates wait for the pending row to be finished,
+// and only the first of them publishes the events.
+type Store struct {
+	dba *db.DB
+	cfg *config.IdempotencyConfig
+}
+
+func NewStore(
+	cfg *config.AppConfig,
+	dba *db.DB,
+) *Store {
+	return &Store{
+		dba: dba,
+		cfg: &cfg.HttpServerConfig.IdempotencyConfig,
+	}
+}
+
+// HashRequest covers everything the command depends on: the query parameters (e. g. pin=true) and the expected version from If-Match,
+// not only the body. The parts are separated by the zero byte, so moving a suffix of one part into the next one changes the hash
+func HashRequest(method, path, query, ifMatch string, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{method, path, query, ifMatch} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Acquire returns nil if the key has been claimed, then the caller runs the command and calls either Finish or Release.
+// Otherwise, it returns the stored response of the first request, waiting for it if it's still pending
+func (s *Store) Acquire(ctx context.Context, k *Key, requestHash string) (*Response, error) {
+	waitStart := time.Now()
+	for {
+		claimed, err := s.claim(ctx, k, requestHash)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		stored, err := s.get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil {
+			// the first request has failed and released the key
+			continue
+		}
+		if stored.RequestHash != requestHash {
+			return nil, ErrKeyReused
+		}
+		if !stored.Pending {
+			return stored, nil
+		}
+		if time.Since(waitStart) > s.cfg.WaitTimeout {
+			return nil, ErrInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.cfg.PollInterval):
+		}
+	}
+}
+
+// claim inserts the pending row, it returns false if someone else holds the key.
+// The expired key is taken over. The pending one isn't, even if its request has crashed, because its events may have been published,
+// it expires with the ttl
+func (s *Store) claim(ctx context.Context, k *Key, requestHash string) (bool, error) {
+	return db.TransactWithResult(ctx, s.dba, func(tx *db.Tx) (bool, error) {
+		now := time.Now().UTC()
+		_, err := tx.ExecContext(ctx, `
+			delete from idempotency_key
+			where (key, user_id, method, path) = ($1, $2, $3, $4) and expire_date_time <= $5
+		`, k.Key, k.UserId, k.Method, k.Path, now)
+		if err != nil {
+			return false, err
+		}
+		res, err := tx.ExecContext(ctx, `
+			insert into idempotency_key(key, user_id, method, path, request_hash, create_date_time, expire_date_time)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			on conflict(key, user_id, method, path) do nothing
+		`, k.Key, k.UserId, k.Method, k.Path, requestHash, now, now.Add(s.cfg.Ttl))
+		if err != nil {
+			return false, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return affected > 0, nil
+	})
+}
+
+func (s *Store) get(ctx context.Context, k *Key) (*Response, error) {
+	r := s.dba.QueryRowContext(ctx, `
+		select request_hash, response_status, response_content_type, response_body
+		from idempotency_key
+		where (key, user_id, method, path) = ($1, $2, $3, $4) and expire_date_time > $5
+	`, k.Key, k.UserId, k.Method, k.Path, time.Now().UTC())
+	var sr Response
+	var status sql.NullInt32
+	var contentType sql.NullString
+	err := r.Scan(&sr.RequestHash, &status, &contentType, &sr.Body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// there were no rows, but otherwise no error occurred
+			return nil, nil
+		}
+		return nil, err
+	}
+	sr.Pending = !status.Valid
+	sr.Status = int(status.Int32)
+	sr.ContentType = contentType.String
+	return &sr, nil
+}
+
+// Finish stores the response of the claimed key. If it fails, the key stays pending,
+// so the retries are rejected instead of publishing the events twice
+func (s *Store) Finish(ctx context.Context, k *Key, sr *Response) error {
+	_, err := s.dba.ExecContext(ctx, `
+		update idempotency_key set
+			response_status = $5,
+			response_content_type = $6,
+			response_body = $7,
+			expire_date_time = $8
+		where (key, user_id, method, path) = ($1, $2, $3, $4) and request_hash = $9
+	`, k.Key, k.UserId, k.Method, k.Path, sr.Status, sr.ContentType, sr.Body, time.Now().UTC().Add(s.cfg.Ttl), sr.RequestHash)
+	return err
+}
+
+// Release removes the claimed key, so a client can retry the failed command
+func (s *Store) Release(ctx context.Context, k *Key) error {
+	_, err := s.dba.ExecContext(ctx, "delete from idempotency_key where (key, user_id, method, path) = ($1, $2, $3, $4) and response_status is null", k.Key, k.UserId, k.Method, k.Path)
+	return err
+}
+
+func RunKeysCleaner(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	dba *db.DB,
+	lc fx.Lifecycle,
+) {
+	interval := cfg.HttpServerConfig.IdempotencyConfig.CleanInterval
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStop: func(c context.Context) error {
+			lgr.Info("Stopping idempotency keys cleaner")
+			cancelFunc()
+			return nil
+		},
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				res, err := dba.ExecContext(ctx, "delete from idempotency_key where expire_date_time <= $1", time.Now().UTC())
+				if err != nil {
+					lgr.Error("Error during removing expired idempotency keys", "err", err)
+					continue
+				}
+				affected, _ := res.RowsAffected()
+				lgr.Debug("Expired idempotency keys were removed", "count", affected)
+			}
+		}
+	}()
+}
@@ -0,0 +1,554 @@
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Jeffail/gabs/v2"
+	"github.com/klauspost/compress/zstd"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/logger"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventNameHeader is the metadata of watermill's cqrs marshaler with the event type
+const EventNameHeader = "name"
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ExportOptions selects the events to export, the zero value exports the whole topic uncompressed
+type ExportOptions struct {
+	ChatIds     []string        `json:"chatIds,omitempty"`     // the partition keys
+	EventTypes  []string        `json:"eventTypes,omitempty"`  // the name metadata
+	From        *time.Time      `json:"from,omitempty"`        // createdAt of the envelope, inclusive
+	To          *time.Time      `json:"to,omitempty"`          // exclusive
+	FromOffsets map[int32]int64 `json:"fromOffsets,omitempty"` // the first offset to read by partition
+	ToOffsets   map[int32]int64 `json:"toOffsets,omitempty"`   // the last offset to read by partition
+	Compression string          `json:"compression,omitempty"`
+}
+
+// ExportManifest is written next to the export file, so the file can be validated without kafka
+type ExportManifest struct {
+	CreateDateTime time.Time           `json:"createDateTime"`
+	Topic          string              `json:"topic"`
+	Options        ExportOptions       `json:"options"`
+	Partitions     []ExportedPartition `json:"partitions"`
+	Checksum       string              `json:"checksum"` // sha256 of the file as it's written, compressed
+}
+
+type ExportedPartition struct {
+	Partition  int32  `json:"partition"`
+	FromOffset int64  `json:"fromOffset"` // the read range, both inclusive, the filtered out events are inside too
+	ToOffset   int64  `json:"toOffset"`
+	Events     int64  `json:"events"`   // the exported ones
+	Checksum   string `json:"checksum"` // sha256 of the partition's lines, uncompressed
+}
+
+func ExportManifestFile(file string) string {
+	return file + ".manifest.json"
+}
+
+// ParsePartitionOffsets parses the "partition=offset" pairs
+func ParsePartitionOffsets(pairs []string) (map[int32]int64, error) {
+	ret := map[int32]int64{}
+	for _, pair := range pairs {
+		partitionStr, offsetStr, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("expected partition=offset, got %v", pair)
+		}
+		partition, err := strconv.ParseInt(partitionStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the partition of %v: %w", pair, err)
+		}
+		offset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the offset of %v: %w", pair, err)
+		}
+		ret[int32(partition)] = offset
+	}
+	return ret, nil
+}
+
+func (o *ExportOptions) validate() error {
+	if o.Compression == "" {
+		o.Compression = CompressionNone
+	}
+	if !slices.Contains([]string{CompressionNone, CompressionGzip, CompressionZstd}, o.Compression) {
+		return fmt.Errorf("unknown compression %v, expected one of none, gzip, zstd", o.Compression)
+	}
+	return nil
+}
+
+func Export(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	options *ExportOptions,
+) error {
+	err := options.validate()
+	if err != nil {
+		return err
+	}
+
+	maxOffsets, err := getMaxOffsets(lgr, cfg, saramaClient)
+	if err != nil {
+		return err
+	}
+
+	newConsumer, err := newExportConsumer(cfg)
+	if err != nil {
+		return err
+	}
+	defer newConsumer.Close()
+
+	w, err := newExportWriter(cfg.CqrsConfig.ExportConfig.File, cfg.KafkaConfig.Topic, options)
+	if err != nil {
+		return err
+	}
+	defer w.abort()
+
+	for i := range cfg.KafkaConfig.NumPartitions {
+		fromOffset, toOffset, err := options.offsetRange(cfg, saramaClient, i, maxOffsets[i])
+		if err != nil {
+			return err
+		}
+		if fromOffset > toOffset {
+			lgr.Info("Skipping partition because absence of messages in the range", "partition", i)
+			continue
+		}
+
+		lgr.Info("Reading partition in the offset range", "partition", i, "from_offset", fromOffset, "to_offset", toOffset)
+
+		w.startPartition(i, fromOffset)
+		err = readPartition(newConsumer, cfg.KafkaConfig.Topic, i, fromOffset, toOffset, func(kafkaMessage *sarama.ConsumerMessage) error {
+			if !options.matches(kafkaMessage) {
+				return nil
+			}
+			return w.write(kafkaMessage)
+		})
+		if err != nil {
+			return err
+		}
+		exported := w.finishPartition(toOffset)
+		lgr.Info("Finish reading partition", "partition", i, "events", exported.Events)
+	}
+
+	err = w.close()
+	if err != nil {
+		return err
+	}
+
+	if cfg.CqrsConfig.ExportConfig.File == "stdout" {
+		lgr.Info("The manifest isn't written for stdout")
+		return nil
+	}
+	lgr.Info("The export has been made", "file", cfg.CqrsConfig.ExportConfig.File, "manifest", ExportManifestFile(cfg.CqrsConfig.ExportConfig.File))
+	return nil
+}
+
+func newExportConsumer(cfg *config.AppConfig) (sarama.Consumer, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V4_0_0_0
+
+	return sarama.NewConsumer(cfg.KafkaConfig.BootstrapServers, config)
+}
+
+// readPartition passes the events of the partition from fromOffset to toOffset, both inclusive, to handle
+func readPartition(consumer sarama.Consumer, topic string, partition int32, fromOffset, toOffset int64, handle func(kafkaMessage *sarama.ConsumerMessage) error) error {
+	partitionConsumer, err := consumer.ConsumePartition(topic, partition, fromOffset)
+	if err != nil {
+		return err
+	}
+	defer partitionConsumer.Close()
+
+	for kafkaMessage := range partitionConsumer.Messages() {
+		err = handle(kafkaMessage)
+		if err != nil {
+			return err
+		}
+		if kafkaMessage.Offset >= toOffset {
+			return nil
+		}
+	}
+	return nil
+}
+
+// exportWriter writes one export file, with its manifest unless it's stdout
+type exportWriter struct {
+	file          string
+	f             *os.File
+	fileHash      hash.Hash
+	buffered      *bufio.Writer
+	writer        io.WriteCloser
+	manifest      ExportManifest
+	partition     *ExportedPartition // the one being written
+	partitionHash hash.Hash
+	events        int64
+	closed        bool
+}
+
+func newExportWriter(file, topic string, options *ExportOptions) (*exportWriter, error) {
+	w := &exportWriter{
+		file:     file,
+		fileHash: sha256.New(),
+		manifest: ExportManifest{
+			CreateDateTime: time.Now().UTC(),
+			Topic:          topic,
+			Options:        *options,
+			Partitions:     []ExportedPartition{},
+		},
+	}
+	var out io.Writer
+	if file == "stdout" {
+		out = os.Stdout
+	} else {
+		var err error
+		w.f, err = os.Create(file)
+		if err != nil {
+			return nil, err
+		}
+		out = io.MultiWriter(w.f, w.fileHash)
+	}
+	w.buffered = bufio.NewWriter(out)
+	var err error
+	w.writer, err = newCompressingWriter(w.buffered, options.Compression)
+	if err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *exportWriter) startPartition(partition int32, fromOffset int64) {
+	w.partition = &ExportedPartition{Partition: partition, FromOffset: fromOffset}
+	w.partitionHash = sha256.New()
+}
+
+func (w *exportWriter) write(kafkaMessage *sarama.ConsumerMessage) error {
+	line, err := exportLine(kafkaMessage)
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.Write(line)
+	if err != nil {
+		return err
+	}
+	w.partitionHash.Write(line)
+	w.partition.Events++
+	w.events++
+	return nil
+}
+
+// finishPartition records the read range of the partition, the filtered out events of the range don't need to be read again
+func (w *exportWriter) finishPartition(toOffset int64) ExportedPartition {
+	w.partition.ToOffset = toOffset
+	w.partition.Checksum = hex.EncodeToString(w.partitionHash.Sum(nil))
+	w.manifest.Partitions = append(w.manifest.Partitions, *w.partition)
+	w.partition = nil
+	return w.manifest.Partitions[len(w.manifest.Partitions)-1]
+}
+
+func (w *exportWriter) close() error {
+	err := w.writer.Close()
+	if err != nil {
+		return err
+	}
+	err = w.buffered.Flush()
+	if err != nil {
+		return err
+	}
+	w.closed = true
+	if w.f == nil {
+		return nil
+	}
+	err = w.f.Close()
+	if err != nil {
+		return err
+	}
+
+	w.manifest.Checksum = hex.EncodeToString(w.fileHash.Sum(nil))
+	manifestBytes, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ExportManifestFile(w.file), manifestBytes, 0644)
+}
+
+// abort removes the unfinished file, so it isn't taken for a complete one
+func (w *exportWriter) abort() {
+	if w.closed || w.f == nil {
+		return
+	}
+	w.closed = true
+	w.f.Close()
+	os.Remove(w.file)
+}
+
+// offsetRange is limited by the oldest retained offset and by the max offset at the start of the export, both ends are inclusive
+func (o *ExportOptions) offsetRange(cfg *config.AppConfig, saramaClient sarama.Client, partition int32, maxOffset int64) (int64, int64, error) {
+	toOffset := maxOffset - 1
+	if limit, ok := o.ToOffsets[partition]; ok && limit < toOffset {
+		toOffset = limit
+	}
+	if toOffset < 0 {
+		return 0, toOffset, nil
+	}
+
+	fromOffset, err := saramaClient.GetOffset(cfg.KafkaConfig.Topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit, ok := o.FromOffsets[partition]; ok && limit > fromOffset {
+		fromOffset = limit
+	}
+	return fromOffset, toOffset, nil
+}
+
+type exportedEventCreatedAt struct {
+	AdditionalData *struct {
+		CreatedAt time.Time `json:"createdAt"`
+	} `json:"additionalData"`
+}
+
+func (o *ExportOptions) matches(kafkaMessage *sarama.ConsumerMessage) bool {
+	if len(o.ChatIds) > 0 && !slices.Contains(o.ChatIds, string(kafkaMessage.Key)) {
+		return false
+	}
+	if len(o.EventTypes) > 0 {
+		var eventType string
+		for _, h := range kafkaMessage.Headers {
+			if string(h.Key) == EventNameHeader {
+				eventType = string(h.Value)
+			}
+		}
+		if !slices.Contains(o.EventTypes, eventType) {
+			return false
+		}
+	}
+	if o.From != nil || o.To != nil {
+		// the events without the envelope are compared by the time they were sent to kafka
+		createdAt := kafkaMessage.Timestamp
+		ec := exportedEventCreatedAt{}
+		err := json.Unmarshal(kafkaMessage.Value, &ec)
+		if err == nil && ec.AdditionalData != nil && !ec.AdditionalData.CreatedAt.IsZero() {
+			createdAt = ec.AdditionalData.CreatedAt
+		}
+		if o.From != nil && createdAt.Before(*o.From) {
+			return false
+		}
+		if o.To != nil && !createdAt.Before(*o.To) {
+			return false
+		}
+	}
+	return true
+}
+
+func exportLine(kafkaMessage *sarama.ConsumerMessage) ([]byte, error) {
+	jsonObj := gabs.New()
+	_, err := jsonObj.SetP(kafkaMessage.Offset, MetadataKey+"."+MetadataOffsetKey)
+	if err != nil {
+		return nil, err
+	}
+	_, err = jsonObj.SetP(kafkaMessage.Partition, MetadataKey+"."+MetadataPartitionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedKey := string(kafkaMessage.Key)
+	parsedValue, err := gabs.ParseJSON(kafkaMessage.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range kafkaMessage.Headers {
+		parsedHeaderKey := string(h.Key)
+		parsedHeaderValue := string(h.Value)
+
+		_, err = jsonObj.Set(parsedHeaderValue, HeadersKey, parsedHeaderKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = jsonObj.Set(parsedKey, KeyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = jsonObj.Set(parsedValue, ValueKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(jsonObj.Bytes(), '\n'), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func newCompressingWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// newDecompressingReader recognizes the compression of the export by its magic bytes, so import doesn't need to be told it
+func newDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+type exportedLineMetadata struct {
+	Metadata struct {
+		Partition int32 `json:"partition"`
+		Offset    int64 `json:"offset"`
+	} `json:"metadata"`
+}
+
+func RunValidateExport(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+) error {
+	if cfg.CqrsConfig.ExportConfig.File == "stdout" {
+		return errors.New("the export to stdout has no manifest")
+	}
+	return ValidateExport(lgr, cfg.CqrsConfig.ExportConfig.File)
+}
+
+// ValidateExport recomputes the checksums of the export file and checks them and the offsets of its events against the manifest
+func ValidateExport(lgr *logger.LoggerWrapper, file string) error {
+	manifestBytes, err := os.ReadFile(ExportManifestFile(file))
+	if err != nil {
+		return err
+	}
+	manifest := ExportManifest{}
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return fmt.Errorf("unable to read the manifest: %w", err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fileHash := sha256.New()
+	tee := io.TeeReader(f, fileHash)
+	reader, err := newDecompressingReader(tee)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	expected := map[int32]ExportedPartition{}
+	for _, p := range manifest.Partitions {
+		expected[p.Partition] = p
+	}
+	partitionHashes := map[int32]hash.Hash{}
+	events := map[int32]int64{}
+	lastOffsets := map[int32]int64{}
+
+	br := bufio.NewReader(reader)
+	for i := 1; ; i++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			break
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("unable to read line %v: %w", i, err)
+		}
+
+		md := exportedLineMetadata{}
+		err = json.Unmarshal(line, &md)
+		if err != nil {
+			return fmt.Errorf("unable to parse line %v: %w", i, err)
+		}
+		partition, offset := md.Metadata.Partition, md.Metadata.Offset
+		p, ok := expected[partition]
+		if !ok {
+			return fmt.Errorf("line %v: partition %v isn't in the manifest", i, partition)
+		}
+		if offset < p.FromOffset || offset > p.ToOffset {
+			return fmt.Errorf("line %v: offset %v is out of the range %v-%v of partition %v", i, offset, p.FromOffset, p.ToOffset, partition)
+		}
+		if lastOffset, ok := lastOffsets[partition]; ok && offset <= lastOffset {
+			return fmt.Errorf("line %v: offset %v of partition %v isn't after the previous one %v", i, offset, partition, lastOffset)
+		}
+		lastOffsets[partition] = offset
+
+		if partitionHashes[partition] == nil {
+			partitionHashes[partition] = sha256.New()
+		}
+		partitionHashes[partition].Write(line)
+		events[partition]++
+	}
+
+	// the decompressor may leave the trailing bytes unread
+	_, err = io.Copy(io.Discard, tee)
+	if err != nil {
+		return err
+	}
+	if checksum := hex.EncodeToString(fileHash.Sum(nil)); checksum != manifest.Checksum {
+		return fmt.Errorf("the checksum of the file is %v, but the manifest has %v", checksum, manifest.Checksum)
+	}
+
+	emptyChecksum := hex.EncodeToString(sha256.New().Sum(nil))
+	for _, p := range manifest.Partitions {
+		if events[p.Partition] != p.Events {
+			return fmt.Errorf("partition %v has %v events, but the manifest has %v", p.Partition, events[p.Partition], p.Events)
+		}
+		checksum := emptyChecksum
+		if partitionHashes[p.Partition] != nil {
+			checksum = hex.EncodeToString(partitionHashes[p.Partition].Sum(nil))
+		}
+		if checksum != p.Checksum {
+			return fmt.Errorf("the checksum of partition %v is %v, but the manifest has %v", p.Partition, checksum, p.Checksum)
+		}
+	}
+
+	lgr.Info("The export is valid", "file", file, "create_date_time", manifest.CreateDateTime, "partitions", len(manifest.Partitions))
+	return nil
+}
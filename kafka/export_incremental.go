@@ -0,0 +1,264 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/logger"
+	"go.uber.org/fx"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ExportState is the progress of the incremental export, it's kept in the directory of the segments
+type ExportState struct {
+	Topic          string          `json:"topic"`
+	Offsets        map[int32]int64 `json:"offsets"` // the next offset to export by partition
+	UpdateDateTime time.Time       `json:"updateDateTime"`
+}
+
+const exportStateFile = "export-state.json"
+
+const segmentTimeLayout = "20060102T150405.000Z"
+
+func segmentExtension(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return ".json.gz"
+	case CompressionZstd:
+		return ".json.zst"
+	default:
+		return ".json"
+	}
+}
+
+func readExportState(cfg *config.AppConfig) (*ExportState, error) {
+	state := &ExportState{
+		Topic:   cfg.KafkaConfig.Topic,
+		Offsets: map[int32]int64{},
+	}
+	stateBytes, err := os.ReadFile(filepath.Join(cfg.CqrsConfig.ExportConfig.Incremental.Directory, exportStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(stateBytes, state)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the export state: %w", err)
+	}
+	if state.Topic != cfg.KafkaConfig.Topic {
+		return nil, fmt.Errorf("the export state is of topic %v, but the configured one is %v", state.Topic, cfg.KafkaConfig.Topic)
+	}
+	return state, nil
+}
+
+// writeExportState replaces the file by rename, so an interruption leaves either the previous state or the new one
+func writeExportState(cfg *config.AppConfig, state *ExportState) error {
+	stateBytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(cfg.CqrsConfig.ExportConfig.Incremental.Directory, exportStateFile)
+	err = os.WriteFile(file+".tmp", stateBytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func RunIncrementalExport(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	options *ExportOptions,
+) error {
+	return ExportIncrementally(context.Background(), lgr, cfg, saramaClient, options)
+}
+
+// RunIncrementalExportDaemon exports the new events every interval until the app is stopped
+func RunIncrementalExportDaemon(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	options *ExportOptions,
+	lc fx.Lifecycle,
+) error {
+	interval := cfg.CqrsConfig.ExportConfig.Incremental.Interval
+	if interval <= 0 {
+		return errors.New("the interval of the incremental export should be positive")
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStop: func(c context.Context) error {
+			lgr.Info("Stopping incremental export")
+			cancelFunc()
+			// the unfinished segment is removed and the state is left at the last complete one
+			select {
+			case <-done:
+			case <-c.Done():
+			}
+			return nil
+		},
+	})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := ExportIncrementally(ctx, lgr, cfg, saramaClient, options)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				lgr.Error("Error during incremental export", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// ExportIncrementally exports the events after the ones of the previous run into the new segment files.
+// The state is saved after every segment, so an interrupted run is continued from the last complete segment
+func ExportIncrementally(
+	ctx context.Context,
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	options *ExportOptions,
+) error {
+	if len(options.FromOffsets) > 0 || len(options.ToOffsets) > 0 {
+		return errors.New("the offsets of the incremental export are taken from its state")
+	}
+	err := options.validate()
+	if err != nil {
+		return err
+	}
+
+	incrementalConfig := cfg.CqrsConfig.ExportConfig.Incremental
+	err = os.MkdirAll(incrementalConfig.Directory, 0755)
+	if err != nil {
+		return err
+	}
+	state, err := readExportState(cfg)
+	if err != nil {
+		return err
+	}
+
+	maxOffsets, err := getMaxOffsets(lgr, cfg, saramaClient)
+	if err != nil {
+		return err
+	}
+
+	newConsumer, err := newExportConsumer(cfg)
+	if err != nil {
+		return err
+	}
+	defer newConsumer.Close()
+
+	runDateTime := time.Now().UTC()
+	var segments int
+	var w *exportWriter
+	defer func() {
+		if w != nil {
+			w.abort()
+		}
+	}()
+	openSegment := func() error {
+		segments++
+		file := filepath.Join(incrementalConfig.Directory, fmt.Sprintf("event-%s-%03d%s", runDateTime.Format(segmentTimeLayout), segments, segmentExtension(options.Compression)))
+		var err error
+		w, err = newExportWriter(file, cfg.KafkaConfig.Topic, options)
+		return err
+	}
+	closeSegment := func() error {
+		err := w.close()
+		if err != nil {
+			return err
+		}
+		for _, p := range w.manifest.Partitions {
+			state.Offsets[p.Partition] = p.ToOffset + 1
+		}
+		state.UpdateDateTime = time.Now().UTC()
+		err = writeExportState(cfg, state)
+		if err != nil {
+			return err
+		}
+		lgr.Info("The segment has been exported", "file", w.file, "events", w.events, "partitions", len(w.manifest.Partitions))
+		w = nil
+		return nil
+	}
+
+	for i := range cfg.KafkaConfig.NumPartitions {
+		toOffset := maxOffsets[i] - 1
+		if toOffset < 0 {
+			continue
+		}
+		oldestOffset, err := saramaClient.GetOffset(cfg.KafkaConfig.Topic, i, sarama.OffsetOldest)
+		if err != nil {
+			return err
+		}
+		fromOffset, ok := state.Offsets[i]
+		if !ok {
+			fromOffset = oldestOffset
+		} else if fromOffset < oldestOffset {
+			lgr.Warn("The events since the previous export have been removed by the retention of the topic", "partition", i, "from_offset", fromOffset, "oldest_offset", oldestOffset)
+			fromOffset = oldestOffset
+		}
+		if fromOffset > toOffset {
+			continue
+		}
+
+		lgr.Info("Reading partition in the offset range", "partition", i, "from_offset", fromOffset, "to_offset", toOffset)
+		if w == nil {
+			err = openSegment()
+			if err != nil {
+				return err
+			}
+		}
+		w.startPartition(i, fromOffset)
+		err = readPartition(newConsumer, cfg.KafkaConfig.Topic, i, fromOffset, toOffset, func(kafkaMessage *sarama.ConsumerMessage) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if options.matches(kafkaMessage) {
+				err := w.write(kafkaMessage)
+				if err != nil {
+					return err
+				}
+			}
+			if incrementalConfig.MaxSegmentEvents > 0 && w.events >= incrementalConfig.MaxSegmentEvents && kafkaMessage.Offset < toOffset {
+				w.finishPartition(kafkaMessage.Offset)
+				err := closeSegment()
+				if err != nil {
+					return err
+				}
+				err = openSegment()
+				if err != nil {
+					return err
+				}
+				w.startPartition(i, kafkaMessage.Offset+1)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		w.finishPartition(toOffset)
+	}
+
+	if w == nil {
+		lgr.Info("There are no new events to export")
+		return nil
+	}
+	return closeSegment()
+}
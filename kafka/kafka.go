@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/IBM/sarama"
 	"github.com/Jeffail/gabs/v2"
+	"go-cqrs-chat-example/app"
 	"go-cqrs-chat-example/config"
 	"go-cqrs-chat-example/logger"
 	"go-cqrs-chat-example/utils"
@@ -97,18 +98,96 @@ func RunResetPartitions(
 ) error {
 	lgr.Info("Start reset partitions")
 
-	err := kafkaAdmin.DeleteConsumerGroup(cfg.KafkaConfig.ConsumerGroup)
+	// the audit log is in the same database, so it's rebuilt from the beginning too
+	err := DeleteConsumerGroups(lgr, kafkaAdmin, append(cfg.ProjectionsConfig.AllConsumerGroups(), cfg.CqrsConfig.AuditLogConfig.ConsumerGroup))
+	if err != nil {
+		return err
+	}
+
+	lgr.Info("Finished reset partitions")
+
+	return nil
+}
+
+// DeleteConsumerGroups makes the groups start from the oldest offsets, the groups shouldn't have the active members
+func DeleteConsumerGroups(
+	lgr *logger.LoggerWrapper,
+	kafkaAdmin sarama.ClusterAdmin,
+	consumerGroups []string,
+) error {
+	for _, consumerGroup := range consumerGroups {
+		err := kafkaAdmin.DeleteConsumerGroup(consumerGroup)
 
+		if err != nil {
+			if strings.Contains(err.Error(), "The group id does not exist") {
+				lgr.Info("There is no consumer group", "consumer_group", consumerGroup)
+			} else {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CopyCommittedOffsets commits the offsets of one consumer group into another one, the partitions where the latter has already committed something are left as they are.
+// It should be called before the latter has any members
+func CopyCommittedOffsets(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	client sarama.Client,
+	fromConsumerGroup string,
+	toConsumerGroup string,
+) error {
+	fromOffsets, err := getCommittedOffsets(lgr, cfg, client, fromConsumerGroup)
 	if err != nil {
-		if strings.Contains(err.Error(), "The group id does not exist") {
-			lgr.Info("There is no consumer group", "consumer_group", cfg.KafkaConfig.ConsumerGroup)
-		} else {
-			return err
+		return err
+	}
+
+	offsets := map[int32]int64{}
+	for i, offset := range fromOffsets {
+		if offset != -1 {
+			offsets[int32(i)] = offset
 		}
 	}
+	lgr.Info("Copying the committed offsets", "from_consumer_group", fromConsumerGroup, "to_consumer_group", toConsumerGroup)
+	return CommitOffsets(lgr, cfg, client, toConsumerGroup, offsets)
+}
 
-	lgr.Info("Finished reset partitions")
+// CommitOffsets sets the next offsets to consume by partition for the consumer group which hasn't committed anything in these partitions yet.
+// It should be called before the group has any members
+func CommitOffsets(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	client sarama.Client,
+	consumerGroup string,
+	offsets map[int32]int64,
+) error {
+	offsetManager, err := sarama.NewOffsetManagerFromClient(consumerGroup, client)
+	if err != nil {
+		return err
+	}
+	defer offsetManager.Close()
+
+	for i := range cfg.KafkaConfig.NumPartitions {
+		offset, ok := offsets[i]
+		if !ok {
+			continue
+		}
+		partitionManager, err := offsetManager.ManagePartition(cfg.KafkaConfig.Topic, i)
+		if err != nil {
+			return err
+		}
+		defer partitionManager.AsyncClose()
 
+		offs, _ := partitionManager.NextOffset()
+		if offs != -1 {
+			lgr.Info("Keeping the committed offset", "consumer_group", consumerGroup, "partition", i, "offset", offs)
+			continue
+		}
+		partitionManager.MarkOffset(offset, "")
+		lgr.Info("Committing the offset", "consumer_group", consumerGroup, "partition", i, "offset", offset)
+	}
+	offsetManager.Commit()
 	return nil
 }
 
@@ -143,6 +222,49 @@ func WaitForAllEventsProcessed(
 	cfg *config.AppConfig,
 	saramaClient sarama.Client,
 	lc fx.Lifecycle,
+) error {
+	return waitForAllEventsProcessed(lgr, cfg, saramaClient, nil, lc, func() {})
+}
+
+// IsPartitionStopped tells the partitions where the consumer group doesn't go further on purpose, they are considered processed
+type IsPartitionStopped func(consumerGroup string, partition int32) bool
+
+// WaitForCatchingUp is WaitForAllEventsProcessed which reports the percent of the consumed offsets into the startup state
+func WaitForCatchingUp(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	startupState *app.StartupState,
+	isPartitionStopped IsPartitionStopped,
+	lc fx.Lifecycle,
+) error {
+	consumerGroups, err := cfg.ProjectionsConfig.EnabledConsumerGroups()
+	if err != nil {
+		return err
+	}
+	return waitForAllEventsProcessed(lgr, cfg, saramaClient, isPartitionStopped, lc, func() {
+		offsets := []PartitionOffsets{}
+		for _, consumerGroup := range consumerGroups {
+			groupOffsets, err := GetPartitionOffsets(lgr, cfg, saramaClient, consumerGroup)
+			if err != nil {
+				lgr.Warn("Unable to get the offsets for the progress", "consumer_group", consumerGroup, "err", err)
+				return
+			}
+			offsets = append(offsets, groupOffsets...)
+		}
+		percent := ConsumedPercent(offsets)
+		startupState.SetProgress(percent)
+		lgr.Info("Catching up with the events", "percent", fmt.Sprintf("%.1f", percent))
+	})
+}
+
+func waitForAllEventsProcessed(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	isPartitionStopped IsPartitionStopped, // nil means none
+	lc fx.Lifecycle,
+	onNotProcessed func(),
 ) error {
 	stoppingCtx, cancelFunc := context.WithCancel(context.Background())
 
@@ -156,9 +278,14 @@ func WaitForAllEventsProcessed(
 
 	du := cfg.CqrsConfig.CheckAreEventsProcessedInterval
 
+	consumerGroups, err := cfg.ProjectionsConfig.EnabledConsumerGroups()
+	if err != nil {
+		return err
+	}
+
 	for {
 		lgr.Info("Checking for the current offsets will be equal to the latest ones for all partitions")
-		isEnd, errE := isEndOnAllPartitions(lgr, cfg, saramaClient)
+		isEnd, errE := isEndOnAllPartitions(lgr, cfg, saramaClient, consumerGroups, isPartitionStopped)
 		if errE != nil {
 			lgr.Error("Error during checking isEndOnAllPartitions", "err", errE)
 			return errE
@@ -168,6 +295,7 @@ func WaitForAllEventsProcessed(
 			cancelFunc()
 		} else {
 			lgr.Info("The current offsets still aren't equal to the latest ones")
+			onNotProcessed()
 		}
 
 		if errors.Is(stoppingCtx.Err(), context.Canceled) {
@@ -200,10 +328,13 @@ func getMaxOffsets(
 	return maxOffsets, nil
 }
 
+// isEndOnAllPartitions checks that every consumer group has committed the latest offsets
 func isEndOnAllPartitions(
 	lgr *logger.LoggerWrapper,
 	cfg *config.AppConfig,
 	client sarama.Client,
+	consumerGroups []string,
+	isPartitionStopped IsPartitionStopped,
 ) (bool, error) {
 
 	maxOffsets, err := getMaxOffsets(lgr, cfg, client)
@@ -226,9 +357,49 @@ func isEndOnAllPartitions(
 		return true, nil
 	}
 
-	offsetManager, err := sarama.NewOffsetManagerFromClient(cfg.KafkaConfig.ConsumerGroup, client)
+	for _, consumerGroup := range consumerGroups {
+		givenOffsets, err := getCommittedOffsets(lgr, cfg, client, consumerGroup)
+		if err != nil {
+			if errors.Is(err, sarama.ErrIncompleteResponse) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		hasOneInitialized := false
+		for i := range cfg.KafkaConfig.NumPartitions {
+			if isPartitionStopped != nil && isPartitionStopped(consumerGroup, i) {
+				hasOneInitialized = true
+				continue
+			}
+			if givenOffsets[i] == -1 {
+				continue
+			} else {
+				hasOneInitialized = true
+
+				if maxOffsets[i] != givenOffsets[i] {
+					return false, nil
+				}
+			}
+		}
+		if !hasOneInitialized {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// getCommittedOffsets returns -1 for the partitions where the consumer group hasn't committed anything yet
+func getCommittedOffsets(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	client sarama.Client,
+	consumerGroup string,
+) ([]int64, error) {
+	offsetManager, err := sarama.NewOffsetManagerFromClient(consumerGroup, client)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer offsetManager.Close()
 
@@ -238,146 +409,79 @@ func isEndOnAllPartitions(
 		if err != nil {
 			if errors.Is(err, sarama.ErrIncompleteResponse) {
 				lgr.Info("Skipping partition", "partition", i)
-				return false, nil
 			}
-			return false, err
+			return nil, err
 		}
 		defer partitionManager.AsyncClose() // faster
 
 		offs, _ := partitionManager.NextOffset()
-		if err != nil {
-			return false, err
-		}
 		givenOffsets[i] = offs
 		lgr.Debug("Got given", "partition", i, "offset", offs)
 	}
+	return givenOffsets, nil
+}
 
-	hasOneInitialized := false
-	for i := range cfg.KafkaConfig.NumPartitions {
-		if givenOffsets[i] == -1 {
-			continue
-		} else {
-			hasOneInitialized = true
+type PartitionOffsets struct {
+	Partition       int32 `json:"partition"`
+	LatestOffset    int64 `json:"latestOffset"`
+	CommittedOffset int64 `json:"committedOffset"` // -1 means the consumer group hasn't committed anything yet
+	Lag             int64 `json:"lag"`
+}
 
-			if maxOffsets[i] != givenOffsets[i] {
-				return false, nil
-			}
+// ConsumedPercent is the share of the topic's offsets which the consumer group has committed, 100 for the empty topic
+func ConsumedPercent(offsets []PartitionOffsets) float64 {
+	var consumed, latest int64
+	for _, po := range offsets {
+		latest += po.LatestOffset
+		if po.CommittedOffset > 0 {
+			consumed += po.CommittedOffset
 		}
 	}
-
-	return hasOneInitialized, nil
+	if latest == 0 {
+		return 100
+	}
+	return float64(consumed) * 100 / float64(latest)
 }
 
-const KeyKey = "key"
-const ValueKey = "value"
-const MetadataKey = "metadata"
-const MetadataOffsetKey = "offset"
-const MetadataPartitionKey = "partition"
-const HeadersKey = "headers"
-
-func Export(
+// GetPartitionOffsets shows how far the consumer group is behind the topic
+func GetPartitionOffsets(
 	lgr *logger.LoggerWrapper,
 	cfg *config.AppConfig,
-	saramaClient sarama.Client,
-) error {
-
-	maxOffsets, err := getMaxOffsets(lgr, cfg, saramaClient)
+	client sarama.Client,
+	consumerGroup string,
+) ([]PartitionOffsets, error) {
+	maxOffsets, err := getMaxOffsets(lgr, cfg, client)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	config := sarama.NewConfig()
-	config.Version = sarama.V4_0_0_0
-
-	newConsumer, err := sarama.NewConsumer(cfg.KafkaConfig.BootstrapServers, config)
+	givenOffsets, err := getCommittedOffsets(lgr, cfg, client, consumerGroup)
 	if err != nil {
-		return err
-	}
-	defer newConsumer.Close()
-
-	var writer io.Writer
-	var f *os.File
-	if cfg.CqrsConfig.ExportConfig.File == "stdout" {
-		writer = os.Stdout
-	} else {
-		f, err = os.Create(cfg.CqrsConfig.ExportConfig.File)
-		if err != nil {
-			return err
-		}
-		writer = f
-	}
-	if f != nil {
-		defer f.Close()
+		return nil, err
 	}
 
+	ret := make([]PartitionOffsets, cfg.KafkaConfig.NumPartitions)
 	for i := range cfg.KafkaConfig.NumPartitions {
-		partitionMaxOffset := maxOffsets[i]
-		if partitionMaxOffset == 0 {
-			lgr.Info("Skipping partition because absence of messages", "partition", i)
-			continue
-		}
-
-		lgr.Info("Reading partition and it's max offset", "partition", i, "offset", partitionMaxOffset)
-
-		partitionConsumer, err := newConsumer.ConsumePartition(cfg.KafkaConfig.Topic, i, sarama.OffsetOldest)
-		if err != nil {
-			return err
+		lag := maxOffsets[i]
+		if givenOffsets[i] >= 0 {
+			lag = maxOffsets[i] - givenOffsets[i]
 		}
-		defer partitionConsumer.Close()
-
-		for kafkaMessage := range partitionConsumer.Messages() {
-			jsonObj := gabs.New()
-			_, err = jsonObj.SetP(kafkaMessage.Offset, MetadataKey+"."+MetadataOffsetKey)
-			if err != nil {
-				return err
-			}
-			_, err = jsonObj.SetP(kafkaMessage.Partition, MetadataKey+"."+MetadataPartitionKey)
-			if err != nil {
-				return err
-			}
-
-			parsedKey := string(kafkaMessage.Key)
-			parsedValue, err := gabs.ParseJSON(kafkaMessage.Value)
-			if err != nil {
-				return err
-			}
-
-			for _, h := range kafkaMessage.Headers {
-				parsedHeaderKey := string(h.Key)
-				parsedHeaderValue := string(h.Value)
-
-				_, err = jsonObj.Set(parsedHeaderValue, HeadersKey, parsedHeaderKey)
-				if err != nil {
-					return err
-				}
-			}
-
-			_, err = jsonObj.Set(parsedKey, KeyKey)
-			if err != nil {
-				return err
-			}
-
-			_, err = jsonObj.Set(parsedValue, ValueKey)
-			if err != nil {
-				return err
-			}
-
-			_, err = fmt.Fprintln(writer, jsonObj.String())
-			if err != nil {
-				return err
-			}
-
-			if kafkaMessage.Offset >= partitionMaxOffset-1 {
-				lgr.Info("Reached max offset, closing partitionConsumer", "partition", i)
-				break
-			}
+		ret[i] = PartitionOffsets{
+			Partition:       i,
+			LatestOffset:    maxOffsets[i],
+			CommittedOffset: givenOffsets[i],
+			Lag:             lag,
 		}
-
-		lgr.Info("Finish reading partition", "partition", i)
 	}
-	return nil
+	return ret, nil
 }
 
+const KeyKey = "key"
+const ValueKey = "value"
+const MetadataKey = "metadata"
+const MetadataOffsetKey = "offset"
+const MetadataPartitionKey = "partition"
+const HeadersKey = "headers"
+
 func Import(
 	lgr *logger.LoggerWrapper,
 	cfg *config.AppConfig,
@@ -406,8 +510,13 @@ func Import(
 	if f != nil {
 		defer f.Close()
 	}
+	decompressed, err := newDecompressingReader(reader)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
 
-	scanner := bufio.NewScanner(reader)
+	scanner := bufio.NewScanner(decompressed)
 	i := 0
 	for scanner.Scan() {
 		i++
@@ -0,0 +1,67 @@
+package otel
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go-cqrs-chat-example/app"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.uber.org/fx"
+)
+
+// ConfigureMeterProvider sets the global meter provider, so the instruments which were created by otel.Meter() before start to work.
+// The registry is served on /metrics.
+func ConfigureMeterProvider(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	lc fx.Lifecycle,
+) (*sdkmetric.MeterProvider, *prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	prometheusExporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resources := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(app.TRACE_RESOURCE),
+	)
+	options := []sdkmetric.Option{
+		sdkmetric.WithReader(prometheusExporter),
+		sdkmetric.WithResource(resources),
+	}
+
+	if cfg.OtlpConfig.MetricsConfig.Enabled {
+		otlpExporter, err := otlpmetricgrpc.New(context.Background(),
+			otlpmetricgrpc.WithEndpoint(cfg.OtlpConfig.Endpoint),
+			otlpmetricgrpc.WithInsecure(),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		options = append(options, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(otlpExporter, sdkmetric.WithInterval(cfg.OtlpConfig.MetricsConfig.Interval))))
+	}
+
+	mp := sdkmetric.NewMeterProvider(options...)
+	otel.SetMeterProvider(mp)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			lgr.Info("Stopping meter provider")
+			if err := mp.Shutdown(context.Background()); err != nil {
+				lgr.Error("Error shutting meter provider", "err", err)
+			}
+			return nil
+		},
+	})
+	return mp, registry, nil
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"go.uber.org/fx"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps in-memory token buckets, so the limits are per instance
+type RateLimiter struct {
+	lgr     *logger.LoggerWrapper
+	cfg     *config.RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimiter(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	lc fx.Lifecycle,
+) *RateLimiter {
+	rl := &RateLimiter{
+		lgr:     lgr,
+		cfg:     &cfg.HttpServerConfig.RateLimitConfig,
+		buckets: map[string]*bucket{},
+	}
+
+	idleTimeout := rl.cfg.IdleTimeout
+	if idleTimeout > 0 {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		lc.Append(fx.Hook{
+			OnStop: func(c context.Context) error {
+				lgr.Info("Stopping rate limiter")
+				cancelFunc()
+				return nil
+			},
+		})
+
+		go func() {
+			ticker := time.NewTicker(idleTimeout)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					rl.evictIdle(time.Now())
+				}
+			}
+		}()
+	}
+
+	return rl
+}
+
+func (rl *RateLimiter) evictIdle(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for k, b := range rl.buckets {
+		if now.Sub(b.lastSeen) > rl.cfg.IdleTimeout {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+type bucketRequest struct {
+	key   string
+	limit rate.Limit
+	burst int
+}
+
+// allow takes a token from every given bucket or from none of them.
+// In case of rejection it returns the duration after which the client can retry.
+func (rl *RateLimiter) allow(requests ...bucketRequest) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(requests))
+	var retryAfter time.Duration
+	for _, br := range requests {
+		b, ok := rl.buckets[br.key]
+		if !ok {
+			b = &bucket{limiter: rate.NewLimiter(br.limit, br.burst)}
+			rl.buckets[br.key] = b
+		} else if b.limiter.Limit() != br.limit || b.limiter.Burst() != br.burst {
+			// slow mode of the chat has been changed
+			b.limiter.SetLimitAt(now, br.limit)
+			b.limiter.SetBurstAt(now, br.burst)
+		}
+		b.lastSeen = now
+
+		r := b.limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		if delay := r.DelayFrom(now); delay > retryAfter {
+			retryAfter = delay
+		}
+	}
+
+	if retryAfter > 0 {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		return false, retryAfter
+	}
+	return true, 0
+}
+
+func (rl *RateLimiter) Enabled() bool {
+	return rl.cfg.Enabled
+}
+
+func (rl *RateLimiter) AllowCommand(userId *int64, chatId *int64) (bool, time.Duration) {
+	requests := []bucketRequest{}
+	if userId != nil {
+		requests = append(requests, bucketRequest{"user:" + utils.ToString(*userId), rate.Limit(rl.cfg.User.Rate), rl.cfg.User.Burst})
+	}
+	if chatId != nil {
+		requests = append(requests, bucketRequest{"chat:" + utils.ToString(*chatId), rate.Limit(rl.cfg.Chat.Rate), rl.cfg.Chat.Burst})
+	}
+	return rl.allow(requests...)
+}
+
+// AllowSlowMode lets the participant to write one message per slowModeSeconds
+func (rl *RateLimiter) AllowSlowMode(chatId, userId, slowModeSeconds int64) (bool, time.Duration) {
+	return rl.allow(bucketRequest{
+		key:   "slow:" + utils.ToString(chatId) + ":" + utils.ToString(userId),
+		limit: rate.Every(time.Duration(slowModeSeconds) * time.Second),
+		burst: 1,
+	})
+}
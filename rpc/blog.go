@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"context"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type BlogService struct {
+	UnimplementedBlogServiceServer
+	lgr              *logger.LoggerWrapper
+	commonProjection *cqrs.CommonProjection
+}
+
+func NewBlogService(
+	lgr *logger.LoggerWrapper,
+	commonProjection *cqrs.CommonProjection,
+) *BlogService {
+	return &BlogService{
+		lgr:              lgr,
+		commonProjection: commonProjection,
+	}
+}
+
+func (bs *BlogService) SearchBlogs(ctx context.Context, req *SearchBlogsRequest) (*SearchBlogsResponse, error) {
+	page := utils.FixPage(req.GetPage())
+	size := utils.FixSize(req.GetSize())
+	offset := utils.GetOffset(page, size)
+	reverse := true
+	if req.Reverse != nil {
+		reverse = req.GetReverse()
+	}
+
+	blogs, err := bs.commonProjection.GetBlogs(ctx, size, offset, reverse)
+	if err != nil {
+		return nil, statusError(ctx, bs.lgr, "Error getting blogs", err)
+	}
+
+	resp := &SearchBlogsResponse{Blogs: make([]*BlogPreview, 0, len(blogs))}
+	for _, b := range blogs {
+		resp.Blogs = append(resp.Blogs, &BlogPreview{
+			Id:             b.Id,
+			OwnerId:        b.OwnerId,
+			Title:          b.Title,
+			Preview:        b.Preview,
+			CreateDateTime: timestamppb.New(b.CreateDateTime),
+		})
+	}
+	return resp, nil
+}
+
+func (bs *BlogService) GetBlog(ctx context.Context, req *GetBlogRequest) (*Blog, error) {
+	blog, err := bs.commonProjection.GetBlog(ctx, req.GetBlogId())
+	if err != nil {
+		return nil, statusError(ctx, bs.lgr, "Error getting blog", err)
+	}
+
+	return &Blog{
+		Id:             blog.Id,
+		OwnerId:        blog.OwnerId,
+		Title:          blog.Title,
+		Post:           blog.Post,
+		CreateDateTime: timestamppb.New(blog.CreateDateTime),
+	}, nil
+}
+
+func (bs *BlogService) SearchComments(ctx context.Context, req *SearchCommentsRequest) (*SearchCommentsResponse, error) {
+	page := utils.FixPage(req.GetPage())
+	size := utils.FixSize(req.GetSize())
+	offset := utils.GetOffset(page, size)
+
+	comments, err := bs.commonProjection.GetComments(ctx, req.GetBlogId(), size, offset, req.GetReverse())
+	if err != nil {
+		return nil, statusError(ctx, bs.lgr, "Error getting blog comments", err)
+	}
+
+	resp := &SearchCommentsResponse{Comments: make([]*Comment, 0, len(comments))}
+	for _, c := range comments {
+		resp.Comments = append(resp.Comments, &Comment{
+			Id:             c.Id,
+			OwnerId:        c.OwnerId,
+			Content:        c.Content,
+			CreateDateTime: timestamppb.New(c.CreateDateTime),
+			UpdateDateTime: timestampOrNil(c.UpdateDateTime),
+		})
+	}
+	return resp, nil
+}
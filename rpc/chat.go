@@ -0,0 +1,209 @@
+package rpc
+
+import (
+	"context"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"slices"
+	"time"
+)
+
+type ChatService struct {
+	UnimplementedChatServiceServer
+	lgr                   *logger.LoggerWrapper
+	eventBus              *cqrs.PartitionAwareEventBus
+	dbWrapper             *db.DB
+	commonProjection      *cqrs.CommonProjection
+	chatRepository        *cqrs.ChatRepository
+	chatEventsBroadcaster *ChatEventsBroadcaster
+	idGenerator           cqrs.IdGenerator
+}
+
+func NewChatService(
+	lgr *logger.LoggerWrapper,
+	eventBus *cqrs.PartitionAwareEventBus,
+	dbWrapper *db.DB,
+	commonProjection *cqrs.CommonProjection,
+	chatRepository *cqrs.ChatRepository,
+	chatEventsBroadcaster *ChatEventsBroadcaster,
+	idGenerator cqrs.IdGenerator,
+) *ChatService {
+	return &ChatService{
+		lgr:                   lgr,
+		eventBus:              eventBus,
+		dbWrapper:             dbWrapper,
+		commonProjection:      commonProjection,
+		chatRepository:        chatRepository,
+		chatEventsBroadcaster: chatEventsBroadcaster,
+		idGenerator:           idGenerator,
+	}
+}
+
+func (cs *ChatService) CreateChat(ctx context.Context, req *CreateChatRequest) (*IdResponse, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := cqrs.ChatCreate{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		Title:          req.GetTitle(),
+		ParticipantIds: req.GetParticipantIds(),
+	}
+
+	if !slices.Contains(cc.ParticipantIds, userId) {
+		cc.ParticipantIds = append(cc.ParticipantIds, userId)
+	}
+
+	chatId, err := cc.Handle(ctx, cs.eventBus, cs.chatRepository, cs.idGenerator)
+	if err != nil {
+		return nil, statusError(ctx, cs.lgr, "Error sending ChatCreate command", err)
+	}
+
+	return &IdResponse{Id: chatId}, nil
+}
+
+func (cs *ChatService) EditChat(ctx context.Context, req *EditChatRequest) (*Empty, error) {
+	expectedVersion, err := getIfMatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := cqrs.ChatEdit{
+		AdditionalData:      cqrs.GenerateMessageAdditionalData(ctx),
+		ChatId:              req.GetChatId(),
+		Title:               req.GetTitle(),
+		ParticipantIdsToAdd: req.GetParticipantIds(),
+		Blog:                req.GetBlog(),
+		ExpectedVersion:     expectedVersion,
+	}
+
+	version, err := cc.Handle(ctx, cs.eventBus, cs.chatRepository, cs.commonProjection)
+	if err != nil {
+		return nil, statusError(ctx, cs.lgr, "Error sending ChatEdit command", err)
+	}
+
+	return &Empty{}, setETag(ctx, version)
+}
+
+func (cs *ChatService) DeleteChat(ctx context.Context, req *ChatIdRequest) (*Empty, error) {
+	cc := cqrs.ChatDelete{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ChatId:         req.GetChatId(),
+	}
+
+	err := cc.Handle(ctx, cs.eventBus, cs.chatRepository)
+	if err != nil {
+		return nil, statusError(ctx, cs.lgr, "Error sending ChatDelete command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (cs *ChatService) PinChat(ctx context.Context, req *PinChatRequest) (*Empty, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := cqrs.ChatPin{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ChatId:         req.GetChatId(),
+		Pin:            req.GetPin(),
+		ParticipantId:  userId,
+	}
+
+	err = cc.Handle(ctx, cs.eventBus, cs.chatRepository)
+	if err != nil {
+		return nil, statusError(ctx, cs.lgr, "Error sending ChatPin command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (cs *ChatService) SearchChats(ctx context.Context, req *SearchChatsRequest) (*SearchChatsResponse, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	size := utils.FixSize(req.GetSize())
+
+	var startingFromItemId *cqrs.ChatId
+	if req.Pinned != nil && req.LastUpdateDateTime != nil && req.Id != nil {
+		startingFromItemId = &cqrs.ChatId{
+			Pinned:             req.GetPinned(),
+			LastUpdateDateTime: req.GetLastUpdateDateTime().AsTime(),
+			Id:                 req.GetId(),
+		}
+	}
+
+	chats, err := cs.commonProjection.GetChats(ctx, userId, size, startingFromItemId, req.GetIncludeStartingFrom(), req.GetReverse())
+	if err != nil {
+		return nil, statusError(ctx, cs.lgr, "Error getting chats", err)
+	}
+
+	resp := &SearchChatsResponse{Chats: make([]*Chat, 0, len(chats))}
+	for _, c := range chats {
+		resp.Chats = append(resp.Chats, &Chat{
+			Id:                 c.Id,
+			Title:              c.Title,
+			Pinned:             c.Pinned,
+			UnreadMessages:     c.UnreadMessages,
+			LastMessageId:      c.LastMessageId,
+			LastMessageOwnerId: c.LastMessageOwnerId,
+			LastMessageContent: c.LastMessageContent,
+			ParticipantsCount:  c.ParticipantsCount,
+			ParticipantIds:     c.ParticipantIds,
+			Blog:               c.Blog,
+			LastUpdateDateTime: timestampOrNil(c.UpdateDateTime),
+		})
+	}
+	return resp, nil
+}
+
+func (cs *ChatService) SubscribeChatEvents(req *ChatIdRequest, stream grpc.ServerStreamingServer[ChatEvent]) error {
+	ctx := stream.Context()
+
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return err
+	}
+	// the events carry the messages, so only the participants can see them
+	chat, err := cs.chatRepository.Load(ctx, req.GetChatId())
+	if err != nil {
+		return statusError(ctx, cs.lgr, "Error loading chat", err)
+	}
+	err = chat.CheckParticipant(ctx, userId)
+	if err != nil {
+		return statusError(ctx, cs.lgr, "Error subscribing to chat events", err)
+	}
+
+	events, unsubscribe := cs.chatEventsBroadcaster.subscribe(req.GetChatId())
+	defer unsubscribe()
+
+	cs.lgr.WithTrace(ctx).Info("Subscribed to chat events", "chat_id", req.GetChatId())
+	for {
+		select {
+		case <-ctx.Done():
+			cs.lgr.WithTrace(ctx).Info("Unsubscribed from chat events", "chat_id", req.GetChatId())
+			return nil
+		case event := <-events:
+			err := stream.Send(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
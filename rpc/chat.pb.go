@@ -0,0 +1,1964 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.30.2
+// source: chat.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Empty struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	mi := &file_chat_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{0}
+}
+
+type IdResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IdResponse) Reset() {
+	*x = IdResponse{}
+	mi := &file_chat_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IdResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdResponse) ProtoMessage() {}
+
+func (x *IdResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdResponse.ProtoReflect.Descriptor instead.
+func (*IdResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *IdResponse) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ChatIdRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChatId        int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatIdRequest) Reset() {
+	*x = ChatIdRequest{}
+	mi := &file_chat_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatIdRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatIdRequest) ProtoMessage() {}
+
+func (x *ChatIdRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatIdRequest.ProtoReflect.Descriptor instead.
+func (*ChatIdRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ChatIdRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+type MessageIdRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChatId        int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	MessageId     int64                  `protobuf:"varint,2,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageIdRequest) Reset() {
+	*x = MessageIdRequest{}
+	mi := &file_chat_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageIdRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageIdRequest) ProtoMessage() {}
+
+func (x *MessageIdRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageIdRequest.ProtoReflect.Descriptor instead.
+func (*MessageIdRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MessageIdRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *MessageIdRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+type CreateChatRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Title          string                 `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	ParticipantIds []int64                `protobuf:"varint,2,rep,packed,name=participant_ids,json=participantIds,proto3" json:"participant_ids,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CreateChatRequest) Reset() {
+	*x = CreateChatRequest{}
+	mi := &file_chat_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateChatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateChatRequest) ProtoMessage() {}
+
+func (x *CreateChatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateChatRequest.ProtoReflect.Descriptor instead.
+func (*CreateChatRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateChatRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *CreateChatRequest) GetParticipantIds() []int64 {
+	if x != nil {
+		return x.ParticipantIds
+	}
+	return nil
+}
+
+type EditChatRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ChatId         int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	Title          string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	ParticipantIds []int64                `protobuf:"varint,3,rep,packed,name=participant_ids,json=participantIds,proto3" json:"participant_ids,omitempty"`
+	Blog           bool                   `protobuf:"varint,4,opt,name=blog,proto3" json:"blog,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *EditChatRequest) Reset() {
+	*x = EditChatRequest{}
+	mi := &file_chat_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EditChatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EditChatRequest) ProtoMessage() {}
+
+func (x *EditChatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EditChatRequest.ProtoReflect.Descriptor instead.
+func (*EditChatRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EditChatRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *EditChatRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *EditChatRequest) GetParticipantIds() []int64 {
+	if x != nil {
+		return x.ParticipantIds
+	}
+	return nil
+}
+
+func (x *EditChatRequest) GetBlog() bool {
+	if x != nil {
+		return x.Blog
+	}
+	return false
+}
+
+type PinChatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChatId        int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	Pin           bool                   `protobuf:"varint,2,opt,name=pin,proto3" json:"pin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PinChatRequest) Reset() {
+	*x = PinChatRequest{}
+	mi := &file_chat_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PinChatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PinChatRequest) ProtoMessage() {}
+
+func (x *PinChatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PinChatRequest.ProtoReflect.Descriptor instead.
+func (*PinChatRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PinChatRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *PinChatRequest) GetPin() bool {
+	if x != nil {
+		return x.Pin
+	}
+	return false
+}
+
+type SearchChatsRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Size    int32                  `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+	Reverse bool                   `protobuf:"varint,2,opt,name=reverse,proto3" json:"reverse,omitempty"`
+	// the keyset of the chat to start from, all three should be set
+	Pinned              *bool                  `protobuf:"varint,3,opt,name=pinned,proto3,oneof" json:"pinned,omitempty"`
+	LastUpdateDateTime  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_update_date_time,json=lastUpdateDateTime,proto3,oneof" json:"last_update_date_time,omitempty"`
+	Id                  *int64                 `protobuf:"varint,5,opt,name=id,proto3,oneof" json:"id,omitempty"`
+	IncludeStartingFrom bool                   `protobuf:"varint,6,opt,name=include_starting_from,json=includeStartingFrom,proto3" json:"include_starting_from,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *SearchChatsRequest) Reset() {
+	*x = SearchChatsRequest{}
+	mi := &file_chat_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchChatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchChatsRequest) ProtoMessage() {}
+
+func (x *SearchChatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchChatsRequest.ProtoReflect.Descriptor instead.
+func (*SearchChatsRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SearchChatsRequest) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SearchChatsRequest) GetReverse() bool {
+	if x != nil {
+		return x.Reverse
+	}
+	return false
+}
+
+func (x *SearchChatsRequest) GetPinned() bool {
+	if x != nil && x.Pinned != nil {
+		return *x.Pinned
+	}
+	return false
+}
+
+func (x *SearchChatsRequest) GetLastUpdateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastUpdateDateTime
+	}
+	return nil
+}
+
+func (x *SearchChatsRequest) GetId() int64 {
+	if x != nil && x.Id != nil {
+		return *x.Id
+	}
+	return 0
+}
+
+func (x *SearchChatsRequest) GetIncludeStartingFrom() bool {
+	if x != nil {
+		return x.IncludeStartingFrom
+	}
+	return false
+}
+
+type Chat struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Id                 int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title              string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Pinned             bool                   `protobuf:"varint,3,opt,name=pinned,proto3" json:"pinned,omitempty"`
+	UnreadMessages     int64                  `protobuf:"varint,4,opt,name=unread_messages,json=unreadMessages,proto3" json:"unread_messages,omitempty"`
+	LastMessageId      *int64                 `protobuf:"varint,5,opt,name=last_message_id,json=lastMessageId,proto3,oneof" json:"last_message_id,omitempty"`
+	LastMessageOwnerId *int64                 `protobuf:"varint,6,opt,name=last_message_owner_id,json=lastMessageOwnerId,proto3,oneof" json:"last_message_owner_id,omitempty"`
+	LastMessageContent *string                `protobuf:"bytes,7,opt,name=last_message_content,json=lastMessageContent,proto3,oneof" json:"last_message_content,omitempty"`
+	ParticipantsCount  int64                  `protobuf:"varint,8,opt,name=participants_count,json=participantsCount,proto3" json:"participants_count,omitempty"`
+	ParticipantIds     []int64                `protobuf:"varint,9,rep,packed,name=participant_ids,json=participantIds,proto3" json:"participant_ids,omitempty"`
+	Blog               bool                   `protobuf:"varint,10,opt,name=blog,proto3" json:"blog,omitempty"`
+	LastUpdateDateTime *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=last_update_date_time,json=lastUpdateDateTime,proto3,oneof" json:"last_update_date_time,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Chat) Reset() {
+	*x = Chat{}
+	mi := &file_chat_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chat) ProtoMessage() {}
+
+func (x *Chat) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chat.ProtoReflect.Descriptor instead.
+func (*Chat) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Chat) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Chat) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Chat) GetPinned() bool {
+	if x != nil {
+		return x.Pinned
+	}
+	return false
+}
+
+func (x *Chat) GetUnreadMessages() int64 {
+	if x != nil {
+		return x.UnreadMessages
+	}
+	return 0
+}
+
+func (x *Chat) GetLastMessageId() int64 {
+	if x != nil && x.LastMessageId != nil {
+		return *x.LastMessageId
+	}
+	return 0
+}
+
+func (x *Chat) GetLastMessageOwnerId() int64 {
+	if x != nil && x.LastMessageOwnerId != nil {
+		return *x.LastMessageOwnerId
+	}
+	return 0
+}
+
+func (x *Chat) GetLastMessageContent() string {
+	if x != nil && x.LastMessageContent != nil {
+		return *x.LastMessageContent
+	}
+	return ""
+}
+
+func (x *Chat) GetParticipantsCount() int64 {
+	if x != nil {
+		return x.ParticipantsCount
+	}
+	return 0
+}
+
+func (x *Chat) GetParticipantIds() []int64 {
+	if x != nil {
+		return x.ParticipantIds
+	}
+	return nil
+}
+
+func (x *Chat) GetBlog() bool {
+	if x != nil {
+		return x.Blog
+	}
+	return false
+}
+
+func (x *Chat) GetLastUpdateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastUpdateDateTime
+	}
+	return nil
+}
+
+type SearchChatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Chats         []*Chat                `protobuf:"bytes,1,rep,name=chats,proto3" json:"chats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchChatsResponse) Reset() {
+	*x = SearchChatsResponse{}
+	mi := &file_chat_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchChatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchChatsResponse) ProtoMessage() {}
+
+func (x *SearchChatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchChatsResponse.ProtoReflect.Descriptor instead.
+func (*SearchChatsResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SearchChatsResponse) GetChats() []*Chat {
+	if x != nil {
+		return x.Chats
+	}
+	return nil
+}
+
+type ChatEvent struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	ChatId int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	// name of the event, e.g. "messageCreated"
+	Type      string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// the event as JSON, the same as it is stored in Kafka
+	Data          []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatEvent) Reset() {
+	*x = ChatEvent{}
+	mi := &file_chat_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatEvent) ProtoMessage() {}
+
+func (x *ChatEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatEvent.ProtoReflect.Descriptor instead.
+func (*ChatEvent) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ChatEvent) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *ChatEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ChatEvent) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *ChatEvent) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ParticipantsRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ChatId         int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	ParticipantIds []int64                `protobuf:"varint,2,rep,packed,name=participant_ids,json=participantIds,proto3" json:"participant_ids,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ParticipantsRequest) Reset() {
+	*x = ParticipantsRequest{}
+	mi := &file_chat_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ParticipantsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ParticipantsRequest) ProtoMessage() {}
+
+func (x *ParticipantsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ParticipantsRequest.ProtoReflect.Descriptor instead.
+func (*ParticipantsRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ParticipantsRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *ParticipantsRequest) GetParticipantIds() []int64 {
+	if x != nil {
+		return x.ParticipantIds
+	}
+	return nil
+}
+
+type GetParticipantsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	ChatId int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	Page   int64                  `protobuf:"varint,2,opt,name=page,proto3" json:"page,omitempty"`
+	Size   int32                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	// true by default
+	Reverse       *bool `protobuf:"varint,4,opt,name=reverse,proto3,oneof" json:"reverse,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetParticipantsRequest) Reset() {
+	*x = GetParticipantsRequest{}
+	mi := &file_chat_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetParticipantsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetParticipantsRequest) ProtoMessage() {}
+
+func (x *GetParticipantsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetParticipantsRequest.ProtoReflect.Descriptor instead.
+func (*GetParticipantsRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetParticipantsRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *GetParticipantsRequest) GetPage() int64 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *GetParticipantsRequest) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *GetParticipantsRequest) GetReverse() bool {
+	if x != nil && x.Reverse != nil {
+		return *x.Reverse
+	}
+	return false
+}
+
+type GetParticipantsResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ParticipantIds []int64                `protobuf:"varint,1,rep,packed,name=participant_ids,json=participantIds,proto3" json:"participant_ids,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GetParticipantsResponse) Reset() {
+	*x = GetParticipantsResponse{}
+	mi := &file_chat_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetParticipantsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetParticipantsResponse) ProtoMessage() {}
+
+func (x *GetParticipantsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetParticipantsResponse.ProtoReflect.Descriptor instead.
+func (*GetParticipantsResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *GetParticipantsResponse) GetParticipantIds() []int64 {
+	if x != nil {
+		return x.ParticipantIds
+	}
+	return nil
+}
+
+type CreateMessageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChatId        int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateMessageRequest) Reset() {
+	*x = CreateMessageRequest{}
+	mi := &file_chat_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateMessageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateMessageRequest) ProtoMessage() {}
+
+func (x *CreateMessageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateMessageRequest.ProtoReflect.Descriptor instead.
+func (*CreateMessageRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *CreateMessageRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *CreateMessageRequest) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type EditMessageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChatId        int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	MessageId     int64                  `protobuf:"varint,2,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Content       string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EditMessageRequest) Reset() {
+	*x = EditMessageRequest{}
+	mi := &file_chat_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EditMessageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EditMessageRequest) ProtoMessage() {}
+
+func (x *EditMessageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EditMessageRequest.ProtoReflect.Descriptor instead.
+func (*EditMessageRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *EditMessageRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *EditMessageRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *EditMessageRequest) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type SearchMessagesRequest struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	ChatId              int64                  `protobuf:"varint,1,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	Size                int32                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Reverse             bool                   `protobuf:"varint,3,opt,name=reverse,proto3" json:"reverse,omitempty"`
+	StartingFromItemId  *int64                 `protobuf:"varint,4,opt,name=starting_from_item_id,json=startingFromItemId,proto3,oneof" json:"starting_from_item_id,omitempty"`
+	IncludeStartingFrom bool                   `protobuf:"varint,5,opt,name=include_starting_from,json=includeStartingFrom,proto3" json:"include_starting_from,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *SearchMessagesRequest) Reset() {
+	*x = SearchMessagesRequest{}
+	mi := &file_chat_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchMessagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchMessagesRequest) ProtoMessage() {}
+
+func (x *SearchMessagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchMessagesRequest.ProtoReflect.Descriptor instead.
+func (*SearchMessagesRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *SearchMessagesRequest) GetChatId() int64 {
+	if x != nil {
+		return x.ChatId
+	}
+	return 0
+}
+
+func (x *SearchMessagesRequest) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SearchMessagesRequest) GetReverse() bool {
+	if x != nil {
+		return x.Reverse
+	}
+	return false
+}
+
+func (x *SearchMessagesRequest) GetStartingFromItemId() int64 {
+	if x != nil && x.StartingFromItemId != nil {
+		return *x.StartingFromItemId
+	}
+	return 0
+}
+
+func (x *SearchMessagesRequest) GetIncludeStartingFrom() bool {
+	if x != nil {
+		return x.IncludeStartingFrom
+	}
+	return false
+}
+
+type Message struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	OwnerId        int64                  `protobuf:"varint,2,opt,name=owner_id,json=ownerId,proto3" json:"owner_id,omitempty"`
+	Content        string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	BlogPost       bool                   `protobuf:"varint,4,opt,name=blog_post,json=blogPost,proto3" json:"blog_post,omitempty"`
+	CreateDateTime *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=create_date_time,json=createDateTime,proto3" json:"create_date_time,omitempty"`
+	UpdateDateTime *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=update_date_time,json=updateDateTime,proto3,oneof" json:"update_date_time,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_chat_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Message) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Message) GetOwnerId() int64 {
+	if x != nil {
+		return x.OwnerId
+	}
+	return 0
+}
+
+func (x *Message) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Message) GetBlogPost() bool {
+	if x != nil {
+		return x.BlogPost
+	}
+	return false
+}
+
+func (x *Message) GetCreateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateDateTime
+	}
+	return nil
+}
+
+func (x *Message) GetUpdateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdateDateTime
+	}
+	return nil
+}
+
+type SearchMessagesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*Message             `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchMessagesResponse) Reset() {
+	*x = SearchMessagesResponse{}
+	mi := &file_chat_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchMessagesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchMessagesResponse) ProtoMessage() {}
+
+func (x *SearchMessagesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchMessagesResponse.ProtoReflect.Descriptor instead.
+func (*SearchMessagesResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SearchMessagesResponse) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+type SearchBlogsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Page  int64                  `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	Size  int32                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	// true by default
+	Reverse       *bool `protobuf:"varint,3,opt,name=reverse,proto3,oneof" json:"reverse,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchBlogsRequest) Reset() {
+	*x = SearchBlogsRequest{}
+	mi := &file_chat_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchBlogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchBlogsRequest) ProtoMessage() {}
+
+func (x *SearchBlogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchBlogsRequest.ProtoReflect.Descriptor instead.
+func (*SearchBlogsRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *SearchBlogsRequest) GetPage() int64 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *SearchBlogsRequest) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SearchBlogsRequest) GetReverse() bool {
+	if x != nil && x.Reverse != nil {
+		return *x.Reverse
+	}
+	return false
+}
+
+type BlogPreview struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	OwnerId        *int64                 `protobuf:"varint,2,opt,name=owner_id,json=ownerId,proto3,oneof" json:"owner_id,omitempty"`
+	Title          string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Preview        *string                `protobuf:"bytes,4,opt,name=preview,proto3,oneof" json:"preview,omitempty"`
+	CreateDateTime *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=create_date_time,json=createDateTime,proto3" json:"create_date_time,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *BlogPreview) Reset() {
+	*x = BlogPreview{}
+	mi := &file_chat_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlogPreview) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlogPreview) ProtoMessage() {}
+
+func (x *BlogPreview) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlogPreview.ProtoReflect.Descriptor instead.
+func (*BlogPreview) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *BlogPreview) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *BlogPreview) GetOwnerId() int64 {
+	if x != nil && x.OwnerId != nil {
+		return *x.OwnerId
+	}
+	return 0
+}
+
+func (x *BlogPreview) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *BlogPreview) GetPreview() string {
+	if x != nil && x.Preview != nil {
+		return *x.Preview
+	}
+	return ""
+}
+
+func (x *BlogPreview) GetCreateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateDateTime
+	}
+	return nil
+}
+
+type SearchBlogsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Blogs         []*BlogPreview         `protobuf:"bytes,1,rep,name=blogs,proto3" json:"blogs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchBlogsResponse) Reset() {
+	*x = SearchBlogsResponse{}
+	mi := &file_chat_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchBlogsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchBlogsResponse) ProtoMessage() {}
+
+func (x *SearchBlogsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchBlogsResponse.ProtoReflect.Descriptor instead.
+func (*SearchBlogsResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SearchBlogsResponse) GetBlogs() []*BlogPreview {
+	if x != nil {
+		return x.Blogs
+	}
+	return nil
+}
+
+type GetBlogRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BlogId        int64                  `protobuf:"varint,1,opt,name=blog_id,json=blogId,proto3" json:"blog_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBlogRequest) Reset() {
+	*x = GetBlogRequest{}
+	mi := &file_chat_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBlogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBlogRequest) ProtoMessage() {}
+
+func (x *GetBlogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBlogRequest.ProtoReflect.Descriptor instead.
+func (*GetBlogRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *GetBlogRequest) GetBlogId() int64 {
+	if x != nil {
+		return x.BlogId
+	}
+	return 0
+}
+
+type Blog struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	OwnerId        *int64                 `protobuf:"varint,2,opt,name=owner_id,json=ownerId,proto3,oneof" json:"owner_id,omitempty"`
+	Title          string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Post           *string                `protobuf:"bytes,4,opt,name=post,proto3,oneof" json:"post,omitempty"`
+	CreateDateTime *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=create_date_time,json=createDateTime,proto3" json:"create_date_time,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Blog) Reset() {
+	*x = Blog{}
+	mi := &file_chat_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Blog) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Blog) ProtoMessage() {}
+
+func (x *Blog) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Blog.ProtoReflect.Descriptor instead.
+func (*Blog) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *Blog) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Blog) GetOwnerId() int64 {
+	if x != nil && x.OwnerId != nil {
+		return *x.OwnerId
+	}
+	return 0
+}
+
+func (x *Blog) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Blog) GetPost() string {
+	if x != nil && x.Post != nil {
+		return *x.Post
+	}
+	return ""
+}
+
+func (x *Blog) GetCreateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateDateTime
+	}
+	return nil
+}
+
+type SearchCommentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BlogId        int64                  `protobuf:"varint,1,opt,name=blog_id,json=blogId,proto3" json:"blog_id,omitempty"`
+	Page          int64                  `protobuf:"varint,2,opt,name=page,proto3" json:"page,omitempty"`
+	Size          int32                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	Reverse       bool                   `protobuf:"varint,4,opt,name=reverse,proto3" json:"reverse,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchCommentsRequest) Reset() {
+	*x = SearchCommentsRequest{}
+	mi := &file_chat_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchCommentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchCommentsRequest) ProtoMessage() {}
+
+func (x *SearchCommentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchCommentsRequest.ProtoReflect.Descriptor instead.
+func (*SearchCommentsRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *SearchCommentsRequest) GetBlogId() int64 {
+	if x != nil {
+		return x.BlogId
+	}
+	return 0
+}
+
+func (x *SearchCommentsRequest) GetPage() int64 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *SearchCommentsRequest) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SearchCommentsRequest) GetReverse() bool {
+	if x != nil {
+		return x.Reverse
+	}
+	return false
+}
+
+type Comment struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	OwnerId        int64                  `protobuf:"varint,2,opt,name=owner_id,json=ownerId,proto3" json:"owner_id,omitempty"`
+	Content        string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	CreateDateTime *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=create_date_time,json=createDateTime,proto3" json:"create_date_time,omitempty"`
+	UpdateDateTime *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=update_date_time,json=updateDateTime,proto3,oneof" json:"update_date_time,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Comment) Reset() {
+	*x = Comment{}
+	mi := &file_chat_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Comment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Comment) ProtoMessage() {}
+
+func (x *Comment) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Comment.ProtoReflect.Descriptor instead.
+func (*Comment) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *Comment) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Comment) GetOwnerId() int64 {
+	if x != nil {
+		return x.OwnerId
+	}
+	return 0
+}
+
+func (x *Comment) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Comment) GetCreateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateDateTime
+	}
+	return nil
+}
+
+func (x *Comment) GetUpdateDateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdateDateTime
+	}
+	return nil
+}
+
+type SearchCommentsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Comments      []*Comment             `protobuf:"bytes,1,rep,name=comments,proto3" json:"comments,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchCommentsResponse) Reset() {
+	*x = SearchCommentsResponse{}
+	mi := &file_chat_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchCommentsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchCommentsResponse) ProtoMessage() {}
+
+func (x *SearchCommentsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchCommentsResponse.ProtoReflect.Descriptor instead.
+func (*SearchCommentsResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *SearchCommentsResponse) GetComments() []*Comment {
+	if x != nil {
+		return x.Comments
+	}
+	return nil
+}
+
+var File_chat_proto protoreflect.FileDescriptor
+
+const file_chat_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"chat.proto\x12\x04chat\x1a\x1fgoogle/protobuf/timestamp.proto\"\a\n" +
+	"\x05Empty\"\x1c\n" +
+	"\n" +
+	"IdResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"(\n" +
+	"\rChatIdRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\"J\n" +
+	"\x10MessageIdRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x02 \x01(\x03R\tmessageId\"R\n" +
+	"\x11CreateChatRequest\x12\x14\n" +
+	"\x05title\x18\x01 \x01(\tR\x05title\x12'\n" +
+	"\x0fparticipant_ids\x18\x02 \x03(\x03R\x0eparticipantIds\"}\n" +
+	"\x0fEditChatRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12'\n" +
+	"\x0fparticipant_ids\x18\x03 \x03(\x03R\x0eparticipantIds\x12\x12\n" +
+	"\x04blog\x18\x04 \x01(\bR\x04blog\";\n" +
+	"\x0ePinChatRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x10\n" +
+	"\x03pin\x18\x02 \x01(\bR\x03pin\"\xa8\x02\n" +
+	"\x12SearchChatsRequest\x12\x12\n" +
+	"\x04size\x18\x01 \x01(\x05R\x04size\x12\x18\n" +
+	"\areverse\x18\x02 \x01(\bR\areverse\x12\x1b\n" +
+	"\x06pinned\x18\x03 \x01(\bH\x00R\x06pinned\x88\x01\x01\x12R\n" +
+	"\x15last_update_date_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampH\x01R\x12lastUpdateDateTime\x88\x01\x01\x12\x13\n" +
+	"\x02id\x18\x05 \x01(\x03H\x02R\x02id\x88\x01\x01\x122\n" +
+	"\x15include_starting_from\x18\x06 \x01(\bR\x13includeStartingFromB\t\n" +
+	"\a_pinnedB\x18\n" +
+	"\x16_last_update_date_timeB\x05\n" +
+	"\x03_id\"\xaa\x04\n" +
+	"\x04Chat\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x16\n" +
+	"\x06pinned\x18\x03 \x01(\bR\x06pinned\x12'\n" +
+	"\x0funread_messages\x18\x04 \x01(\x03R\x0eunreadMessages\x12+\n" +
+	"\x0flast_message_id\x18\x05 \x01(\x03H\x00R\rlastMessageId\x88\x01\x01\x126\n" +
+	"\x15last_message_owner_id\x18\x06 \x01(\x03H\x01R\x12lastMessageOwnerId\x88\x01\x01\x125\n" +
+	"\x14last_message_content\x18\a \x01(\tH\x02R\x12lastMessageContent\x88\x01\x01\x12-\n" +
+	"\x12participants_count\x18\b \x01(\x03R\x11participantsCount\x12'\n" +
+	"\x0fparticipant_ids\x18\t \x03(\x03R\x0eparticipantIds\x12\x12\n" +
+	"\x04blog\x18\n" +
+	" \x01(\bR\x04blog\x12R\n" +
+	"\x15last_update_date_time\x18\v \x01(\v2\x1a.google.protobuf.TimestampH\x03R\x12lastUpdateDateTime\x88\x01\x01B\x12\n" +
+	"\x10_last_message_idB\x18\n" +
+	"\x16_last_message_owner_idB\x17\n" +
+	"\x15_last_message_contentB\x18\n" +
+	"\x16_last_update_date_time\"7\n" +
+	"\x13SearchChatsResponse\x12 \n" +
+	"\x05chats\x18\x01 \x03(\v2\n" +
+	".chat.ChatR\x05chats\"\x87\x01\n" +
+	"\tChatEvent\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x129\n" +
+	"\n" +
+	"created_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\"W\n" +
+	"\x13ParticipantsRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12'\n" +
+	"\x0fparticipant_ids\x18\x02 \x03(\x03R\x0eparticipantIds\"\x84\x01\n" +
+	"\x16GetParticipantsRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x12\n" +
+	"\x04page\x18\x02 \x01(\x03R\x04page\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x05R\x04size\x12\x1d\n" +
+	"\areverse\x18\x04 \x01(\bH\x00R\areverse\x88\x01\x01B\n" +
+	"\n" +
+	"\b_reverse\"B\n" +
+	"\x17GetParticipantsResponse\x12'\n" +
+	"\x0fparticipant_ids\x18\x01 \x03(\x03R\x0eparticipantIds\"I\n" +
+	"\x14CreateMessageRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\"f\n" +
+	"\x12EditMessageRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x02 \x01(\x03R\tmessageId\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\"\xe4\x01\n" +
+	"\x15SearchMessagesRequest\x12\x17\n" +
+	"\achat_id\x18\x01 \x01(\x03R\x06chatId\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x05R\x04size\x12\x18\n" +
+	"\areverse\x18\x03 \x01(\bR\areverse\x126\n" +
+	"\x15starting_from_item_id\x18\x04 \x01(\x03H\x00R\x12startingFromItemId\x88\x01\x01\x122\n" +
+	"\x15include_starting_from\x18\x05 \x01(\bR\x13includeStartingFromB\x18\n" +
+	"\x16_starting_from_item_id\"\x91\x02\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x19\n" +
+	"\bowner_id\x18\x02 \x01(\x03R\aownerId\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12\x1b\n" +
+	"\tblog_post\x18\x04 \x01(\bR\bblogPost\x12D\n" +
+	"\x10create_date_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x0ecreateDateTime\x12I\n" +
+	"\x10update_date_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampH\x00R\x0eupdateDateTime\x88\x01\x01B\x13\n" +
+	"\x11_update_date_time\"C\n" +
+	"\x16SearchMessagesResponse\x12)\n" +
+	"\bmessages\x18\x01 \x03(\v2\r.chat.MessageR\bmessages\"g\n" +
+	"\x12SearchBlogsRequest\x12\x12\n" +
+	"\x04page\x18\x01 \x01(\x03R\x04page\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x05R\x04size\x12\x1d\n" +
+	"\areverse\x18\x03 \x01(\bH\x00R\areverse\x88\x01\x01B\n" +
+	"\n" +
+	"\b_reverse\"\xd1\x01\n" +
+	"\vBlogPreview\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1e\n" +
+	"\bowner_id\x18\x02 \x01(\x03H\x00R\aownerId\x88\x01\x01\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x1d\n" +
+	"\apreview\x18\x04 \x01(\tH\x01R\apreview\x88\x01\x01\x12D\n" +
+	"\x10create_date_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x0ecreateDateTimeB\v\n" +
+	"\t_owner_idB\n" +
+	"\n" +
+	"\b_preview\">\n" +
+	"\x13SearchBlogsResponse\x12'\n" +
+	"\x05blogs\x18\x01 \x03(\v2\x11.chat.BlogPreviewR\x05blogs\")\n" +
+	"\x0eGetBlogRequest\x12\x17\n" +
+	"\ablog_id\x18\x01 \x01(\x03R\x06blogId\"\xc1\x01\n" +
+	"\x04Blog\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1e\n" +
+	"\bowner_id\x18\x02 \x01(\x03H\x00R\aownerId\x88\x01\x01\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x17\n" +
+	"\x04post\x18\x04 \x01(\tH\x01R\x04post\x88\x01\x01\x12D\n" +
+	"\x10create_date_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x0ecreateDateTimeB\v\n" +
+	"\t_owner_idB\a\n" +
+	"\x05_post\"r\n" +
+	"\x15SearchCommentsRequest\x12\x17\n" +
+	"\ablog_id\x18\x01 \x01(\x03R\x06blogId\x12\x12\n" +
+	"\x04page\x18\x02 \x01(\x03R\x04page\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x05R\x04size\x12\x18\n" +
+	"\areverse\x18\x04 \x01(\bR\areverse\"\xf4\x01\n" +
+	"\aComment\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x19\n" +
+	"\bowner_id\x18\x02 \x01(\x03R\aownerId\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12D\n" +
+	"\x10create_date_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x0ecreateDateTime\x12I\n" +
+	"\x10update_date_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampH\x00R\x0eupdateDateTime\x88\x01\x01B\x13\n" +
+	"\x11_update_date_time\"C\n" +
+	"\x16SearchCommentsResponse\x12)\n" +
+	"\bcomments\x18\x01 \x03(\v2\r.chat.CommentR\bcomments2\xd7\x02\n" +
+	"\vChatService\x127\n" +
+	"\n" +
+	"CreateChat\x12\x17.chat.CreateChatRequest\x1a\x10.chat.IdResponse\x12.\n" +
+	"\bEditChat\x12\x15.chat.EditChatRequest\x1a\v.chat.Empty\x12.\n" +
+	"\n" +
+	"DeleteChat\x12\x13.chat.ChatIdRequest\x1a\v.chat.Empty\x12,\n" +
+	"\aPinChat\x12\x14.chat.PinChatRequest\x1a\v.chat.Empty\x12B\n" +
+	"\vSearchChats\x12\x18.chat.SearchChatsRequest\x1a\x19.chat.SearchChatsResponse\x12=\n" +
+	"\x13SubscribeChatEvents\x12\x13.chat.ChatIdRequest\x1a\x0f.chat.ChatEvent0\x012\xdd\x01\n" +
+	"\x12ParticipantService\x129\n" +
+	"\x0fAddParticipants\x12\x19.chat.ParticipantsRequest\x1a\v.chat.Empty\x12<\n" +
+	"\x12DeleteParticipants\x12\x19.chat.ParticipantsRequest\x1a\v.chat.Empty\x12N\n" +
+	"\x0fGetParticipants\x12\x1c.chat.GetParticipantsRequest\x1a\x1d.chat.GetParticipantsResponse2\xf1\x02\n" +
+	"\x0eMessageService\x12=\n" +
+	"\rCreateMessage\x12\x1a.chat.CreateMessageRequest\x1a\x10.chat.IdResponse\x124\n" +
+	"\vEditMessage\x12\x18.chat.EditMessageRequest\x1a\v.chat.Empty\x124\n" +
+	"\rDeleteMessage\x12\x16.chat.MessageIdRequest\x1a\v.chat.Empty\x122\n" +
+	"\vReadMessage\x12\x16.chat.MessageIdRequest\x1a\v.chat.Empty\x123\n" +
+	"\fMakeBlogPost\x12\x16.chat.MessageIdRequest\x1a\v.chat.Empty\x12K\n" +
+	"\x0eSearchMessages\x12\x1b.chat.SearchMessagesRequest\x1a\x1c.chat.SearchMessagesResponse2\xcb\x01\n" +
+	"\vBlogService\x12B\n" +
+	"\vSearchBlogs\x12\x18.chat.SearchBlogsRequest\x1a\x19.chat.SearchBlogsResponse\x12+\n" +
+	"\aGetBlog\x12\x14.chat.GetBlogRequest\x1a\n" +
+	".chat.Blog\x12K\n" +
+	"\x0eSearchComments\x12\x1b.chat.SearchCommentsRequest\x1a\x1c.chat.SearchCommentsResponseB\x1eZ\x1cgo-cqrs-chat-example/rpc;rpcb\x06proto3"
+
+var (
+	file_chat_proto_rawDescOnce sync.Once
+	file_chat_proto_rawDescData []byte
+)
+
+func file_chat_proto_rawDescGZIP() []byte {
+	file_chat_proto_rawDescOnce.Do(func() {
+		file_chat_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_chat_proto_rawDesc), len(file_chat_proto_rawDesc)))
+	})
+	return file_chat_proto_rawDescData
+}
+
+var file_chat_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
+var file_chat_proto_goTypes = []any{
+	(*Empty)(nil),                   // 0: chat.Empty
+	(*IdResponse)(nil),              // 1: chat.IdResponse
+	(*ChatIdRequest)(nil),           // 2: chat.ChatIdRequest
+	(*MessageIdRequest)(nil),        // 3: chat.MessageIdRequest
+	(*CreateChatRequest)(nil),       // 4: chat.CreateChatRequest
+	(*EditChatRequest)(nil),         // 5: chat.EditChatRequest
+	(*PinChatRequest)(nil),          // 6: chat.PinChatRequest
+	(*SearchChatsRequest)(nil),      // 7: chat.SearchChatsRequest
+	(*Chat)(nil),                    // 8: chat.Chat
+	(*SearchChatsResponse)(nil),     // 9: chat.SearchChatsResponse
+	(*ChatEvent)(nil),               // 10: chat.ChatEvent
+	(*ParticipantsRequest)(nil),     // 11: chat.ParticipantsRequest
+	(*GetParticipantsRequest)(nil),  // 12: chat.GetParticipantsRequest
+	(*GetParticipantsResponse)(nil), // 13: chat.GetParticipantsResponse
+	(*CreateMessageRequest)(nil),    // 14: chat.CreateMessageRequest
+	(*EditMessageRequest)(nil),      // 15: chat.EditMessageRequest
+	(*SearchMessagesRequest)(nil),   // 16: chat.SearchMessagesRequest
+	(*Message)(nil),                 // 17: chat.Message
+	(*SearchMessagesResponse)(nil),  // 18: chat.SearchMessagesResponse
+	(*SearchBlogsRequest)(nil),      // 19: chat.SearchBlogsRequest
+	(*BlogPreview)(nil),             // 20: chat.BlogPreview
+	(*SearchBlogsResponse)(nil),     // 21: chat.SearchBlogsResponse
+	(*GetBlogRequest)(nil),          // 22: chat.GetBlogRequest
+	(*Blog)(nil),                    // 23: chat.Blog
+	(*SearchCommentsRequest)(nil),   // 24: chat.SearchCommentsRequest
+	(*Comment)(nil),                 // 25: chat.Comment
+	(*SearchCommentsResponse)(nil),  // 26: chat.SearchCommentsResponse
+	(*timestamppb.Timestamp)(nil),   // 27: google.protobuf.Timestamp
+}
+var file_chat_proto_depIdxs = []int32{
+	27, // 0: chat.SearchChatsRequest.last_update_date_time:type_name -> google.protobuf.Timestamp
+	27, // 1: chat.Chat.last_update_date_time:type_name -> google.protobuf.Timestamp
+	8,  // 2: chat.SearchChatsResponse.chats:type_name -> chat.Chat
+	27, // 3: chat.ChatEvent.created_at:type_name -> google.protobuf.Timestamp
+	27, // 4: chat.Message.create_date_time:type_name -> google.protobuf.Timestamp
+	27, // 5: chat.Message.update_date_time:type_name -> google.protobuf.Timestamp
+	17, // 6: chat.SearchMessagesResponse.messages:type_name -> chat.Message
+	27, // 7: chat.BlogPreview.create_date_time:type_name -> google.protobuf.Timestamp
+	20, // 8: chat.SearchBlogsResponse.blogs:type_name -> chat.BlogPreview
+	27, // 9: chat.Blog.create_date_time:type_name -> google.protobuf.Timestamp
+	27, // 10: chat.Comment.create_date_time:type_name -> google.protobuf.Timestamp
+	27, // 11: chat.Comment.update_date_time:type_name -> google.protobuf.Timestamp
+	25, // 12: chat.SearchCommentsResponse.comments:type_name -> chat.Comment
+	4,  // 13: chat.ChatService.CreateChat:input_type -> chat.CreateChatRequest
+	5,  // 14: chat.ChatService.EditChat:input_type -> chat.EditChatRequest
+	2,  // 15: chat.ChatService.DeleteChat:input_type -> chat.ChatIdRequest
+	6,  // 16: chat.ChatService.PinChat:input_type -> chat.PinChatRequest
+	7,  // 17: chat.ChatService.SearchChats:input_type -> chat.SearchChatsRequest
+	2,  // 18: chat.ChatService.SubscribeChatEvents:input_type -> chat.ChatIdRequest
+	11, // 19: chat.ParticipantService.AddParticipants:input_type -> chat.ParticipantsRequest
+	11, // 20: chat.ParticipantService.DeleteParticipants:input_type -> chat.ParticipantsRequest
+	12, // 21: chat.ParticipantService.GetParticipants:input_type -> chat.GetParticipantsRequest
+	14, // 22: chat.MessageService.CreateMessage:input_type -> chat.CreateMessageRequest
+	15, // 23: chat.MessageService.EditMessage:input_type -> chat.EditMessageRequest
+	3,  // 24: chat.MessageService.DeleteMessage:input_type -> chat.MessageIdRequest
+	3,  // 25: chat.MessageService.ReadMessage:input_type -> chat.MessageIdRequest
+	3,  // 26: chat.MessageService.MakeBlogPost:input_type -> chat.MessageIdRequest
+	16, // 27: chat.MessageService.SearchMessages:input_type -> chat.SearchMessagesRequest
+	19, // 28: chat.BlogService.SearchBlogs:input_type -> chat.SearchBlogsRequest
+	22, // 29: chat.BlogService.GetBlog:input_type -> chat.GetBlogRequest
+	24, // 30: chat.BlogService.SearchComments:input_type -> chat.SearchCommentsRequest
+	1,  // 31: chat.ChatService.CreateChat:output_type -> chat.IdResponse
+	0,  // 32: chat.ChatService.EditChat:output_type -> chat.Empty
+	0,  // 33: chat.ChatService.DeleteChat:output_type -> chat.Empty
+	0,  // 34: chat.ChatService.PinChat:output_type -> chat.Empty
+	9,  // 35: chat.ChatService.SearchChats:output_type -> chat.SearchChatsResponse
+	10, // 36: chat.ChatService.SubscribeChatEvents:output_type -> chat.ChatEvent
+	0,  // 37: chat.ParticipantService.AddParticipants:output_type -> chat.Empty
+	0,  // 38: chat.ParticipantService.DeleteParticipants:output_type -> chat.Empty
+	13, // 39: chat.ParticipantService.GetParticipants:output_type -> chat.GetParticipantsResponse
+	1,  // 40: chat.MessageService.CreateMessage:output_type -> chat.IdResponse
+	0,  // 41: chat.MessageService.EditMessage:output_type -> chat.Empty
+	0,  // 42: chat.MessageService.DeleteMessage:output_type -> chat.Empty
+	0,  // 43: chat.MessageService.ReadMessage:output_type -> chat.Empty
+	0,  // 44: chat.MessageService.MakeBlogPost:output_type -> chat.Empty
+	18, // 45: chat.MessageService.SearchMessages:output_type -> chat.SearchMessagesResponse
+	21, // 46: chat.BlogService.SearchBlogs:output_type -> chat.SearchBlogsResponse
+	23, // 47: chat.BlogService.GetBlog:output_type -> chat.Blog
+	26, // 48: chat.BlogService.SearchComments:output_type -> chat.SearchCommentsResponse
+	31, // [31:49] is the sub-list for method output_type
+	13, // [13:31] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_chat_proto_init() }
+func file_chat_proto_init() {
+	if File_chat_proto != nil {
+		return
+	}
+	file_chat_proto_msgTypes[7].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[8].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[12].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[16].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[17].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[19].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[20].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[23].OneofWrappers = []any{}
+	file_chat_proto_msgTypes[25].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_chat_proto_rawDesc), len(file_chat_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   27,
+			NumExtensions: 0,
+			NumServices:   4,
+		},
+		GoTypes:           file_chat_proto_goTypes,
+		DependencyIndexes: file_chat_proto_depIdxs,
+		MessageInfos:      file_chat_proto_msgTypes,
+	}.Build()
+	File_chat_proto = out.File
+	file_chat_proto_goTypes = nil
+	file_chat_proto_depIdxs = nil
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/logger"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sync"
+)
+
+// ChatEventsBroadcaster reads all the partitions of the topic starting from the newest offsets
+// and fans the events out to the SubscribeChatEvents streams of this instance.
+// It doesn't use a consumer group, because every instance needs all the events.
+type ChatEventsBroadcaster struct {
+	lgr            *logger.LoggerWrapper
+	cfg            *config.AppConfig
+	kafkaMarshaler kafka.MarshalerUnmarshaler
+	cqrsMarshaler  *cqrs.CqrsMarshalerDecorator
+	propagator     propagation.TextMapPropagator
+	tracer         trace.Tracer
+
+	mu          sync.RWMutex
+	subscribers map[int64]map[chan *ChatEvent]struct{}
+}
+
+type chatIdHolder struct {
+	ChatId int64 `json:"chatId"`
+}
+
+func ConfigureChatEventsBroadcaster(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	saramaClient sarama.Client,
+	kafkaMarshaler kafka.MarshalerUnmarshaler,
+	cqrsMarshaler *cqrs.CqrsMarshalerDecorator,
+	propagator propagation.TextMapPropagator,
+	tp *sdktrace.TracerProvider,
+	lc fx.Lifecycle,
+) (*ChatEventsBroadcaster, error) {
+	b := &ChatEventsBroadcaster{
+		lgr:            lgr,
+		cfg:            cfg,
+		kafkaMarshaler: kafkaMarshaler,
+		cqrsMarshaler:  cqrsMarshaler,
+		propagator:     propagator,
+		tracer:         tp.Tracer("chat-events-broadcaster"),
+		subscribers:    map[int64]map[chan *ChatEvent]struct{}{},
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(saramaClient)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			for partition := range cfg.KafkaConfig.NumPartitions {
+				pc, err := consumer.ConsumePartition(cfg.KafkaConfig.Topic, partition, sarama.OffsetNewest)
+				if err != nil {
+					return err
+				}
+				go func() {
+					for kafkaMsg := range pc.Messages() {
+						b.broadcast(kafkaMsg)
+					}
+				}()
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			lgr.Info("Stopping chat events broadcaster")
+			if err := consumer.Close(); err != nil {
+				lgr.Error("Error shutting down chat events consumer", "err", err)
+			}
+			return nil
+		},
+	})
+
+	return b, nil
+}
+
+func (b *ChatEventsBroadcaster) broadcast(kafkaMsg *sarama.ConsumerMessage) {
+	msg, err := b.kafkaMarshaler.Unmarshal(kafkaMsg)
+	if err != nil {
+		b.lgr.Error("Unable to unmarshal kafka message", "err", err)
+		return
+	}
+
+	// continue the trace of the publisher
+	ctx := b.propagator.Extract(context.Background(), propagation.MapCarrier(msg.Metadata))
+	ctx, span := b.tracer.Start(ctx, "chat events broadcast")
+	defer span.End()
+
+	var holder chatIdHolder
+	err = json.Unmarshal(msg.Payload, &holder)
+	if err != nil {
+		b.lgr.WithTrace(ctx).Error("Unable to get chatId from the event", "err", err)
+		return
+	}
+
+	event := &ChatEvent{
+		ChatId:    holder.ChatId,
+		Type:      b.cqrsMarshaler.NameFromMessage(msg),
+		CreatedAt: timestamppb.New(kafkaMsg.Timestamp),
+		Data:      msg.Payload,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers[holder.ChatId] {
+		select {
+		case ch <- event:
+		default:
+			b.lgr.WithTrace(ctx).Warn("Subscriber is too slow, dropping the event", "chat_id", holder.ChatId, "type", event.Type)
+		}
+	}
+}
+
+func (b *ChatEventsBroadcaster) subscribe(chatId int64) (chan *ChatEvent, func()) {
+	ch := make(chan *ChatEvent, b.cfg.GrpcServerConfig.SubscriberBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[chatId] == nil {
+		b.subscribers[chatId] = map[chan *ChatEvent]struct{}{}
+	}
+	b.subscribers[chatId][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[chatId], ch)
+		if len(b.subscribers[chatId]) == 0 {
+			delete(b.subscribers, chatId)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"context"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/ratelimit"
+	"go-cqrs-chat-example/utils"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type MessageService struct {
+	UnimplementedMessageServiceServer
+	lgr              *logger.LoggerWrapper
+	eventBus         *cqrs.PartitionAwareEventBus
+	dbWrapper        *db.DB
+	commonProjection *cqrs.CommonProjection
+	chatRepository   *cqrs.ChatRepository
+	rateLimiter      *ratelimit.RateLimiter
+	idGenerator      cqrs.IdGenerator
+}
+
+func NewMessageService(
+	lgr *logger.LoggerWrapper,
+	eventBus *cqrs.PartitionAwareEventBus,
+	dbWrapper *db.DB,
+	commonProjection *cqrs.CommonProjection,
+	chatRepository *cqrs.ChatRepository,
+	rateLimiter *ratelimit.RateLimiter,
+	idGenerator cqrs.IdGenerator,
+) *MessageService {
+	return &MessageService{
+		lgr:              lgr,
+		eventBus:         eventBus,
+		dbWrapper:        dbWrapper,
+		commonProjection: commonProjection,
+		chatRepository:   chatRepository,
+		rateLimiter:      rateLimiter,
+		idGenerator:      idGenerator,
+	}
+}
+
+func (ms *MessageService) CreateMessage(ctx context.Context, req *CreateMessageRequest) (*IdResponse, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slowModeSeconds, err := ms.commonProjection.GetChatSlowModeSeconds(ctx, req.GetChatId())
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error getting slow mode", err)
+	}
+	if slowModeSeconds > 0 {
+		allowed, retryAfter := ms.rateLimiter.AllowSlowMode(req.GetChatId(), userId, slowModeSeconds)
+		if !allowed {
+			ms.lgr.WithTrace(ctx).Info("Slow mode is active", "chat_id", req.GetChatId(), "user_id", userId, "retry_after", retryAfter)
+			return nil, resourceExhausted(ctx, retryAfter, "slow mode is active, retry after %v", retryAfter)
+		}
+	}
+
+	cc := cqrs.MessageCreate{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ChatId:         req.GetChatId(),
+		Content:        req.GetContent(),
+		OwnerId:        userId,
+	}
+
+	mid, err := cc.Handle(ctx, ms.eventBus, ms.chatRepository, ms.commonProjection, ms.idGenerator)
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error sending MessageCreate command", err)
+	}
+
+	return &IdResponse{Id: mid}, nil
+}
+
+func (ms *MessageService) EditMessage(ctx context.Context, req *EditMessageRequest) (*Empty, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedVersion, err := getIfMatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := cqrs.MessageEdit{
+		AdditionalData:  cqrs.GenerateMessageAdditionalData(ctx),
+		MessageId:       req.GetMessageId(),
+		ChatId:          req.GetChatId(),
+		Content:         req.GetContent(),
+		ExpectedVersion: expectedVersion,
+	}
+
+	version, err := cc.Handle(ctx, ms.eventBus, ms.chatRepository, ms.commonProjection, userId)
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error sending MessageEdit command", err)
+	}
+
+	return &Empty{}, setETag(ctx, version)
+}
+
+func (ms *MessageService) DeleteMessage(ctx context.Context, req *MessageIdRequest) (*Empty, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := cqrs.MessageDelete{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		MessageId:      req.GetMessageId(),
+		ChatId:         req.GetChatId(),
+	}
+
+	err = cc.Handle(ctx, ms.eventBus, ms.chatRepository, ms.commonProjection, userId)
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error sending MessageDelete command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (ms *MessageService) ReadMessage(ctx context.Context, req *MessageIdRequest) (*Empty, error) {
+	userId, err := getUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mr := cqrs.MessageRead{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ChatId:         req.GetChatId(),
+		MessageId:      req.GetMessageId(),
+		ParticipantId:  userId,
+	}
+
+	err = mr.Handle(ctx, ms.eventBus, ms.chatRepository, ms.commonProjection)
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error sending MessageRead command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (ms *MessageService) MakeBlogPost(ctx context.Context, req *MessageIdRequest) (*Empty, error) {
+	mr := cqrs.MakeMessageBlogPost{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ChatId:         req.GetChatId(),
+		MessageId:      req.GetMessageId(),
+		BlogPost:       true,
+	}
+
+	err := mr.Handle(ctx, ms.eventBus, ms.chatRepository)
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error sending MakeMessageBlogPost command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (ms *MessageService) SearchMessages(ctx context.Context, req *SearchMessagesRequest) (*SearchMessagesResponse, error) {
+	size := utils.FixSize(req.GetSize())
+
+	messages, err := ms.commonProjection.GetMessages(ctx, req.GetChatId(), size, req.StartingFromItemId, req.GetIncludeStartingFrom(), req.GetReverse())
+	if err != nil {
+		return nil, statusError(ctx, ms.lgr, "Error getting messages", err)
+	}
+
+	resp := &SearchMessagesResponse{Messages: make([]*Message, 0, len(messages))}
+	for _, m := range messages {
+		resp.Messages = append(resp.Messages, &Message{
+			Id:             m.Id,
+			OwnerId:        m.OwnerId,
+			Content:        m.Content,
+			BlogPost:       m.BlogPost,
+			CreateDateTime: timestamppb.New(m.CreateDateTime),
+			UpdateDateTime: timestampOrNil(m.UpdateDateTime),
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"context"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/db"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/utils"
+)
+
+type ParticipantService struct {
+	UnimplementedParticipantServiceServer
+	lgr              *logger.LoggerWrapper
+	eventBus         *cqrs.PartitionAwareEventBus
+	dbWrapper        *db.DB
+	commonProjection *cqrs.CommonProjection
+	chatRepository   *cqrs.ChatRepository
+}
+
+func NewParticipantService(
+	lgr *logger.LoggerWrapper,
+	eventBus *cqrs.PartitionAwareEventBus,
+	dbWrapper *db.DB,
+	commonProjection *cqrs.CommonProjection,
+	chatRepository *cqrs.ChatRepository,
+) *ParticipantService {
+	return &ParticipantService{
+		lgr:              lgr,
+		eventBus:         eventBus,
+		dbWrapper:        dbWrapper,
+		commonProjection: commonProjection,
+		chatRepository:   chatRepository,
+	}
+}
+
+func (ps *ParticipantService) AddParticipants(ctx context.Context, req *ParticipantsRequest) (*Empty, error) {
+	cc := cqrs.ParticipantAdd{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ParticipantIds: req.GetParticipantIds(),
+		ChatId:         req.GetChatId(),
+	}
+
+	err := cc.Handle(ctx, ps.eventBus, ps.chatRepository, ps.commonProjection)
+	if err != nil {
+		return nil, statusError(ctx, ps.lgr, "Error sending ParticipantAdd command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (ps *ParticipantService) DeleteParticipants(ctx context.Context, req *ParticipantsRequest) (*Empty, error) {
+	cc := cqrs.ParticipantDelete{
+		AdditionalData: cqrs.GenerateMessageAdditionalData(ctx),
+		ParticipantIds: req.GetParticipantIds(),
+		ChatId:         req.GetChatId(),
+	}
+
+	err := cc.Handle(ctx, ps.eventBus, ps.chatRepository, ps.commonProjection)
+	if err != nil {
+		return nil, statusError(ctx, ps.lgr, "Error sending ParticipantDelete command", err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (ps *ParticipantService) GetParticipants(ctx context.Context, req *GetParticipantsRequest) (*GetParticipantsResponse, error) {
+	page := utils.FixPage(req.GetPage())
+	size := utils.FixSize(req.GetSize())
+	offset := utils.GetOffset(page, size)
+	reverse := true
+	if req.Reverse != nil {
+		reverse = req.GetReverse()
+	}
+
+	participantIds, err := ps.commonProjection.GetParticipantIdsForExternal(ctx, req.GetChatId(), size, offset, reverse)
+	if err != nil {
+		return nil, statusError(ctx, ps.lgr, "Error getting participants", err)
+	}
+
+	return &GetParticipantsResponse{ParticipantIds: participantIds}, nil
+}
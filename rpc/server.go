@@ -0,0 +1,349 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"go-cqrs-chat-example/config"
+	"go-cqrs-chat-example/cqrs"
+	"go-cqrs-chat-example/idempotency"
+	"go-cqrs-chat-example/logger"
+	"go-cqrs-chat-example/ratelimit"
+	"go-cqrs-chat-example/utils"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/fx"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const UserIdMetadata = "x-userid"
+const IfMatchMetadata = "if-match"
+const ETagMetadata = "etag"
+const CorrelationIdMetadata = "x-correlation-id"
+const UserAgentMetadata = "user-agent"
+const IdempotencyKeyMetadata = "idempotency-key"
+const IdempotentReplayedMetadata = "idempotent-replayed"
+const RetryAfterMetadata = "retry-after"
+
+// commandMethods are limited by RateLimiter.AllowCommand and honour idempotency-key, as the commands of REST do
+var commandMethods = []string{
+	ChatService_CreateChat_FullMethodName,
+	ChatService_EditChat_FullMethodName,
+	ChatService_DeleteChat_FullMethodName,
+	ChatService_PinChat_FullMethodName,
+	ParticipantService_AddParticipants_FullMethodName,
+	ParticipantService_DeleteParticipants_FullMethodName,
+	MessageService_CreateMessage_FullMethodName,
+	MessageService_EditMessage_FullMethodName,
+	MessageService_DeleteMessage_FullMethodName,
+	MessageService_ReadMessage_FullMethodName,
+	MessageService_MakeBlogPost_FullMethodName,
+}
+
+type chatIdRequest interface {
+	GetChatId() int64
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func getUserId(ctx context.Context) (int64, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, status.Error(codes.Unauthenticated, "no metadata")
+	}
+	values := md.Get(UserIdMetadata)
+	if len(values) == 0 {
+		return 0, status.Error(codes.Unauthenticated, "no "+UserIdMetadata)
+	}
+	userId, err := utils.ParseInt64(values[0])
+	if err != nil {
+		return 0, status.Error(codes.Unauthenticated, "wrong "+UserIdMetadata)
+	}
+	return userId, nil
+}
+
+// getIfMatch returns the expected version of the chat or the message, as If-Match header does in REST
+func getIfMatch(ctx context.Context) (*int64, error) {
+	expectedVersion, err := cqrs.ParseIfMatch(firstMetadata(ctx, IfMatchMetadata))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return expectedVersion, nil
+}
+
+func setETag(ctx context.Context, version int64) error {
+	return grpc.SetHeader(ctx, metadata.Pairs(ETagMetadata, cqrs.FormatETag(version)))
+}
+
+// statusError maps the domain errors to the codes and shows their details to the client,
+// the rest of the errors are logged and hidden behind Internal, as the REST handlers do
+func statusError(ctx context.Context, lgr *logger.LoggerWrapper, msg string, err error) error {
+	var de *cqrs.DomainError
+	if !errors.As(err, &de) {
+		lgr.WithTrace(ctx).Error(msg, "err", err)
+		return status.Error(codes.Internal, msg)
+	}
+
+	lgr.WithTrace(ctx).Info(msg, "err", err)
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, cqrs.ErrValidation):
+		code = codes.InvalidArgument
+	case errors.Is(err, cqrs.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, cqrs.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, cqrs.ErrConflict):
+		code = codes.Aborted
+	case errors.Is(err, cqrs.ErrReadOnly):
+		code = codes.Unavailable
+	}
+	return status.Error(code, de.Detail)
+}
+
+// requestInfoInterceptor puts the data for the events' envelope into the context, as RequestInfoMiddleware does in REST
+func requestInfoInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	correlationId := firstMetadata(ctx, CorrelationIdMetadata)
+	if correlationId == "" {
+		correlationId = cqrs.NewCorrelationId(ctx)
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(CorrelationIdMetadata, correlationId))
+
+	actorId, _ := utils.ParseInt64(firstMetadata(ctx, UserIdMetadata))
+
+	clientInfo := &cqrs.ClientInfo{
+		UserAgent: firstMetadata(ctx, UserAgentMetadata),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		clientInfo.Ip = p.Addr.String()
+	}
+
+	requestInfo := &cqrs.RequestInfo{
+		ActorId:       actorId,
+		CorrelationId: correlationId,
+		ClientInfo:    clientInfo,
+	}
+	return handler(cqrs.MakeContextWithRequestInfo(ctx, requestInfo), req)
+}
+
+func resourceExhausted(ctx context.Context, retryAfter time.Duration, format string, args ...any) error {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RetryAfterMetadata, strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10)))
+	return status.Errorf(codes.ResourceExhausted, format, args...)
+}
+
+// rateLimitInterceptor applies the per-user and per-chat limits to the commands, as RateLimitMiddleware does in REST
+func rateLimitInterceptor(lgr *logger.LoggerWrapper, rl *ratelimit.RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !rl.Enabled() || !slices.Contains(commandMethods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		var userIdPtr *int64
+		if userId, err := getUserId(ctx); err == nil {
+			userIdPtr = &userId
+		}
+
+		var chatIdPtr *int64
+		if cr, ok := req.(chatIdRequest); ok && cr.GetChatId() != 0 {
+			chatId := cr.GetChatId()
+			chatIdPtr = &chatId
+		}
+
+		allowed, retryAfter := rl.AllowCommand(userIdPtr, chatIdPtr)
+		if !allowed {
+			lgr.WithTrace(ctx).Info("Rate limit is exceeded", "method", info.FullMethod, "retry_after", retryAfter)
+			return nil, resourceExhausted(ctx, retryAfter, "retry after %v", retryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// isRetryableCode tells whether the failed command is released for the retry, the rest of the outcomes are stored and replayed
+func isRetryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return true
+	}
+	return false
+}
+
+// idempotencyInterceptor stores the first outcome of a command with idempotency-key metadata and replays it for the duplicates,
+// as IdempotencyMiddleware does in REST. The response message is stored as Any, so it's replayed without knowing its type here
+func idempotencyInterceptor(lgr *logger.LoggerWrapper, store *idempotency.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		key := firstMetadata(ctx, IdempotencyKeyMetadata)
+		if key == "" || !slices.Contains(commandMethods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if len(key) > idempotency.MaxKeyLength {
+			return nil, status.Error(codes.InvalidArgument, "too long "+IdempotencyKeyMetadata)
+		}
+
+		requestBody, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+		if err != nil {
+			return nil, statusError(ctx, lgr, "Error marshalling request", err)
+		}
+
+		userId, _ := getUserId(ctx)
+		k := &idempotency.Key{
+			Key:    key,
+			UserId: userId,
+			Method: "grpc",
+			Path:   info.FullMethod,
+		}
+		requestHash := idempotency.HashRequest(k.Method, k.Path, "", firstMetadata(ctx, IfMatchMetadata), requestBody)
+
+		stored, err := store.Acquire(ctx, k, requestHash)
+		if errors.Is(err, idempotency.ErrKeyReused) {
+			lgr.WithTrace(ctx).Info("Idempotency key is reused with a different request", "user_id", userId, "method", k.Path)
+			return nil, status.Error(codes.InvalidArgument, IdempotencyKeyMetadata+" is reused with a different request")
+		} else if errors.Is(err, idempotency.ErrInProgress) {
+			lgr.WithTrace(ctx).Info("The request with the same idempotency key is still in progress", "user_id", userId, "method", k.Path)
+			return nil, status.Error(codes.Aborted, "the request with the same "+IdempotencyKeyMetadata+" is still in progress")
+		} else if err != nil {
+			return nil, statusError(ctx, lgr, "Error during acquiring idempotency key", err)
+		}
+		if stored != nil {
+			lgr.WithTrace(ctx).Info("Replaying the stored response", "user_id", userId, "method", k.Path, "code", codes.Code(stored.Status))
+			_ = grpc.SetHeader(ctx, metadata.Pairs(IdempotentReplayedMetadata, "true"))
+			return replayResponse(stored)
+		}
+
+		trackingCtx, committed := cqrs.WithCommitTracking(ctx)
+		resp, handlerErr := handler(trackingCtx, req)
+
+		// the request can already be cancelled by the client, but the outcome of the handler should be stored anyway
+		finishCtx := context.WithoutCancel(ctx)
+		code := status.Code(handlerErr)
+		if isRetryableCode(code) && !committed() {
+			err = store.Release(finishCtx, k)
+		} else {
+			var body []byte
+			body, err = marshalResponse(resp, handlerErr)
+			if err == nil {
+				err = store.Finish(finishCtx, k, &idempotency.Response{
+					RequestHash: requestHash,
+					Status:      int(code),
+					ContentType: "application/grpc+proto",
+					Body:        body,
+				})
+			}
+		}
+		if err != nil {
+			lgr.WithTrace(ctx).Error("Error during storing the response of idempotency key", "err", err)
+		}
+		return resp, handlerErr
+	}
+}
+
+func marshalResponse(resp any, handlerErr error) ([]byte, error) {
+	if handlerErr != nil {
+		return proto.Marshal(status.Convert(handlerErr).Proto())
+	}
+	a, err := anypb.New(resp.(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(a)
+}
+
+func replayResponse(stored *idempotency.Response) (any, error) {
+	if codes.Code(stored.Status) != codes.OK {
+		st := &spb.Status{}
+		err := proto.Unmarshal(stored.Body, st)
+		if err != nil {
+			return nil, err
+		}
+		return nil, status.FromProto(st).Err()
+	}
+	a := &anypb.Any{}
+	err := proto.Unmarshal(stored.Body, a)
+	if err != nil {
+		return nil, err
+	}
+	return a.UnmarshalNew()
+}
+
+func ConfigureGrpcServer(
+	lgr *logger.LoggerWrapper,
+	propagator propagation.TextMapPropagator,
+	tp *sdktrace.TracerProvider,
+	lc fx.Lifecycle,
+	chatService *ChatService,
+	participantService *ParticipantService,
+	messageService *MessageService,
+	blogService *BlogService,
+	rl *ratelimit.RateLimiter,
+	idempotencyStore *idempotency.Store,
+) *grpc.Server {
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithPropagators(propagator),
+			otelgrpc.WithTracerProvider(tp),
+		)),
+		grpc.ChainUnaryInterceptor(
+			requestInfoInterceptor,
+			rateLimitInterceptor(lgr, rl),
+			idempotencyInterceptor(lgr, idempotencyStore),
+		),
+	)
+
+	RegisterChatServiceServer(grpcServer, chatService)
+	RegisterParticipantServiceServer(grpcServer, participantService)
+	RegisterMessageServiceServer(grpcServer, messageService)
+	RegisterBlogServiceServer(grpcServer, blogService)
+	// lets grpcurl discover the services
+	reflection.Register(grpcServer)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			lgr.Info("Stopping grpc server")
+			// the streams are infinite, so we don't wait for them as GracefulStop() does
+			grpcServer.Stop()
+			return nil
+		},
+	})
+
+	return grpcServer
+}
+
+func RunGrpcServer(
+	lgr *logger.LoggerWrapper,
+	cfg *config.AppConfig,
+	grpcServer *grpc.Server,
+) error {
+	listener, err := net.Listen("tcp", cfg.GrpcServerConfig.Address)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := grpcServer.Serve(listener)
+		if errors.Is(err, grpc.ErrServerStopped) {
+			lgr.Info("Grpc server is closed")
+		} else if err != nil {
+			lgr.Error("Got grpc server error", "err", err)
+		}
+	}()
+	return nil
+}